@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// requireAdmin only lets requests through that carry the configured admin
+// token or the session cookie of a user logged in through OIDC. The admin
+// API is hidden entirely when neither is configured.
+func requireAdmin(c *fiber.Ctx) error {
+	if cfg().AdminToken == "" && !oidcEnabled() {
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+
+	if !isAdmin(c) {
+		return c.Status(401).JSON(fiber.Map{
+			"code":    401,
+			"message": "Invalid admin token",
+		})
+	}
+	return c.Next()
+}
+
+// isAdmin reports whether the request carries the configured admin token
+// or a session cookie, remembering the session's user for the audit log.
+func isAdmin(c *fiber.Ctx) bool {
+	token, ok := strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+	if ok && cfg().AdminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(cfg().AdminToken)) == 1 {
+		return true
+	}
+	if user, ok := currentSession(c); ok {
+		c.Locals(sessionUserLocal, user)
+		return true
+	}
+	return false
+}
+
+// pinEndpoint pins a /translate request to the endpoint named in its body,
+// one of DEEPL_ENDPOINTS, so admins can tell whether a mirror is the one
+// translating badly. Other callers can't pick the endpoint.
+func pinEndpoint(c *fiber.Ctx, params *TranslateParams) *translateError {
+	if !bytes.Contains(c.Body(), []byte(`"endpoint"`)) {
+		return nil
+	}
+	var body struct {
+		Endpoint string `json:"endpoint"`
+	}
+	if err := c.BodyParser(&body); err != nil || body.Endpoint == "" {
+		return nil
+	}
+	if !isAdmin(c) {
+		return &translateError{Code: 403, Message: "Only admins may pick the endpoint"}
+	}
+	if !upstreams.hasEndpoint(body.Endpoint) {
+		return &translateError{Code: 400, Message: "Unknown endpoint, use one of DEEPL_ENDPOINTS"}
+	}
+	if params.Engine != "" && !strings.EqualFold(params.Engine, EngineDeepL) {
+		return &translateError{Code: 400, Message: "An endpoint can only be picked for the deepl engine"}
+	}
+	params.Engine = EngineDeepL
+	params.endpoint = body.Endpoint
+	return nil
+}
+
+func registerAdminRoutes(app *fiber.App) {
+	// The dashboard page asks for the token itself, as browsers don't send
+	// it when navigating, so it is registered ahead of the group.
+	app.Get("/admin/dashboard", handleDashboard)
+
+	admin := app.Group("/admin", requireAdmin)
+
+	admin.Get("/stats", handleStats)
+	admin.Put("/upstreams/weights", handleSetWeights)
+	admin.Put("/upstreams/enabled", handleSetEnabled)
+
+	admin.Get("/maintenance", handleGetMaintenance)
+	admin.Put("/maintenance", handleStartMaintenance)
+	admin.Delete("/maintenance", handleStopMaintenance)
+
+	admin.Get("/terms", handleListTerms)
+	admin.Post("/terms", handleAddTerm)
+	admin.Put("/terms", handleReplaceTerms)
+	admin.Delete("/terms/:id", handleDeleteTerm)
+}
+
+func handleStats(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{
+		"upstreams": upstreams.stats(),
+		"jobs":      jobs.stats(),
+	})
+}
+
+func handleSetWeights(c *fiber.Ctx) error {
+	var body struct {
+		Endpoints map[string]float64 `json:"endpoints"`
+		Proxies   map[string]float64 `json:"proxies"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{"code": 400, "message": "Invalid request body"})
+	}
+
+	before := upstreamWeights()
+	if err := upstreams.setWeights(body.Endpoints, body.Proxies); err != nil {
+		return c.Status(400).JSON(fiber.Map{"code": 400, "message": err.Error()})
+	}
+	auditAdmin(c, "upstreams.weights", "", before, upstreamWeights())
+	return c.JSON(fiber.Map{
+		"upstreams": upstreams.stats(),
+	})
+}
+
+func handleSetEnabled(c *fiber.Ctx) error {
+	var body struct {
+		Endpoint string `json:"endpoint"`
+		Proxy    string `json:"proxy"`
+		Enabled  *bool  `json:"enabled"`
+	}
+	if err := c.BodyParser(&body); err != nil || body.Enabled == nil {
+		return c.Status(400).JSON(fiber.Map{"code": 400, "message": "Invalid request body"})
+	}
+
+	before := upstreamEnabled()
+	if err := upstreams.setEnabled(body.Endpoint, body.Proxy, *body.Enabled); err != nil {
+		return c.Status(404).JSON(fiber.Map{"code": 404, "message": err.Error()})
+	}
+	auditAdmin(c, "upstreams.enabled", targetLabel(body.Endpoint, body.Proxy), before, upstreamEnabled())
+	return c.JSON(fiber.Map{
+		"upstreams": upstreams.stats(),
+	})
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Alert webhook formats.
+const (
+	AlertSlack   = "slack"
+	AlertDiscord = "discord"
+	AlertGeneric = "generic"
+)
+
+// alertBuckets is the number of slices the alert window is counted in, so
+// that old calls leave the window gradually.
+const alertBuckets = 10
+
+// alertPayload is the body of generic alert webhooks.
+type alertPayload struct {
+	Alert     string  `json:"alert"`
+	Message   string  `json:"message"`
+	Rate      float64 `json:"rate"`
+	Threshold float64 `json:"threshold"`
+	Requests  int     `json:"requests"`
+	Window    string  `json:"window"`
+}
+
+type alertBucket struct {
+	start                      time.Time
+	calls, failures, throttled int
+}
+
+// alertMonitor counts upstream calls over ALERT_WINDOW and posts to
+// ALERT_WEBHOOK when the error or 429 rate crosses its threshold, at most
+// once per ALERT_COOLDOWN for each kind of alert.
+type alertMonitor struct {
+	mu      sync.Mutex
+	buckets [alertBuckets]alertBucket
+	fired   map[string]time.Time
+}
+
+var alerts = &alertMonitor{fired: make(map[string]time.Time)}
+
+var alertClient = &http.Client{Timeout: 10 * time.Second}
+
+// alertFormat returns format, or the format the webhook URL suggests when it
+// is empty.
+func alertFormat(webhook, format string) string {
+	if format != "" {
+		return format
+	}
+	switch {
+	case strings.Contains(webhook, "hooks.slack.com"):
+		return AlertSlack
+	case strings.Contains(webhook, "discord.com/api/webhooks"), strings.Contains(webhook, "discordapp.com/api/webhooks"):
+		return AlertDiscord
+	default:
+		return AlertGeneric
+	}
+}
+
+// observe counts an upstream call.
+func (m *alertMonitor) observe(ok, rateLimited bool) {
+	if cfg().AlertWebhook == "" {
+		return
+	}
+	now := time.Now()
+	slot := cfg().AlertWindow / alertBuckets
+
+	m.mu.Lock()
+	start := now.Truncate(slot)
+	bucket := &m.buckets[start.UnixNano()/int64(slot)%alertBuckets]
+	if !bucket.start.Equal(start) {
+		*bucket = alertBucket{start: start}
+	}
+	bucket.calls++
+	if !ok {
+		bucket.failures++
+	}
+	if rateLimited {
+		bucket.throttled++
+	}
+	m.mu.Unlock()
+
+	m.check(now)
+}
+
+// check fires the alerts whose rate is over the threshold in the window
+// ending at now.
+func (m *alertMonitor) check(now time.Time) {
+	window := cfg().AlertWindow
+
+	m.mu.Lock()
+	var calls, failures, throttled int
+	for _, bucket := range m.buckets {
+		if now.Sub(bucket.start) < window {
+			calls += bucket.calls
+			failures += bucket.failures
+			throttled += bucket.throttled
+		}
+	}
+	if calls < cfg().AlertMinRequests {
+		m.mu.Unlock()
+		return
+	}
+
+	var due []alertPayload
+	for _, alert := range []struct {
+		name      string
+		label     string
+		count     int
+		threshold float64
+	}{
+		{"error_rate", "error rate", failures, cfg().AlertErrorRate},
+		{"rate_limited", "429 rate", throttled, cfg().Alert429Rate},
+	} {
+		rate := float64(alert.count) / float64(calls)
+		if alert.threshold <= 0 || rate < alert.threshold || now.Sub(m.fired[alert.name]) < cfg().AlertCooldown {
+			continue
+		}
+		m.fired[alert.name] = now
+		due = append(due, alertPayload{
+			Alert: alert.name,
+			Message: fmt.Sprintf("DeepLX-Go: upstream %s is %.0f%% (%d of %d calls) over the last %v, above the %.0f%% threshold",
+				alert.label, 100*rate, alert.count, calls, window, 100*alert.threshold),
+			Rate:      rate,
+			Threshold: alert.threshold,
+			Requests:  calls,
+			Window:    window.String(),
+		})
+	}
+	m.mu.Unlock()
+
+	for _, alert := range due {
+		log.Printf("Alert: %s", alert.Message)
+		go sendAlert(cfg().AlertWebhook, cfg().AlertFormat, alert.Message, alert)
+	}
+}
+
+// sendAlert posts message to a Slack or Discord webhook, or generic to
+// other webhooks.
+func sendAlert(webhook, format, message string, generic any) {
+	payload := generic
+	switch alertFormat(webhook, format) {
+	case AlertSlack:
+		payload = map[string]string{"text": message}
+	case AlertDiscord:
+		payload = map[string]string{"content": message}
+	}
+	body, err := jsonMarshal(payload)
+	if err != nil {
+		log.Printf("Error encoding alert: %v", err)
+		return
+	}
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, webhook, bytes.NewReader(body))
+	if err != nil {
+		log.Printf("Error sending alert: %v", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := alertClient.Do(req)
+	if err != nil {
+		log.Printf("Error sending alert: %v", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		log.Printf("Error sending alert: webhook answered %s", resp.Status)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// Orders alternatives can be ranked in.
+const (
+	RankDistance = "distance"
+	RankLength   = "length"
+)
+
+func isValidRanking(rank string) bool {
+	switch rank {
+	case "", RankDistance, RankLength:
+		return true
+	}
+	return false
+}
+
+// refineAlternatives drops the alternatives of the response and its
+// sentences that repeat their translation or an earlier alternative, ranks
+// the rest as params ask and keeps at most params.MaxAlternatives.
+func refineAlternatives(params TranslateParams, response *TranslateResponse) {
+	response.Alternatives = refineList(params, response.Data, response.Alternatives)
+	for i := range response.Sentences {
+		item := &response.Sentences[i]
+		item.Alternatives = refineList(params, item.Text, item.Alternatives)
+	}
+}
+
+func refineList(params TranslateParams, translation string, alternatives []string) []string {
+	if len(alternatives) == 0 {
+		return alternatives
+	}
+
+	// Alternatives at least ALTERNATIVES_SIMILARITY alike count as
+	// duplicates; ones differing only in case and spacing always do.
+	threshold := cfg().DuplicateSimilarity
+	duplicate := func(a, b string) bool {
+		if strings.EqualFold(strings.Join(strings.Fields(a), " "), strings.Join(strings.Fields(b), " ")) {
+			return true
+		}
+		return threshold > 0 && similarity(a, b) >= threshold
+	}
+	var kept []string
+	for _, alternative := range alternatives {
+		if duplicate(alternative, translation) || slices.ContainsFunc(kept, func(k string) bool { return duplicate(alternative, k) }) {
+			continue
+		}
+		kept = append(kept, alternative)
+	}
+
+	switch params.RankAlternatives {
+	case RankDistance:
+		// Closest to the translation first.
+		slices.SortStableFunc(kept, func(a, b string) int {
+			return cmp.Compare(levenshtein(a, translation), levenshtein(b, translation))
+		})
+	case RankLength:
+		length := utf8.RuneCountInString(translation)
+		gap := func(s string) int {
+			n := utf8.RuneCountInString(s) - length
+			return max(n, -n)
+		}
+		slices.SortStableFunc(kept, func(a, b string) int { return cmp.Compare(gap(a), gap(b)) })
+	}
+
+	if params.MaxAlternatives > 0 && len(kept) > params.MaxAlternatives {
+		kept = kept[:params.MaxAlternatives]
+	}
+	return kept
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Actors of audit entries.
+const (
+	ActorAdmin  = "admin"
+	ActorSystem = "system"
+)
+
+// auditEntry is one line of the audit log.
+type auditEntry struct {
+	Time   time.Time `json:"time"`
+	Actor  string    `json:"actor"`
+	IP     string    `json:"ip,omitempty"`
+	Action string    `json:"action"`
+	Target string    `json:"target,omitempty"`
+	Reason string    `json:"reason,omitempty"`
+	Before any       `json:"before"`
+	After  any       `json:"after"`
+}
+
+// auditMu keeps entries written by concurrent requests on lines of their
+// own.
+var auditMu sync.Mutex
+
+// writeAudit appends an entry to AUDIT_LOG. The file is opened for every
+// entry, so it can be moved away for archiving, and synced, so an entry is
+// not lost when the server crashes right after a change.
+func writeAudit(entry auditEntry) {
+	path := cfg().AuditLog
+	if path == "" {
+		return
+	}
+	entry.Time = time.Now().UTC()
+	line, err := jsonMarshal(entry)
+	if err != nil {
+		log.Printf("Error encoding audit entry: %v", err)
+		return
+	}
+	line = append([]byte(redact(string(line))), '\n')
+
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		log.Printf("Error writing audit log: %v", err)
+		return
+	}
+	defer file.Close()
+	if _, err := file.Write(line); err != nil {
+		log.Printf("Error writing audit log: %v", err)
+		return
+	}
+	if err := file.Sync(); err != nil {
+		log.Printf("Error writing audit log: %v", err)
+	}
+}
+
+// auditAdmin records a change made through the admin API, by the user of
+// the session or by whoever holds the admin token.
+func auditAdmin(c *fiber.Ctx, action, target string, before, after any) {
+	actor := ActorAdmin
+	if user, ok := c.Locals(sessionUserLocal).(sessionUser); ok {
+		actor = user.actor()
+	}
+	writeAudit(auditEntry{
+		Actor:  actor,
+		IP:     c.IP(),
+		Action: action,
+		Target: target,
+		Before: before,
+		After:  after,
+	})
+}
+
+// settingSnapshot returns the value of every setting in effect, to tell
+// what a reload changed.
+func settingSnapshot() map[string]string {
+	snapshot := make(map[string]string, len(configSettings))
+	for _, setting := range configSettings {
+		value := getEnv(setting.Name, "")
+		if containsFold(secretSettings, setting.Name) {
+			value = getSecret(setting.Name)
+		}
+		if value != "" {
+			snapshot[setting.Name] = value
+		}
+	}
+	return snapshot
+}
+
+// auditReload records the settings a reload changed, compared to before.
+// Secrets are only recorded as set or unset, and URLs without passwords.
+func auditReload(reason string, before map[string]string) {
+	if cfg().AuditLog == "" {
+		return
+	}
+	after := settingSnapshot()
+	mask := func(name, value string) string {
+		if value != "" && containsFold(secretSettings, name) {
+			return "(redacted)"
+		}
+		return maskURLs(value)
+	}
+	changedBefore, changedAfter := map[string]string{}, map[string]string{}
+	for _, setting := range configSettings {
+		if old, value := before[setting.Name], after[setting.Name]; old != value {
+			changedBefore[setting.Name] = mask(setting.Name, old)
+			changedAfter[setting.Name] = mask(setting.Name, value)
+		}
+	}
+	writeAudit(auditEntry{
+		Actor:  ActorSystem,
+		Action: "config.reload",
+		Reason: reason,
+		Before: changedBefore,
+		After:  changedAfter,
+	})
+}
+
+// maskURLs masks the passwords of the URLs in a comma-separated value, such
+// as proxies with credentials.
+func maskURLs(value string) string {
+	if !strings.Contains(value, "@") {
+		return value
+	}
+	items := strings.Split(value, ",")
+	for i, item := range items {
+		if u, err := url.Parse(strings.TrimSpace(item)); err == nil && u.User != nil {
+			items[i] = u.Redacted()
+		}
+	}
+	return strings.Join(items, ",")
+}
+
+// targetLabel names an endpoint/proxy combination without the proxy's
+// password.
+func targetLabel(endpoint, proxy string) string {
+	if proxy == "" {
+		return maskURLs(endpoint)
+	}
+	return maskURLs(endpoint) + " via " + maskURLs(proxy)
+}
+
+// upstreamWeights returns the weight of every endpoint/proxy combination.
+func upstreamWeights() map[string]float64 {
+	weights := make(map[string]float64)
+	for _, target := range upstreams.stats() {
+		weights[targetLabel(target.Endpoint, target.Proxy)] = target.Weight
+	}
+	return weights
+}
+
+// upstreamEnabled returns whether every endpoint/proxy combination is
+// enabled.
+func upstreamEnabled() map[string]bool {
+	enabled := make(map[string]bool)
+	for _, target := range upstreams.stats() {
+		enabled[targetLabel(target.Endpoint, target.Proxy)] = target.Enabled
+	}
+	return enabled
+}
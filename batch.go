@@ -0,0 +1,112 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+type batchOutcome struct {
+	result upstreamResult
+	err    error
+}
+
+type batchWaiter struct {
+	offset int
+	count  int
+	done   chan batchOutcome
+}
+
+// batch collects the texts of concurrent requests for one language pair.
+type batch struct {
+	params  TranslateParams
+	texts   []string
+	waiters []batchWaiter
+	timer   *time.Timer
+}
+
+// batcher coalesces requests arriving within cfg().BatchWindow into a single
+// upstream call and splits the result back out, cutting the number of
+// upstream requests for bursts of short texts.
+type batcher struct {
+	mu      sync.Mutex
+	pending map[string]*batch
+}
+
+var batches = &batcher{pending: make(map[string]*batch)}
+
+// batchKey groups requests for one language pair and style, as a batch is
+// sent with the options of its first request.
+func batchKey(params TranslateParams) string {
+	key := strings.ToUpper(params.SourceLang) + "|" + strings.ToUpper(params.TargetLang)
+	if job := jobParams(params); job != nil {
+		data, _ := jsonMarshal(job)
+		key += "|" + string(data)
+	}
+	return key
+}
+
+func (b *batcher) submit(params TranslateParams, texts []string) (upstreamResult, error) {
+	key := batchKey(params)
+	waiter := batchWaiter{count: len(texts), done: make(chan batchOutcome, 1)}
+
+	b.mu.Lock()
+	current := b.pending[key]
+	if current == nil {
+		current = &batch{params: params}
+		current.timer = time.AfterFunc(cfg().BatchWindow, func() {
+			b.flush(key, current)
+		})
+		b.pending[key] = current
+	}
+	waiter.offset = len(current.texts)
+	current.texts = append(current.texts, texts...)
+	current.waiters = append(current.waiters, waiter)
+	full := len(current.texts) >= cfg().BatchMaxTexts
+	b.mu.Unlock()
+
+	if full && current.timer.Stop() {
+		go b.flush(key, current)
+	}
+
+	outcome := <-waiter.done
+	return outcome.result, outcome.err
+}
+
+// flush sends the texts of a batch upstream and hands every waiter its share
+// of the result.
+func (b *batcher) flush(key string, current *batch) {
+	b.mu.Lock()
+	if b.pending[key] == current {
+		delete(b.pending, key)
+	}
+	b.mu.Unlock()
+
+	result, err := callDeepL(current.params, current.texts)
+	if len(current.waiters) == 1 {
+		current.waiters[0].done <- batchOutcome{result, err}
+		return
+	}
+
+	if err == nil && len(result.Result.Texts) != len(current.texts) {
+		// The texts cannot be attributed to their requests, so retry them
+		// one request at a time.
+		for _, waiter := range current.waiters {
+			go func(waiter batchWaiter) {
+				texts := current.texts[waiter.offset : waiter.offset+waiter.count]
+				result, err := callDeepL(current.params, texts)
+				waiter.done <- batchOutcome{result, err}
+			}(waiter)
+		}
+		return
+	}
+
+	for _, waiter := range current.waiters {
+		var share upstreamResult
+		if err == nil {
+			share.Result.Lang = result.Result.Lang
+			share.Result.Texts = result.Result.Texts[waiter.offset : waiter.offset+waiter.count]
+		}
+		waiter.done <- batchOutcome{share, err}
+	}
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+func benchCommand() (*flag.FlagSet, func() error) {
+	flags := flag.NewFlagSet("bench", flag.ContinueOnError)
+	client := clientFlags(flags)
+	rps := flags.Float64("rps", 50, "requests sent per second")
+	duration := flags.Duration("duration", time.Minute, "how long to send requests for")
+	maxInFlight := flags.Int("concurrency", 200, "maximum number of requests waiting for a response; requests due beyond it are skipped")
+	text := flags.String("text", "The quick brown fox jumps over the lazy dog.", "text to translate")
+	source := flags.String("source", "EN", "source language")
+	target := flags.String("target", "DE", "target language")
+	cached := flags.Bool("cached", false, "send the same text every time, measuring cache hits instead of upstream calls")
+
+	return flags, func() error {
+		if *rps <= 0 || *duration <= 0 || *maxInFlight <= 0 {
+			return errors.New("--rps, --duration and --concurrency must be positive")
+		}
+		client.http.Transport = &http.Transport{MaxIdleConnsPerHost: *maxInFlight}
+
+		fmt.Fprintf(os.Stderr, "Sending %g requests per second to %s for %v\n", *rps, client.server, *duration)
+		result := runBench(*rps, *duration, *maxInFlight, func(n int) (int, error) {
+			params := TranslateParams{Text: *text, SourceLang: *source, TargetLang: *target}
+			if !*cached {
+				params.Text = fmt.Sprintf("%s (%d)", *text, n)
+			}
+			response, err := client.translate(params)
+			return response.Code, err
+		})
+		result.print()
+		return nil
+	}
+}
+
+// benchResult collects the outcome of the requests of a load test.
+type benchResult struct {
+	mu sync.Mutex
+
+	// elapsed is how long requests were sent for.
+	elapsed   time.Duration
+	sent      int
+	skipped   int
+	latencies []time.Duration
+	failures  map[string]int
+}
+
+// runBench calls send at the given rate for duration, with at most
+// maxInFlight calls at a time. send reports the response code of a
+// request, or 0 when none was received.
+func runBench(rps float64, duration time.Duration, maxInFlight int, send func(n int) (int, error)) *benchResult {
+	result := &benchResult{failures: make(map[string]int)}
+	inFlight := make(chan struct{}, maxInFlight)
+	var wg sync.WaitGroup
+
+	start := time.Now()
+	ticker := time.NewTicker(max(time.Duration(float64(time.Second)/rps), time.Microsecond))
+	defer ticker.Stop()
+	for n := 0; time.Since(start) < duration; n++ {
+		<-ticker.C
+		select {
+		case inFlight <- struct{}{}:
+		default:
+			result.skipped++
+			continue
+		}
+		result.sent++
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-inFlight }()
+			sent := time.Now()
+			code, err := send(n)
+			result.record(time.Since(sent), code, err)
+		}()
+	}
+	result.elapsed = time.Since(start)
+	wg.Wait()
+	return result
+}
+
+func (r *benchResult) record(latency time.Duration, code int, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch {
+	case err == nil:
+		r.latencies = append(r.latencies, latency)
+	case code != 0:
+		r.failures[fmt.Sprintf("HTTP %d", code)]++
+	default:
+		r.failures["no response"]++
+		log.Printf("Error: %v", err)
+	}
+}
+
+func (r *benchResult) print() {
+	slices.Sort(r.latencies)
+	failed := r.sent - len(r.latencies)
+
+	fmt.Printf("Requests:   %d sent in %v (%.1f/s), %d skipped at the concurrency limit\n",
+		r.sent, r.elapsed.Round(time.Millisecond), float64(r.sent)/r.elapsed.Seconds(), r.skipped)
+	fmt.Printf("Succeeded:  %d\n", len(r.latencies))
+	fmt.Printf("Failed:     %d (%.1f%%)\n", failed, 100*float64(failed)/float64(max(r.sent, 1)))
+	reasons := make([]string, 0, len(r.failures))
+	for reason := range r.failures {
+		reasons = append(reasons, reason)
+	}
+	slices.Sort(reasons)
+	for _, reason := range reasons {
+		fmt.Printf("  %-10s%d\n", reason+":", r.failures[reason])
+	}
+
+	if len(r.latencies) == 0 {
+		return
+	}
+	fmt.Println("Latency:")
+	for _, p := range []float64{50, 90, 95, 99, 100} {
+		label := fmt.Sprintf("p%g", p)
+		if p == 100 {
+			label = "max"
+		}
+		index := min(len(r.latencies)-1, int(p/100*float64(len(r.latencies))))
+		fmt.Printf("  %-10s%v\n", label+":", r.latencies[index].Round(100*time.Microsecond))
+	}
+}
+
+func mockCommand() (*flag.FlagSet, func() error) {
+	flags := flag.NewFlagSet("mock", flag.ContinueOnError)
+	addr := flags.String("addr", "127.0.0.1:9000", "address to listen on")
+	latency := flags.Duration("latency", 200*time.Millisecond, "delay before answering, like a real upstream")
+
+	return flags, func() error {
+		fmt.Fprintf(os.Stderr, "Serving a mock DeepL endpoint; run the server with DEEPL_ENDPOINTS=http://%s/jsonrpc\n", *addr)
+		return http.ListenAndServe(*addr, mockUpstream(*latency))
+	}
+}
+
+// mockUpstream answers DeepL JSON-RPC calls after latency, with the target
+// language code prefixed to every text, so the server can be load tested
+// without spending upstream quota. Long texts are split into sentences with
+// splitSentences.
+func mockUpstream(latency time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var call struct {
+			Method string `json:"method"`
+		}
+		if err := json.Unmarshal(body, &call); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		time.Sleep(latency)
+		w.Header().Set("Content-Type", "application/json")
+		switch call.Method {
+		case "LMT_split_text":
+			json.NewEncoder(w).Encode(mockSplitText(body))
+			return
+		case "LMT_handle_jobs":
+			json.NewEncoder(w).Encode(mockHandleJobs(body))
+			return
+		}
+
+		var request RequestConfig
+		if err := json.Unmarshal(body, &request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var response upstreamResult
+		response.Result.Lang = request.Params.Lang.SourceLangUserSelected
+		if response.Result.Lang == "AUTO" {
+			response.Result.Lang = "EN"
+		}
+		prefix := "[" + strings.ToUpper(request.Params.Lang.TargetLang) + "] "
+		for _, text := range request.Params.Texts {
+			response.Result.Texts = append(response.Result.Texts, upstreamText{Text: prefix + text.Text})
+		}
+		json.NewEncoder(w).Encode(response)
+	})
+}
+
+func mockSplitText(body []byte) splitTextResult {
+	var request splitTextRequest
+	var response splitTextResult
+	json.Unmarshal(body, &request)
+	response.Result.Lang.Detected = "EN"
+	if lang := request.Params.Lang.LangUserSelected; lang != "auto" {
+		response.Result.Lang.Detected = lang
+	}
+	response.Result.Texts = make([]splitTextChunks, len(request.Params.Texts))
+	for i, text := range request.Params.Texts {
+		chunks := &response.Result.Texts[i].Chunks
+		prefix := ""
+		for _, s := range splitSentences(text) {
+			*chunks = append(*chunks, struct {
+				Sentences []splitSentence `json:"sentences"`
+			}{[]splitSentence{{Prefix: prefix + s.Lead, Text: s.Text}}})
+			prefix = s.Sep
+		}
+	}
+	return response
+}
+
+func mockHandleJobs(body []byte) handleJobsResult {
+	var request handleJobsRequest
+	var response handleJobsResult
+	json.Unmarshal(body, &request)
+	response.Result.SourceLang = request.Params.Lang.SourceLangComputed
+	prefix := "[" + request.Params.Lang.TargetLang + "] "
+	for _, job := range request.Params.Jobs {
+		var translation jobTranslation
+		translation.Beams = make([]struct {
+			Sentences []struct {
+				Text string `json:"text"`
+			} `json:"sentences"`
+		}, 1)
+		for _, s := range job.Sentences {
+			translation.Beams[0].Sentences = append(translation.Beams[0].Sentences, struct {
+				Text string `json:"text"`
+			}{prefix + s.Text})
+		}
+		response.Result.Translations = append(response.Result.Translations, translation)
+	}
+	return response
+}
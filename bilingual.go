@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"strings"
+)
+
+// Bilingual layouts, which show each source text next to its translation.
+const (
+	BilingualTable       = "table"
+	BilingualInterleaved = "interleaved"
+	BilingualHTML        = "html"
+)
+
+func isValidBilingualLayout(layout string) bool {
+	return layout == BilingualTable || layout == BilingualInterleaved || layout == BilingualHTML
+}
+
+// bilingualExport is a rendered bilingual file.
+type bilingualExport struct {
+	Data        []byte
+	ContentType string
+	Extension   string
+}
+
+// renderBilingual renders sources and their translations in the given
+// layout: a two-column Markdown or HTML table, or Markdown with each
+// translation quoted below its source.
+func renderBilingual(layout string, sources, translations []string) bilingualExport {
+	var out strings.Builder
+	switch layout {
+	case BilingualHTML:
+		out.WriteString("<!DOCTYPE html>\n<html>\n<head><meta charset=\"utf-8\"></head>\n<body>\n<table>\n")
+		out.WriteString("<tr><th>Source</th><th>Translation</th></tr>\n")
+		for i, source := range sources {
+			fmt.Fprintf(&out, "<tr><td>%s</td><td>%s</td></tr>\n", htmlCell(source), htmlCell(translations[i]))
+		}
+		out.WriteString("</table>\n</body>\n</html>\n")
+		return bilingualExport{Data: []byte(out.String()), ContentType: "text/html; charset=utf-8", Extension: ".html"}
+
+	case BilingualInterleaved:
+		for i, source := range sources {
+			if i > 0 {
+				out.WriteString("\n")
+			}
+			out.WriteString(source + "\n\n")
+			out.WriteString("> " + strings.ReplaceAll(translations[i], "\n", "\n> ") + "\n")
+		}
+
+	default:
+		cell := strings.NewReplacer("|", `\|`, "\r\n", "<br>", "\n", "<br>")
+		out.WriteString("| Source | Translation |\n| --- | --- |\n")
+		for i, source := range sources {
+			fmt.Fprintf(&out, "| %s | %s |\n", cell.Replace(source), cell.Replace(translations[i]))
+		}
+	}
+	return bilingualExport{Data: []byte(out.String()), ContentType: "text/markdown; charset=utf-8", Extension: ".md"}
+}
+
+func htmlCell(text string) string {
+	return strings.ReplaceAll(html.EscapeString(text), "\n", "<br>")
+}
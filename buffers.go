@@ -0,0 +1,30 @@
+package main
+
+import (
+	"bytes"
+	"sync"
+)
+
+// maxPooledBuffer is the capacity above which a buffer is left to the
+// garbage collector instead of being pooled, so one large document doesn't
+// pin its memory for good.
+const maxPooledBuffer = 1 << 20
+
+// bufferPool holds the buffers upstream bodies are built and read into, so
+// that requests reuse them instead of allocating their own.
+var bufferPool = sync.Pool{
+	New: func() any { return new(bytes.Buffer) },
+}
+
+func getBuffer() *bytes.Buffer {
+	return bufferPool.Get().(*bytes.Buffer)
+}
+
+// putBuffer returns buf to the pool. It must not be used afterwards.
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBuffer {
+		return
+	}
+	buf.Reset()
+	bufferPool.Put(buf)
+}
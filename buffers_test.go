@@ -0,0 +1,33 @@
+package main
+
+import (
+	"testing"
+)
+
+// BenchmarkBuildRequestBody measures building an upstream body, which is
+// encoded in a pooled buffer.
+func BenchmarkBuildRequestBody(b *testing.B) {
+	params := TranslateParams{SourceLang: "EN", TargetLang: "DE"}
+	texts := benchmarkTexts()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := buildRequestBody(params, texts); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkCallDeepL measures a whole upstream call against the mock
+// upstream, whose response is read into a pooled buffer.
+func BenchmarkCallDeepL(b *testing.B) {
+	withUpstream(b, mockUpstream(0))
+	params := TranslateParams{SourceLang: "EN", TargetLang: "DE"}
+	texts := benchmarkTexts()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := callDeepL(params, texts); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+type ttlItem[V any] struct {
+	value   V
+	expires time.Time
+}
+
+// ttlCache is a size-bounded in-memory cache whose entries expire after a
+// fixed TTL. A cache with a zero TTL stores nothing.
+type ttlCache[V any] struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	maxSize int
+	items   map[string]ttlItem[V]
+}
+
+var translations = newTTLCache[TranslateResponse](cfg().CacheTTL, cfg().CacheSize)
+
+func newTTLCache[V any](ttl time.Duration, maxSize int) *ttlCache[V] {
+	return &ttlCache[V]{
+		ttl:     ttl,
+		maxSize: maxSize,
+		items:   make(map[string]ttlItem[V]),
+	}
+}
+
+func (c *ttlCache[V]) Get(key string) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	item, ok := c.items[key]
+	if !ok || time.Now().After(item.expires) {
+		var zero V
+		return zero, false
+	}
+	return item.value, true
+}
+
+func (c *ttlCache[V]) Set(key string, value V) {
+	if c.ttl <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if _, ok := c.items[key]; !ok && c.maxSize > 0 && len(c.items) >= c.maxSize {
+		c.evict(now)
+	}
+	c.items[key] = ttlItem[V]{value: value, expires: now.Add(c.ttl)}
+}
+
+func (c *ttlCache[V]) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.items, key)
+}
+
+func (c *ttlCache[V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.items)
+}
+
+// evict drops expired items, or the item closest to expiry when none has
+// expired yet. Callers must hold the lock.
+func (c *ttlCache[V]) evict(now time.Time) {
+	oldestKey := ""
+	var oldest time.Time
+	for key, item := range c.items {
+		if now.After(item.expires) {
+			delete(c.items, key)
+			continue
+		}
+		if oldestKey == "" || item.expires.Before(oldest) {
+			oldestKey, oldest = key, item.expires
+		}
+	}
+	if len(c.items) >= c.maxSize && oldestKey != "" {
+		delete(c.items, oldestKey)
+	}
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Periods character caps are counted over.
+const (
+	CapDaily   = "daily"
+	CapMonthly = "monthly"
+)
+
+// capGlobal is the key the characters of every translation are counted
+// under, whichever key made it.
+const capGlobal = "*"
+
+var capPeriods = []string{CapDaily, CapMonthly}
+
+// parseCaps parses comma-separated name:characters pairs.
+func parseCaps(value string) map[string]int {
+	caps := make(map[string]int)
+	for _, item := range splitList(value) {
+		name, limit, _ := strings.Cut(item, ":")
+		if n, err := strconv.Atoi(limit); err == nil && name != "" && n > 0 {
+			caps[name] = n
+		}
+	}
+	return caps
+}
+
+// parseTimeOfDay parses a time such as 06:30 into the time since midnight.
+func parseTimeOfDay(value string) (time.Duration, error) {
+	parsed, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a time such as 00:00", value)
+	}
+	return time.Duration(parsed.Hour())*time.Hour + time.Duration(parsed.Minute())*time.Minute, nil
+}
+
+// capLimit returns the cap of key over period, or 0 when it has none.
+func capLimit(period, key string) int {
+	config := cfg()
+	switch {
+	case key == capGlobal && period == CapDaily:
+		return config.DailyCharacterCap
+	case key == capGlobal:
+		return config.MonthlyCharacterCap
+	case period == CapDaily:
+		return config.KeyDailyCaps[key]
+	default:
+		return config.KeyMonthlyCaps[key]
+	}
+}
+
+// nextCapReset returns when the period of a cap counted at now ends: daily at
+// CAP_RESET_TIME UTC, monthly at that time on CAP_RESET_DAY.
+func nextCapReset(period string, now time.Time) time.Time {
+	config := cfg()
+	now = now.UTC()
+	if period == CapDaily {
+		reset := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC).Add(config.CapResetTime)
+		if !now.Before(reset) {
+			reset = reset.AddDate(0, 0, 1)
+		}
+		return reset
+	}
+	reset := time.Date(now.Year(), now.Month(), config.CapResetDay, 0, 0, 0, 0, time.UTC).Add(config.CapResetTime)
+	if !now.Before(reset) {
+		reset = reset.AddDate(0, 1, 0)
+	}
+	return reset
+}
+
+// capCounter counts the characters translated upstream by key and period.
+// Counters live in sharedStore when Redis is configured, so the caps hold
+// across replicas.
+type capCounter struct {
+	mu      sync.Mutex
+	windows map[string]callerWindow
+}
+
+var characterCaps = &capCounter{windows: make(map[string]callerWindow)}
+
+// add adds n characters to the counter name of period and returns it; an n
+// of 0 reads the counter. Shared counters are updated in a single step, so
+// replicas translating at the same time can't both take the last characters
+// of a cap.
+func (c *capCounter) add(name, period string, n int, now time.Time) callerWindow {
+	if counter, ok := sharedStore.(sharedCounter); ok {
+		// When Redis fails, the replica counts on its own.
+		if count, reset, err := counter.Increment(name, n, nextCapReset(period, now)); err == nil {
+			return callerWindow{Count: count, Reset: reset}
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	window := c.windows[name]
+	if !now.Before(window.Reset) {
+		window = callerWindow{Reset: nextCapReset(period, now)}
+	}
+	if n == 0 {
+		return window
+	}
+	window.Count = max(window.Count+n, 0)
+	for k, w := range c.windows {
+		if !now.Before(w.Reset) {
+			delete(c.windows, k)
+		}
+	}
+	c.windows[name] = window
+	return window
+}
+
+// reserve counts characters against the caps of key and the global caps
+// before they are translated. When that would exceed a cap, nothing is
+// counted and the error reports when the cap resets.
+func (c *capCounter) reserve(key string, characters int) *translateError {
+	keys := []string{capGlobal}
+	if key != "" {
+		keys = append(keys, key)
+	}
+	type counted struct {
+		name, period, key string
+		limit             int
+		window            callerWindow
+	}
+	var windows []counted
+
+	now := time.Now()
+	for _, period := range capPeriods {
+		for _, key := range keys {
+			limit := capLimit(period, key)
+			if limit <= 0 {
+				continue
+			}
+			name := "cap:" + period + ":" + key
+			window := c.add(name, period, characters, now)
+			windows = append(windows, counted{name, period, key, limit, window})
+			if window.Count > limit {
+				// Counting first and taking the characters back when
+				// over leaves no gap between checking and counting.
+				for _, counted := range windows {
+					c.add(counted.name, counted.period, -characters, now)
+				}
+				return &translateError{
+					Code:    456,
+					Message: fmt.Sprintf("Quota exceeded, the %s character cap resets at %s", period, window.Reset.Format(time.RFC3339)),
+				}
+			}
+		}
+	}
+	threshold := cfg().QuotaWarning
+	for _, counted := range windows {
+		// The webhook fires once per period, when a request crosses the
+		// threshold.
+		before := capPercent(counted.window.Count-characters, counted.limit)
+		after := capPercent(counted.window.Count, counted.limit)
+		if threshold > 0 && cfg().QuotaWarningWebhook != "" && before < threshold && after >= threshold {
+			go sendQuotaWarning(counted.period, counted.key, counted.window, counted.limit)
+		}
+	}
+	return nil
+}
+
+// release gives back the characters reserved for a translation that failed.
+func (c *capCounter) release(key string, characters int) {
+	keys := []string{capGlobal}
+	if key != "" {
+		keys = append(keys, key)
+	}
+	now := time.Now()
+	for _, period := range capPeriods {
+		for _, key := range keys {
+			if capLimit(period, key) > 0 {
+				c.add("cap:"+period+":"+key, period, -characters, now)
+			}
+		}
+	}
+}
+
+// capPercent returns the whole percentage of limit count is.
+func capPercent(count, limit int) int {
+	return int(int64(count) * 100 / int64(limit))
+}
+
+// used returns the highest percentage of a cap of key, or of a global cap,
+// used in the current periods.
+func (c *capCounter) used(key string) int {
+	now := time.Now()
+	highest := 0
+	for _, period := range capPeriods {
+		for _, key := range []string{capGlobal, key} {
+			if limit := capLimit(period, key); limit > 0 {
+				highest = max(highest, capPercent(c.add("cap:"+period+":"+key, period, 0, now).Count, limit))
+			}
+		}
+	}
+	return highest
+}
+
+// capProjection is how a translation would leave a character cap.
+type capProjection struct {
+	Period string `json:"period"`
+	// Key is left out for the global caps.
+	Key       string    `json:"key,omitempty"`
+	Cap       int       `json:"cap"`
+	Used      int       `json:"used"`
+	Projected int       `json:"projected"`
+	Percent   int       `json:"percent"`
+	Exceeds   bool      `json:"exceeds"`
+	Reset     time.Time `json:"reset"`
+}
+
+// project reports how translating characters would leave the caps of key
+// and the global caps, without counting them.
+func (c *capCounter) project(key string, characters int) []capProjection {
+	now := time.Now()
+	var projections []capProjection
+	for _, period := range capPeriods {
+		for _, key := range []string{capGlobal, key} {
+			limit := capLimit(period, key)
+			if limit <= 0 {
+				continue
+			}
+			window := c.add("cap:"+period+":"+key, period, 0, now)
+			projection := capProjection{
+				Period:    period,
+				Key:       key,
+				Cap:       limit,
+				Used:      window.Count,
+				Projected: window.Count + characters,
+				Percent:   capPercent(window.Count+characters, limit),
+				Exceeds:   window.Count+characters > limit,
+				Reset:     window.Reset,
+			}
+			if key == capGlobal {
+				projection.Key = ""
+			}
+			projections = append(projections, projection)
+		}
+	}
+	return projections
+}
+
+// warnQuota adds an X-Quota-Warning header such as "85%" to the responses of
+// callers that have used QUOTA_WARNING percent of a cap, so they can slow
+// down before being refused.
+func warnQuota(c *fiber.Ctx) error {
+	err := c.Next()
+	if threshold := cfg().QuotaWarning; threshold > 0 {
+		if used := characterCaps.used(meterKey(c)); used >= threshold {
+			c.Set("X-Quota-Warning", strconv.Itoa(used)+"%")
+		}
+	}
+	return err
+}
+
+// quotaWarning is the body of generic quota warning webhooks.
+type quotaWarning struct {
+	Alert      string    `json:"alert"`
+	Message    string    `json:"message"`
+	Key        string    `json:"key,omitempty"`
+	Period     string    `json:"period"`
+	Characters int       `json:"characters"`
+	Cap        int       `json:"cap"`
+	Reset      time.Time `json:"reset"`
+}
+
+// sendQuotaWarning posts to QUOTA_WARNING_WEBHOOK that a cap passed
+// QUOTA_WARNING percent.
+func sendQuotaWarning(period, key string, window callerWindow, limit int) {
+	owner := "all callers"
+	if key == capGlobal {
+		key = ""
+	} else {
+		owner = key
+	}
+	warning := quotaWarning{
+		Alert: "quota_warning",
+		Message: fmt.Sprintf("DeepLX-Go: %s used %d%% of the %s character cap (%d of %d), which resets at %s",
+			owner, capPercent(window.Count, limit), period, window.Count, limit, window.Reset.Format(time.RFC3339)),
+		Key:        key,
+		Period:     period,
+		Characters: window.Count,
+		Cap:        limit,
+		Reset:      window.Reset,
+	}
+	log.Printf("Quota warning: %s", warning.Message)
+	sendAlert(cfg().QuotaWarningWebhook, "", warning.Message, warning)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// withCharacterCaps gives a test counters of its own.
+func withCharacterCaps(t *testing.T) {
+	t.Helper()
+	previous := characterCaps
+	characterCaps = &capCounter{windows: make(map[string]callerWindow)}
+	t.Cleanup(func() { characterCaps = previous })
+}
+
+// TestCapReserve checks that translations fill a cap up to its limit and no
+// further, in memory and through the shared store.
+func TestCapReserve(t *testing.T) {
+	withConfig(t, func(c *Config) {
+		c.DailyCharacterCap = 10
+		c.KeyDailyCaps = map[string]int{"team": 6}
+	})
+	for _, shared := range []bool{false, true} {
+		withCharacterCaps(t)
+		var store *memoryStore
+		if shared {
+			store = withSharedStore(t)
+		}
+		reserve := func(key string, characters int, want int) {
+			t.Helper()
+			code := 0
+			if failure := characterCaps.reserve(key, characters); failure != nil {
+				code = failure.Code
+			}
+			if code != want {
+				t.Errorf("shared %v: reserving %d for %q: code %d, want %d", shared, characters, key, code, want)
+			}
+		}
+		globalUsed := func() int { return characterCaps.project("", 0)[0].Used }
+
+		reserve("team", 6, 0)
+		reserve("team", 1, 456)
+		if used := globalUsed(); used != 6 {
+			t.Errorf("shared %v: a refused translation left %d characters counted, want 6", shared, used)
+		}
+		reserve("", 4, 0)
+		reserve("", 1, 456)
+		characterCaps.release("", 4)
+		reserve("", 4, 0)
+		if used := globalUsed(); used != 10 {
+			t.Errorf("shared %v: %d characters counted, want 10", shared, used)
+		}
+		if shared && (store.windows["cap:daily:*"].Count != 10 || len(characterCaps.windows) != 0) {
+			t.Errorf("shared caps counted locally: %+v", characterCaps.windows)
+		}
+	}
+}
+
+// TestCapReleaseOnFailure checks that failed translations don't count
+// against the caps.
+func TestCapReleaseOnFailure(t *testing.T) {
+	withCharacterCaps(t)
+	withConfig(t, func(c *Config) { c.DailyCharacterCap = 100 })
+	app := newCompatApp()
+
+	withUpstream(t, mockUpstream(0))
+	postTranslate(t, app, `{"text": "counted", "source_lang": "EN", "target_lang": "DE"}`)
+	withUpstream(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	if _, body := postTranslate(t, app, `{"text": "not counted", "source_lang": "EN", "target_lang": "DE"}`); body["code"] == float64(200) {
+		t.Fatal("the failing upstream translated")
+	}
+	if used := characterCaps.project("", 0)[0].Used; used != len("counted") {
+		t.Errorf("%d characters counted, want %d", used, len("counted"))
+	}
+}
+
+// TestQuotaWarning checks the X-Quota-Warning header, the webhook fired once
+// when the threshold is crossed and the 456 past the cap.
+func TestQuotaWarning(t *testing.T) {
+	warnings := make(chan struct{}, 10)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		warnings <- struct{}{}
+	}))
+	t.Cleanup(webhook.Close)
+	withCharacterCaps(t)
+	withConfig(t, func(c *Config) {
+		c.DailyCharacterCap = 10
+		c.QuotaWarning = 80
+		c.QuotaWarningWebhook = webhook.URL
+	})
+	withUpstream(t, mockUpstream(0))
+	app := fiber.New(fiber.Config{JSONEncoder: jsonMarshal, JSONDecoder: jsonUnmarshal})
+	app.Post("/translate", warnQuota, handleTranslate)
+
+	for _, test := range []struct {
+		text    string
+		code    float64
+		warning string
+		webhook bool
+	}{
+		{"abcd", 200, "", false},
+		{"efgh", 200, "80%", true},
+		{"ij", 200, "100%", false},
+		{"k", 456, "100%", false},
+	} {
+		response, body := postTranslate(t, app, `{"text": "`+test.text+`", "source_lang": "EN", "target_lang": "DE"}`)
+		if body["code"] != test.code {
+			t.Errorf("%q: code %v, want %v", test.text, body["code"], test.code)
+		}
+		if warning := response.Header.Get("X-Quota-Warning"); warning != test.warning {
+			t.Errorf("%q: X-Quota-Warning %q, want %q", test.text, warning, test.warning)
+		}
+		wait := 100 * time.Millisecond
+		if test.webhook {
+			wait = 5 * time.Second
+		}
+		select {
+		case <-warnings:
+			if !test.webhook {
+				t.Errorf("%q: the webhook was posted to again", test.text)
+			}
+		case <-time.After(wait):
+			if test.webhook {
+				t.Errorf("%q: the webhook wasn't posted to", test.text)
+			}
+		}
+	}
+}
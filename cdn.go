@@ -0,0 +1,49 @@
+package main
+
+import (
+	"github.com/gofiber/fiber/v2"
+)
+
+// translateQueryParams reads the options of a GET /translate request from
+// its query string, which CDNs use as the cache key. tts is left out, as
+// cached audio URLs would outlive TTS_TTL.
+func translateQueryParams(c *fiber.Ctx) TranslateParams {
+	return TranslateParams{
+		Text:               c.Query("text", c.Query("q")),
+		SourceLang:         c.Query("source_lang"),
+		TargetLang:         c.Query("target_lang"),
+		Sentences:          c.QueryBool("sentences"),
+		Confidence:         c.QueryBool("confidence"),
+		PreserveWhitespace: c.QueryBool("preserve_whitespace"),
+		HTMLEntities:       c.Query("html_entities"),
+		Engine:             c.Query("engine"),
+		MaxAlternatives:    c.QueryInt("max_alternatives"),
+		RankAlternatives:   c.Query("rank_alternatives"),
+		Romanize:           c.QueryBool("romanize"),
+		Formality:          c.Query("formality"),
+		RegionalVariant:    c.Query("regional_variant"),
+		WasSpoken:          c.QueryBool("was_spoken"),
+		AdvancedMode:       c.QueryBool("advanced_mode"),
+	}
+}
+
+// setCacheHeaders lets CDNs and browsers cache the answer to a GET
+// /translate request for CACHE_CONTROL. Failures are never cached, and
+// neither are the answers to keyed callers, which may depend on their key
+// defaults, in shared caches.
+func setCacheHeaders(c *fiber.Ctx, params TranslateParams, code int) {
+	control := cfg().CacheControl
+	if control == "" {
+		return
+	}
+	switch {
+	case code != 200:
+		control = "no-store"
+	case params.usageKey != usageAnonymous:
+		control = "private"
+	}
+	c.Set(fiber.HeaderCacheControl, control)
+	if vary := cfg().CacheVary; vary != "" {
+		c.Set(fiber.HeaderVary, vary)
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// chaosEnabled reports whether any CHAOS_* setting injects faults.
+func chaosEnabled() bool {
+	config := cfg()
+	return config.ChaosDelayRate > 0 || config.Chaos429Rate > 0 || config.ChaosMalformedRate > 0
+}
+
+// injectFault delays an upstream call and fails it at the rates set by the
+// CHAOS_* settings. It returns the reply to use instead of calling the
+// upstream when it fails the call.
+func injectFault(ctx context.Context, reply upstreamReply) (upstreamReply, bool) {
+	config := cfg()
+	if config.ChaosDelayRate > 0 && rand.Float64() < config.ChaosDelayRate {
+		select {
+		case <-time.After(time.Duration(rand.Int63n(int64(config.ChaosDelay) + 1))):
+		case <-ctx.Done():
+			reply.Err = ctx.Err()
+			return reply, true
+		}
+	}
+
+	switch r := rand.Float64(); {
+	case r < config.Chaos429Rate:
+		reply.Status = http.StatusTooManyRequests
+		return reply, true
+	case r < config.Chaos429Rate+config.ChaosMalformedRate:
+		// A response cut off halfway, as from a dropped connection.
+		reply.Status = http.StatusOK
+		reply.Body = []byte(`{"jsonrpc":"2.0","result":{"texts":[{"text":`)
+		return reply, true
+	}
+	return reply, false
+}
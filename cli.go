@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2/utils"
+)
+
+// cliCommand is a subcommand of the binary. Without a subcommand, the
+// binary runs the server.
+type cliCommand struct {
+	Summary string
+
+	// Args are the values completed for the first argument.
+	Args []string
+
+	// Setup declares the flags of the command and returns the function
+	// running it once they are parsed. Completions are generated from the
+	// flags.
+	Setup func() (*flag.FlagSet, func() error)
+}
+
+var cliCommands map[string]cliCommand
+
+func init() {
+	// Assigned in init because the help and completion commands refer to
+	// the map.
+	cliCommands = map[string]cliCommand{
+		"serve":         {Summary: "Run the translation server (the default)", Setup: serveCommand},
+		"translate":     {Summary: "Translate arguments, or standard input line by line", Setup: translateCommand},
+		"tui":           {Summary: "Interactive terminal translator", Setup: tuiCommand},
+		"clip":          {Summary: "Translate text copied to the clipboard", Setup: clipCommand},
+		"repl":          {Summary: "Translate line by line in an interactive prompt", Setup: replCommand},
+		"bench":         {Summary: "Load test a server and report latency percentiles", Setup: benchCommand},
+		"mock":          {Summary: "Serve a mock DeepL endpoint for load tests", Setup: mockCommand},
+		"replay":        {Summary: "Serve upstream calls recorded with UPSTREAM_RECORD_DIR", Setup: replayCommand},
+		"config":        {Summary: "Check a config file, or print a default one", Args: []string{"check", "init"}, Setup: configCommand},
+		"doctor":        {Summary: "Check the configuration, upstreams, TLS and clock", Setup: doctorCommand},
+		"git-translate": {Summary: "Translate what changed in Markdown and PO files between two commits", Setup: gitTranslateCommand},
+		"sync":          {Summary: "Translate the changed pages of a Hugo or Jekyll site", Setup: syncCommand},
+		"completion":    {Summary: "Print a bash, zsh or fish completion script", Args: completionShells, Setup: completionCommand},
+		"help":          {Summary: "Show this help", Setup: helpCommand},
+	}
+	maps.Copy(cliCommands, platformCommands())
+}
+
+func runCommand(name string, args []string) {
+	command, ok := cliCommands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", name)
+		printHelp()
+		os.Exit(2)
+	}
+
+	flags, run := command.Setup()
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return
+		}
+		os.Exit(2)
+	}
+	if err := run(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// commandNames returns the names of the commands in alphabetical order.
+func commandNames() []string {
+	names := make([]string, 0, len(cliCommands))
+	for name := range cliCommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func serveCommand() (*flag.FlagSet, func() error) {
+	return flag.NewFlagSet("serve", flag.ContinueOnError), func() error {
+		serve()
+		return nil
+	}
+}
+
+func helpCommand() (*flag.FlagSet, func() error) {
+	return flag.NewFlagSet("help", flag.ContinueOnError), func() error {
+		printHelp()
+		return nil
+	}
+}
+
+func printHelp() {
+	fmt.Fprintln(os.Stderr, "Usage: deeplx [command] [flags]")
+	fmt.Fprintln(os.Stderr, "\nCommands:")
+	for _, name := range commandNames() {
+		fmt.Fprintf(os.Stderr, "  %-14s %s\n", name, cliCommands[name].Summary)
+	}
+	fmt.Fprintln(os.Stderr, "\nRun deeplx <command> -h for the flags of a command.")
+}
+
+func translateCommand() (*flag.FlagSet, func() error) {
+	flags := flag.NewFlagSet("translate", flag.ContinueOnError)
+	client := clientFlags(flags)
+	output := outputFlags(flags)
+	source := flags.String("source", "", "source language (detected by default)")
+	target := flags.String("target", "EN-US", "target language")
+
+	return flags, func() error {
+		params := TranslateParams{SourceLang: strings.ToUpper(*source), TargetLang: strings.ToUpper(*target)}
+		if flags.NArg() > 0 {
+			params.Text = strings.Join(flags.Args(), " ")
+			result, err := client.translate(params)
+			if err != nil {
+				return err
+			}
+			return output.print(params.Text, result)
+		}
+
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			params.Text = scanner.Text()
+			if strings.TrimSpace(params.Text) == "" {
+				continue
+			}
+			result, err := client.translate(params)
+			if err != nil {
+				return err
+			}
+			if err := output.print(params.Text, result); err != nil {
+				return err
+			}
+		}
+		return scanner.Err()
+	}
+}
+
+// cliOutput prints translations as plain text, JSON Lines or TSV.
+type cliOutput struct {
+	json, tsv bool
+}
+
+func outputFlags(flags *flag.FlagSet) *cliOutput {
+	output := &cliOutput{}
+	flags.BoolVar(&output.json, "json", false, "print each result as a JSON object on its own line")
+	flags.BoolVar(&output.tsv, "tsv", false, "print each result as source, source language, target language and translation separated by tabs")
+	return output
+}
+
+// machine reports whether results are printed for scripts.
+func (o *cliOutput) machine() bool {
+	return o.json || o.tsv
+}
+
+var tsvEscaper = strings.NewReplacer("\\", "\\\\", "\t", "\\t", "\n", "\\n", "\r", "\\r")
+
+func (o *cliOutput) print(source string, result TranslateResponse) error {
+	switch {
+	case o.json:
+		return json.NewEncoder(os.Stdout).Encode(struct {
+			Source string `json:"source"`
+			TranslateResponse
+		}{source, result})
+	case o.tsv:
+		_, err := fmt.Println(strings.Join([]string{
+			tsvEscaper.Replace(source),
+			result.SourceLang,
+			result.TargetLang,
+			tsvEscaper.Replace(result.Data),
+		}, "\t"))
+		return err
+	default:
+		_, err := fmt.Println(result.Data)
+		return err
+	}
+}
+
+// cliClient talks to a running server.
+type cliClient struct {
+	server     string
+	token      string
+	signingKey string
+	http       *http.Client
+}
+
+// clientFlags registers the flags shared by the commands talking to a
+// server. The server URL, token and signing key default to DEEPLX_URL,
+// DEEPLX_TOKEN and DEEPLX_SIGNING_KEY (or their _FILE variants).
+func clientFlags(flags *flag.FlagSet) *cliClient {
+	client := &cliClient{http: &http.Client{Timeout: 30 * time.Second}}
+	flags.StringVar(&client.server, "server", getEnv("DEEPLX_URL", "http://localhost:8080"), "URL of the DeepLX server")
+	flags.StringVar(&client.token, "token", getSecret("DEEPLX_TOKEN"), "API token sent as a bearer token")
+	flags.StringVar(&client.signingKey, "signing-key", getSecret("DEEPLX_SIGNING_KEY"), "id:secret pair requests are signed with")
+	return client
+}
+
+// post sends a request to the server, with the token and signature the
+// server expects.
+func (c *cliClient) post(path, contentType string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodPost, strings.TrimRight(c.server, "/")+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	if id, secret, ok := strings.Cut(c.signingKey, ":"); ok {
+		timestamp, nonce := time.Now().Unix(), utils.UUIDv4()
+		req.Header.Set(HeaderSigningKey, id)
+		req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+		req.Header.Set(HeaderNonce, nonce)
+		req.Header.Set(HeaderSignature, requestSignature(secret, timestamp, nonce, req.Method, req.URL.RequestURI(), body))
+	}
+	return c.http.Do(req)
+}
+
+func (c *cliClient) translate(params TranslateParams) (TranslateResponse, error) {
+	var result TranslateResponse
+	body, err := json.Marshal(params)
+	if err != nil {
+		return result, err
+	}
+
+	resp, err := c.post("/translate", "application/json", body)
+	if err != nil {
+		return result, err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return result, fmt.Errorf("unexpected response (HTTP %d): %w", resp.StatusCode, err)
+	}
+	if result.Code != 200 {
+		return result, fmt.Errorf("%d: %s", result.Code, result.Message)
+	}
+	return result, nil
+}
+
+// translateDocument translates a file with POST /document and returns the
+// translated file.
+func (c *cliClient) translateDocument(filename string, data []byte, format string, params TranslateParams) ([]byte, error) {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for name, value := range map[string]string{"format": format, "source_lang": params.SourceLang, "target_lang": params.TargetLang} {
+		if value != "" {
+			form.WriteField(name, value)
+		}
+	}
+	part, err := form.CreateFormFile("file", filename)
+	if err != nil {
+		return nil, err
+	}
+	part.Write(data)
+	if err := form.Close(); err != nil {
+		return nil, err
+	}
+
+	resp, err := c.post("/document", form.FormDataContentType(), body.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	translated, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var failure TranslateResponse
+		if err := json.Unmarshal(translated, &failure); err != nil || failure.Message == "" {
+			return nil, fmt.Errorf("unexpected response (HTTP %d)", resp.StatusCode)
+		}
+		return nil, fmt.Errorf("%d: %s", failure.Code, failure.Message)
+	}
+	return translated, nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/atotto/clipboard"
+)
+
+// clipCacheSize caps the translations the clipboard watcher remembers.
+const clipCacheSize = 256
+
+func clipCommand() (*flag.FlagSet, func() error) {
+	flags := flag.NewFlagSet("clip", flag.ContinueOnError)
+	client := clientFlags(flags)
+	output := outputFlags(flags)
+	source := flags.String("source", "", "source language (detected by default)")
+	target := flags.String("target", "EN-US", "target language")
+	replace := flags.Bool("replace", false, "replace the clipboard with the translation")
+	interval := flags.Duration("interval", 500*time.Millisecond, "how often the clipboard is checked")
+	debounce := flags.Duration("debounce", 700*time.Millisecond, "how long copied text must stay unchanged before it is translated")
+	maxLength := flags.Int("max-length", 5000, "ignore copied text longer than this many characters")
+
+	return flags, func() error {
+		if clipboard.Unsupported {
+			return errors.New("no clipboard available (on Linux, install xclip, xsel or wl-clipboard)")
+		}
+
+		params := TranslateParams{SourceLang: *source, TargetLang: strings.ToUpper(*target)}
+		cache := make(map[string]TranslateResponse)
+		stop := make(chan os.Signal, 1)
+		signal.Notify(stop, os.Interrupt)
+
+		// The current clipboard is not translated, only what is copied later.
+		last, _ := clipboard.ReadAll()
+		var pending string
+		var changedAt time.Time
+
+		fmt.Fprintf(os.Stderr, "Watching the clipboard, translating to %s. Press Ctrl+C to stop.\n", params.TargetLang)
+		ticker := time.NewTicker(*interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return nil
+			case <-ticker.C:
+			}
+
+			text, err := clipboard.ReadAll()
+			if err != nil {
+				return err
+			}
+			if text != pending {
+				pending, changedAt = text, time.Now()
+				continue
+			}
+			if text == last || time.Since(changedAt) < *debounce {
+				continue
+			}
+			last = text
+			if strings.TrimSpace(text) == "" || len([]rune(text)) > *maxLength {
+				continue
+			}
+
+			result, ok := cache[text]
+			if !ok {
+				params.Text = text
+				var err error
+				result, err = client.translate(params)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+					continue
+				}
+				if len(cache) >= clipCacheSize {
+					clear(cache)
+				}
+				cache[text] = result
+			}
+
+			if err := output.print(text, result); err != nil {
+				return err
+			}
+			if !output.machine() {
+				fmt.Println()
+			}
+			if *replace {
+				if err := clipboard.WriteAll(result.Data); err != nil {
+					return err
+				}
+				// Don't translate our own translation again.
+				last, pending = result.Data, result.Data
+			}
+		}
+	}
+}
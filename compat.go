@@ -0,0 +1,125 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Compatibility modes tune the server for a specific client.
+const (
+	CompatImmersive = "immersive"
+)
+
+// Response schemas of /translate.
+const (
+	CompatLegacy = "legacy"
+	CompatStrict = "strict"
+)
+
+// ImmersiveBatchWindow is the micro-batching window used by default in
+// immersive-translate mode, which sends bursts of short paragraphs.
+const ImmersiveBatchWindow = 20 * time.Millisecond
+
+const projectInfo = "Developed by StardustAlN. More info: https://github.com/StardustAlN/DeepLX-Go"
+
+// immersiveLanguages maps the language codes immersive-translate sends to
+// the ones DeepL expects as source languages, where it only knows the base
+// language.
+var immersiveLanguages = map[string]string{
+	"AUTO":    "",
+	"ZH-CN":   "ZH",
+	"ZH-HANS": "ZH",
+	"ZH-TW":   "ZH",
+	"ZH-HK":   "ZH",
+	"ZH-HANT": "ZH",
+	"NO":      "NB",
+}
+
+// immersiveTargetLanguages overrides immersiveLanguages for target
+// languages, for which DeepL tells traditional Chinese and the Portuguese
+// variants apart.
+var immersiveTargetLanguages = map[string]string{
+	"ZH-TW":   "ZH-HANT",
+	"ZH-HK":   "ZH-HANT",
+	"ZH-HANT": "ZH-HANT",
+	"PT":      "PT-PT",
+}
+
+func normalizeImmersiveLang(lang string, target bool) string {
+	lang = strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(lang), "_", "-"))
+	if mapped, ok := immersiveTargetLanguages[lang]; ok && target {
+		return mapped
+	}
+	if mapped, ok := immersiveLanguages[lang]; ok {
+		return mapped
+	}
+	return lang
+}
+
+// applyCompatMode adapts a request to the client the server is tuned for.
+func applyCompatMode(params *TranslateParams) {
+	if cfg().CompatMode != CompatImmersive {
+		return
+	}
+	params.SourceLang = normalizeImmersiveLang(params.SourceLang, false)
+	params.TargetLang = normalizeImmersiveLang(params.TargetLang, true)
+}
+
+// legacyTranslateResponse is a successful /translate response of the
+// original DeepLX project, which always carries alternatives.
+type legacyTranslateResponse struct {
+	Code         int      `json:"code"`
+	ID           int64    `json:"id"`
+	Data         string   `json:"data"`
+	Alternatives []string `json:"alternatives"`
+	SourceLang   string   `json:"source_lang"`
+	TargetLang   string   `json:"target_lang"`
+	Method       string   `json:"method"`
+}
+
+// legacyResponse reduces a /translate response to the fields of the
+// original DeepLX project: these on success, code and message otherwise.
+func legacyResponse(result TranslateResponse) any {
+	if result.Code != 200 {
+		return fiber.Map{"code": result.Code, "message": result.Message}
+	}
+	alternatives := result.Alternatives
+	if alternatives == nil {
+		alternatives = []string{}
+	}
+	return legacyTranslateResponse{
+		Code:         result.Code,
+		ID:           result.ID,
+		Data:         result.Data,
+		Alternatives: alternatives,
+		SourceLang:   result.SourceLang,
+		TargetLang:   result.TargetLang,
+		Method:       result.Method,
+	}
+}
+
+// handleRoot describes the server. In immersive-translate mode it also
+// returns the settings to enter in the extension's DeepLX service.
+func handleRoot(c *fiber.Ctx) error {
+	if cfg().CompatMode != CompatImmersive {
+		return c.SendString(projectInfo)
+	}
+
+	requestsPerSecond := 10
+	if cfg().RateLimit > 0 {
+		requestsPerSecond = max(1, int(float64(cfg().RateLimit)/cfg().RateLimitWindow.Seconds()))
+	}
+	return c.JSON(fiber.Map{
+		"message":     projectInfo,
+		"compat_mode": cfg().CompatMode,
+		"immersive_translate": fiber.Map{
+			"service":                     "DeepLX",
+			"api_url":                     c.BaseURL() + "/translate",
+			"max_requests_per_second":     requestsPerSecond,
+			"max_text_length_per_request": 1000,
+			"max_paragraphs_per_request":  1,
+		},
+	})
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// withConfig runs a test with a changed copy of the current config.
+func withConfig(t testing.TB, change func(*Config)) {
+	t.Helper()
+	previous := cfg()
+	next := *previous
+	change(&next)
+	currentConfig.Store(&next)
+	t.Cleanup(func() { currentConfig.Store(previous) })
+}
+
+// withUpstream points the upstream pool at handler for the length of a test.
+func withUpstream(t testing.TB, handler http.Handler) {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	previous := upstreams
+	upstreams = mustUpstreamPool([]string{server.URL}, nil)
+	t.Cleanup(func() {
+		upstreams = previous
+		server.Close()
+	})
+}
+
+// newCompatApp serves /translate the way serve does.
+func newCompatApp() *fiber.App {
+	app := fiber.New(fiber.Config{JSONEncoder: jsonMarshal, JSONDecoder: jsonUnmarshal})
+	currentLimiter.Store(newRateLimiter())
+	app.Post("/translate", rateLimit, handleTranslate)
+	return app
+}
+
+func postTranslate(t *testing.T, app *fiber.App, body string) (*http.Response, map[string]any) {
+	t.Helper()
+	request := httptest.NewRequest(http.MethodPost, "/translate", strings.NewReader(body))
+	request.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	response, err := app.Test(request, -1)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	data, err := io.ReadAll(response.Body)
+	if err != nil {
+		t.Fatalf("reading response: %v", err)
+	}
+	var decoded map[string]any
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("response %q is not JSON: %v", data, err)
+	}
+	return response, decoded
+}
+
+// TestClientCompatibility checks the request and response shapes Bob and
+// Easydict rely on with their DeepLX service type.
+func TestClientCompatibility(t *testing.T) {
+	tooManyRequests := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "too many requests", http.StatusTooManyRequests)
+	})
+
+	tests := []struct {
+		name       string
+		body       string
+		upstream   http.Handler
+		status     int
+		fields     map[string]any
+		retryAfter string
+	}{
+		{
+			name:     "echoes the request id",
+			body:     `{"id": 8300001, "text": "echo id", "source_lang": "EN", "target_lang": "DE"}`,
+			upstream: mockUpstream(0),
+			status:   200,
+			fields: map[string]any{
+				"code":        float64(200),
+				"id":          float64(8300001),
+				"data":        "[DE] echo id",
+				"source_lang": "EN",
+				"target_lang": "DE",
+				"method":      MethodFree,
+			},
+		},
+		{
+			name:     "accepts auto source",
+			body:     `{"text": "auto source", "source_lang": "auto", "target_lang": "ZH"}`,
+			upstream: mockUpstream(0),
+			status:   200,
+			fields:   map[string]any{"code": float64(200), "data": "[ZH] auto source", "source_lang": "EN"},
+		},
+		{
+			name:     "accepts a missing source",
+			body:     `{"text": "no source", "target_lang": "JA"}`,
+			upstream: mockUpstream(0),
+			status:   200,
+			fields:   map[string]any{"code": float64(200), "data": "[JA] no source", "target_lang": "JA"},
+		},
+		{
+			name:     "rejects an invalid body",
+			body:     `{"text": `,
+			upstream: mockUpstream(0),
+			status:   400,
+			fields:   map[string]any{"code": float64(400)},
+		},
+		{
+			name:     "reports empty text as not found",
+			body:     `{"text": "", "target_lang": "DE"}`,
+			upstream: mockUpstream(0),
+			status:   404,
+			fields:   map[string]any{"code": float64(404)},
+		},
+		{
+			name:       "passes on DeepL's 429",
+			body:       `{"id": 8300002, "text": "blocked", "source_lang": "EN", "target_lang": "DE"}`,
+			upstream:   tooManyRequests,
+			status:     429,
+			fields:     map[string]any{"code": float64(429), "id": float64(8300002), "message": TooManyRequestsMessage},
+			retryAfter: "60",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			withConfig(t, func(c *Config) {
+				c.CacheTTL = 0
+				c.UpstreamCooldown = time.Minute
+			})
+			withUpstream(t, test.upstream)
+
+			response, body := postTranslate(t, newCompatApp(), test.body)
+			if response.StatusCode != test.status {
+				t.Fatalf("status = %d, want %d (body %v)", response.StatusCode, test.status, body)
+			}
+			for field, want := range test.fields {
+				if body[field] != want {
+					t.Errorf("%s = %v, want %v", field, body[field], want)
+				}
+			}
+			if id, _ := body["id"].(float64); id == 0 && test.status != 400 {
+				t.Errorf("id is missing")
+			}
+			if got := response.Header.Get(fiber.HeaderRetryAfter); got != test.retryAfter {
+				t.Errorf("Retry-After = %q, want %q", got, test.retryAfter)
+			}
+		})
+	}
+}
+
+// TestClientRateLimit checks that callers over RATE_LIMIT get a 429 in the
+// DeepLX response shape.
+func TestClientRateLimit(t *testing.T) {
+	withConfig(t, func(c *Config) {
+		c.CacheTTL = 0
+		c.RateLimit = 1
+		c.RateLimitWindow = time.Minute
+	})
+	withUpstream(t, mockUpstream(0))
+	app := newCompatApp()
+
+	body := `{"text": "limited", "target_lang": "DE"}`
+	if response, _ := postTranslate(t, app, body); response.StatusCode != 200 {
+		t.Fatalf("first request: status = %d, want 200", response.StatusCode)
+	}
+	response, decoded := postTranslate(t, app, body)
+	if response.StatusCode != 429 || decoded["code"] != float64(429) {
+		t.Fatalf("second request: status = %d, code = %v, want 429", response.StatusCode, decoded["code"])
+	}
+}
+
+// TestLegacySchema checks that COMPAT=legacy answers with exactly the fields
+// of the original DeepLX project.
+func TestLegacySchema(t *testing.T) {
+	withConfig(t, func(c *Config) {
+		c.CacheTTL = 0
+		c.Compat = CompatLegacy
+	})
+	withUpstream(t, mockUpstream(0))
+	app := newCompatApp()
+
+	tests := []struct {
+		body   string
+		status int
+		fields []string
+	}{
+		{`{"text": "legacy", "target_lang": "DE"}`, 200, []string{"code", "id", "data", "alternatives", "source_lang", "target_lang", "method"}},
+		{`{"text": "", "target_lang": "DE"}`, 404, []string{"code", "message"}},
+		{`{"text": `, 400, []string{"code", "message"}},
+	}
+	for _, test := range tests {
+		response, body := postTranslate(t, app, test.body)
+		if response.StatusCode != test.status {
+			t.Fatalf("%s: status = %d, want %d", test.body, response.StatusCode, test.status)
+		}
+		if len(body) != len(test.fields) {
+			t.Errorf("%s: fields %v, want %v", test.body, body, test.fields)
+		}
+		for _, field := range test.fields {
+			if _, ok := body[field]; !ok {
+				t.Errorf("%s: %s is missing from %v", test.body, field, body)
+			}
+		}
+	}
+	if _, body := postTranslate(t, app, tests[0].body); body["alternatives"] == nil {
+		t.Error("alternatives are null, want an empty array")
+	}
+}
+
+func TestNormalizeImmersiveLang(t *testing.T) {
+	tests := []struct {
+		lang   string
+		target bool
+		want   string
+	}{
+		{"auto", false, ""},
+		{"zh-CN", false, "ZH"},
+		{"zh-CN", true, "ZH"},
+		{"zh_TW", false, "ZH"},
+		{"zh-TW", true, "ZH-HANT"},
+		{"zh-HK", true, "ZH-HANT"},
+		{"zh-Hant", true, "ZH-HANT"},
+		{"pt", false, "PT"},
+		{"pt", true, "PT-PT"},
+		{"pt-BR", true, "PT-BR"},
+		{"no", true, "NB"},
+		{" de ", true, "DE"},
+	}
+	for _, test := range tests {
+		if got := normalizeImmersiveLang(test.lang, test.target); got != test.want {
+			t.Errorf("normalizeImmersiveLang(%q, %v) = %q, want %q", test.lang, test.target, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// completionShells are the shells completion scripts are generated for.
+var completionShells = []string{"bash", "zsh", "fish"}
+
+func completionCommand() (*flag.FlagSet, func() error) {
+	flags := flag.NewFlagSet("completion", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: deeplx completion bash|zsh|fish")
+	}
+
+	return flags, func() error {
+		switch shell := flags.Arg(0); shell {
+		case "bash":
+			writeBashCompletion(os.Stdout)
+		case "zsh":
+			writeZshCompletion(os.Stdout)
+		case "fish":
+			writeFishCompletion(os.Stdout)
+		default:
+			return fmt.Errorf("unknown shell %q, expected one of %s", shell, strings.Join(completionShells, ", "))
+		}
+		return nil
+	}
+}
+
+// commandFlags lists the flags of a command in alphabetical order.
+func commandFlags(name string) []*flag.Flag {
+	flags, _ := cliCommands[name].Setup()
+	var list []*flag.Flag
+	flags.VisitAll(func(f *flag.Flag) {
+		list = append(list, f)
+	})
+	return list
+}
+
+// isBoolFlag reports whether a flag is given without a value.
+func isBoolFlag(f *flag.Flag) bool {
+	value, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && value.IsBoolFlag()
+}
+
+func writeBashCompletion(w io.Writer) {
+	fmt.Fprintln(w, "# bash completion for deeplx")
+	fmt.Fprintln(w, "_deeplx() {")
+	fmt.Fprintln(w, `	local cur="${COMP_WORDS[COMP_CWORD]}"`)
+	fmt.Fprintln(w, `	if [ "$COMP_CWORD" -eq 1 ]; then`)
+	fmt.Fprintf(w, "\t\tCOMPREPLY=($(compgen -W %q -- \"$cur\"))\n", strings.Join(commandNames(), " "))
+	fmt.Fprintln(w, "\t\treturn")
+	fmt.Fprintln(w, "\tfi")
+	fmt.Fprintln(w, `	case "${COMP_WORDS[1]}" in`)
+	for _, name := range commandNames() {
+		words := cliCommands[name].Args
+		for _, f := range commandFlags(name) {
+			words = append(words, "--"+f.Name)
+		}
+		if len(words) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "\t%s)\n", name)
+		fmt.Fprintf(w, "\t\tCOMPREPLY=($(compgen -W %q -- \"$cur\"))\n", strings.Join(words, " "))
+		fmt.Fprintln(w, "\t\t;;")
+	}
+	fmt.Fprintln(w, "\tesac")
+	fmt.Fprintln(w, "}")
+	fmt.Fprintln(w, "complete -F _deeplx deeplx")
+}
+
+// zshEscaper escapes the characters special in _arguments and _describe
+// specs, and the single quotes the specs are wrapped in.
+var zshEscaper = strings.NewReplacer(`[`, `\[`, `]`, `\]`, `:`, `\:`, `'`, `'\''`)
+
+func writeZshCompletion(w io.Writer) {
+	fmt.Fprintln(w, "#compdef deeplx")
+	fmt.Fprintln(w, "_deeplx() {")
+	fmt.Fprintln(w, "\tlocal -a commands")
+	fmt.Fprintln(w, "\tcommands=(")
+	for _, name := range commandNames() {
+		fmt.Fprintf(w, "\t\t'%s:%s'\n", name, zshEscaper.Replace(cliCommands[name].Summary))
+	}
+	fmt.Fprintln(w, "\t)")
+	fmt.Fprintln(w, "\tif (( CURRENT == 2 )); then")
+	fmt.Fprintln(w, "\t\t_describe 'command' commands")
+	fmt.Fprintln(w, "\t\treturn")
+	fmt.Fprintln(w, "\tfi")
+	fmt.Fprintln(w, "\tshift words")
+	fmt.Fprintln(w, "\t(( CURRENT-- ))")
+	fmt.Fprintln(w, "\tcase $words[1] in")
+	for _, name := range commandNames() {
+		fmt.Fprintf(w, "\t%s)\n", name)
+		fmt.Fprint(w, "\t\t_arguments")
+		for _, f := range commandFlags(name) {
+			spec := "--" + f.Name + "[" + zshEscaper.Replace(f.Usage) + "]"
+			if !isBoolFlag(f) {
+				spec += ":" + f.Name + ":"
+			}
+			fmt.Fprintf(w, " \\\n\t\t\t'%s'", spec)
+		}
+		if args := cliCommands[name].Args; len(args) > 0 {
+			fmt.Fprintf(w, " \\\n\t\t\t'1:argument:(%s)'", strings.Join(args, " "))
+		}
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "\t\t;;")
+	}
+	fmt.Fprintln(w, "\tesac")
+	fmt.Fprintln(w, "}")
+	fmt.Fprintln(w, `_deeplx "$@"`)
+}
+
+// fishQuote quotes a string for fish.
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
+
+func writeFishCompletion(w io.Writer) {
+	fmt.Fprintln(w, "# fish completion for deeplx")
+	fmt.Fprintln(w, "complete -c deeplx -f")
+	for _, name := range commandNames() {
+		fmt.Fprintf(w, "complete -c deeplx -n __fish_use_subcommand -a %s -d %s\n", name, fishQuote(cliCommands[name].Summary))
+	}
+	for _, name := range commandNames() {
+		condition := fishQuote("__fish_seen_subcommand_from " + name)
+		if args := cliCommands[name].Args; len(args) > 0 {
+			fmt.Fprintf(w, "complete -c deeplx -n %s -a %s\n", condition, fishQuote(strings.Join(args, " ")))
+		}
+		for _, f := range commandFlags(name) {
+			fmt.Fprintf(w, "complete -c deeplx -n %s -l %s -d %s", condition, f.Name, fishQuote(f.Usage))
+			if !isBoolFlag(f) {
+				fmt.Fprint(w, " -r")
+			}
+			fmt.Fprintln(w)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"math"
+	"unicode/utf8"
+)
+
+// scoreConfidence estimates how reliable a translation is. The upstream does
+// not expose quality signals, so the score is a heuristic combining how much
+// the alternatives agree with the main translation and whether the output
+// length is plausible for the input.
+func scoreConfidence(source, translation string, alternatives []string) float64 {
+	if translation == "" {
+		return 0
+	}
+
+	agreement := 0.5
+	if len(alternatives) > 0 {
+		total := 0.0
+		for _, alt := range alternatives {
+			total += similarity(translation, alt)
+		}
+		agreement = total / float64(len(alternatives))
+	}
+
+	lengthScore := 1.0
+	sourceLen := utf8.RuneCountInString(source)
+	if sourceLen > 0 {
+		ratio := float64(utf8.RuneCountInString(translation)) / float64(sourceLen)
+		switch {
+		case ratio < 0.2 || ratio > 5:
+			lengthScore = 0.2
+		case ratio < 0.4 || ratio > 2.5:
+			lengthScore = 0.6
+		}
+	}
+
+	score := 0.7*agreement + 0.3*lengthScore
+	return math.Round(score*100) / 100
+}
+
+// addConfidence fills in the confidence score of the response and of each of
+// its sentences.
+func addConfidence(source string, response *TranslateResponse) {
+	score := scoreConfidence(source, response.Data, response.Alternatives)
+	response.Confidence = &score
+	for i := range response.Sentences {
+		item := &response.Sentences[i]
+		score := scoreConfidence(item.Source, item.Text, item.Alternatives)
+		item.Confidence = &score
+	}
+}
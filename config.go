@@ -0,0 +1,767 @@
+package main
+
+import (
+	"log"
+	"math"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Config holds the runtime settings of the server. All values are read from
+// environment variables, from SECRETS_URL or from the config file named by
+// CONFIG_FILE, so the binary can be configured without flags.
+type Config struct {
+	// Endpoints are the DeepL JSON-RPC endpoints requests are spread over.
+	Endpoints []string
+
+	// Proxies are HTTP(S) or SOCKS5 proxy URLs. Every endpoint is reached
+	// through every proxy, and each combination is balanced separately.
+	Proxies []string
+
+	// HedgeDelay enables hedged requests: when an endpoint has not answered
+	// within this delay, the request is also sent to the next endpoint.
+	HedgeDelay time.Duration
+
+	// UpstreamRecordDir is the directory every upstream call is saved to,
+	// for replay with deeplx replay. Empty disables recording.
+	UpstreamRecordDir string
+
+	// StickySessions keeps each client on one endpoint and proxy, which
+	// keeps its cookies and numbers its requests in sequence.
+	StickySessions bool
+
+	// TimestampAlgorithm is how request timestamps are derived from the
+	// texts, following the web client version imitated.
+	TimestampAlgorithm string
+
+	// UpstreamFormality, UpstreamVariants and UpstreamAdvanced are the
+	// style options of the web client sent with requests leaving them out.
+	UpstreamFormality string
+	UpstreamVariants  []string
+	UpstreamAdvanced  bool
+
+	// SplitTextThreshold is the length in characters above which texts are
+	// translated sentence by sentence with LMT_split_text and
+	// LMT_handle_jobs. Zero disables it.
+	SplitTextThreshold int
+	// GapMarker replaces the sentences of long texts that failed to
+	// translate, in partial results.
+	GapMarker string
+
+	// QuarantineFailures is the number of consecutive failures after which a
+	// target is taken out of rotation. Zero disables quarantining.
+	QuarantineFailures int
+
+	// ProbeInterval is how often quarantined targets are probed.
+	ProbeInterval time.Duration
+
+	// UpstreamCooldown is how long a target that answered 429 is kept out of
+	// rotation.
+	UpstreamCooldown time.Duration
+
+	// DNSCacheTTL is how long the addresses of endpoints and proxies are
+	// cached. Zero disables the cache.
+	DNSCacheTTL time.Duration
+
+	// DoHURL resolves endpoints and proxies with DNS over HTTPS instead of
+	// the system resolver.
+	DoHURL string
+
+	// SourceAddrs are the local addresses upstream connections are made
+	// from in turn. A prefix stands for a random address of it.
+	SourceAddrs []netip.Prefix
+
+	// Fault injection for testing clients: the share of upstream calls
+	// delayed by up to ChaosDelay, answered with 429 or answered with a
+	// malformed response.
+	ChaosDelay         time.Duration
+	ChaosDelayRate     float64
+	Chaos429Rate       float64
+	ChaosMalformedRate float64
+
+	// BatchWindow enables micro-batching: requests for the same language
+	// pair arriving within the window share one upstream call.
+	BatchWindow time.Duration
+
+	// CompatMode tunes the server for a specific client. "immersive"
+	// accepts immersive-translate's language codes and enables
+	// micro-batching unless BatchWindow is set.
+	CompatMode string
+
+	// Compat picks the /translate response schema: "legacy" mirrors the
+	// original DeepLX project, "strict" is this server's own.
+	Compat string
+
+	// BatchMaxTexts flushes a batch early once it holds this many texts.
+	BatchMaxTexts int
+
+	// JobWorkers is the number of jobs processed at the same time, and
+	// JobConcurrency the number of texts of one job translated in parallel.
+	JobWorkers     int
+	JobConcurrency int
+
+	// JobQueueSize caps the number of jobs waiting for a worker.
+	JobQueueSize int
+
+	// JobTTL is how long finished jobs are kept for fetching their results.
+	JobTTL time.Duration
+
+	// JobsDir enables checkpointing jobs to disk, so unfinished jobs resume
+	// after a restart.
+	JobsDir string
+
+	// S3 settings for jobs reading from or writing to s3:// locations.
+	S3Endpoint  string
+	S3Region    string
+	S3AccessKey string
+	S3SecretKey string
+	S3PathStyle bool
+	// S3AllowedPrefixes are the s3:// locations any caller may use for job
+	// input and output. Other locations need the admin token.
+	S3AllowedPrefixes []string
+
+	// RedisURL enables sharing rate limits and upstream cooldowns between
+	// replicas through Redis.
+	RedisURL string
+
+	// SameLangPassthrough returns the input text untouched when the source
+	// and target language are the same instead of calling the upstream, or
+	// instead of the translation when the upstream detected the source
+	// language to be the target language.
+	SameLangPassthrough bool
+
+	// DuplicateSimilarity is the similarity at which an alternative
+	// counts as a duplicate of the translation or of another alternative.
+	DuplicateSimilarity float64
+	// RomanizeDir holds dictionaries of romanized readings by language.
+	RomanizeDir string
+
+	// QAThreshold is the back-translation similarity below which /qa marks
+	// a translation as suspect.
+	QAThreshold float64
+
+	// AllowedSourceLangs and AllowedTargetLangs restrict the languages
+	// translated from and to. Empty lists allow every language.
+	AllowedSourceLangs []string
+	AllowedTargetLangs []string
+
+	// LookupMaxWords is the number of words /lookup takes at most.
+	LookupMaxWords int
+
+	// TTSURL is a text-to-speech backend translations can be listened
+	// through, called with TTSToken as bearer token. Audio URLs stay valid
+	// for TTSTTL.
+	TTSURL   string
+	TTSToken string
+	TTSTTL   time.Duration
+
+	// AdminToken enables the /admin API when set. Requests must send it as
+	// a bearer token.
+	AdminToken string
+
+	// OIDCIssuer, OIDCClientID, OIDCClientSecret and OIDCRedirectURL let
+	// OIDCAllowedUsers log in to the admin pages through an OpenID Connect
+	// provider, with sessions lasting OIDCSessionTTL.
+	OIDCIssuer       string
+	OIDCClientID     string
+	OIDCClientSecret string
+	OIDCRedirectURL  string
+	OIDCAllowedUsers []string
+	OIDCSessionTTL   time.Duration
+
+	// TermsFile is the JSON file holding the terminology replacement rules.
+	// Changes made through the admin API are written back to it.
+	TermsFile string
+
+	// ProfanityWordlist enables the profanity filter with one word per line.
+	ProfanityWordlist string
+
+	// ProfanityMode is either "mask" to replace listed words with asterisks
+	// or "flag" to only mark the response.
+	ProfanityMode string
+
+	// PreHook and PostHook are commands or webhook URLs the text is passed
+	// through before it is sent upstream and after it is translated.
+	PreHook  string
+	PostHook string
+
+	// HookTimeout bounds each hook call, and HookFailure is "reject" to fail
+	// the request when a hook fails or "skip" to go on with the text
+	// unchanged.
+	HookTimeout time.Duration
+	HookFailure string
+
+	// ScriptsDir holds JavaScript transform scripts, each run for at most
+	// ScriptTimeout.
+	ScriptsDir    string
+	ScriptTimeout time.Duration
+
+	// Engine is the backend used when a request doesn't pick one: "deepl",
+	// "local" or the name of a plugin in PluginsDir. EngineRoutes pick the
+	// engine by language pair instead, the first match winning.
+	Engine       string
+	EngineRoutes []engineRoute
+
+	// AlertWebhook is posted to when the share of failed or rate limited
+	// upstream calls over AlertWindow reaches AlertErrorRate or
+	// Alert429Rate, once there were AlertMinRequests calls, and at most once
+	// per AlertCooldown for each rate. AlertFormat is "slack", "discord" or
+	// "generic", or empty to tell from the URL.
+	AlertWebhook     string
+	AlertFormat      string
+	AlertErrorRate   float64
+	Alert429Rate     float64
+	AlertWindow      time.Duration
+	AlertMinRequests int
+	AlertCooldown    time.Duration
+
+	// SchemaCheckInterval is how often a canary translation checks that the
+	// upstream answer format is still the one parsed. Zero disables it.
+	SchemaCheckInterval time.Duration
+
+	// StatsdAddr enables pushing metrics to a StatsD agent at this UDP
+	// address every StatsdInterval. StatsdFormat is "statsd", which appends
+	// tag values to the metric names, or "dogstatsd", which sends them as
+	// tags along with StatsdTags.
+	StatsdAddr     string
+	StatsdFormat   string
+	StatsdPrefix   string
+	StatsdTags     []string
+	StatsdInterval time.Duration
+
+	// UsageExport is a file or webhook URL the usage by key is exported to
+	// every UsageExportInterval, as UsageExportFormat ("csv" or "json").
+	UsageExport         string
+	UsageExportFormat   string
+	UsageExportInterval time.Duration
+
+	// LocalModelURL is the HTTP endpoint of a local model server, enabling
+	// the "local" engine. LocalModelCodes is "flores" or "deepl", the style
+	// of language codes it expects, and LocalModelFallback retries DeepL
+	// failures with it.
+	LocalModelURL      string
+	LocalModelCodes    string
+	LocalModelTimeout  time.Duration
+	LocalModelFallback bool
+
+	// PluginsDir holds executables run as translation engines, each in
+	// PluginInstances processes answering within PluginTimeout.
+	PluginsDir      string
+	PluginInstances int
+	PluginTimeout   time.Duration
+
+	// NormalizeInput runs the input through sanitizeText before it is sent
+	// upstream.
+	NormalizeInput bool
+
+	// CollapseWhitespace replaces exotic whitespace with plain spaces while
+	// normalizing.
+	CollapseWhitespace bool
+
+	// IdempotencyTTL is how long results are kept for replay by
+	// Idempotency-Key, and IdempotencyMaxKeys how many are kept at most.
+	IdempotencyTTL     time.Duration
+	IdempotencyMaxKeys int
+
+	// CacheTTL enables the in-memory translation cache when positive.
+	CacheTTL time.Duration
+
+	// CacheSize caps the number of cached translations.
+	CacheSize int
+
+	// CacheControl is the Cache-Control header of successful GET /translate
+	// responses, so CDNs can cache them, and CacheVary their Vary header.
+	CacheControl string
+	CacheVary    string
+
+	// WarmFile lists queries, and WarmTop is the number of most requested
+	// queries, translated again every WarmInterval to keep them cached.
+	WarmFile     string
+	WarmTop      int
+	WarmInterval time.Duration
+
+	// RateLimit is the number of translation requests a caller may make per
+	// RateLimitWindow. Zero disables rate limiting.
+	RateLimit       int
+	RateLimitWindow time.Duration
+	// DuplicateLimit is how often a caller may send the same /translate
+	// request per DuplicateWindow before it is answered without calling
+	// the upstream. Zero disables the limit.
+	DuplicateLimit  int
+	DuplicateWindow time.Duration
+	// APITokens are the bearer tokens whose callers get a rate limit budget
+	// of their own; other callers are limited by IP.
+	APITokens []apiToken
+	// KeyDefaultsFile holds the default request options of named tokens
+	// and signing keys.
+	KeyDefaultsFile string
+	// DailyCharacterCap and MonthlyCharacterCap cap the characters sent
+	// upstream by all callers, and KeyDailyCaps and KeyMonthlyCaps those of
+	// single keys by name. Daily caps reset at CapResetTime after midnight
+	// UTC, monthly caps at that time on CapResetDay. Zero disables a cap.
+	DailyCharacterCap   int
+	MonthlyCharacterCap int
+	KeyDailyCaps        map[string]int
+	KeyMonthlyCaps      map[string]int
+	CapResetTime        time.Duration
+	CapResetDay         int
+	// QuotaWarning is the percentage of a cap at which responses carry an
+	// X-Quota-Warning header and QuotaWarningWebhook is posted to, if set.
+	QuotaWarning        int
+	QuotaWarningWebhook string
+	// SigningKeys are the secrets of signed requests by key id, which give
+	// their callers a budget like APITokens, and SigningWindow is how old or
+	// far ahead their timestamp may be.
+	SigningKeys   map[string]string
+	SigningWindow time.Duration
+
+	// TelegramToken enables the Telegram bot, and TelegramTargetLang is the
+	// language it translates to unless a message picks another one.
+	TelegramToken      string
+	TelegramTargetLang string
+
+	// DiscordToken enables the Discord bot, and DiscordTargetLang is the
+	// default language of its /translate command.
+	DiscordToken      string
+	DiscordTargetLang string
+
+	// SlackSigningSecret enables the Slack slash command endpoint, and
+	// SlackResponseType is "ephemeral" or "in_channel".
+	SlackSigningSecret string
+	SlackResponseType  string
+
+	// LogFile and AccessLog are the files the application log and one line
+	// per request are written to. They are rotated once they reach
+	// LogMaxSize bytes, and rotated files are removed after LogMaxAge or
+	// beyond LogMaxBackups files, gzipped when LogCompress is set.
+	// AccessLog may instead be "syslog" or "journald".
+	LogFile       string
+	AccessLog     string
+	LogMaxSize    int
+	LogMaxAge     time.Duration
+	LogMaxBackups int
+	LogCompress   bool
+
+	// LogSampleRate is the share of requests logged with their bodies, and
+	// LogRedactFile holds the rules redacting every log line.
+	LogSampleRate float64
+	LogRedactFile string
+
+	// LogSyslog is the address of a syslog server the application log is
+	// sent to with LogSyslogFacility, and LogJournald sends it to the
+	// journal.
+	LogSyslog         string
+	LogSyslogFacility string
+	LogJournald       bool
+
+	// AuditLog is the file changes made through the admin API and config
+	// reloads are appended to.
+	AuditLog string
+
+	// ShutdownTimeout is how long requests and jobs in flight are each given
+	// to complete when the server stops or hands over to an upgraded process.
+	ShutdownTimeout time.Duration
+
+	// MemoryLimit is the soft memory limit of the runtime, as a size or a
+	// percentage of the container's memory limit, and GCPercent its GC
+	// target percentage.
+	MemoryLimit string
+	GCPercent   int
+
+	// Prefork runs one server process per CPU, sharing the port with
+	// SO_REUSEPORT.
+	Prefork bool
+
+	// BodyLimit caps request bodies in bytes, and Concurrency the number of
+	// connections served at the same time.
+	BodyLimit   int
+	Concurrency int
+
+	// ReadTimeout, WriteTimeout and IdleTimeout bound reading a request,
+	// writing a response and waiting for the next request on a keep-alive
+	// connection. Zero means no timeout; a zero IdleTimeout falls back to
+	// ReadTimeout.
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	IdleTimeout  time.Duration
+}
+
+// currentConfig holds the settings in effect. A reload replaces the Config
+// as a whole, so readers never see a partially updated one.
+var currentConfig = newConfigPointer(loadStartupConfig())
+
+func newConfigPointer(config *Config) *atomic.Pointer[Config] {
+	pointer := &atomic.Pointer[Config]{}
+	pointer.Store(config)
+	return pointer
+}
+
+// cfg returns the settings in effect.
+func cfg() *Config {
+	return currentConfig.Load()
+}
+
+func loadConfig() *Config {
+	return &Config{
+		Endpoints:           getEnvList("DEEPL_ENDPOINTS", []string{DeeplApiEndpoint}),
+		Proxies:             getEnvList("PROXIES", nil),
+		HedgeDelay:          getEnvDuration("HEDGE_DELAY", 0),
+		UpstreamRecordDir:   getEnv("UPSTREAM_RECORD_DIR", ""),
+		StickySessions:      getEnvBool("STICKY_SESSIONS", false),
+		TimestampAlgorithm:  strings.ToLower(getEnv("TIMESTAMP_ALGORITHM", TimestampV1)),
+		UpstreamFormality:   getEnv("UPSTREAM_FORMALITY", ""),
+		UpstreamVariants:    getEnvList("UPSTREAM_VARIANTS", nil),
+		UpstreamAdvanced:    getEnvBool("UPSTREAM_ADVANCED_MODE", false),
+		SplitTextThreshold:  getEnvInt("SPLIT_TEXT_THRESHOLD", 5000),
+		GapMarker:           getEnv("GAP_MARKER", "[…]"),
+		QuarantineFailures:  getEnvInt("QUARANTINE_FAILURES", 5),
+		ProbeInterval:       getEnvDuration("PROBE_INTERVAL", 30*time.Second),
+		UpstreamCooldown:    getEnvDuration("UPSTREAM_COOLDOWN", time.Minute),
+		DNSCacheTTL:         getEnvDuration("DNS_CACHE_TTL", time.Minute),
+		DoHURL:              getEnv("DOH_URL", ""),
+		SourceAddrs:         getEnvSourceAddrs("SOURCE_ADDRS"),
+		ChaosDelay:          getEnvDuration("CHAOS_DELAY", 5*time.Second),
+		ChaosDelayRate:      getEnvFloat("CHAOS_DELAY_RATE", 0),
+		Chaos429Rate:        getEnvFloat("CHAOS_429_RATE", 0),
+		ChaosMalformedRate:  getEnvFloat("CHAOS_MALFORMED_RATE", 0),
+		BatchWindow:         getEnvDuration("BATCH_WINDOW", defaultBatchWindow()),
+		CompatMode:          strings.ToLower(getEnv("COMPAT_MODE", "")),
+		Compat:              strings.ToLower(getEnv("COMPAT", CompatStrict)),
+		BatchMaxTexts:       getEnvInt("BATCH_MAX_TEXTS", 50),
+		JobWorkers:          getEnvInt("JOB_WORKERS", 2),
+		JobConcurrency:      getEnvInt("JOB_CONCURRENCY", 4),
+		JobQueueSize:        getEnvInt("JOB_QUEUE_SIZE", 100),
+		JobTTL:              getEnvDuration("JOB_TTL", 24*time.Hour),
+		JobsDir:             getEnv("JOBS_DIR", ""),
+		S3Endpoint:          getEnv("S3_ENDPOINT", "https://s3.amazonaws.com"),
+		S3Region:            getEnv("S3_REGION", "us-east-1"),
+		S3AccessKey:         getSecret("S3_ACCESS_KEY"),
+		S3SecretKey:         getSecret("S3_SECRET_KEY"),
+		S3PathStyle:         getEnvBool("S3_PATH_STYLE", true),
+		S3AllowedPrefixes:   getEnvList("S3_ALLOWED_PREFIXES", nil),
+		RedisURL:            getSecret("REDIS_URL"),
+		SameLangPassthrough: getEnvBool("SAME_LANG_PASSTHROUGH", false),
+		DuplicateSimilarity: getEnvFloat("ALTERNATIVES_SIMILARITY", 0.9),
+		RomanizeDir:         getEnv("ROMANIZE_DIR", ""),
+		QAThreshold:         getEnvFloat("QA_THRESHOLD", 0.6),
+		AllowedSourceLangs:  getEnvList("ALLOWED_SOURCE_LANGS", nil),
+		AllowedTargetLangs:  getEnvList("ALLOWED_TARGET_LANGS", nil),
+		LookupMaxWords:      getEnvInt("LOOKUP_MAX_WORDS", 3),
+		TTSURL:              getEnv("TTS_URL", ""),
+		TTSToken:            getSecret("TTS_TOKEN"),
+		TTSTTL:              getEnvDuration("TTS_TTL", time.Hour),
+		AdminToken:          getSecret("ADMIN_TOKEN"),
+		OIDCIssuer:          getEnv("OIDC_ISSUER", ""),
+		OIDCClientID:        getEnv("OIDC_CLIENT_ID", ""),
+		OIDCClientSecret:    getSecret("OIDC_CLIENT_SECRET"),
+		OIDCRedirectURL:     getEnv("OIDC_REDIRECT_URL", ""),
+		OIDCAllowedUsers:    getEnvList("OIDC_ALLOWED_USERS", nil),
+		OIDCSessionTTL:      getEnvDuration("OIDC_SESSION_TTL", 12*time.Hour),
+		TermsFile:           getEnv("TERMS_FILE", ""),
+		ProfanityWordlist:   getEnv("PROFANITY_WORDLIST", ""),
+		ProfanityMode:       getEnv("PROFANITY_MODE", "mask"),
+		PreHook:             getEnv("PRE_HOOK", ""),
+		PostHook:            getEnv("POST_HOOK", ""),
+		HookTimeout:         getEnvDuration("HOOK_TIMEOUT", 5*time.Second),
+		HookFailure:         strings.ToLower(getEnv("HOOK_FAILURE", HookReject)),
+		ScriptsDir:          getEnv("SCRIPTS_DIR", ""),
+		ScriptTimeout:       getEnvDuration("SCRIPT_TIMEOUT", time.Second),
+		Engine:              strings.ToLower(getEnv("ENGINE", EngineDeepL)),
+		EngineRoutes:        getEnvRoutes("ENGINE_ROUTES"),
+		AlertWebhook:        getSecret("ALERT_WEBHOOK"),
+		AlertFormat:         strings.ToLower(getEnv("ALERT_FORMAT", "")),
+		AlertErrorRate:      getEnvFloat("ALERT_ERROR_RATE", 0.5),
+		Alert429Rate:        getEnvFloat("ALERT_429_RATE", 0.2),
+		AlertWindow:         max(getEnvDuration("ALERT_WINDOW", 5*time.Minute), alertBuckets*time.Second),
+		AlertMinRequests:    getEnvInt("ALERT_MIN_REQUESTS", 20),
+		AlertCooldown:       getEnvDuration("ALERT_COOLDOWN", 30*time.Minute),
+		SchemaCheckInterval: getEnvDuration("SCHEMA_CHECK_INTERVAL", 0),
+		StatsdAddr:          getEnv("STATSD_ADDR", ""),
+		StatsdFormat:        strings.ToLower(getEnv("STATSD_FORMAT", StatsdPlain)),
+		StatsdPrefix:        getEnv("STATSD_PREFIX", "deeplx."),
+		StatsdTags:          getEnvList("STATSD_TAGS", nil),
+		StatsdInterval:      max(getEnvDuration("STATSD_INTERVAL", 10*time.Second), time.Second),
+		UsageExport:         getEnv("USAGE_EXPORT", ""),
+		UsageExportFormat:   strings.ToLower(getEnv("USAGE_EXPORT_FORMAT", UsageCSV)),
+		UsageExportInterval: max(getEnvDuration("USAGE_EXPORT_INTERVAL", time.Hour), time.Minute),
+		LocalModelURL:       getEnv("LOCAL_MODEL_URL", ""),
+		LocalModelCodes:     strings.ToLower(getEnv("LOCAL_MODEL_CODES", LocalCodesFlores)),
+		LocalModelTimeout:   getEnvDuration("LOCAL_MODEL_TIMEOUT", time.Minute),
+		LocalModelFallback:  getEnvBool("LOCAL_MODEL_FALLBACK", false),
+		PluginsDir:          getEnv("PLUGINS_DIR", ""),
+		PluginInstances:     getEnvInt("PLUGIN_INSTANCES", 1),
+		PluginTimeout:       getEnvDuration("PLUGIN_TIMEOUT", 30*time.Second),
+		NormalizeInput:      getEnvBool("NORMALIZE_INPUT", true),
+		CollapseWhitespace:  getEnvBool("COLLAPSE_WHITESPACE", false),
+		IdempotencyTTL:      getEnvDuration("IDEMPOTENCY_TTL", 24*time.Hour),
+		IdempotencyMaxKeys:  getEnvInt("IDEMPOTENCY_MAX_KEYS", 10000),
+		CacheTTL:            getEnvDuration("CACHE_TTL", 0),
+		CacheSize:           getEnvInt("CACHE_SIZE", 10000),
+		CacheControl:        getEnv("CACHE_CONTROL", ""),
+		CacheVary:           getEnv("CACHE_VARY", "Accept-Encoding"),
+		WarmFile:            getEnv("WARM_FILE", ""),
+		WarmTop:             getEnvInt("WARM_TOP", 0),
+		WarmInterval:        getEnvDuration("WARM_INTERVAL", 0),
+		RateLimit:           getEnvInt("RATE_LIMIT", 0),
+		RateLimitWindow:     getEnvDuration("RATE_LIMIT_WINDOW", time.Minute),
+		DuplicateLimit:      getEnvInt("DUPLICATE_LIMIT", 0),
+		DuplicateWindow:     getEnvDuration("DUPLICATE_WINDOW", time.Minute),
+		APITokens:           parseAPITokens(getSecret("API_TOKENS")),
+		KeyDefaultsFile:     getEnv("KEY_DEFAULTS_FILE", ""),
+		DailyCharacterCap:   getEnvInt("DAILY_CHARACTER_CAP", 0),
+		MonthlyCharacterCap: getEnvInt("MONTHLY_CHARACTER_CAP", 0),
+		KeyDailyCaps:        parseCaps(getEnv("KEY_DAILY_CAPS", "")),
+		KeyMonthlyCaps:      parseCaps(getEnv("KEY_MONTHLY_CAPS", "")),
+		CapResetTime:        getEnvTimeOfDay("CAP_RESET_TIME", 0),
+		CapResetDay:         min(max(getEnvInt("CAP_RESET_DAY", 1), 1), 28),
+		QuotaWarning:        getEnvInt("QUOTA_WARNING", 80),
+		QuotaWarningWebhook: getSecret("QUOTA_WARNING_WEBHOOK"),
+		SigningKeys:         parseSigningKeys(getSecret("SIGNING_KEYS")),
+		SigningWindow:       getEnvDuration("SIGNING_WINDOW", 5*time.Minute),
+		TelegramToken:       getSecret("TELEGRAM_TOKEN"),
+		TelegramTargetLang:  strings.ToUpper(getEnv("TELEGRAM_TARGET_LANG", "EN")),
+		DiscordToken:        getSecret("DISCORD_TOKEN"),
+		DiscordTargetLang:   strings.ToUpper(getEnv("DISCORD_TARGET_LANG", "EN")),
+		SlackSigningSecret:  getSecret("SLACK_SIGNING_SECRET"),
+		SlackResponseType:   getEnv("SLACK_RESPONSE_TYPE", "ephemeral"),
+		LogFile:             getEnv("LOG_FILE", ""),
+		AccessLog:           getEnv("ACCESS_LOG", ""),
+		LogMaxSize:          getEnvSize("LOG_MAX_SIZE", 100<<20),
+		LogMaxAge:           getEnvDuration("LOG_MAX_AGE", 0),
+		LogMaxBackups:       getEnvInt("LOG_MAX_BACKUPS", 10),
+		LogCompress:         getEnvBool("LOG_COMPRESS", false),
+		LogSampleRate:       getEnvFloat("LOG_SAMPLE_RATE", 0),
+		LogRedactFile:       getEnv("LOG_REDACT_FILE", ""),
+		LogSyslog:           getEnv("LOG_SYSLOG", ""),
+		LogSyslogFacility:   strings.ToLower(getEnv("LOG_SYSLOG_FACILITY", "daemon")),
+		LogJournald:         getEnvBool("LOG_JOURNALD", false),
+		AuditLog:            getEnv("AUDIT_LOG", ""),
+		ShutdownTimeout:     getEnvDuration("SHUTDOWN_TIMEOUT", 30*time.Second),
+		MemoryLimit:         getEnv("MEMORY_LIMIT", "90%"),
+		GCPercent:           getEnvInt("GC_PERCENT", 100),
+		Prefork:             getEnvBool("PREFORK", false),
+		BodyLimit:           getEnvSize("BODY_LIMIT", fiber.DefaultBodyLimit),
+		Concurrency:         getEnvInt("CONCURRENCY", fiber.DefaultConcurrency),
+		ReadTimeout:         getEnvDuration("READ_TIMEOUT", 0),
+		WriteTimeout:        getEnvDuration("WRITE_TIMEOUT", 0),
+		IdleTimeout:         getEnvDuration("IDLE_TIMEOUT", 0),
+	}
+}
+
+func defaultBatchWindow() time.Duration {
+	if strings.EqualFold(getEnv("COMPAT_MODE", ""), CompatImmersive) {
+		return ImmersiveBatchWindow
+	}
+	return 0
+}
+
+// settingValues holds settings from a source other than the environment.
+// A reload replaces them as a whole, so getEnv can read them at any time.
+type settingValues struct {
+	values atomic.Pointer[map[string]string]
+}
+
+func newSettingValues(values map[string]string) *settingValues {
+	settings := &settingValues{}
+	settings.store(values)
+	return settings
+}
+
+func (s *settingValues) load() map[string]string {
+	if values := s.values.Load(); values != nil {
+		return *values
+	}
+	return nil
+}
+
+func (s *settingValues) store(values map[string]string) {
+	s.values.Store(&values)
+}
+
+func getEnv(key, fallback string) string {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		value, ok = remoteSettings.load()[key]
+	}
+	if !ok {
+		value, ok = configFile.load()[key]
+	}
+	if ok && strings.TrimSpace(value) != "" {
+		return strings.TrimSpace(value)
+	}
+	return fallback
+}
+
+// secretSettings may instead be read from a file named by the same variable
+// with a _FILE suffix, such as a mounted Docker or Kubernetes secret.
+var secretSettings = []string{
+	"S3_ACCESS_KEY",
+	"S3_SECRET_KEY",
+	"REDIS_URL",
+	"ADMIN_TOKEN",
+	"OIDC_CLIENT_SECRET",
+	"TELEGRAM_TOKEN",
+	"DISCORD_TOKEN",
+	"SLACK_SIGNING_SECRET",
+	"SECRETS_TOKEN",
+	"ALERT_WEBHOOK",
+	"QUOTA_WARNING_WEBHOOK",
+	"TTS_TOKEN",
+	"API_TOKENS",
+	"SIGNING_KEYS",
+	"DEEPLX_TOKEN",
+	"DEEPLX_SIGNING_KEY",
+}
+
+// getSecret reads a secret from key, or from the file named by key_FILE.
+// The value set directly takes precedence, and surrounding whitespace such
+// as a trailing newline is trimmed from the file.
+func getSecret(key string) string {
+	if value := getEnv(key, ""); value != "" {
+		return value
+	}
+	path := getEnv(key+"_FILE", "")
+	if path == "" {
+		return ""
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Printf("Error reading %s_FILE: %v", key, err)
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// getEnvList reads a comma-separated list, skipping empty items.
+func getEnvList(key string, fallback []string) []string {
+	value := getEnv(key, "")
+	if value == "" {
+		return fallback
+	}
+	return splitList(value)
+}
+
+// splitList splits a comma-separated list, dropping empty items.
+func splitList(value string) []string {
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func getEnvBool(key string, fallback bool) bool {
+	value := getEnv(key, "")
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("Invalid boolean for %s: %q, using default %v", key, value, fallback)
+		return fallback
+	}
+	return parsed
+}
+
+func getEnvInt(key string, fallback int) int {
+	value := getEnv(key, "")
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("Invalid integer for %s: %q, using default %v", key, value, fallback)
+		return fallback
+	}
+	return parsed
+}
+
+func getEnvFloat(key string, fallback float64) float64 {
+	value := getEnv(key, "")
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		log.Printf("Invalid number for %s: %q, using default %v", key, value, fallback)
+		return fallback
+	}
+	return parsed
+}
+
+// getEnvSourceAddrs reads a list of addresses and prefixes, skipping
+// invalid entries.
+func getEnvSourceAddrs(key string) []netip.Prefix {
+	var prefixes []netip.Prefix
+	for _, item := range getEnvList(key, nil) {
+		prefix, err := parseSourceAddr(item)
+		if err != nil {
+			log.Printf("Invalid address for %s: %q, skipping it", key, item)
+			continue
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	return prefixes
+}
+
+// getEnvRoutes reads a list of engine routes, skipping invalid ones.
+func getEnvRoutes(key string) []engineRoute {
+	var routes []engineRoute
+	for _, item := range getEnvList(key, nil) {
+		route, err := parseEngineRoute(item)
+		if err != nil {
+			log.Printf("Invalid route for %s: %v, skipping it", key, err)
+			continue
+		}
+		routes = append(routes, route)
+	}
+	return routes
+}
+
+// getEnvSize reads a number of bytes such as "4MiB".
+func getEnvSize(key string, fallback int) int {
+	value := getEnv(key, "")
+	if value == "" {
+		return fallback
+	}
+	parsed, err := parseSize(value)
+	if err != nil || parsed > math.MaxInt32 {
+		log.Printf("Invalid size for %s: %q, using default %v", key, value, fallback)
+		return fallback
+	}
+	return int(parsed)
+}
+
+func getEnvTimeOfDay(key string, fallback time.Duration) time.Duration {
+	value := getEnv(key, "")
+	if value == "" {
+		return fallback
+	}
+	parsed, err := parseTimeOfDay(value)
+	if err != nil {
+		log.Printf("Invalid time for %s: %q, using default %v", key, value, fallback)
+		return fallback
+	}
+	return parsed
+}
+
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	value := getEnv(key, "")
+	if value == "" {
+		return fallback
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("Invalid duration for %s: %q, using default %v", key, value, fallback)
+		return fallback
+	}
+	return parsed
+}
@@ -0,0 +1,708 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// configFile holds the settings of the file named by CONFIG_FILE. Environment
+// variables take precedence over it.
+var configFile = newSettingValues(loadConfigFile(os.Getenv("CONFIG_FILE")))
+
+// configSetting documents a configuration variable for `deeplx config`.
+// Check validates a value that is set, and is nil for free-form strings.
+type configSetting struct {
+	Name        string
+	Default     string
+	Description string
+	Check       func(value string) error
+}
+
+// configSettings lists the settings read by loadConfig, in the order of the
+// generated example.
+var configSettings = []configSetting{
+	{"DEEPL_ENDPOINTS", DeeplApiEndpoint, "Comma-separated DeepL JSON-RPC endpoints. Append |weight to an entry to weight it; weight 0 makes it a backup.", checkWeightedURLs("http", "https")},
+	{"PROXIES", "", "Comma-separated http://, https:// or socks5:// proxy URLs, optionally weighted like endpoints.", checkWeightedURLs("http", "https", "socks5")},
+	{"QUARANTINE_FAILURES", "5", "Consecutive failures after which an endpoint/proxy combination is taken out of rotation. 0 disables quarantining.", checkInt(0)},
+	{"PROBE_INTERVAL", "30s", "How often quarantined combinations are probed.", checkInterval(time.Second)},
+	{"UPSTREAM_COOLDOWN", "1m", "How long a combination that answered 429 is kept out of rotation. 0 disables cooldowns.", checkDuration(0)},
+	{"DNS_CACHE_TTL", "1m", "How long the addresses of endpoints and proxies are cached. 0 disables the cache.", checkDuration(0)},
+	{"DOH_URL", "", "DNS over HTTPS server to resolve endpoints and proxies with, such as https://1.1.1.1/dns-query.", checkURL("https")},
+	{"SOURCE_ADDRS", "", "Comma-separated local addresses upstream requests are sent from in turn. A prefix such as 2001:db8::/64 sends from random addresses of it.", checkSourceAddrs},
+	{"CHAOS_DELAY_RATE", "0", "Testing only: share of upstream calls delayed by a random time up to CHAOS_DELAY.", checkFraction},
+	{"CHAOS_DELAY", "5s", "Longest delay injected by CHAOS_DELAY_RATE.", checkDuration(0)},
+	{"CHAOS_429_RATE", "0", "Testing only: share of upstream calls failed with 429 Too Many Requests.", checkFraction},
+	{"CHAOS_MALFORMED_RATE", "0", "Testing only: share of upstream calls answered with a malformed response.", checkFraction},
+	{"BATCH_WINDOW", "0", "Requests for the same language pair arriving within this window are sent upstream as one call. 0 disables batching.", checkDuration(0)},
+	{"COMPAT_MODE", "", "Set to immersive to tune the server for the immersive-translate extension.", checkOneOf(CompatImmersive)},
+	{"COMPAT", "strict", "Response schema of /translate: legacy for exactly the fields of the original DeepLX project, strict for this server's.", checkOneOf(CompatLegacy, CompatStrict)},
+	{"BATCH_MAX_TEXTS", "50", "Send a batch early once it holds this many texts.", checkInt(1)},
+	{"JOB_WORKERS", "2", "Number of jobs processed at the same time.", checkInt(1)},
+	{"JOB_CONCURRENCY", "4", "Number of texts of one job translated in parallel.", checkInt(1)},
+	{"JOB_QUEUE_SIZE", "100", "Maximum number of jobs waiting for a worker.", checkInt(0)},
+	{"JOB_TTL", "24h", "How long finished jobs and their results are kept.", checkDuration(time.Second)},
+	{"JOBS_DIR", "", "Directory to checkpoint jobs in, so unfinished jobs resume after a restart.", nil},
+	{"S3_ENDPOINT", "https://s3.amazonaws.com", "S3 or S3-compatible endpoint for job input/output locations.", checkURL("http", "https")},
+	{"S3_REGION", "us-east-1", "Region used to sign S3 requests.", nil},
+	{"S3_ACCESS_KEY", "", "S3 access key.", nil},
+	{"S3_SECRET_KEY", "", "S3 secret key.", nil},
+	{"S3_PATH_STYLE", "true", "Address buckets as endpoint/bucket/key; false for bucket.endpoint/key.", checkBool},
+	{"S3_ALLOWED_PREFIXES", "", "Comma-separated s3:// prefixes any caller may use as job input or output. Other locations need the admin token.", checkS3Prefixes},
+	{"REDIS_URL", "", "redis:// URL to share rate limits and upstream cooldowns between replicas.", checkRedisURL},
+	{"HEDGE_DELAY", "0", "Also send a request to the next endpoint when it has not been answered within this delay. 0 disables hedging.", checkDuration(0)},
+	{"STICKY_SESSIONS", "false", "Send each client's requests to the same endpoint and proxy, which keeps cookies and numbers requests in sequence like a browser session.", checkBool},
+	{"UPSTREAM_FORMALITY", "", "Formality of translations whose request sets none: formal or informal.", checkOneOf(FormalityFormal, FormalityInformal)},
+	{"UPSTREAM_VARIANTS", "", "Comma-separated regional variants, such as en-GB,pt-BR, of target languages requested without a region.", checkRegionalVariants},
+	{"UPSTREAM_ADVANCED_MODE", "false", "Send every translation in the web client's advanced mode.", checkBool},
+	{"SPLIT_TEXT_THRESHOLD", "5000", "Length in characters above which texts are split into sentences upstream and translated as jobs, like the web client does for long texts. 0 disables it.", checkInt(0)},
+	{"GAP_MARKER", "[…]", "Text replacing the sentences of a long text that failed to translate, in partial results.", nil},
+	{"TIMESTAMP_ALGORITHM", "v1", "How request timestamps are derived from the texts, following the web client version imitated.", checkOneOf(TimestampV1)},
+	{"UPSTREAM_RECORD_DIR", "", "Directory every upstream call is saved to, with LOG_REDACT_FILE rules applied, for deeplx replay to serve.", nil},
+	{"SAME_LANG_PASSTHROUGH", "false", "Return the input unchanged when the given or detected source language is the target language.", checkBool},
+	{"ALTERNATIVES_SIMILARITY", "0.9", "Similarity from 0 to 1 at which alternatives count as duplicates of the translation or of each other and are dropped. 0 only drops identical ones.", checkFraction},
+	{"ROMANIZE_DIR", "", "Directory of romanization dictionaries named after a language, such as zh.tsv, of word and reading pairs separated by a tab.", checkRomanizeDir},
+	{"QA_THRESHOLD", "0.6", "Back-translation similarity below which /qa flags a translation as suspect.", checkFraction},
+	{"ALLOWED_SOURCE_LANGS", "", "Comma-separated languages that may be translated from, such as EN,DE. Others get 403.", nil},
+	{"ALLOWED_TARGET_LANGS", "", "Comma-separated languages that may be translated to. Others get 403.", nil},
+	{"LOOKUP_MAX_WORDS", "3", "Maximum number of words /lookup takes.", checkInt(1)},
+	{"TTS_URL", "", "Text-to-speech backend posted the text and its language as JSON, answering with audio. Enables the tts option.", checkURL("http", "https")},
+	{"TTS_TOKEN", "", "Bearer token sent to TTS_URL.", nil},
+	{"TTS_TTL", "1h", "How long the audio URLs of translations stay valid.", checkDuration(time.Second)},
+	{"ADMIN_TOKEN", "", "Enables the /admin API, authenticated with this bearer token.", nil},
+	{"OIDC_ISSUER", "", "OpenID Connect provider users log in to the admin pages with, e.g. https://accounts.google.com.", checkURL("https", "http")},
+	{"OIDC_CLIENT_ID", "", "Client ID registered at OIDC_ISSUER.", nil},
+	{"OIDC_CLIENT_SECRET", "", "Client secret registered at OIDC_ISSUER. Also signs session cookies.", nil},
+	{"OIDC_REDIRECT_URL", "", "Public URL of this server's /auth/callback, registered as redirect URI at OIDC_ISSUER.", checkURL("https", "http")},
+	{"OIDC_ALLOWED_USERS", "", "Comma-separated e-mail addresses, @domains or subjects allowed to log in, or * for every user of OIDC_ISSUER.", nil},
+	{"OIDC_SESSION_TTL", "12h", "How long a login lasts.", checkDuration(time.Minute)},
+	{"TERMS_FILE", "", "JSON file with terminology replacement rules.", checkFile},
+	{"PROFANITY_WORDLIST", "", "File with one word per line to mask or flag in translations.", checkFile},
+	{"PROFANITY_MODE", "mask", "mask replaces listed words with asterisks, flag only marks the response.", checkOneOf("mask", "flag")},
+	{"PRE_HOOK", "", "Command or webhook URL the text is passed through as JSON before it is sent upstream, e.g. for PII scrubbing.", checkHook},
+	{"POST_HOOK", "", "Command or webhook URL translations are passed through as JSON.", checkHook},
+	{"HOOK_TIMEOUT", "5s", "How long a hook may take.", checkDuration(time.Millisecond)},
+	{"HOOK_FAILURE", HookReject, "reject fails the request when a hook fails, skip goes on with the text unchanged.", checkOneOf(HookReject, HookSkip)},
+	{"SCRIPTS_DIR", "", "Directory of JavaScript transform scripts (*.js) defining transformRequest and transformResponse functions.", checkScriptsDir},
+	{"SCRIPT_TIMEOUT", "1s", "How long a transform script may run per call.", checkDuration(time.Millisecond)},
+	{"ENGINE", EngineDeepL, "Translation engine used when a request doesn't name one: deepl, local or the name of a plugin.", nil},
+	{"ENGINE_ROUTES", "", "Engines by language pair, first match first, e.g. JA<>ZH:argos,*>KO:local. Other pairs use ENGINE.", checkEngineRoutes},
+	{"ALERT_WEBHOOK", "", "Slack, Discord or generic webhook URL posted to when the upstream error or 429 rate crosses its threshold.", checkURL("http", "https")},
+	{"ALERT_FORMAT", "", "Payload of the alert webhook: slack, discord or generic. Told from the URL when unset.", checkOneOf(AlertSlack, AlertDiscord, AlertGeneric)},
+	{"ALERT_ERROR_RATE", "0.5", "Share of failed upstream calls over ALERT_WINDOW that triggers an alert. 0 disables the alert.", checkFraction},
+	{"ALERT_429_RATE", "0.2", "Share of rate limited (429) upstream calls over ALERT_WINDOW that triggers an alert. 0 disables the alert.", checkFraction},
+	{"ALERT_WINDOW", "5m", "Window the alert rates are measured over.", checkDuration(10 * time.Second)},
+	{"ALERT_MIN_REQUESTS", "20", "Minimum number of upstream calls in the window before an alert can fire.", checkInt(1)},
+	{"ALERT_COOLDOWN", "30m", "Minimum time between two alerts of the same kind.", checkDuration(0)},
+	{"SCHEMA_CHECK_INTERVAL", "0", "How often to translate a canary text and check that the upstream answer format hasn't changed, logging and alerting ALERT_WEBHOOK when it has. 0 disables the check.", checkDuration(0)},
+	{"STATSD_ADDR", "", "host:port of a StatsD or DogStatsD agent metrics are pushed to over UDP. Enables the metrics.", checkHostPort},
+	{"STATSD_FORMAT", StatsdPlain, "statsd appends tag values to metric names, dogstatsd sends them as DogStatsD tags.", checkOneOf(StatsdPlain, StatsdDog)},
+	{"STATSD_PREFIX", "deeplx.", "Prefix of every metric name.", nil},
+	{"STATSD_TAGS", "", "Comma-separated tags such as env:prod added to every metric in dogstatsd format.", nil},
+	{"STATSD_INTERVAL", "10s", "How often metrics are pushed.", checkInterval(time.Second)},
+	{"USAGE_EXPORT", "", "File or http(s) webhook URL the requests, characters and cache hits of every key are exported to.", nil},
+	{"USAGE_EXPORT_FORMAT", "csv", "Format of USAGE_EXPORT: csv or json.", checkOneOf(UsageCSV, UsageJSON)},
+	{"USAGE_EXPORT_INTERVAL", "1h", "How often usage is exported.", checkInterval(time.Minute)},
+	{"LOCAL_MODEL_URL", "", "HTTP endpoint of a local translation model server, e.g. NLLB, enabling the local engine.", checkURL("http", "https")},
+	{"LOCAL_MODEL_CODES", LocalCodesFlores, "Language codes sent to the local model: flores for FLORES-200 codes such as deu_Latn, deepl to send them unchanged.", checkOneOf(LocalCodesFlores, LocalCodesDeepL)},
+	{"LOCAL_MODEL_TIMEOUT", "1m", "How long the local model may take to answer.", checkDuration(time.Millisecond)},
+	{"LOCAL_MODEL_FALLBACK", "false", "Translate with the local model when DeepL cannot be reached or rate limits the request.", checkBool},
+	{"PLUGINS_DIR", "", "Directory of plugin executables, each run as a translation engine named after the file.", checkDir},
+	{"PLUGIN_INSTANCES", "1", "Number of processes started for each plugin.", checkInt(1)},
+	{"PLUGIN_TIMEOUT", "30s", "How long a plugin may take to answer a request.", checkDuration(time.Millisecond)},
+	{"NORMALIZE_INPUT", "true", "Normalize input to Unicode NFC and strip control characters.", checkBool},
+	{"COLLAPSE_WHITESPACE", "false", "While normalizing, replace exotic spaces with plain spaces.", checkBool},
+	{"IDEMPOTENCY_TTL", "24h", "How long results are kept for replay by Idempotency-Key.", checkDuration(time.Second)},
+	{"IDEMPOTENCY_MAX_KEYS", "10000", "Maximum number of Idempotency-Key results kept; the oldest are dropped to make room.", checkInt(1)},
+	{"CACHE_TTL", "0", "Keep successful translations in memory for this long. 0 disables the cache.", checkDuration(0)},
+	{"CACHE_SIZE", "10000", "Maximum number of cached translations.", checkInt(1)},
+	{"CACHE_CONTROL", "", "Cache-Control header of successful GET /translate responses to anonymous callers, such as public, max-age=86400, so a CDN can cache them. Empty sends none.", nil},
+	{"CACHE_VARY", "Accept-Encoding", "Vary header sent with CACHE_CONTROL.", nil},
+	{"WARM_FILE", "", "File of /translate request bodies, one JSON object per line, translated again on a schedule to keep them cached.", checkFile},
+	{"WARM_TOP", "0", "Number of most requested queries translated again on a schedule to keep them cached.", checkInt(0)},
+	{"WARM_INTERVAL", "0", "How often the cache is warmed. 0 warms just before CACHE_TTL runs out.", checkDuration(0)},
+	{"RATE_LIMIT", "0", "Maximum translation requests per caller per RATE_LIMIT_WINDOW. 0 disables the limit.", checkInt(0)},
+	{"RATE_LIMIT_WINDOW", "1m", "Window of RATE_LIMIT.", checkDuration(time.Second)},
+	{"DUPLICATE_LIMIT", "0", "How often a caller may send the same /translate request per DUPLICATE_WINDOW before getting the last answer without an upstream call. 0 disables the limit.", checkInt(0)},
+	{"DUPLICATE_WINDOW", "1m", "Window of DUPLICATE_LIMIT.", checkDuration(time.Second)},
+	{"API_TOKENS", "", "Comma-separated bearer tokens whose callers get their own RATE_LIMIT budget, optionally named as name:token. Other callers are limited by IP.", nil},
+	{"KEY_DEFAULTS_FILE", "", "JSON file of default source_lang, target_lang, engine and html_entities, and allowed source_langs and target_langs, by token name or signing key id.", checkKeyDefaultsFile},
+	{"DAILY_CHARACTER_CAP", "0", "Maximum characters translated upstream per day by all callers; further requests get 456. 0 disables the cap.", checkInt(0)},
+	{"MONTHLY_CHARACTER_CAP", "0", "Maximum characters translated upstream per month by all callers. 0 disables the cap.", checkInt(0)},
+	{"KEY_DAILY_CAPS", "", "Comma-separated name:characters pairs capping the characters translated per day by a token name, signing key id or anonymous.", checkCaps},
+	{"KEY_MONTHLY_CAPS", "", "Comma-separated name:characters pairs capping the characters translated per month by a key.", checkCaps},
+	{"CAP_RESET_TIME", "00:00", "Time of day in UTC the character caps reset at.", checkTimeOfDay},
+	{"CAP_RESET_DAY", "1", "Day of the month the monthly character caps reset on, up to 28.", checkCapResetDay},
+	{"QUOTA_WARNING", "80", "Percentage of a character cap at which responses carry X-Quota-Warning. 0 disables the warning.", checkPercent},
+	{"QUOTA_WARNING_WEBHOOK", "", "Slack, Discord or generic webhook URL posted to when a character cap passes QUOTA_WARNING.", checkURL("http", "https")},
+	{"SIGNING_KEYS", "", "Comma-separated id:secret pairs clients sign requests with instead of sending a bearer token. Signed callers get their own RATE_LIMIT budget.", checkSigningKeys},
+	{"SIGNING_WINDOW", "5m", "How far the timestamp of a signed request may be from the server's clock. Signatures can't be reused within it.", checkDuration(time.Second)},
+	{"TELEGRAM_TOKEN", "", "Telegram bot token from @BotFather. Enables the Telegram bot.", nil},
+	{"TELEGRAM_TARGET_LANG", "EN", "Language the Telegram bot translates to when a message doesn't pick one.", nil},
+	{"DISCORD_TOKEN", "", "Discord bot token. Enables the Discord bot.", nil},
+	{"DISCORD_TARGET_LANG", "EN", "Default target language of the Discord /translate command.", nil},
+	{"SLACK_SIGNING_SECRET", "", "Signing secret of a Slack app. Enables POST /slack/command.", nil},
+	{"SLACK_RESPONSE_TYPE", "ephemeral", "ephemeral shows Slack translations only to the user who asked, in_channel posts them to the channel.", checkOneOf("ephemeral", "in_channel")},
+	{"LOG_FILE", "", "File the application log is written to instead of standard error, rotated by LOG_MAX_SIZE.", nil},
+	{"ACCESS_LOG", "", "File one line per request is written to, rotated like LOG_FILE, or syslog or journald to send it there. Unset disables the access log.", nil},
+	{"LOG_MAX_SIZE", "100MiB", "Size at which LOG_FILE and ACCESS_LOG are rotated.", checkSize},
+	{"LOG_MAX_AGE", "0", "Remove rotated log files older than this, rounded up to whole days. 0 keeps them regardless of age.", checkDuration(24 * time.Hour)},
+	{"LOG_MAX_BACKUPS", "10", "Number of rotated files kept per log. 0 keeps all of them.", checkInt(0)},
+	{"LOG_COMPRESS", "false", "Gzip rotated log files.", checkBool},
+	{"LOG_SAMPLE_RATE", "0", "Share of requests logged with their request and response bodies, e.g. 0.01 for 1%.", checkFraction},
+	{"LOG_REDACT_FILE", "", "File of regular expressions, optionally followed by => and a replacement, redacted from every log line.", checkRedactFile},
+	{"LOG_SYSLOG", "", "Syslog server the log is sent to as RFC 5424 messages: udp://host:514, tcp://host:601 or unix:///dev/log.", checkSyslogAddr},
+	{"LOG_SYSLOG_FACILITY", "daemon", "Syslog facility: user, daemon, auth, syslog or local0 to local7.", checkSyslogFacility},
+	{"LOG_JOURNALD", "false", "Send the log to the systemd journal with priorities.", checkBool},
+	{"AUDIT_LOG", "", "File admin API changes and config reloads are appended to as JSON lines, with their actor and before/after values.", checkAuditLog},
+	{"SHUTDOWN_TIMEOUT", "30s", "How long requests and jobs in flight are given to complete when the server stops or is upgraded.", checkDuration(0)},
+	{"MEMORY_LIMIT", "90%", "Soft memory limit of the Go runtime, as a size such as 512MiB or a percentage of the container's memory limit. 0 disables it. Ignored when GOMEMLIMIT is set.", checkMemoryLimit},
+	{"GC_PERCENT", "100", "Garbage collection target percentage; lower values trade CPU for memory, -1 disables collection until MEMORY_LIMIT is reached. Ignored when GOGC is set.", checkInt(-1)},
+	{"PREFORK", "false", "Run one server process per CPU sharing the port. Jobs, caches and rate limits without REDIS_URL are then kept per process.", checkBool},
+	{"BODY_LIMIT", "4MiB", "Maximum size of a request body, such as an uploaded document.", checkSize},
+	{"CONCURRENCY", "262144", "Maximum number of connections served at the same time.", checkInt(1)},
+	{"READ_TIMEOUT", "0", "Time allowed to read a request. 0 means no timeout.", checkDuration(0)},
+	{"WRITE_TIMEOUT", "0", "Time allowed to write a response. 0 means no timeout.", checkDuration(0)},
+	{"IDLE_TIMEOUT", "0", "How long keep-alive connections wait for the next request. 0 uses READ_TIMEOUT.", checkDuration(0)},
+	{"SECRETS_URL", "", "URL of a JSON object or HashiCorp Vault KV secret with settings such as credentials, e.g. https://vault:8200/v1/secret/data/deeplx.", checkURL("http", "https")},
+	{"SECRETS_TOKEN", "", "Bearer token sent to SECRETS_URL, such as a Vault token.", nil},
+	{"SECRETS_REFRESH", "5m", "How often SECRETS_URL is fetched again to pick up rotated credentials.", checkDuration(time.Second)},
+}
+
+// configProblem is a finding of `deeplx config check`. Line is 0 for
+// problems not tied to a line.
+type configProblem struct {
+	Line    int
+	Message string
+}
+
+func (p configProblem) String() string {
+	if p.Line == 0 {
+		return p.Message
+	}
+	return fmt.Sprintf("line %d: %s", p.Line, p.Message)
+}
+
+// configEntry is a KEY=value line of a config file.
+type configEntry struct {
+	Line  int
+	Key   string
+	Value string
+}
+
+// parseConfigFile reads a config file in the env-file format also used by
+// Docker's --env-file and systemd's EnvironmentFile: KEY=value lines, an
+// optional "export " prefix, optionally quoted values and # comments.
+func parseConfigFile(data []byte) ([]configEntry, []configProblem) {
+	var entries []configEntry
+	var problems []configProblem
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		key, value, found := strings.Cut(strings.TrimPrefix(text, "export "), "=")
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if !found || key == "" || strings.ContainsAny(key, " \t") {
+			problems = append(problems, configProblem{line, fmt.Sprintf("expected KEY=value, got %q", text)})
+			continue
+		}
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		entries = append(entries, configEntry{line, key, value})
+	}
+	if err := scanner.Err(); err != nil {
+		problems = append(problems, configProblem{0, err.Error()})
+	}
+	return entries, problems
+}
+
+// loadConfigFile reads the settings of a config file. Problems are logged
+// and the affected lines skipped, like invalid environment variables.
+func loadConfigFile(path string) map[string]string {
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Printf("Error reading config file: %v", err)
+		return nil
+	}
+	entries, problems := parseConfigFile(data)
+	for _, problem := range problems {
+		log.Printf("Invalid config file %s, %v", path, problem)
+	}
+	return configValues(entries)
+}
+
+// configValues maps the keys of a config file to their values. Later lines
+// win over earlier ones.
+func configValues(entries []configEntry) map[string]string {
+	values := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		values[entry.Key] = entry.Value
+	}
+	return values
+}
+
+// checkConfigFile validates a config file: its syntax, unknown and
+// duplicate keys, the values and settings that must be set together.
+func checkConfigFile(data []byte) []configProblem {
+	entries, problems := parseConfigFile(data)
+
+	settings := make(map[string]configSetting, len(configSettings))
+	for _, setting := range configSettings {
+		settings[setting.Name] = setting
+	}
+	seen := make(map[string]int)
+	values := make(map[string]string)
+	for _, entry := range entries {
+		if name, ok := strings.CutSuffix(entry.Key, "_FILE"); ok && containsFold(secretSettings, name) && settings[name].Name != "" {
+			settings[entry.Key] = configSetting{Name: entry.Key, Check: checkFile}
+		}
+		setting, ok := settings[entry.Key]
+		if !ok {
+			message := "unknown setting " + entry.Key
+			if suggestion := suggestSetting(entry.Key); suggestion != "" {
+				message += ", did you mean " + suggestion + "?"
+			}
+			problems = append(problems, configProblem{entry.Line, message})
+			continue
+		}
+		if line, ok := seen[entry.Key]; ok {
+			problems = append(problems, configProblem{entry.Line, fmt.Sprintf("%s is already set on line %d", entry.Key, line)})
+		}
+		seen[entry.Key] = entry.Line
+		values[entry.Key] = entry.Value
+
+		if entry.Value != "" && setting.Check != nil {
+			if err := setting.Check(entry.Value); err != nil {
+				problems = append(problems, configProblem{entry.Line, fmt.Sprintf("%s: %v", entry.Key, err)})
+			}
+		}
+	}
+
+	for _, name := range secretSettings {
+		if values[name] != "" && values[name+"_FILE"] != "" {
+			problems = append(problems, configProblem{seen[name+"_FILE"], fmt.Sprintf("both %s and %s_FILE are set, %s_FILE is ignored", name, name, name)})
+		}
+	}
+	secret := func(name string) bool { return values[name] != "" || values[name+"_FILE"] != "" }
+	if secret("S3_ACCESS_KEY") != secret("S3_SECRET_KEY") {
+		problems = append(problems, configProblem{0, "S3_ACCESS_KEY and S3_SECRET_KEY must be set together"})
+	}
+	if values["OIDC_ISSUER"] != "" {
+		for _, name := range []string{"OIDC_CLIENT_ID", "OIDC_CLIENT_SECRET", "OIDC_REDIRECT_URL", "OIDC_ALLOWED_USERS"} {
+			if !secret(name) {
+				problems = append(problems, configProblem{seen["OIDC_ISSUER"], "OIDC_ISSUER needs " + name})
+			}
+		}
+	}
+	if values["ACCESS_LOG"] == AccessLogSyslog && values["LOG_SYSLOG"] == "" {
+		problems = append(problems, configProblem{seen["ACCESS_LOG"], "ACCESS_LOG=syslog needs LOG_SYSLOG"})
+	}
+	if values["STATSD_TAGS"] != "" && !strings.EqualFold(values["STATSD_FORMAT"], StatsdDog) {
+		problems = append(problems, configProblem{seen["STATSD_TAGS"], "STATSD_TAGS needs STATSD_FORMAT=dogstatsd"})
+	}
+	if fallback, _ := strconv.ParseBool(values["LOCAL_MODEL_FALLBACK"]); fallback && values["LOCAL_MODEL_URL"] == "" {
+		problems = append(problems, configProblem{seen["LOCAL_MODEL_FALLBACK"], "LOCAL_MODEL_FALLBACK needs LOCAL_MODEL_URL"})
+	}
+
+	// Report in file order, with the problems of the whole file last.
+	sort.SliceStable(problems, func(i, j int) bool {
+		a, b := problems[i].Line, problems[j].Line
+		return a != 0 && (b == 0 || a < b)
+	})
+	return problems
+}
+
+// suggestSetting returns the setting closest to a misspelled name, if any is
+// close enough.
+func suggestSetting(name string) string {
+	best, bestDistance := "", 4
+	for _, setting := range configSettings {
+		if distance := levenshtein(strings.ToUpper(name), setting.Name); distance < bestDistance {
+			best, bestDistance = setting.Name, distance
+		}
+	}
+	return best
+}
+
+func checkBool(value string) error {
+	if _, err := strconv.ParseBool(value); err != nil {
+		return fmt.Errorf("%q is not a boolean, use true or false", value)
+	}
+	return nil
+}
+
+func checkInt(minimum int) func(string) error {
+	return func(value string) error {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a whole number", value)
+		}
+		if n < minimum {
+			return fmt.Errorf("must be at least %d, got %d", minimum, n)
+		}
+		return nil
+	}
+}
+
+func checkPercent(value string) error {
+	if err := checkInt(0)(value); err != nil {
+		return err
+	}
+	if n, _ := strconv.Atoi(value); n > 100 {
+		return fmt.Errorf("must be at most 100, got %d", n)
+	}
+	return nil
+}
+
+func checkFraction(value string) error {
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil || n < 0 || n > 1 {
+		return fmt.Errorf("%q is not a number between 0 and 1", value)
+	}
+	return nil
+}
+
+func checkDuration(minimum time.Duration) func(string) error {
+	return func(value string) error {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a duration, use a number with a unit such as 500ms, 30s or 1h", value)
+		}
+		if d < 0 || (d > 0 && d < minimum) {
+			return fmt.Errorf("must be 0 or at least %v, got %v", minimum, d)
+		}
+		return nil
+	}
+}
+
+// checkInterval is checkDuration for settings that cannot be 0.
+func checkInterval(minimum time.Duration) func(string) error {
+	return func(value string) error {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a duration, use a number with a unit such as 500ms, 30s or 1h", value)
+		}
+		if d < minimum {
+			return fmt.Errorf("must be at least %v, got %v", minimum, d)
+		}
+		return nil
+	}
+}
+
+func checkOneOf(choices ...string) func(string) error {
+	return func(value string) error {
+		if !containsFold(choices, value) {
+			return fmt.Errorf("%q is not one of %s", value, strings.Join(choices, ", "))
+		}
+		return nil
+	}
+}
+
+func checkRegionalVariants(value string) error {
+	for _, variant := range splitList(value) {
+		if _, region, ok := strings.Cut(variant, "-"); !ok || region == "" {
+			return fmt.Errorf("%q is not a regional variant such as en-GB", variant)
+		}
+	}
+	return nil
+}
+
+func checkHook(value string) error {
+	if isWebhook(value) {
+		return checkURL("http", "https")(value)
+	}
+	if _, err := exec.LookPath(strings.Fields(value)[0]); err != nil {
+		return fmt.Errorf("command %q not found", strings.Fields(value)[0])
+	}
+	return nil
+}
+
+// checkScriptsDir compiles and runs the scripts, reporting syntax errors.
+func checkScriptsDir(value string) error {
+	_, err := loadScripts(value)
+	return err
+}
+
+func checkEngineRoutes(value string) error {
+	for _, item := range splitList(value) {
+		if _, err := parseEngineRoute(item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkS3Prefixes(value string) error {
+	for _, item := range splitList(value) {
+		bucket, _, _ := strings.Cut(strings.TrimPrefix(item, "s3://"), "/")
+		if !strings.HasPrefix(item, "s3://") || bucket == "" {
+			return fmt.Errorf("%q is not an s3://bucket/prefix location", item)
+		}
+	}
+	return nil
+}
+
+func checkSourceAddrs(value string) error {
+	for _, item := range splitList(value) {
+		if _, err := parseSourceAddr(item); err != nil {
+			return fmt.Errorf("%q is not an IP address or prefix", item)
+		}
+	}
+	return nil
+}
+
+func checkHostPort(value string) error {
+	host, port, err := net.SplitHostPort(value)
+	if err != nil || host == "" {
+		return fmt.Errorf("%q is not a host:port address", value)
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return fmt.Errorf("%q has an invalid port", value)
+	}
+	return nil
+}
+
+func checkRedactFile(value string) error {
+	_, err := loadRedactionRules(value)
+	return err
+}
+
+func checkKeyDefaultsFile(value string) error {
+	_, err := loadKeyDefaults(value)
+	return err
+}
+
+func checkRomanizeDir(value string) error {
+	if err := checkDir(value); err != nil {
+		return err
+	}
+	_, err := loadRomanizationDicts(value)
+	return err
+}
+
+func checkSigningKeys(value string) error {
+	// The items hold secrets, so they are only referred to by position.
+	for i, item := range splitList(value) {
+		if id, secret, _ := strings.Cut(item, ":"); id == "" || secret == "" {
+			return fmt.Errorf("item %d is not an id:secret pair", i+1)
+		}
+	}
+	return nil
+}
+
+func checkCaps(value string) error {
+	for _, item := range splitList(value) {
+		name, limit, _ := strings.Cut(item, ":")
+		if n, err := strconv.Atoi(limit); name == "" || err != nil || n < 1 {
+			return fmt.Errorf("%q is not a name:characters pair with at least 1 character", item)
+		}
+	}
+	return nil
+}
+
+func checkTimeOfDay(value string) error {
+	_, err := parseTimeOfDay(value)
+	return err
+}
+
+func checkCapResetDay(value string) error {
+	if err := checkInt(1)(value); err != nil {
+		return err
+	}
+	if n, _ := strconv.Atoi(value); n > 28 {
+		return fmt.Errorf("must be at most 28, so every month has the day, got %d", n)
+	}
+	return nil
+}
+
+func checkAuditLog(value string) error {
+	return checkDir(filepath.Dir(value))
+}
+
+func checkSyslogAddr(value string) error {
+	_, err := newSyslogWriter(value, "daemon", "")
+	return err
+}
+
+func checkSyslogFacility(value string) error {
+	if _, ok := syslogFacilities[strings.ToLower(value)]; !ok {
+		return fmt.Errorf("%q is not a syslog facility such as daemon or local0", value)
+	}
+	return nil
+}
+
+func checkURL(schemes ...string) func(string) error {
+	return func(value string) error {
+		u, err := url.Parse(value)
+		if err != nil || u.Host == "" {
+			return fmt.Errorf("%q is not an absolute URL", value)
+		}
+		if !containsFold(schemes, u.Scheme) {
+			return fmt.Errorf("%q must use %s://", value, strings.Join(schemes, ":// or "))
+		}
+		return nil
+	}
+}
+
+// checkWeightedURLs validates a comma-separated list of URLs with optional
+// |weight suffixes, as parsed by parseWeighted.
+func checkWeightedURLs(schemes ...string) func(string) error {
+	check := checkURL(schemes...)
+	return func(value string) error {
+		for _, entry := range splitList(value) {
+			u, _, err := parseWeighted(entry)
+			if err != nil {
+				return fmt.Errorf("%v, the weight must be a number of at least 0", err)
+			}
+			if err := check(u); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func checkSize(value string) error {
+	size, err := parseSize(value)
+	if err != nil || size > math.MaxInt32 {
+		return fmt.Errorf("%q is not a size such as 4MiB, up to 2GiB", value)
+	}
+	return nil
+}
+
+func checkMemoryLimit(value string) error {
+	_, err := parseMemoryLimit(value, 0)
+	return err
+}
+
+func checkRedisURL(value string) error {
+	if _, err := redis.ParseURL(value); err != nil {
+		return fmt.Errorf("%v, expected redis://[user:password@]host:port[/db]", err)
+	}
+	return nil
+}
+
+func checkFile(value string) error {
+	info, err := os.Stat(value)
+	if err != nil {
+		return fmt.Errorf("cannot read %s: %v", value, errors.Unwrap(err))
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%s is a directory, expected a file", value)
+	}
+	return nil
+}
+
+func checkDir(value string) error {
+	info, err := os.Stat(value)
+	if err != nil {
+		return fmt.Errorf("cannot read %s: %v", value, errors.Unwrap(err))
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", value)
+	}
+	return nil
+}
+
+// writeExampleConfig writes a config file with every setting commented out
+// at its default value.
+func writeExampleConfig(w io.Writer) {
+	fmt.Fprintln(w, "# DeepLX-Go configuration, loaded from the file named by CONFIG_FILE.")
+	fmt.Fprintln(w, "# Environment variables take precedence over the values set here.")
+	fmt.Fprintln(w, "# Uncomment a line to change a setting from its default. Secrets can be")
+	fmt.Fprintln(w, "# read from a file instead, named by the setting with a _FILE suffix.")
+	for _, setting := range configSettings {
+		fmt.Fprintln(w)
+		for _, line := range wrapWords(setting.Description, 76) {
+			fmt.Fprintln(w, "# "+line)
+		}
+		fmt.Fprintf(w, "#%s=%s\n", setting.Name, setting.Default)
+		if containsFold(secretSettings, setting.Name) {
+			fmt.Fprintf(w, "#%s_FILE=\n", setting.Name)
+		}
+	}
+}
+
+// wrapWords splits text into lines of at most width characters, breaking
+// only between words.
+func wrapWords(text string, width int) []string {
+	var lines []string
+	var line string
+	for _, word := range strings.Fields(text) {
+		if line != "" && len(line)+1+len(word) > width {
+			lines = append(lines, line)
+			line = ""
+		}
+		if line != "" {
+			line += " "
+		}
+		line += word
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func configCommand() (*flag.FlagSet, func() error) {
+	flags := flag.NewFlagSet("config", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: deeplx config check [file]  validate a config file (default $CONFIG_FILE)")
+		fmt.Fprintln(flags.Output(), "       deeplx config init          print a commented default config")
+	}
+
+	return flags, func() error {
+		switch flags.Arg(0) {
+		case "init":
+			writeExampleConfig(os.Stdout)
+			return nil
+		case "check":
+			path := flags.Arg(1)
+			if path == "" {
+				path = os.Getenv("CONFIG_FILE")
+			}
+			if path == "" {
+				return errors.New("no config file given and CONFIG_FILE is not set")
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			problems := checkConfigFile(data)
+			for _, problem := range problems {
+				fmt.Printf("%s: %v\n", path, problem)
+			}
+			if len(problems) > 0 {
+				return fmt.Errorf("%d problem(s) found in %s", len(problems), path)
+			}
+			fmt.Printf("%s: OK\n", path)
+			return nil
+		default:
+			flags.Usage()
+			return fmt.Errorf("unknown config command %q", flags.Arg(0))
+		}
+	}
+}
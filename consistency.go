@@ -0,0 +1,266 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// consistencyWord matches the words terms are made of.
+var consistencyWord = regexp.MustCompile(`\p{L}[\p{L}\p{N}]*(?:['’][\p{L}\p{N}]+)*`)
+
+// termPrecision is the share of the segments holding a phrase of the
+// translations that must also hold a source term for the phrase to count
+// as a translation of the term. It keeps out common words, found in many
+// segments whatever their source.
+const termPrecision = 0.8
+
+// maxConsistencyTerms caps the terms reported, those found in the most
+// segments first.
+const maxConsistencyTerms = 100
+
+// ConsistencyReport lists the texts and terms of a batch or document
+// translated differently in different segments, numbered from 1.
+type ConsistencyReport struct {
+	// Repeated lists source segments translated more than one way.
+	Repeated []consistencyIssue `json:"repeated"`
+	// Terms lists source terms translated more than one way.
+	Terms []consistencyIssue `json:"terms"`
+	// Segments holds the segments the issues refer to.
+	Segments map[int]consistencyPair `json:"segments"`
+}
+
+// consistencyIssue is a source text or term and the ways it was translated,
+// most common first. Other lists the segments holding the term in none of
+// them.
+type consistencyIssue struct {
+	Source   string               `json:"source"`
+	Variants []consistencyVariant `json:"variants"`
+	Other    []int                `json:"other,omitempty"`
+}
+
+type consistencyVariant struct {
+	Text     string `json:"text"`
+	Segments []int  `json:"segments"`
+}
+
+type consistencyPair struct {
+	Source      string `json:"source"`
+	Translation string `json:"translation"`
+}
+
+// consistencyPhrases returns the distinct words and pairs of adjacent words
+// of a text, in lower case. Words shorter than four letters, mostly
+// articles and prepositions, are left out.
+func consistencyPhrases(text string) map[string]bool {
+	phrases := make(map[string]bool)
+	previous := ""
+	for _, word := range consistencyWord.FindAllString(strings.ToLower(text), -1) {
+		if utf8.RuneCountInString(word) < 4 {
+			previous = ""
+			continue
+		}
+		phrases[word] = true
+		if previous != "" {
+			phrases[previous+" "+word] = true
+		}
+		previous = word
+	}
+	return phrases
+}
+
+// consistencyReport checks the translations of segments for consistency.
+// Segments with an empty translation, such as failed ones, are left out.
+//
+// Terms are aligned with their translations by co-occurrence: a phrase of
+// the translations is a translation of a source term when most segments
+// holding it also hold the term. A term is reported when its segments
+// split between several such phrases, or some lack the phrase the others
+// share.
+func consistencyReport(sources, translations []string) ConsistencyReport {
+	report := ConsistencyReport{Repeated: []consistencyIssue{}, Terms: []consistencyIssue{}, Segments: map[int]consistencyPair{}}
+
+	// Identical segments are counted once, with all their numbers.
+	type unit struct {
+		source, translation string
+		numbers             []int
+		sourcePhrases       map[string]bool
+		targetPhrases       map[string]bool
+	}
+	var units []*unit
+	byPair := make(map[[2]string]*unit)
+	bySource := make(map[string][]*unit)
+	var sourceOrder []string
+	for i, source := range sources {
+		source = strings.TrimSpace(source)
+		translation := strings.TrimSpace(translations[i])
+		if source == "" || translation == "" {
+			continue
+		}
+		key := [2]string{source, translation}
+		if u, ok := byPair[key]; ok {
+			u.numbers = append(u.numbers, i+1)
+			continue
+		}
+		u := &unit{source: source, translation: translation, numbers: []int{i + 1}}
+		u.sourcePhrases, u.targetPhrases = consistencyPhrases(source), consistencyPhrases(translation)
+		units = append(units, u)
+		byPair[key] = u
+		if bySource[source] == nil {
+			sourceOrder = append(sourceOrder, source)
+		}
+		bySource[source] = append(bySource[source], u)
+	}
+
+	refer := func(numbers []int) {
+		for _, number := range numbers {
+			report.Segments[number] = consistencyPair{Source: sources[number-1], Translation: translations[number-1]}
+		}
+	}
+
+	for _, source := range sourceOrder {
+		if len(bySource[source]) < 2 {
+			continue
+		}
+		issue := consistencyIssue{Source: source}
+		for _, u := range bySource[source] {
+			issue.Variants = append(issue.Variants, consistencyVariant{Text: u.translation, Segments: u.numbers})
+			refer(u.numbers)
+		}
+		sort.SliceStable(issue.Variants, func(i, j int) bool {
+			return len(issue.Variants[i].Segments) > len(issue.Variants[j].Segments)
+		})
+		report.Repeated = append(report.Repeated, issue)
+	}
+
+	termUnits := make(map[string][]*unit)
+	targetCount := make(map[string]int)
+	for _, u := range units {
+		for phrase := range u.sourcePhrases {
+			termUnits[phrase] = append(termUnits[phrase], u)
+		}
+		for phrase := range u.targetPhrases {
+			targetCount[phrase]++
+		}
+	}
+	var terms []string
+	for term, list := range termUnits {
+		if len(list) >= 2 {
+			terms = append(terms, term)
+		}
+	}
+	// The terms found in the most segments first, and pairs of words before
+	// single words found in as many, so words reporting the same as their
+	// pair are left out.
+	sort.Slice(terms, func(i, j int) bool {
+		if ni, nj := len(termUnits[terms[i]]), len(termUnits[terms[j]]); ni != nj {
+			return ni > nj
+		}
+		if wi, wj := strings.Count(terms[i], " "), strings.Count(terms[j], " "); wi != wj {
+			return wi > wj
+		}
+		return terms[i] < terms[j]
+	})
+
+	seen := make(map[string]bool)
+	for _, term := range terms {
+		list := termUnits[term]
+		cooccurrences := make(map[string]int)
+		for _, u := range list {
+			for phrase := range u.targetPhrases {
+				cooccurrences[phrase]++
+			}
+		}
+		var candidates []string
+		for phrase, count := range cooccurrences {
+			if count >= 2 && float64(count)/float64(targetCount[phrase]) >= termPrecision {
+				candidates = append(candidates, phrase)
+			}
+		}
+		// Among phrases as common, those resembling the term, such as
+		// names left untranslated, are more likely its translation than
+		// words of the sentences around it.
+		close := make(map[string]bool, len(candidates))
+		for _, candidate := range candidates {
+			close[candidate] = similarity(term, candidate) >= 0.5
+		}
+		sort.Slice(candidates, func(i, j int) bool {
+			if ci, cj := cooccurrences[candidates[i]], cooccurrences[candidates[j]]; ci != cj {
+				return ci > cj
+			}
+			if close[candidates[i]] != close[candidates[j]] {
+				return close[candidates[i]]
+			}
+			if li, lj := len(candidates[i]), len(candidates[j]); li != lj {
+				return li < lj
+			}
+			return candidates[i] < candidates[j]
+		})
+
+		// Each segment goes to the most common candidate it holds.
+		remaining := list
+		issue := consistencyIssue{Source: term}
+		for _, candidate := range candidates {
+			var matched, rest []*unit
+			for _, u := range remaining {
+				if u.targetPhrases[candidate] {
+					matched = append(matched, u)
+				} else {
+					rest = append(rest, u)
+				}
+			}
+			if len(matched) < 2 {
+				continue
+			}
+			variant := consistencyVariant{Text: candidate}
+			for _, u := range matched {
+				variant.Segments = append(variant.Segments, u.numbers...)
+			}
+			sort.Ints(variant.Segments)
+			issue.Variants = append(issue.Variants, variant)
+			remaining = rest
+		}
+		for _, u := range remaining {
+			issue.Other = append(issue.Other, u.numbers...)
+		}
+		sort.Ints(issue.Other)
+		if len(issue.Variants) == 0 || (len(issue.Variants) == 1 && len(issue.Other) == 0) {
+			continue
+		}
+
+		key := fmt.Sprint(issue.Variants, issue.Other)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		report.Terms = append(report.Terms, issue)
+		for _, variant := range issue.Variants {
+			refer(variant.Segments)
+		}
+		refer(issue.Other)
+		if len(report.Terms) == maxConsistencyTerms {
+			break
+		}
+	}
+	return report
+}
+
+// handleJobConsistency reports the texts and terms of a job translated
+// inconsistently, for reviewers to fix drift.
+func handleJobConsistency(c *fiber.Ctx) error {
+	job, ok := jobs.get(c.Params("id"))
+	if !ok {
+		return c.Status(404).JSON(fiber.Map{"code": 404, "message": "Job not found"})
+	}
+	translations := make([]string, len(job.texts))
+	for i, result := range job.Results {
+		if result.Code == 200 {
+			translations[i] = result.Data
+		}
+	}
+	return c.JSON(consistencyReport(job.texts, translations))
+}
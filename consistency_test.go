@@ -0,0 +1,49 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestConsistencyReport checks that a term translated two ways is reported
+// with its variants, while consistent terms and common words are not.
+func TestConsistencyReport(t *testing.T) {
+	pairs := [][2]string{
+		{"Open the dashboard.", "Öffnen Sie die Übersicht."},
+		{"Click Save to keep your changes.", "Klicken Sie auf Speichern, um Ihre Änderungen zu behalten."},
+		{"The dashboard shows your projects.", "Die Übersicht zeigt Ihre Projekte."},
+		{"Click the dashboard icon.", "Klicken Sie auf das Dashboard-Symbol."},
+		{"Your projects are listed on the dashboard.", "Ihre Projekte sind im Dashboard aufgeführt."},
+		{"Click Save again.", "Klicken Sie erneut auf Speichern."},
+		{"Open the dashboard.", "Öffne das Dashboard."},
+	}
+	var sources, translations []string
+	for _, pair := range pairs {
+		sources = append(sources, pair[0])
+		translations = append(translations, pair[1])
+	}
+	report := consistencyReport(sources, translations)
+
+	if len(report.Repeated) != 1 || report.Repeated[0].Source != "Open the dashboard." || len(report.Repeated[0].Variants) != 2 {
+		t.Errorf("repeated = %+v", report.Repeated)
+	}
+	var dashboard *consistencyIssue
+	for i, issue := range report.Terms {
+		switch issue.Source {
+		case "dashboard":
+			dashboard = &report.Terms[i]
+		case "click", "save", "projects", "your":
+			t.Errorf("consistent term reported: %+v", issue)
+		}
+	}
+	if dashboard == nil {
+		t.Fatalf("dashboard not reported in %+v", report.Terms)
+	}
+	want := []consistencyVariant{{"dashboard", []int{4, 5, 7}}, {"übersicht", []int{1, 3}}}
+	if !reflect.DeepEqual(dashboard.Variants, want) || len(dashboard.Other) != 0 {
+		t.Errorf("dashboard = %+v, want variants %+v", *dashboard, want)
+	}
+	if report.Segments[4].Translation != translations[3] {
+		t.Errorf("segment 4 = %+v", report.Segments[4])
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// handleDashboard serves the admin dashboard, a page showing the state and
+// recent latency of every upstream from /admin/stats. With OIDC, users
+// without a session are sent to log in first, and the page uses the session
+// cookie. Otherwise it asks for the admin token and keeps it for the browser
+// session.
+func handleDashboard(c *fiber.Ctx) error {
+	page := dashboardPage
+	switch {
+	case oidcEnabled():
+		if _, ok := currentSession(c); !ok {
+			return c.Redirect("/auth/login?next=/admin/dashboard", fiber.StatusFound)
+		}
+		page = strings.Replace(page, "const sessionLogin = false;", "const sessionLogin = true;", 1)
+	case cfg().AdminToken == "":
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+	c.Set(fiber.HeaderContentType, fiber.MIMETextHTMLCharsetUTF8)
+	c.Set(fiber.HeaderContentSecurityPolicy, "default-src 'self'; script-src 'unsafe-inline'; style-src 'unsafe-inline'")
+	return c.SendString(page)
+}
+
+const dashboardPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>DeepLX-Go upstreams</title>
+<style>
+body { font-family: system-ui, sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; width: 100%; }
+th, td { padding: .4em .8em; border-bottom: 1px solid #ddd; text-align: left; vertical-align: middle; }
+th { font-weight: 600; }
+td.number { text-align: right; font-variant-numeric: tabular-nums; }
+.state { padding: .1em .5em; border-radius: .8em; font-size: .9em; }
+.healthy { background: #d7f5dd; }
+.cooling_down { background: #fdf0c4; }
+.quarantined { background: #fbd5d5; }
+.disabled { background: #e4e4e4; }
+polyline { fill: none; stroke: #3b6fd8; stroke-width: 1.5; }
+#status { color: #777; }
+</style>
+</head>
+<body>
+<h1>Upstreams</h1>
+<p id="status">Loading…</p>
+<p><button id="logout" hidden>Log out</button></p>
+<table>
+<thead><tr><th>Endpoint</th><th>Proxy</th><th>State</th><th>Latency</th><th>Recent latency</th><th>Error rate</th><th>Requests</th><th>Weight</th><th></th></tr></thead>
+<tbody id="upstreams"></tbody>
+</table>
+<script>
+"use strict";
+
+// sessionLogin is set by the server when users log in through OIDC.
+const sessionLogin = false;
+
+function token() {
+  let value = sessionStorage.getItem("deeplx-admin-token");
+  if (!value) {
+    value = prompt("Admin token") || "";
+    sessionStorage.setItem("deeplx-admin-token", value);
+  }
+  return value;
+}
+
+async function api(method, path, body) {
+  const response = await fetch(path, {
+    method,
+    headers: sessionLogin ? {"Content-Type": "application/json"} :
+      {"Authorization": "Bearer " + token(), "Content-Type": "application/json"},
+    body: body && JSON.stringify(body),
+  });
+  if (response.status === 401) {
+    if (sessionLogin) {
+      location.href = "/auth/login?next=/admin/dashboard";
+    }
+    sessionStorage.removeItem("deeplx-admin-token");
+  }
+  if (!response.ok) {
+    throw new Error("HTTP " + response.status);
+  }
+  return response.json();
+}
+
+function sparkline(samples) {
+  const width = 120, height = 24;
+  const svg = document.createElementNS("http://www.w3.org/2000/svg", "svg");
+  svg.setAttribute("width", width);
+  svg.setAttribute("height", height);
+  if (samples.length > 1) {
+    const top = Math.max(...samples, 1);
+    const points = samples.map((ms, i) =>
+      (i * width / (samples.length - 1)).toFixed(1) + "," + (height - 1 - ms / top * (height - 2)).toFixed(1));
+    const line = document.createElementNS("http://www.w3.org/2000/svg", "polyline");
+    line.setAttribute("points", points.join(" "));
+    svg.appendChild(line);
+  }
+  svg.appendChild(document.createElementNS("http://www.w3.org/2000/svg", "title")).textContent =
+    samples.length ? "max " + Math.max(...samples) + " ms over the last " + samples.length + " requests" : "no requests yet";
+  return svg;
+}
+
+function cell(row, content, className) {
+  const td = row.insertCell();
+  if (content instanceof Node) {
+    td.appendChild(content);
+  } else {
+    td.textContent = content;
+  }
+  if (className) {
+    td.className = className;
+  }
+  return td;
+}
+
+function render(upstreams) {
+  const body = document.getElementById("upstreams");
+  body.replaceChildren();
+  for (const upstream of upstreams) {
+    const row = body.insertRow();
+    cell(row, upstream.endpoint);
+    cell(row, upstream.proxy || "direct");
+    const state = document.createElement("span");
+    state.className = "state " + upstream.state;
+    state.textContent = upstream.state.replace("_", " ");
+    cell(row, state);
+    cell(row, upstream.requests ? upstream.latency_ms + " ms" : "–", "number");
+    cell(row, sparkline(upstream.recent_latency_ms || []));
+    cell(row, (upstream.error_rate * 100).toFixed(1) + " %", "number");
+    cell(row, upstream.requests, "number");
+    cell(row, upstream.weight, "number");
+    const button = document.createElement("button");
+    button.textContent = upstream.enabled ? "Disable" : "Enable";
+    button.onclick = () => api("PUT", "/admin/upstreams/enabled",
+      {endpoint: upstream.endpoint, proxy: upstream.proxy || "", enabled: !upstream.enabled})
+      .then((data) => render(data.upstreams))
+      .catch(showError);
+    cell(row, button);
+  }
+}
+
+function showError(error) {
+  document.getElementById("status").textContent = "Error: " + error.message;
+}
+
+async function refresh() {
+  try {
+    const stats = await api("GET", "/admin/stats");
+    render(stats.upstreams);
+    document.getElementById("status").textContent =
+      "Updated " + new Date().toLocaleTimeString() + ", " + stats.jobs.queued + " job(s) queued";
+  } catch (error) {
+    showError(error);
+  }
+}
+
+if (sessionLogin) {
+  const logout = document.getElementById("logout");
+  logout.hidden = false;
+  logout.onclick = () => fetch("/auth/logout", {method: "POST"}).then(() => { location.href = "/"; });
+}
+
+refresh();
+setInterval(refresh, 5000);
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"log"
+	"math"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Units /diff compares translations in.
+const (
+	DiffLines     = "line"
+	DiffSentences = "sentence"
+	DiffWords     = "word"
+)
+
+// maxDiffCells caps the size of the table diffTexts fills, the product of
+// the unit counts of both texts. Larger texts are reported as replaced
+// whole.
+const maxDiffCells = 4 << 20
+
+// DiffRequest is a /translate request for the current source text, along
+// with the translation of its previous version.
+type DiffRequest struct {
+	TranslateParams
+	Previous    string `json:"previous"`
+	Granularity string `json:"granularity"`
+}
+
+type DiffResponse struct {
+	Code        int      `json:"code"`
+	Message     string   `json:"message"`
+	SourceLang  string   `json:"source_lang,omitempty"`
+	TargetLang  string   `json:"target_lang,omitempty"`
+	Translation string   `json:"translation,omitempty"`
+	Changed     bool     `json:"changed"`
+	Similarity  float64  `json:"similarity"`
+	Diff        []diffOp `json:"diff,omitempty"`
+}
+
+// diffOp is a run of units kept (equal), added (insert), removed (delete) or
+// replaced between the previous translation and the new one. Kept runs only
+// have Text.
+type diffOp struct {
+	Op       string `json:"op"`
+	Previous string `json:"previous,omitempty"`
+	Text     string `json:"text,omitempty"`
+}
+
+// diffUnits splits a text into the units it is compared in, and returns the
+// separator they are joined with in the diff.
+func diffUnits(text, granularity string) ([]string, string) {
+	var units []string
+	switch granularity {
+	case DiffWords:
+		return strings.Fields(text), " "
+	case DiffSentences:
+		for _, segment := range splitSentences(text) {
+			units = append(units, segment.Text)
+		}
+		return units, " "
+	}
+	for _, line := range strings.Split(strings.TrimSpace(text), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			units = append(units, line)
+		}
+	}
+	return units, "\n"
+}
+
+// diffTexts compares the units of two texts by their longest common
+// subsequence. Adjacent units of the same kind form one run, and adjacent
+// removals and additions one replacement.
+func diffTexts(previous, current []string, sep string) []diffOp {
+	n, m := len(previous), len(current)
+	if n*m > maxDiffCells {
+		return []diffOp{{Op: "replace", Previous: strings.Join(previous, sep), Text: strings.Join(current, sep)}}
+	}
+	// common[i][j] is the length of the longest common subsequence of
+	// previous[i:] and current[j:].
+	common := make([][]int, n+1)
+	for i := range common {
+		common[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if previous[i] == current[j] {
+				common[i][j] = common[i+1][j+1] + 1
+			} else {
+				common[i][j] = max(common[i+1][j], common[i][j+1])
+			}
+		}
+	}
+
+	var ops []diffOp
+	add := func(op, previous, text string) {
+		last := len(ops) - 1
+		if last < 0 || (op == "equal") != (ops[last].Op == "equal") {
+			ops = append(ops, diffOp{Op: op, Previous: previous, Text: text})
+			return
+		}
+		run := &ops[last]
+		if previous != "" {
+			run.Previous = joinUnit(run.Previous, previous, sep)
+		}
+		if text != "" {
+			run.Text = joinUnit(run.Text, text, sep)
+		}
+		if run.Op != op {
+			run.Op = "replace"
+		}
+	}
+	i, j := 0, 0
+	for i < n || j < m {
+		switch {
+		case i < n && j < m && previous[i] == current[j]:
+			add("equal", "", current[j])
+			i, j = i+1, j+1
+		case j < m && (i == n || common[i][j+1] >= common[i+1][j]):
+			add("insert", "", current[j])
+			j++
+		default:
+			add("delete", previous[i], "")
+			i++
+		}
+	}
+	return ops
+}
+
+func joinUnit(run, unit, sep string) string {
+	if run == "" {
+		return unit
+	}
+	return run + sep + unit
+}
+
+// handleDiff translates the current version of a source text and compares
+// the translation with the one of its previous version, so that translated
+// documents can be brought in line with their edited originals.
+func handleDiff(c *fiber.Ctx) error {
+	var request DiffRequest
+	if err := c.BodyParser(&request); err != nil {
+		log.Printf("Error parsing request body: %v", err)
+		return c.Status(400).JSON(DiffResponse{
+			Code:    400,
+			Message: "Invalid request body",
+		})
+	}
+	granularity := strings.ToLower(request.Granularity)
+	switch granularity {
+	case "":
+		granularity = DiffLines
+	case DiffLines, DiffSentences, DiffWords:
+	default:
+		return c.Status(400).JSON(DiffResponse{
+			Code:    400,
+			Message: "Invalid granularity, use line, sentence or word",
+		})
+	}
+
+	params := request.TranslateParams
+	applyKeyDefaults(c, &params)
+	applyCompatMode(&params)
+	params.usageKey = meterRequest(c)
+	params.client = clientKey(c)
+	result := translate(params)
+	if result.Code != 200 {
+		return c.Status(result.Code).JSON(DiffResponse{
+			Code:    result.Code,
+			Message: result.Message,
+		})
+	}
+
+	previous, sep := diffUnits(request.Previous, granularity)
+	current, _ := diffUnits(result.Data, granularity)
+	ops := diffTexts(previous, current, sep)
+	changed := false
+	for _, op := range ops {
+		changed = changed || op.Op != "equal"
+	}
+	return c.JSON(DiffResponse{
+		Code:        200,
+		Message:     "success",
+		SourceLang:  result.SourceLang,
+		TargetLang:  result.TargetLang,
+		Translation: result.Data,
+		Changed:     changed,
+		Similarity:  math.Round(similarity(request.Previous, result.Data)*100) / 100,
+		Diff:        ops,
+	})
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"log"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// flagLanguages maps the country of a flag emoji to the DeepL target
+// language a reaction with it translates to.
+var flagLanguages = map[string]string{
+	"US": "EN-US", "GB": "EN-GB", "AU": "EN-GB", "CA": "EN-US",
+	"DE": "DE", "AT": "DE", "CH": "DE",
+	"FR": "FR", "BE": "FR",
+	"ES": "ES", "MX": "ES", "AR": "ES",
+	"IT": "IT", "NL": "NL", "PL": "PL",
+	"PT": "PT-PT", "BR": "PT-BR",
+	"RU": "RU", "UA": "UK", "BG": "BG",
+	"JP": "JA", "CN": "ZH", "TW": "ZH", "KR": "KO",
+	"GR": "EL", "DK": "DA", "SE": "SV", "NO": "NB", "FI": "FI",
+	"CZ": "CS", "SK": "SK", "SI": "SL", "EE": "ET", "LV": "LV", "LT": "LT",
+	"HU": "HU", "RO": "RO", "TR": "TR", "ID": "ID", "SA": "AR", "EG": "AR",
+}
+
+// flagLanguage returns the target language of a flag emoji such as 🇩🇪.
+func flagLanguage(emoji string) (string, bool) {
+	runes := []rune(emoji)
+	if len(runes) != 2 {
+		return "", false
+	}
+	var country strings.Builder
+	for _, r := range runes {
+		if r < '\U0001F1E6' || r > '\U0001F1FF' {
+			return "", false
+		}
+		country.WriteRune('A' + r - '\U0001F1E6')
+	}
+	lang, ok := flagLanguages[country.String()]
+	return lang, ok
+}
+
+var discordCommand = &discordgo.ApplicationCommand{
+	Name:        "translate",
+	Description: "Translate a text",
+	Options: []*discordgo.ApplicationCommandOption{
+		{Type: discordgo.ApplicationCommandOptionString, Name: "text", Description: "Text to translate", Required: true},
+		{Type: discordgo.ApplicationCommandOptionString, Name: "target_lang", Description: "Target language, e.g. DE (default " + cfg().DiscordTargetLang + ")"},
+		{Type: discordgo.ApplicationCommandOptionString, Name: "source_lang", Description: "Source language (detected by default)"},
+	},
+}
+
+// startDiscordBot connects to the Discord gateway and serves the /translate
+// slash command and flag reactions. Reading the message a reaction was
+// added to needs the privileged Message Content intent.
+func startDiscordBot(token string) error {
+	session, err := discordgo.New("Bot " + token)
+	if err != nil {
+		return err
+	}
+	session.Identify.Intents = discordgo.IntentsGuilds |
+		discordgo.IntentsGuildMessageReactions |
+		discordgo.IntentsDirectMessageReactions |
+		discordgo.IntentsMessageContent
+
+	session.AddHandler(func(s *discordgo.Session, ready *discordgo.Ready) {
+		if _, err := s.ApplicationCommandCreate(ready.User.ID, "", discordCommand); err != nil {
+			log.Printf("Error registering Discord command: %v", err)
+		}
+	})
+	session.AddHandler(handleDiscordCommand)
+	session.AddHandler(handleDiscordReaction)
+	return session.Open()
+}
+
+// discordTranslate translates text on behalf of a Discord user, applying
+// the same rate limit as API callers.
+func discordTranslate(userID string, params TranslateParams) string {
+	if !callerLimits.allow("discord:" + userID) {
+		return "Too many requests, please try again later."
+	}
+	result := translate(params)
+	if result.Code != 200 {
+		return "Translation failed: " + result.Message
+	}
+	return result.Data
+}
+
+func handleDiscordCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if i.Type != discordgo.InteractionApplicationCommand || i.ApplicationCommandData().Name != discordCommand.Name {
+		return
+	}
+
+	params := TranslateParams{TargetLang: cfg().DiscordTargetLang}
+	for _, option := range i.ApplicationCommandData().Options {
+		switch option.Name {
+		case "text":
+			params.Text = option.StringValue()
+		case "target_lang":
+			params.TargetLang = strings.ToUpper(option.StringValue())
+		case "source_lang":
+			params.SourceLang = strings.ToUpper(option.StringValue())
+		}
+	}
+
+	// Interactions must be acknowledged within three seconds, which a slow
+	// upstream can exceed, so the reply is deferred and edited in.
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+	})
+	if err != nil {
+		log.Printf("Error acknowledging Discord command: %v", err)
+		return
+	}
+
+	user := i.User
+	if i.Member != nil {
+		user = i.Member.User
+	}
+	reply := discordTranslate(user.ID, params)
+	if _, err := s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{Content: &reply}); err != nil {
+		log.Printf("Error replying to Discord command: %v", err)
+	}
+}
+
+// handleDiscordReaction replies to a message with its translation when
+// someone reacts to it with a flag.
+func handleDiscordReaction(s *discordgo.Session, r *discordgo.MessageReactionAdd) {
+	lang, ok := flagLanguage(r.Emoji.Name)
+	if !ok || r.UserID == s.State.User.ID {
+		return
+	}
+
+	message, err := s.ChannelMessage(r.ChannelID, r.MessageID)
+	if err != nil {
+		log.Printf("Error fetching Discord message: %v", err)
+		return
+	}
+	if strings.TrimSpace(message.Content) == "" {
+		return
+	}
+
+	reply := discordTranslate(r.UserID, TranslateParams{Text: message.Content, TargetLang: lang})
+	_, err = s.ChannelMessageSendReply(r.ChannelID, reply, message.Reference())
+	if err != nil {
+		log.Printf("Error replying on Discord: %v", err)
+	}
+}
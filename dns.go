@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// dohClient sends DNS over HTTPS queries. The DoH server itself is resolved
+// by the system, so DOH_URL is best given with an IP address.
+var dohClient = &http.Client{Timeout: 10 * time.Second}
+
+// upstreamDialer connects to endpoints, or to proxies when they are used.
+var upstreamDialer = &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+
+// resolver resolves the hosts upstream connections are made to.
+var resolver = &dnsCache{entries: make(map[string]dnsEntry)}
+
+// dnsCache keeps resolved addresses for DNS_CACHE_TTL, resolving with DNS
+// over HTTPS when DOH_URL is set and with the system resolver otherwise.
+type dnsCache struct {
+	mu      sync.Mutex
+	entries map[string]dnsEntry
+}
+
+type dnsEntry struct {
+	addrs   []netip.Addr
+	expires time.Time
+}
+
+// lookup returns the addresses of host. When resolving fails, addresses
+// cached earlier are used even if they have expired.
+func (r *dnsCache) lookup(ctx context.Context, host string) ([]netip.Addr, error) {
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return []netip.Addr{addr}, nil
+	}
+
+	r.mu.Lock()
+	entry, cached := r.entries[host]
+	r.mu.Unlock()
+	if cached && time.Now().Before(entry.expires) {
+		return entry.addrs, nil
+	}
+
+	addrs, err := resolveHost(ctx, host)
+	if err != nil {
+		if cached {
+			log.Printf("Error resolving %s, using cached addresses: %v", host, err)
+			return entry.addrs, nil
+		}
+		return nil, err
+	}
+	if ttl := cfg().DNSCacheTTL; ttl > 0 {
+		r.mu.Lock()
+		r.entries[host] = dnsEntry{addrs: addrs, expires: time.Now().Add(ttl)}
+		r.mu.Unlock()
+	}
+	return addrs, nil
+}
+
+func resolveHost(ctx context.Context, host string) ([]netip.Addr, error) {
+	dohURL := cfg().DoHURL
+	if dohURL == "" {
+		return net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	}
+
+	// IPv4 first, as it is the more likely to be routable.
+	var addrs []netip.Addr
+	var errs []error
+	for _, qtype := range []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA} {
+		found, err := queryDoH(ctx, dohURL, host, qtype)
+		addrs = append(addrs, found...)
+		errs = append(errs, err)
+	}
+	if len(addrs) == 0 {
+		if err := errors.Join(errs...); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("no addresses found for %s", host)
+	}
+	return addrs, nil
+}
+
+// queryDoH asks the DNS over HTTPS server at dohURL for the records of type
+// qtype of host, as described in RFC 8484.
+func queryDoH(ctx context.Context, dohURL, host string, qtype dnsmessage.Type) ([]netip.Addr, error) {
+	name, err := dnsmessage.NewName(strings.TrimSuffix(host, ".") + ".")
+	if err != nil {
+		return nil, err
+	}
+	query, err := (&dnsmessage.Message{
+		Header:    dnsmessage.Header{RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: name, Type: qtype, Class: dnsmessage.ClassINET}},
+	}).Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, dohURL, bytes.NewReader(query))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+	resp, err := dohClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("DNS over HTTPS query for %s returned %s", host, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return nil, err
+	}
+
+	var reply dnsmessage.Message
+	if err := reply.Unpack(data); err != nil {
+		return nil, fmt.Errorf("invalid DNS over HTTPS reply for %s: %w", host, err)
+	}
+	if reply.RCode != dnsmessage.RCodeSuccess {
+		return nil, fmt.Errorf("DNS over HTTPS query for %s failed: %v", host, reply.RCode)
+	}
+	// The answers may also hold the CNAME records leading to the addresses.
+	var addrs []netip.Addr
+	for _, answer := range reply.Answers {
+		switch body := answer.Body.(type) {
+		case *dnsmessage.AResource:
+			addrs = append(addrs, netip.AddrFrom4(body.A))
+		case *dnsmessage.AAAAResource:
+			addrs = append(addrs, netip.AddrFrom16(body.AAAA))
+		}
+	}
+	return addrs, nil
+}
+
+// dialUpstream connects to address, resolving its host with resolver and
+// trying its addresses in turn. It connects from the local address picked
+// by withSourceAddr, if any.
+func dialUpstream(ctx context.Context, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	addrs, err := resolver.lookup(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("no addresses found for %s", host)
+	}
+
+	dialer := upstreamDialer
+	local, bound := ctx.Value(sourceAddrKey{}).(netip.Addr)
+	if bound {
+		dialer = &net.Dialer{
+			Timeout:   upstreamDialer.Timeout,
+			KeepAlive: upstreamDialer.KeepAlive,
+			LocalAddr: &net.TCPAddr{IP: local.AsSlice()},
+		}
+	}
+
+	var errs []error
+	for _, addr := range addrs {
+		addr = addr.Unmap()
+		if bound && addr.Is4() != local.Is4() {
+			continue
+		}
+		conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(addr.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		errs = append(errs, err)
+	}
+	if len(errs) == 0 {
+		return nil, fmt.Errorf("no address of %s can be reached from %s", host, local)
+	}
+	return nil, errors.Join(errs...)
+}
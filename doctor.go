@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Thresholds of the checks of deeplx doctor.
+const (
+	certExpiryWarning = 14 * 24 * time.Hour
+	clockSkewWarning  = 30 * time.Second
+	// S3 rejects requests signed more than 15 minutes off its clock.
+	clockSkewFailure = 5 * time.Minute
+)
+
+func doctorCommand() (*flag.FlagSet, func() error) {
+	flags := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	timeout := flags.Duration("timeout", 10*time.Second, "timeout of each network check")
+
+	return flags, func() error {
+		// Failures are reported by the checks, not logged as by the server.
+		log.SetOutput(io.Discard)
+
+		report := &doctorReport{}
+		checkConfig(report)
+		checkUpstreams(report, *timeout)
+		checkEndpoints(report, *timeout)
+
+		fmt.Printf("\n%d failure(s), %d warning(s)\n", report.failures, report.warnings)
+		if report.failures > 0 {
+			return fmt.Errorf("%d check(s) failed", report.failures)
+		}
+		return nil
+	}
+}
+
+// doctorReport prints the outcome of the checks of deeplx doctor.
+type doctorReport struct {
+	failures, warnings int
+}
+
+func (r *doctorReport) section(title string) {
+	fmt.Printf("\n%s\n", title)
+}
+
+func (r *doctorReport) ok(format string, args ...any) {
+	fmt.Printf("  ok    %s\n", fmt.Sprintf(format, args...))
+}
+
+func (r *doctorReport) warn(format string, args ...any) {
+	r.warnings++
+	fmt.Printf("  WARN  %s\n", fmt.Sprintf(format, args...))
+}
+
+func (r *doctorReport) fail(format string, args ...any) {
+	r.failures++
+	fmt.Printf("  FAIL  %s\n", fmt.Sprintf(format, args...))
+}
+
+func checkConfig(report *doctorReport) {
+	report.section("Configuration")
+
+	if path := os.Getenv("CONFIG_FILE"); path == "" {
+		report.ok("CONFIG_FILE is not set, the environment is used alone")
+	} else if data, err := os.ReadFile(path); err != nil {
+		report.fail("CONFIG_FILE: %v", err)
+	} else if problems := checkConfigFile(data); len(problems) > 0 {
+		for _, problem := range problems {
+			report.fail("%s: %v", path, problem)
+		}
+	} else {
+		report.ok("%s has no problems", path)
+	}
+
+	set, valid := 0, true
+	for _, setting := range configSettings {
+		value := strings.TrimSpace(os.Getenv(setting.Name))
+		if value == "" {
+			continue
+		}
+		set++
+		if setting.Check != nil {
+			if err := setting.Check(value); err != nil {
+				report.fail("environment variable %s: %v", setting.Name, err)
+				valid = false
+			}
+		}
+	}
+	if valid {
+		report.ok("%d setting(s) in the environment are valid", set)
+	}
+
+	if getEnv("SECRETS_URL", "") != "" {
+		if _, err := fetchRemoteSettings(); err != nil {
+			report.fail("SECRETS_URL: %v", err)
+		} else {
+			report.ok("SECRETS_URL is readable")
+		}
+	}
+	if chaosEnabled() {
+		report.warn("fault injection is enabled by the CHAOS_* settings")
+	}
+}
+
+// checkUpstreams translates a word through every endpoint and proxy
+// combination.
+func checkUpstreams(report *doctorReport, timeout time.Duration) {
+	report.section("Upstreams")
+
+	params := TranslateParams{Text: "Hello", SourceLang: "EN", TargetLang: "DE"}
+	for _, target := range upstreams.snapshot() {
+		body, err := target.requestBody(params, []string{params.Text})
+		if err != nil {
+			report.fail("%s: %v", target.name(), err)
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		start := time.Now()
+		reply := postUpstream(ctx, target, body)
+		took := time.Since(start)
+		cancel()
+
+		switch {
+		case reply.Err != nil:
+			report.fail("%s: %v", target.name(), reply.Err)
+		case reply.Status == http.StatusTooManyRequests:
+			report.warn("%s: reachable but rate limited (HTTP 429)", target.name())
+		case reply.Status != http.StatusOK:
+			report.fail("%s: HTTP %d", target.name(), reply.Status)
+		default:
+			if problems := upstreamSchemaProblems(reply.Body, 1); len(problems) > 0 {
+				report.fail("%s: unexpected response %.100q: %s", target.name(), reply.Body, strings.Join(problems, "; "))
+			} else {
+				report.ok("%s: translated in %v", target.name(), took.Round(time.Millisecond))
+			}
+		}
+		reply.release()
+	}
+}
+
+// checkEndpoints checks the TLS certificate of every endpoint and compares
+// the local clock with the Date header of its response.
+func checkEndpoints(report *doctorReport, timeout time.Duration) {
+	report.section("TLS and clock")
+
+	seen := make(map[string]bool)
+	for _, target := range upstreams.snapshot() {
+		if seen[target.Endpoint] {
+			continue
+		}
+		seen[target.Endpoint] = true
+
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.Endpoint, nil)
+		if err != nil {
+			cancel()
+			report.fail("%s: %v", target.Endpoint, err)
+			continue
+		}
+		start := time.Now()
+		resp, err := target.client.Do(req)
+		if err != nil {
+			cancel()
+			report.fail("%s: %v", target.Endpoint, err)
+			continue
+		}
+		// The response is taken to be dated halfway through the request.
+		received := start.Add(time.Since(start) / 2)
+		resp.Body.Close()
+		cancel()
+
+		checkTLS(report, target.Endpoint, resp.TLS)
+		if date, err := http.ParseTime(resp.Header.Get("Date")); err == nil {
+			checkClock(report, target.Endpoint, received.Sub(date))
+		} else {
+			report.warn("%s: no Date header to compare the clock with", target.Endpoint)
+		}
+	}
+}
+
+func checkTLS(report *doctorReport, endpoint string, state *tls.ConnectionState) {
+	if state == nil {
+		report.warn("%s: not encrypted", endpoint)
+		return
+	}
+	if len(state.PeerCertificates) == 0 {
+		report.fail("%s: no certificate presented", endpoint)
+		return
+	}
+	cert := state.PeerCertificates[0]
+	left := time.Until(cert.NotAfter)
+	if left < certExpiryWarning {
+		report.warn("%s: %s, certificate expires in %v", endpoint, tls.VersionName(state.Version), left.Round(time.Hour))
+		return
+	}
+	report.ok("%s: %s, certificate valid until %s", endpoint, tls.VersionName(state.Version), cert.NotAfter.Format(time.DateOnly))
+}
+
+func checkClock(report *doctorReport, endpoint string, skew time.Duration) {
+	// The Date header has a resolution of one second.
+	skew = skew.Round(time.Second)
+	switch {
+	case skew.Abs() >= clockSkewFailure:
+		report.fail("%s: local clock is %v off", endpoint, skew)
+	case skew.Abs() >= clockSkewWarning:
+		report.warn("%s: local clock is %v off", endpoint, skew)
+	default:
+		report.ok("%s: local clock is within %v", endpoint, max(skew.Abs(), time.Second))
+	}
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"path/filepath"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// document is a parsed file whose translatable segments can be replaced by
+// their translations to render the translated file.
+type document interface {
+	Segments() []string
+	Render(translations []string) ([]byte, error)
+}
+
+// documentFormat describes a supported file format. Formats that can't be
+// written back, such as PDF, set the OutputExtension of what they render.
+type documentFormat struct {
+	Name            string
+	Extensions      []string
+	MIMETypes       []string
+	ContentType     string
+	OutputExtension string
+	Parse           func(data []byte, options documentOptions) (document, error)
+}
+
+// documentOptions are the parsing options of an upload. Columns and Header
+// apply to CSV and TSV files.
+type documentOptions struct {
+	Columns []string
+	Header  bool
+}
+
+var documentFormats = []documentFormat{
+	{
+		Name:        "txt",
+		Extensions:  []string{".txt"},
+		MIMETypes:   []string{"text/plain"},
+		ContentType: "text/plain; charset=utf-8",
+		Parse:       parseTextDocument,
+	},
+	{
+		Name:        "md",
+		Extensions:  []string{".md", ".markdown"},
+		MIMETypes:   []string{"text/markdown", "text/x-markdown"},
+		ContentType: "text/markdown; charset=utf-8",
+		Parse:       parseMarkdownDocument,
+	},
+	{
+		Name:        "srt",
+		Extensions:  []string{".srt"},
+		MIMETypes:   []string{"application/x-subrip", "text/srt"},
+		ContentType: "application/x-subrip; charset=utf-8",
+		Parse:       parseSRTDocument,
+	},
+	{
+		Name:        "csv",
+		Extensions:  []string{".csv"},
+		MIMETypes:   []string{"text/csv"},
+		ContentType: "text/csv; charset=utf-8",
+		Parse:       parseCSVDocument,
+	},
+	{
+		Name:        "tsv",
+		Extensions:  []string{".tsv", ".tab"},
+		MIMETypes:   []string{"text/tab-separated-values"},
+		ContentType: "text/tab-separated-values; charset=utf-8",
+		Parse:       parseTSVDocument,
+	},
+	{
+		Name:        "json",
+		Extensions:  []string{".json"},
+		MIMETypes:   []string{"application/json"},
+		ContentType: "application/json; charset=utf-8",
+		Parse:       parseJSONDocument,
+	},
+	{
+		Name:        "po",
+		Extensions:  []string{".po", ".pot"},
+		MIMETypes:   []string{"text/x-po", "text/x-gettext-translation"},
+		ContentType: "text/x-po; charset=utf-8",
+		Parse:       parsePODocument,
+	},
+	{
+		Name:        "android",
+		Extensions:  []string{".xml"},
+		MIMETypes:   []string{"application/xml", "text/xml"},
+		ContentType: "application/xml; charset=utf-8",
+		Parse:       parseAndroidDocument,
+	},
+	{
+		Name:        "strings",
+		Extensions:  []string{".strings"},
+		ContentType: "text/plain; charset=utf-8",
+		Parse:       parseAppleStringsDocument,
+	},
+	{
+		Name:        "stringsdict",
+		Extensions:  []string{".stringsdict"},
+		ContentType: "application/x-plist; charset=utf-8",
+		Parse:       parseStringsdictDocument,
+	},
+	{
+		Name:        "docx",
+		Extensions:  []string{".docx"},
+		MIMETypes:   []string{"application/vnd.openxmlformats-officedocument.wordprocessingml.document"},
+		ContentType: "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+		Parse:       parseDOCXDocument,
+	},
+	{
+		Name:        "epub",
+		Extensions:  []string{".epub"},
+		MIMETypes:   []string{"application/epub+zip"},
+		ContentType: "application/epub+zip",
+		Parse:       parseEPUBDocument,
+	},
+	{
+		Name:            "pdf",
+		Extensions:      []string{".pdf"},
+		MIMETypes:       []string{"application/pdf"},
+		ContentType:     "text/markdown; charset=utf-8",
+		OutputExtension: ".md",
+		Parse:           parsePDFDocument,
+	},
+}
+
+// Document output modes.
+const (
+	DocumentOutputTranslated  = "translated"
+	DocumentOutputBilingual   = "bilingual"
+	DocumentOutputConsistency = "consistency"
+)
+
+// detectDocumentFormat picks the format by explicit name, then by file
+// extension, then by MIME type.
+func detectDocumentFormat(name, filename, contentType string) (documentFormat, bool) {
+	ext := strings.ToLower(filepath.Ext(filename))
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+
+	for _, match := range []func(documentFormat) bool{
+		func(f documentFormat) bool { return name != "" && strings.EqualFold(f.Name, name) },
+		func(f documentFormat) bool { return ext != "" && containsFold(f.Extensions, ext) },
+		func(f documentFormat) bool { return mediaType != "" && containsFold(f.MIMETypes, mediaType) },
+	} {
+		for _, format := range documentFormats {
+			if match(format) {
+				return format, true
+			}
+		}
+	}
+	return documentFormat{}, false
+}
+
+func containsFold(list []string, value string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// errQueueFull is returned when the worker pool has no room for a document.
+var errQueueFull = &translateError{Code: 503, Message: "Job queue is full, please try again later"}
+
+// translateSegments translates the segments of a document on the job worker
+// pool, with up to cfg().JobConcurrency requests in flight. Blank segments
+// are kept as they are.
+func translateSegments(params TranslateParams, segments []string) ([]string, error) {
+	results, ok := jobs.translate(params, segments)
+	if !ok {
+		return nil, errQueueFull
+	}
+	translations := make([]string, len(segments))
+	for i, result := range results {
+		if result.Code != 200 {
+			return nil, &translateError{Code: result.Code, Message: result.Message}
+		}
+		translations[i] = result.Data
+	}
+	return translations, nil
+}
+
+// translatedFilename inserts the target language before the extension, so
+// "guide.md" translated to German becomes "guide.de.md". A non-empty ext
+// replaces the original extension.
+func translatedFilename(filename, targetLang, ext string) string {
+	base := strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
+	if base == "" || base == "." {
+		base = "document"
+	}
+	if ext == "" {
+		ext = filepath.Ext(filename)
+	}
+	if targetLang == "" {
+		targetLang = "en"
+	}
+	return base + "." + strings.ToLower(targetLang) + ext
+}
+
+func handleDocument(c *fiber.Ctx) error {
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"code": 400, "message": "Missing file upload"})
+	}
+
+	format, ok := detectDocumentFormat(c.FormValue("format"), fileHeader.Filename, fileHeader.Header.Get("Content-Type"))
+	if !ok {
+		return c.Status(415).JSON(fiber.Map{"code": 415, "message": "Unsupported document format"})
+	}
+	output := c.FormValue("output", DocumentOutputTranslated)
+	if output != DocumentOutputTranslated && output != DocumentOutputBilingual && output != DocumentOutputConsistency {
+		return c.Status(400).JSON(fiber.Map{"code": 400, "message": "Invalid output: " + output})
+	}
+	layout := c.FormValue("layout", BilingualTable)
+	if !isValidBilingualLayout(layout) {
+		return c.Status(400).JSON(fiber.Map{"code": 400, "message": "Invalid layout: " + layout})
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		log.Printf("Error opening uploaded file: %v", err)
+		return c.Status(400).JSON(fiber.Map{"code": 400, "message": "Failed to read upload"})
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		log.Printf("Error reading uploaded file: %v", err)
+		return c.Status(400).JSON(fiber.Map{"code": 400, "message": "Failed to read upload"})
+	}
+
+	options := documentOptions{
+		Columns: splitList(c.FormValue("columns")),
+		Header:  c.FormValue("header") != "false",
+	}
+	doc, err := format.Parse(data, options)
+	if err != nil {
+		return c.Status(422).JSON(fiber.Map{"code": 422, "message": fmt.Sprintf("Invalid %s document: %v", format.Name, err)})
+	}
+
+	params := TranslateParams{
+		SourceLang: c.FormValue("source_lang"),
+		TargetLang: c.FormValue("target_lang"),
+	}
+	applyKeyDefaults(c, &params)
+	params.usageKey = meterRequest(c)
+	params.client = clientKey(c)
+	translations, err := translateSegments(params, doc.Segments())
+	if err != nil {
+		failure := &translateError{Code: 500, Message: "Translation failed"}
+		errors.As(err, &failure)
+		return c.Status(failure.Code).JSON(fiber.Map{"code": failure.Code, "message": failure.Message})
+	}
+
+	if output == DocumentOutputConsistency {
+		return c.JSON(consistencyReport(doc.Segments(), translations))
+	}
+	if output == DocumentOutputBilingual {
+		export := renderBilingual(layout, doc.Segments(), translations)
+		c.Attachment(translatedFilename(fileHeader.Filename, params.TargetLang, export.Extension))
+		c.Set(fiber.HeaderContentType, export.ContentType)
+		return c.Send(export.Data)
+	}
+
+	rendered, err := doc.Render(translations)
+	if err != nil {
+		log.Printf("Error rendering %s document: %v", format.Name, err)
+		return c.Status(500).JSON(fiber.Map{"code": 500, "message": "Failed to build translated document"})
+	}
+
+	c.Attachment(translatedFilename(fileHeader.Filename, params.TargetLang, format.OutputExtension))
+	c.Set(fiber.HeaderContentType, format.ContentType)
+	return c.Send(rendered)
+}
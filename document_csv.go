@@ -0,0 +1,194 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// csvField is the range of a field in the raw file and its unquoted value.
+type csvField struct {
+	start, end int
+	quoted     bool
+	value      string
+}
+
+// csvDocument translates selected columns of a CSV or TSV file. Only the
+// translated fields are rewritten; delimiters, line endings, quoting and
+// all other fields are kept byte for byte.
+type csvDocument struct {
+	raw       string
+	delimiter byte
+	fields    []csvField
+	segments  []string
+}
+
+func parseCSVDocument(data []byte, options documentOptions) (document, error) {
+	return parseDelimitedDocument(data, ',', options)
+}
+
+func parseTSVDocument(data []byte, options documentOptions) (document, error) {
+	return parseDelimitedDocument(data, '\t', options)
+}
+
+func parseDelimitedDocument(data []byte, delimiter byte, options documentOptions) (document, error) {
+	rows, err := scanDelimited(string(data), delimiter)
+	if err != nil {
+		return nil, err
+	}
+
+	first := 0
+	if options.Header && len(rows) > 0 {
+		first = 1
+	}
+	columns, err := selectColumns(rows, options)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := &csvDocument{raw: string(data), delimiter: delimiter}
+	for _, row := range rows[first:] {
+		for i, field := range row {
+			if columns != nil && !columns[i] || strings.TrimSpace(field.value) == "" {
+				continue
+			}
+			doc.fields = append(doc.fields, field)
+			doc.segments = append(doc.segments, field.value)
+		}
+	}
+	return doc, nil
+}
+
+// selectColumns resolves the requested columns, given by header name or by
+// 1-based number, to column indexes. It returns nil to select every column.
+func selectColumns(rows [][]csvField, options documentOptions) (map[int]bool, error) {
+	if len(options.Columns) == 0 {
+		return nil, nil
+	}
+
+	columns := make(map[int]bool)
+	for _, column := range options.Columns {
+		if n, err := strconv.Atoi(column); err == nil && n > 0 {
+			columns[n-1] = true
+			continue
+		}
+
+		found := false
+		if options.Header && len(rows) > 0 {
+			for i, field := range rows[0] {
+				if strings.EqualFold(strings.TrimSpace(field.value), column) {
+					columns[i] = true
+					found = true
+				}
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown column %q", column)
+		}
+	}
+	return columns, nil
+}
+
+// scanDelimited splits raw into rows of fields, remembering where each field
+// is so that it can be replaced without touching the rest of the file.
+func scanDelimited(raw string, delimiter byte) ([][]csvField, error) {
+	var rows [][]csvField
+	var row []csvField
+	line := 1
+
+	i := 0
+	for i < len(raw) {
+		field := csvField{start: i}
+		if raw[i] == '"' {
+			field.quoted = true
+			var value strings.Builder
+			i++
+			for {
+				end := strings.IndexByte(raw[i:], '"')
+				if end < 0 {
+					return nil, fmt.Errorf("unterminated quoted field on line %d", line)
+				}
+				value.WriteString(raw[i : i+end])
+				line += strings.Count(raw[i:i+end], "\n")
+				i += end + 1
+				if i < len(raw) && raw[i] == '"' {
+					value.WriteByte('"')
+					i++
+					continue
+				}
+				break
+			}
+			if i < len(raw) && raw[i] != delimiter && raw[i] != '\n' && raw[i] != '\r' {
+				return nil, fmt.Errorf("unexpected text after quoted field on line %d", line)
+			}
+			field.value = value.String()
+		} else {
+			end := strings.IndexAny(raw[i:], string(delimiter)+"\r\n")
+			if end < 0 {
+				end = len(raw) - i
+			}
+			field.value = raw[i : i+end]
+			i += end
+		}
+		field.end = i
+		row = append(row, field)
+
+		switch {
+		case i >= len(raw):
+		case raw[i] == delimiter:
+			i++
+			// A trailing delimiter ends the row with an empty field.
+			if i == len(raw) || raw[i] == '\n' || raw[i] == '\r' {
+				row = append(row, csvField{start: i, end: i})
+			}
+			continue
+		case raw[i] == '\r':
+			i++
+			if i < len(raw) && raw[i] == '\n' {
+				i++
+			}
+		default:
+			i++
+		}
+		rows = append(rows, row)
+		row = nil
+		line++
+	}
+	if row != nil {
+		rows = append(rows, row)
+	}
+	if len(rows) == 0 {
+		return nil, errors.New("empty file")
+	}
+	return rows, nil
+}
+
+func (d *csvDocument) Segments() []string {
+	return d.segments
+}
+
+func (d *csvDocument) Render(translations []string) ([]byte, error) {
+	if len(translations) != len(d.segments) {
+		return nil, errors.New("translation count does not match segment count")
+	}
+
+	var out strings.Builder
+	last := 0
+	for i, field := range d.fields {
+		out.WriteString(d.raw[last:field.start])
+		out.WriteString(d.encode(translations[i], field.quoted))
+		last = field.end
+	}
+	out.WriteString(d.raw[last:])
+	return []byte(out.String()), nil
+}
+
+// encode quotes a translated field if the original was quoted or if the
+// translation now needs quoting.
+func (d *csvDocument) encode(text string, quoted bool) string {
+	if !quoted && !strings.ContainsAny(text, string(d.delimiter)+"\"\r\n") {
+		return text
+	}
+	return `"` + strings.ReplaceAll(text, `"`, `""`) + `"`
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"html"
+	"regexp"
+	"strings"
+)
+
+var (
+	docxParagraph = regexp.MustCompile(`(?s)<w:p[ >].*?</w:p>`)
+	docxText      = regexp.MustCompile(`(?s)<w:t(?: [^>]*)?>(.*?)</w:t>|<w:t(?: [^>]*)?/>`)
+	docxPart      = regexp.MustCompile(`^word/(document|header\d*|footer\d*|footnotes|endnotes)\.xml$`)
+)
+
+// parseDOCXDocument translates a Word document paragraph by paragraph. The
+// text of all runs in a paragraph is translated together and written into
+// the first run, so formatting that changes within a paragraph is not kept.
+func parseDOCXDocument(data []byte, _ documentOptions) (document, error) {
+	archive, err := openZip(data)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := &zipDocument{data: data}
+	for _, file := range archive.File {
+		if !docxPart.MatchString(file.Name) {
+			continue
+		}
+		content, err := readZipFile(file)
+		if err != nil {
+			return nil, err
+		}
+		doc.addPart(zipPart{
+			name:    file.Name,
+			content: string(content),
+			spans:   docxParagraph.FindAllStringIndex(string(content), -1),
+			replace: replaceParagraphText,
+		}, docxParagraphText)
+	}
+	if len(doc.parts) == 0 {
+		return nil, errors.New("no word/document.xml found")
+	}
+	return doc, nil
+}
+
+func docxParagraphText(paragraph string) string {
+	var text strings.Builder
+	for _, match := range docxText.FindAllStringSubmatch(paragraph, -1) {
+		text.WriteString(html.UnescapeString(match[1]))
+	}
+	return text.String()
+}
+
+// replaceParagraphText puts the translation into the first text run of the
+// paragraph and empties the others.
+func replaceParagraphText(paragraph, translation string) string {
+	first := true
+	return docxText.ReplaceAllStringFunc(paragraph, func(string) string {
+		if !first {
+			return `<w:t></w:t>`
+		}
+		first = false
+		return `<w:t xml:space="preserve">` + xmlTextEscaper.Replace(translation) + `</w:t>`
+	})
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"errors"
+	"html"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	markupToken   = regexp.MustCompile(`(?s)<!--.*?-->|<!\[CDATA\[.*?\]\]>|<[^>]*>|[^<]+`)
+	markupTagName = regexp.MustCompile(`^</?(?:[\w.-]+:)?([\w.-]+)`)
+	markupTag     = regexp.MustCompile(`<[^>]*>`)
+)
+
+// inlineElements are the XHTML elements that run within a sentence. They
+// are kept in the text of a block as placeholders; all other elements end
+// a block.
+var inlineElements = map[string]bool{
+	"a": true, "abbr": true, "b": true, "bdi": true, "bdo": true, "br": true,
+	"cite": true, "code": true, "data": true, "del": true, "dfn": true,
+	"em": true, "i": true, "img": true, "ins": true, "kbd": true, "mark": true,
+	"q": true, "rp": true, "rt": true, "ruby": true, "s": true, "samp": true,
+	"small": true, "span": true, "strong": true, "sub": true, "sup": true,
+	"time": true, "u": true, "var": true, "wbr": true,
+}
+
+// parseEPUBDocument translates the text of an EPUB's XHTML content
+// documents, including the navigation document, and the labels of its NCX
+// table of contents. Each block, such as a paragraph or heading, is
+// translated as a whole so sentences stay intact; inline markup like
+// emphasis and links is sent as {0}, {1}, ... placeholders and put back in
+// the translation. Package metadata and all other files are copied
+// unchanged.
+func parseEPUBDocument(data []byte, _ documentOptions) (document, error) {
+	archive, err := openZip(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(archive.File) == 0 || archive.File[0].Name != "mimetype" {
+		return nil, errors.New("missing mimetype file")
+	}
+	mimetype, err := readZipFile(archive.File[0])
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(string(mimetype)) != "application/epub+zip" {
+		return nil, errors.New("not an EPUB file")
+	}
+
+	doc := &zipDocument{data: data}
+	for _, file := range archive.File {
+		var inText func(element string, inBody, inScript bool) bool
+		switch strings.ToLower(path.Ext(file.Name)) {
+		case ".xhtml", ".html", ".htm":
+			inText = func(_ string, inBody, inScript bool) bool { return inBody && !inScript }
+		case ".ncx":
+			inText = func(element string, _, _ bool) bool { return element == "text" }
+		default:
+			continue
+		}
+
+		content, err := readZipFile(file)
+		if err != nil {
+			return nil, err
+		}
+		doc.addPart(zipPart{
+			name:    file.Name,
+			content: string(content),
+			spans:   markupTextSpans(string(content), inText),
+			replace: replaceMarkupText,
+		}, maskMarkup)
+	}
+	return doc, nil
+}
+
+// markupTextSpans returns the ranges of the text blocks in an XML document
+// for which inText reports true. A block is a run of text and inline
+// elements, starting and ending at its first and last non-blank text or
+// inline tag. inText is given the innermost open element, whether the body
+// has started and whether the text is inside a script or style element.
+func markupTextSpans(content string, inText func(element string, inBody, inScript bool) bool) [][]int {
+	var spans [][]int
+	element, inBody, inScript := "", false, false
+	start, end, hasText := -1, -1, false
+	endBlock := func() {
+		if hasText {
+			spans = append(spans, []int{start, end})
+		}
+		start, end, hasText = -1, -1, false
+	}
+	for _, loc := range markupToken.FindAllStringIndex(content, -1) {
+		token := content[loc[0]:loc[1]]
+		if strings.HasPrefix(token, "<") {
+			match := markupTagName.FindStringSubmatch(token)
+			if match == nil {
+				endBlock()
+				continue
+			}
+			name := strings.ToLower(match[1])
+			if inlineElements[name] && inText(element, inBody, inScript) {
+				if start < 0 {
+					start = loc[0]
+				}
+				end = loc[1]
+				continue
+			}
+			endBlock()
+
+			closing := strings.HasPrefix(token, "</")
+			selfClosing := strings.HasSuffix(token, "/>")
+			switch name {
+			case "body":
+				inBody = !closing
+			case "script", "style":
+				inScript = !closing && !selfClosing
+			}
+			if closing || selfClosing {
+				element = ""
+			} else {
+				element = name
+			}
+			continue
+		}
+
+		trimmed := strings.TrimSpace(token)
+		if trimmed == "" || !inText(element, inBody, inScript) {
+			continue
+		}
+		if start < 0 {
+			start = loc[0] + strings.Index(token, trimmed)
+		}
+		end = loc[0] + strings.Index(token, trimmed) + len(trimmed)
+		hasText = true
+	}
+	endBlock()
+	return spans
+}
+
+// maskMarkup returns the text of a block to translate, with its tags
+// replaced by {0}, {1}, ... in order.
+func maskMarkup(block string) string {
+	n := 0
+	var text strings.Builder
+	for _, loc := range markupToken.FindAllStringIndex(block, -1) {
+		token := block[loc[0]:loc[1]]
+		if strings.HasPrefix(token, "<") {
+			text.WriteString("{" + strconv.Itoa(n) + "}")
+			n++
+			continue
+		}
+		text.WriteString(html.UnescapeString(token))
+	}
+	return text.String()
+}
+
+// replaceMarkupText puts the tags of a block back into its translation. A
+// translation that lost or repeated a placeholder leaves the block
+// untranslated rather than breaking its markup.
+func replaceMarkupText(block, translation string) string {
+	restored, ok := unmaskPlaceholders(xmlTextEscaper.Replace(translation), markupTag.FindAllString(block, -1))
+	if !ok {
+		return block
+	}
+	return restored
+}
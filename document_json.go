@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+// jsonDocument translates every string value of a JSON document, keeping
+// keys, key order and all other values. The output is indented with two
+// spaces.
+type jsonDocument struct {
+	tokens   []json.Token
+	segments []string
+}
+
+// jsonFrame tracks an open object or array while walking the tokens.
+type jsonFrame struct {
+	object  bool
+	wantKey bool
+	count   int
+}
+
+// jsonWalker classifies a token stream into keys and values.
+type jsonWalker struct {
+	stack []jsonFrame
+}
+
+func (w *jsonWalker) top() *jsonFrame {
+	if len(w.stack) == 0 {
+		return nil
+	}
+	return &w.stack[len(w.stack)-1]
+}
+
+// next reports whether token is an object key and updates the nesting
+// state.
+func (w *jsonWalker) next(token json.Token) (isKey bool) {
+	afterValue := func() {
+		if frame := w.top(); frame != nil && frame.object {
+			frame.wantKey = true
+		}
+	}
+
+	switch value := token.(type) {
+	case json.Delim:
+		switch value {
+		case '{':
+			w.stack = append(w.stack, jsonFrame{object: true, wantKey: true})
+		case '[':
+			w.stack = append(w.stack, jsonFrame{})
+		default:
+			w.stack = w.stack[:len(w.stack)-1]
+			afterValue()
+		}
+	case string:
+		if frame := w.top(); frame != nil && frame.object && frame.wantKey {
+			frame.wantKey = false
+			return true
+		}
+		afterValue()
+	default:
+		afterValue()
+	}
+	return false
+}
+
+func parseJSONDocument(data []byte, _ documentOptions) (document, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	doc := &jsonDocument{}
+	var walker jsonWalker
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if isKey := walker.next(token); !isKey {
+			if value, ok := token.(string); ok {
+				doc.segments = append(doc.segments, value)
+			}
+		}
+		doc.tokens = append(doc.tokens, token)
+	}
+	return doc, nil
+}
+
+func (d *jsonDocument) Segments() []string {
+	return d.segments
+}
+
+func (d *jsonDocument) Render(translations []string) ([]byte, error) {
+	if len(translations) != len(d.segments) {
+		return nil, errors.New("translation count does not match segment count")
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+
+	var walker jsonWalker
+	next := 0
+	for _, token := range d.tokens {
+		closing := token == json.Delim('}') || token == json.Delim(']')
+		if frame := walker.top(); frame != nil && !closing && (!frame.object || frame.wantKey) {
+			if frame.count > 0 {
+				buf.WriteByte(',')
+			}
+			frame.count++
+		}
+
+		isKey := walker.next(token)
+		switch value := token.(type) {
+		case json.Delim:
+			buf.WriteString(value.String())
+		case string:
+			if !isKey {
+				value = translations[next]
+				next++
+			}
+			if err := encoder.Encode(value); err != nil {
+				return nil, err
+			}
+			buf.Truncate(buf.Len() - 1) // Encode appends a newline.
+			if isKey {
+				buf.WriteByte(':')
+			}
+		case json.Number:
+			buf.WriteString(value.String())
+		case bool:
+			if value {
+				buf.WriteString("true")
+			} else {
+				buf.WriteString("false")
+			}
+		case nil:
+			buf.WriteString("null")
+		}
+	}
+
+	var out bytes.Buffer
+	if err := json.Indent(&out, buf.Bytes(), "", "  "); err != nil {
+		return nil, err
+	}
+	out.WriteByte('\n')
+	return out.Bytes(), nil
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// pdfDocument is the text layer of a PDF, split into paragraphs. PDFs can't
+// be rewritten in place, so it renders the translation as Markdown with the
+// pages separated by horizontal rules.
+type pdfDocument struct {
+	pages    [][]int
+	segments []string
+}
+
+// parsePDFDocument extracts the text of each page line by line and groups
+// the lines into paragraphs where the gap between them is wider than the
+// usual line spacing. This is best effort: scanned PDFs without a text layer
+// have nothing to translate, and multi-column layouts may be read across
+// columns.
+func parsePDFDocument(data []byte, _ documentOptions) (doc document, err error) {
+	// The PDF reader panics on malformed content streams.
+	defer func() {
+		if r := recover(); r != nil {
+			doc, err = nil, fmt.Errorf("unreadable PDF: %v", r)
+		}
+	}()
+
+	reader, err := pdf.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+
+	result := &pdfDocument{}
+	for i := 1; i <= reader.NumPage(); i++ {
+		page := reader.Page(i)
+		if page.V.IsNull() {
+			continue
+		}
+
+		var indexes []int
+		for _, paragraph := range pdfParagraphs(pdfLines(page.Content().Text)) {
+			indexes = append(indexes, len(result.segments))
+			result.segments = append(result.segments, paragraph)
+		}
+		if len(indexes) > 0 {
+			result.pages = append(result.pages, indexes)
+		}
+	}
+	if len(result.segments) == 0 {
+		return nil, errors.New("no text layer found")
+	}
+	return result, nil
+}
+
+// pdfLine is a line of text and its baseline, in points from the bottom of
+// the page.
+type pdfLine struct {
+	y    float64
+	text string
+}
+
+// pdfLines joins the glyphs of a page, in the order they are drawn, into
+// lines. A glyph starts a new line when its baseline moves by more than half
+// its size, and a space is inserted where glyphs on a line are far apart.
+func pdfLines(glyphs []pdf.Text) []pdfLine {
+	var lines []pdfLine
+	var text strings.Builder
+	var last pdf.Text
+	flush := func() {
+		if s := strings.TrimSpace(text.String()); s != "" {
+			lines = append(lines, pdfLine{y: last.Y, text: s})
+		}
+		text.Reset()
+	}
+
+	for i, glyph := range glyphs {
+		if i > 0 {
+			size := math.Max(glyph.FontSize, 1)
+			switch {
+			case math.Abs(glyph.Y-last.Y) > size/2:
+				flush()
+			case glyph.X-(last.X+last.W) > size/4 && !strings.HasSuffix(text.String(), " "):
+				text.WriteByte(' ')
+			}
+		}
+		text.WriteString(glyph.S)
+		last = glyph
+	}
+	flush()
+	return lines
+}
+
+func pdfParagraphs(lines []pdfLine) []string {
+	// The smallest gap between lines is taken as the line spacing.
+	spacing := math.Inf(1)
+	for i := 1; i < len(lines); i++ {
+		if gap := lines[i-1].y - lines[i].y; gap > 0 && gap < spacing {
+			spacing = gap
+		}
+	}
+
+	var paragraphs []string
+	var current strings.Builder
+	for i, line := range lines {
+		if i > 0 && lines[i-1].y-line.y > spacing*1.5 {
+			paragraphs = append(paragraphs, current.String())
+			current.Reset()
+		}
+		switch {
+		case current.Len() == 0:
+		case strings.HasSuffix(current.String(), "-"):
+			// Join words hyphenated across lines.
+			text := strings.TrimSuffix(current.String(), "-")
+			current.Reset()
+			current.WriteString(text)
+		default:
+			current.WriteByte(' ')
+		}
+		current.WriteString(line.text)
+	}
+	if current.Len() > 0 {
+		paragraphs = append(paragraphs, current.String())
+	}
+	return paragraphs
+}
+
+func (d *pdfDocument) Segments() []string {
+	return d.segments
+}
+
+func (d *pdfDocument) Render(translations []string) ([]byte, error) {
+	if len(translations) != len(d.segments) {
+		return nil, errors.New("translation count does not match segment count")
+	}
+
+	pages := make([]string, 0, len(d.pages))
+	for _, indexes := range d.pages {
+		paragraphs := make([]string, len(indexes))
+		for i, index := range indexes {
+			paragraphs[i] = translations[index]
+		}
+		pages = append(pages, strings.Join(paragraphs, "\n\n"))
+	}
+	return []byte(strings.Join(pages, "\n\n---\n\n") + "\n"), nil
+}
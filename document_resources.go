@@ -0,0 +1,282 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/unicode"
+)
+
+// placeholderPattern matches what must survive translation unchanged:
+// printf-style format specifiers (including %@ and stringsdict's %#@var@),
+// {named} placeholders and inline markup.
+var placeholderPattern = regexp.MustCompile(`%#@\w+@|%(?:\d+\$)?[-#+ 0,(]*\d*(?:\.\d+)?(?:hh|h|ll|l|q|z|t|j)?[a-zA-Z@%]|\{\w*\}|<[^>]+>`)
+
+var maskedPlaceholder = regexp.MustCompile(`\{(\d+)\}`)
+
+// maskPlaceholders replaces the placeholders of text by {0}, {1}, ... and
+// returns them in order.
+func maskPlaceholders(text string) (string, []string) {
+	var placeholders []string
+	masked := placeholderPattern.ReplaceAllStringFunc(text, func(placeholder string) string {
+		placeholders = append(placeholders, placeholder)
+		return "{" + strconv.Itoa(len(placeholders)-1) + "}"
+	})
+	return masked, placeholders
+}
+
+// unmaskPlaceholders restores the placeholders in a translation. It fails
+// unless every placeholder appears exactly once, since a lost or duplicated
+// format specifier can crash the app using the string.
+func unmaskPlaceholders(text string, placeholders []string) (string, bool) {
+	seen := make([]bool, len(placeholders))
+	ok := true
+	restored := maskedPlaceholder.ReplaceAllStringFunc(text, func(token string) string {
+		n, _ := strconv.Atoi(token[1 : len(token)-1])
+		if n >= len(placeholders) || seen[n] {
+			ok = false
+			return token
+		}
+		seen[n] = true
+		return placeholders[n]
+	})
+	for _, s := range seen {
+		ok = ok && s
+	}
+	return restored, ok
+}
+
+// resourceDocument is a localization file whose string values are
+// translated in place. Keys, comments and structure are kept as they are,
+// and a translation that loses a placeholder is replaced by the source text.
+type resourceDocument struct {
+	raw          string
+	spans        [][]int
+	sources      []string
+	segments     []string
+	placeholders [][]string
+	encode       func(string) string
+}
+
+func (d *resourceDocument) add(span []int, value string) {
+	if strings.TrimSpace(value) == "" {
+		return
+	}
+	masked, placeholders := maskPlaceholders(value)
+	if strings.TrimSpace(maskedPlaceholder.ReplaceAllString(masked, "")) == "" {
+		// Nothing but placeholders: there is nothing to translate.
+		return
+	}
+	d.spans = append(d.spans, span)
+	d.sources = append(d.sources, value)
+	d.segments = append(d.segments, masked)
+	d.placeholders = append(d.placeholders, placeholders)
+}
+
+func (d *resourceDocument) Segments() []string {
+	return d.segments
+}
+
+func (d *resourceDocument) Render(translations []string) ([]byte, error) {
+	if len(translations) != len(d.segments) {
+		return nil, errors.New("translation count does not match segment count")
+	}
+
+	var out strings.Builder
+	last := 0
+	for i, span := range d.spans {
+		text, ok := unmaskPlaceholders(translations[i], d.placeholders[i])
+		if !ok {
+			text = d.sources[i]
+		}
+		out.WriteString(d.raw[last:span[0]])
+		out.WriteString(d.encode(text))
+		last = span[1]
+	}
+	out.WriteString(d.raw[last:])
+	return []byte(out.String()), nil
+}
+
+var (
+	androidElement      = regexp.MustCompile(`(?s)<!--.*?-->|<(string|item)((?:\s[^>]*)?)>(.*?)</(?:string|item)>`)
+	androidUntranslated = regexp.MustCompile(`\btranslatable\s*=\s*"false"`)
+	androidUnescaper    = strings.NewReplacer(`\'`, `'`, `\"`, `"`, `\n`, "\n", `\t`, "\t", `\@`, `@`, `\?`, `?`, `\\`, `\`)
+	androidEscaper      = strings.NewReplacer(`\`, `\\`, `'`, `\'`, `"`, `\"`, "\n", `\n`, "\t", `\t`)
+)
+
+// parseAndroidDocument translates the strings, string arrays and plurals of
+// an Android strings.xml file. Each plural quantity is translated on its
+// own; strings marked translatable="false" are skipped.
+func parseAndroidDocument(data []byte, _ documentOptions) (document, error) {
+	raw := string(data)
+	if !strings.Contains(raw, "<resources") {
+		return nil, errors.New("no <resources> element found")
+	}
+
+	doc := &resourceDocument{raw: raw, encode: encodeAndroidString}
+	for _, loc := range androidElement.FindAllStringSubmatchIndex(raw, -1) {
+		if loc[2] < 0 {
+			continue
+		}
+		tag, attributes := raw[loc[2]:loc[3]], raw[loc[4]:loc[5]]
+		if androidUntranslated.MatchString(attributes) || tag == "item" && strings.Contains(attributes, "name=") {
+			// Style items have names; array and plural items don't.
+			continue
+		}
+		value := raw[loc[6]:loc[7]]
+		if strings.HasPrefix(strings.TrimSpace(value), "@") {
+			// References such as @string/app_name are not text.
+			continue
+		}
+		doc.add(loc[6:8], decodeAndroidString(value))
+	}
+	return doc, nil
+}
+
+// decodeAndroidString resolves the entities and backslash escapes of a value
+// while leaving inline markup such as <b> or <xliff:g> in place.
+func decodeAndroidString(value string) string {
+	value = strings.TrimPrefix(strings.TrimSuffix(value, `"`), `"`)
+	parts := placeholderPattern.FindAllStringIndex(value, -1)
+
+	var out strings.Builder
+	last := 0
+	for _, loc := range parts {
+		if value[loc[0]] != '<' {
+			continue
+		}
+		out.WriteString(androidUnescaper.Replace(html.UnescapeString(value[last:loc[0]])))
+		out.WriteString(value[loc[0]:loc[1]])
+		last = loc[1]
+	}
+	out.WriteString(androidUnescaper.Replace(html.UnescapeString(value[last:])))
+	return out.String()
+}
+
+func encodeAndroidString(text string) string {
+	var out strings.Builder
+	last := 0
+	for _, loc := range placeholderPattern.FindAllStringIndex(text, -1) {
+		if text[loc[0]] != '<' {
+			continue
+		}
+		out.WriteString(androidEscaper.Replace(xmlTextEscaper.Replace(text[last:loc[0]])))
+		out.WriteString(text[loc[0]:loc[1]])
+		last = loc[1]
+	}
+	out.WriteString(androidEscaper.Replace(xmlTextEscaper.Replace(text[last:])))
+
+	encoded := out.String()
+	if strings.HasPrefix(encoded, "@") || strings.HasPrefix(encoded, "?") {
+		encoded = `\` + encoded
+	}
+	return encoded
+}
+
+var appleStringsToken = regexp.MustCompile(`(?s)/\*.*?\*/|//[^\n]*|("(?:[^"\\]|\\.)*"|[\w.-]+)\s*=\s*"((?:[^"\\]|\\.)*)"\s*;`)
+
+// parseAppleStringsDocument translates the values of an iOS/macOS .strings
+// file, keeping keys and comments. UTF-16 files are converted to UTF-8.
+func parseAppleStringsDocument(data []byte, _ documentOptions) (document, error) {
+	raw, err := decodeAppleText(data)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := &resourceDocument{raw: raw, encode: encodeAppleString}
+	for _, loc := range appleStringsToken.FindAllStringSubmatchIndex(raw, -1) {
+		if loc[2] < 0 {
+			continue
+		}
+		value, err := decodeAppleString(raw[loc[4]:loc[5]])
+		if err != nil {
+			return nil, err
+		}
+		doc.add(loc[4:6], value)
+	}
+	return doc, nil
+}
+
+// decodeAppleText returns data as UTF-8, converting from UTF-16 when it
+// starts with a byte order mark, as older .strings files do.
+func decodeAppleText(data []byte) (string, error) {
+	if len(data) >= 2 && (data[0] == 0xFF && data[1] == 0xFE || data[0] == 0xFE && data[1] == 0xFF) {
+		decoded, err := unicode.UTF16(unicode.BigEndian, unicode.ExpectBOM).NewDecoder().Bytes(data)
+		if err != nil {
+			return "", err
+		}
+		data = decoded
+	}
+	if !utf8.Valid(data) {
+		return "", errors.New("file is not UTF-8 or UTF-16")
+	}
+	return strings.TrimPrefix(string(data), "\uFEFF"), nil
+}
+
+func decodeAppleString(value string) (string, error) {
+	var out strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] != '\\' || i+1 == len(value) {
+			out.WriteByte(value[i])
+			continue
+		}
+		i++
+		switch value[i] {
+		case 'n':
+			out.WriteByte('\n')
+		case 't':
+			out.WriteByte('\t')
+		case 'r':
+			out.WriteByte('\r')
+		case 'U', 'u':
+			if i+4 >= len(value) {
+				return "", fmt.Errorf("invalid escape in %q", value)
+			}
+			code, err := strconv.ParseUint(value[i+1:i+5], 16, 32)
+			if err != nil {
+				return "", fmt.Errorf("invalid escape in %q", value)
+			}
+			out.WriteRune(rune(code))
+			i += 4
+		default:
+			out.WriteByte(value[i])
+		}
+	}
+	return out.String(), nil
+}
+
+var appleEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\t", `\t`, "\r", `\r`)
+
+func encodeAppleString(text string) string {
+	return appleEscaper.Replace(text)
+}
+
+var (
+	stringsdictEntry = regexp.MustCompile(`<key>([^<]*)</key>(\s*)<string>([^<]*)</string>`)
+	pluralCategories = map[string]bool{"zero": true, "one": true, "two": true, "few": true, "many": true, "other": true}
+)
+
+// parseStringsdictDocument translates the format keys and plural variants
+// of an iOS .stringsdict file. The plural rules are kept as they are, so a
+// target language with more plural categories needs them added by hand.
+func parseStringsdictDocument(data []byte, _ documentOptions) (document, error) {
+	raw := string(data)
+	if !strings.Contains(raw, "<plist") {
+		return nil, errors.New("no <plist> element found")
+	}
+
+	doc := &resourceDocument{raw: raw, encode: xmlTextEscaper.Replace}
+	for _, loc := range stringsdictEntry.FindAllStringSubmatchIndex(raw, -1) {
+		key := raw[loc[2]:loc[3]]
+		if key != "NSStringLocalizedFormatKey" && !pluralCategories[key] {
+			continue
+		}
+		doc.add(loc[6:8], html.UnescapeString(raw[loc[6]:loc[7]]))
+	}
+	return doc, nil
+}
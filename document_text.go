@@ -0,0 +1,280 @@
+package main
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// textDocument is a text made of translatable segments and the verbatim
+// text around them: gaps[i] precedes segments[i], and the last gap follows
+// the last segment. Segments added with masked have their placeholders
+// restored, or are kept as they are when the translation lost one.
+type textDocument struct {
+	gaps         []string
+	segments     []string
+	sources      []string
+	placeholders [][]string
+	encode       func(string) string
+}
+
+// textBuilder assembles a textDocument piece by piece.
+type textBuilder struct {
+	doc textDocument
+	gap strings.Builder
+}
+
+func (b *textBuilder) verbatim(text string) {
+	b.gap.WriteString(text)
+}
+
+func (b *textBuilder) segment(text string) {
+	if strings.TrimSpace(text) == "" {
+		b.gap.WriteString(text)
+		return
+	}
+	b.doc.gaps = append(b.doc.gaps, b.gap.String())
+	b.doc.segments = append(b.doc.segments, text)
+	b.doc.sources = append(b.doc.sources, text)
+	b.doc.placeholders = append(b.doc.placeholders, nil)
+	b.gap.Reset()
+}
+
+// masked adds text as a segment with the matches of pattern sent as {0},
+// {1}, ... placeholders. Text with nothing else is kept verbatim.
+func (b *textBuilder) masked(text string, pattern *regexp.Regexp) {
+	var placeholders []string
+	masked := pattern.ReplaceAllStringFunc(text, func(match string) string {
+		placeholders = append(placeholders, match)
+		return "{" + strconv.Itoa(len(placeholders)-1) + "}"
+	})
+	if strings.TrimSpace(maskedPlaceholder.ReplaceAllString(masked, "")) == "" {
+		b.verbatim(text)
+		return
+	}
+	b.segment(masked)
+	b.doc.sources[len(b.doc.sources)-1] = text
+	b.doc.placeholders[len(b.doc.placeholders)-1] = placeholders
+}
+
+func (b *textBuilder) build() *textDocument {
+	b.doc.gaps = append(b.doc.gaps, b.gap.String())
+	return &b.doc
+}
+
+func (d *textDocument) Segments() []string {
+	return d.segments
+}
+
+func (d *textDocument) Render(translations []string) ([]byte, error) {
+	if len(translations) != len(d.segments) {
+		return nil, errors.New("translation count does not match segment count")
+	}
+
+	var out strings.Builder
+	for i, translation := range translations {
+		out.WriteString(d.gaps[i])
+		if placeholders := d.placeholders[i]; placeholders != nil {
+			restored, ok := unmaskPlaceholders(translation, placeholders)
+			if !ok {
+				restored = d.sources[i]
+			}
+			translation = restored
+		}
+		if d.encode != nil {
+			translation = d.encode(translation)
+		}
+		out.WriteString(translation)
+	}
+	out.WriteString(d.gaps[len(d.gaps)-1])
+	return []byte(out.String()), nil
+}
+
+var paragraphBreak = regexp.MustCompile(`\r?\n(?:[ \t]*\r?\n)+`)
+
+// parseTextDocument translates plain text paragraph by paragraph.
+func parseTextDocument(data []byte, _ documentOptions) (document, error) {
+	text := string(data)
+	var b textBuilder
+
+	start := 0
+	for _, loc := range paragraphBreak.FindAllStringIndex(text, -1) {
+		addTrimmed(&b, text[start:loc[0]])
+		b.verbatim(text[loc[0]:loc[1]])
+		start = loc[1]
+	}
+	addTrimmed(&b, text[start:])
+	return b.build(), nil
+}
+
+// addTrimmed adds text as a segment, keeping surrounding whitespace verbatim.
+func addTrimmed(b *textBuilder, text string) {
+	trimmed := strings.TrimSpace(text)
+	if trimmed == "" {
+		b.verbatim(text)
+		return
+	}
+	start := strings.Index(text, trimmed)
+	b.verbatim(text[:start])
+	b.segment(trimmed)
+	b.verbatim(text[start+len(trimmed):])
+}
+
+var (
+	markdownFence  = regexp.MustCompile("^\\s*(```|~~~)")
+	markdownRule   = regexp.MustCompile(`^\s*([-*_])(\s*[-*_]){2,}\s*$`)
+	markdownPrefix = regexp.MustCompile(`^(\s*(?:#{1,6}\s+|>\s*|[-*+]\s+(?:\[[ xX]\]\s+)?|\d+[.)]\s+)*)`)
+
+	// shortcodePattern matches Hugo shortcodes and Liquid tags and
+	// outputs, which Hugo and Jekyll expand when building the site.
+	shortcodePattern = regexp.MustCompile(`\{\{[<%].*?[%>]\}\}|\{%.*?%\}|\{\{.*?\}\}`)
+	// Highlighted code blocks are kept like fenced ones.
+	highlightStart = regexp.MustCompile(`^\s*(\{\{[<%]\s*highlight\b|\{%-?\s*(highlight|raw)\b)`)
+	highlightEnd   = regexp.MustCompile(`^\s*(\{\{[<%]\s*/highlight\b|\{%-?\s*(endhighlight|endraw)\b)`)
+)
+
+// parseMarkdownDocument translates Markdown line by line, keeping headings,
+// list and quote markers, code blocks and front matter untouched, as YAML
+// between "---" lines or TOML between "+++" lines. Shortcodes and Liquid
+// tags are kept as they are, and highlight blocks like code blocks.
+func parseMarkdownDocument(data []byte, _ documentOptions) (document, error) {
+	lines := strings.SplitAfter(string(data), "\n")
+	var b textBuilder
+
+	inFence, inHighlight, frontMatter := false, false, ""
+	for i, line := range lines {
+		content := strings.TrimRight(line, "\r\n")
+		switch {
+		case i == 0 && (content == "---" || content == "+++"):
+			frontMatter = content
+			b.verbatim(line)
+			continue
+		case frontMatter != "":
+			if content == frontMatter || (frontMatter == "---" && content == "...") {
+				frontMatter = ""
+			}
+			b.verbatim(line)
+			continue
+		case markdownFence.MatchString(content):
+			inFence = !inFence
+			b.verbatim(line)
+			continue
+		case !inFence && highlightStart.MatchString(content):
+			inHighlight = true
+			b.verbatim(line)
+			continue
+		case inHighlight:
+			inHighlight = !highlightEnd.MatchString(content)
+			b.verbatim(line)
+			continue
+		case inFence, strings.TrimSpace(content) == "", markdownRule.MatchString(content):
+			b.verbatim(line)
+			continue
+		}
+
+		prefix := markdownPrefix.FindString(content)
+		b.verbatim(prefix)
+		text := content[len(prefix):]
+		trimmed := strings.TrimSpace(text)
+		start := strings.Index(text, trimmed)
+		b.verbatim(text[:start])
+		b.masked(trimmed, shortcodePattern)
+		b.verbatim(text[start+len(trimmed):])
+		b.verbatim(line[len(content):])
+	}
+	return b.build(), nil
+}
+
+// parseSRTDocument translates the text of each subtitle, keeping the cue
+// numbers and timings.
+func parseSRTDocument(data []byte, _ documentOptions) (document, error) {
+	text := strings.TrimPrefix(string(data), "\uFEFF")
+	var b textBuilder
+
+	start := 0
+	blocks := paragraphBreak.FindAllStringIndex(text, -1)
+	blocks = append(blocks, []int{len(text), len(text)})
+	for _, loc := range blocks {
+		block := text[start:loc[0]]
+		lines := strings.SplitAfter(block, "\n")
+
+		header := 0
+		for header < len(lines) && header < 2 {
+			line := strings.TrimSpace(lines[header])
+			_, err := strconv.Atoi(line)
+			if err != nil && !strings.Contains(line, "-->") {
+				break
+			}
+			header++
+		}
+		if header == 0 && strings.TrimSpace(block) != "" {
+			return nil, errors.New("subtitle block without cue number or timing")
+		}
+
+		b.verbatim(strings.Join(lines[:header], ""))
+		addTrimmed(&b, strings.Join(lines[header:], ""))
+		b.verbatim(text[loc[0]:loc[1]])
+		start = loc[1]
+	}
+	return b.build(), nil
+}
+
+var poField = regexp.MustCompile(`^(msgctxt|msgid|msgid_plural|msgstr(?:\[(\d+)\])?)\s+(".*")\s*$`)
+
+// parsePODocument fills in the empty msgstr entries of a gettext catalog
+// with translations of their msgid (or msgid_plural for plural forms).
+// Entries that are already translated and the header are kept as they are.
+func parsePODocument(data []byte, _ documentOptions) (document, error) {
+	lines := strings.SplitAfter(string(data), "\n")
+	b := textBuilder{doc: textDocument{encode: func(text string) string {
+		return strconv.Quote(text)
+	}}}
+
+	var msgid, msgidPlural string
+	for i := 0; i < len(lines); {
+		match := poField.FindStringSubmatch(strings.TrimRight(lines[i], "\r\n"))
+		if match == nil {
+			b.verbatim(lines[i])
+			i++
+			continue
+		}
+
+		keyword := match[1]
+		value, err := strconv.Unquote(match[3])
+		if err != nil {
+			return nil, errors.New("invalid string on line " + strconv.Itoa(i+1))
+		}
+		end := i + 1
+		for end < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[end]), `"`) {
+			part, err := strconv.Unquote(strings.TrimSpace(lines[end]))
+			if err != nil {
+				return nil, errors.New("invalid string on line " + strconv.Itoa(end+1))
+			}
+			value += part
+			end++
+		}
+
+		switch {
+		case keyword == "msgid":
+			msgid, msgidPlural = value, ""
+		case keyword == "msgid_plural":
+			msgidPlural = value
+		case strings.HasPrefix(keyword, "msgstr") && value == "" && msgid != "":
+			source := msgid
+			if match[2] != "" && match[2] != "0" && msgidPlural != "" {
+				source = msgidPlural
+			}
+			line := strings.TrimRight(lines[end-1], "\r\n")
+			b.verbatim(keyword + " ")
+			b.segment(source)
+			b.verbatim(lines[end-1][len(line):])
+			i = end
+			continue
+		}
+
+		b.verbatim(strings.Join(lines[i:end], ""))
+		i = end
+	}
+	return b.build(), nil
+}
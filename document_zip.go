@@ -0,0 +1,152 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+var xmlTextEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// zipPart is an XML file inside a zip-based document. Each span marks a
+// translatable range of the file, which replace rewrites with its
+// translation.
+type zipPart struct {
+	name    string
+	content string
+	spans   [][]int
+	replace func(original, translation string) string
+}
+
+// zipDocument is a zip-based document, such as DOCX or EPUB, whose
+// translatable text lives in some of its XML files. All other files are
+// copied unchanged when the document is rendered.
+type zipDocument struct {
+	data     []byte
+	parts    []zipPart
+	segments []string
+}
+
+// zipExpansion bounds how much larger than BODY_LIMIT the uncompressed
+// content of an uploaded archive may be. Office and EPUB files rarely
+// compress better than 10:1, while a decompression bomb does far better.
+const zipExpansion = 20
+
+// maxZipSize is the most an archive may hold uncompressed, in total and in
+// any one entry.
+func maxZipSize() uint64 {
+	return uint64(max(cfg().BodyLimit, 0)) * zipExpansion
+}
+
+func openZip(data []byte) (*zip.Reader, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	var total uint64
+	for _, file := range archive.File {
+		total += file.UncompressedSize64
+		if total > maxZipSize() {
+			return nil, fmt.Errorf("archive expands to more than %d bytes", maxZipSize())
+		}
+	}
+	return archive, nil
+}
+
+// readZipFile reads an entry, refusing entries larger than maxZipSize()
+// whatever their header claims.
+func readZipFile(file *zip.File) ([]byte, error) {
+	limit := maxZipSize()
+	if file.UncompressedSize64 > limit {
+		return nil, fmt.Errorf("%s expands to more than %d bytes", file.Name, limit)
+	}
+	reader, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	content, err := io.ReadAll(io.LimitReader(reader, int64(limit)+1))
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(content)) > limit {
+		return nil, fmt.Errorf("%s expands to more than %d bytes", file.Name, limit)
+	}
+	return content, nil
+}
+
+// addPart adds a file with its spans; text extracts the segment to
+// translate from each span, and spans with blank text are skipped.
+func (d *zipDocument) addPart(part zipPart, text func(span string) string) {
+	spans := part.spans
+	part.spans = nil
+	for _, loc := range spans {
+		segment := text(part.content[loc[0]:loc[1]])
+		if strings.TrimSpace(segment) == "" {
+			continue
+		}
+		part.spans = append(part.spans, loc)
+		d.segments = append(d.segments, segment)
+	}
+	d.parts = append(d.parts, part)
+}
+
+func (d *zipDocument) Segments() []string {
+	return d.segments
+}
+
+func (d *zipDocument) Render(translations []string) ([]byte, error) {
+	if len(translations) != len(d.segments) {
+		return nil, errors.New("translation count does not match segment count")
+	}
+
+	replaced := make(map[string]string)
+	next := 0
+	for _, part := range d.parts {
+		var out strings.Builder
+		last := 0
+		for _, loc := range part.spans {
+			out.WriteString(part.content[last:loc[0]])
+			out.WriteString(part.replace(part.content[loc[0]:loc[1]], translations[next]))
+			next++
+			last = loc[1]
+		}
+		out.WriteString(part.content[last:])
+		replaced[part.name] = out.String()
+	}
+
+	archive, err := openZip(d.data)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+	for _, file := range archive.File {
+		// Copying the header keeps the entry order and compression method,
+		// which EPUB relies on for its leading uncompressed mimetype file.
+		header := file.FileHeader
+		w, err := writer.CreateHeader(&header)
+		if err != nil {
+			return nil, err
+		}
+		if content, ok := replaced[file.Name]; ok {
+			_, err = io.WriteString(w, content)
+		} else {
+			var content []byte
+			content, err = readZipFile(file)
+			if err == nil {
+				_, err = w.Write(content)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
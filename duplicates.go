@@ -0,0 +1,89 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// duplicateCounter counts how often a caller sent one request over a
+// sliding window, estimated from the counts of the current and previous
+// fixed windows, and keeps the last successful answer to it.
+type duplicateCounter struct {
+	start          time.Time
+	current, prior int
+	last           *TranslateResponse
+	// reported is set once the caller was logged in the current window.
+	reported bool
+}
+
+// duplicateDetector spots callers sending the same request over and over,
+// such as clients stuck in a retry loop. It is kept per process.
+type duplicateDetector struct {
+	mu       sync.Mutex
+	counters map[string]*duplicateCounter
+	swept    time.Time
+}
+
+var duplicates = &duplicateDetector{counters: make(map[string]*duplicateCounter)}
+
+// check counts a request by caller whose requestKey is key. Once the caller
+// sent it more than DUPLICATE_LIMIT times within DUPLICATE_WINDOW, limited
+// is set and replay is the last successful answer, if there is one.
+func (d *duplicateDetector) check(caller, key string) (replay *TranslateResponse, limited bool) {
+	limit, window := cfg().DuplicateLimit, cfg().DuplicateWindow
+	if limit <= 0 {
+		return nil, false
+	}
+	now := time.Now()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if now.Sub(d.swept) > window {
+		for id, counter := range d.counters {
+			if now.Sub(counter.start) > 2*window {
+				delete(d.counters, id)
+			}
+		}
+		d.swept = now
+	}
+
+	id := caller + "|" + key
+	counter := d.counters[id]
+	if counter == nil {
+		counter = &duplicateCounter{start: now}
+		d.counters[id] = counter
+	}
+	switch elapsed := now.Sub(counter.start); {
+	case elapsed >= 2*window:
+		counter.start, counter.current, counter.prior, counter.reported = now, 0, 0, false
+	case elapsed >= window:
+		counter.start, counter.current, counter.prior, counter.reported = counter.start.Add(window), 0, counter.current, false
+	}
+	counter.current++
+
+	weight := 1 - float64(now.Sub(counter.start))/float64(window)
+	count := float64(counter.current) + float64(counter.prior)*weight
+	if count <= float64(limit) {
+		return nil, false
+	}
+	if !counter.reported {
+		counter.reported = true
+		log.Printf("Caller %s repeats a request more than %d times per %v, answering it without calling the upstream", caller, limit, window)
+	}
+	metrics.count("requests.duplicate")
+	return counter.last, true
+}
+
+// remember keeps a successful answer to replay to a caller repeating the
+// request too often.
+func (d *duplicateDetector) remember(caller, key string, response TranslateResponse) {
+	if cfg().DuplicateLimit <= 0 || response.Code != 200 {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if counter := d.counters[caller+"|"+key]; counter != nil {
+		counter.last = &response
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// engine is a translation backend.
+type engine interface {
+	// translate translates texts, which are lines or sentences of one
+	// request, from params.SourceLang to params.TargetLang.
+	translate(params TranslateParams, texts []string) (upstreamResult, error)
+}
+
+// engines are the backends by name: DeepL and the plugins of PLUGINS_DIR.
+// Plugins are added at startup, before the server serves requests.
+var engines = map[string]engine{
+	EngineDeepL: deeplEngine{},
+}
+
+// deeplEngine translates with the DeepL endpoints of the upstream pool.
+type deeplEngine struct{}
+
+func (deeplEngine) translate(params TranslateParams, texts []string) (upstreamResult, error) {
+	return fetchTexts(params, texts)
+}
+
+// engineRoute sends the translations of a language pair to an engine.
+// Empty languages match any language.
+type engineRoute struct {
+	SourceLang string
+	TargetLang string
+	// Both also matches the pair in the other direction.
+	Both   bool
+	Engine string
+}
+
+// parseEngineRoute parses a rule such as "JA<>ZH:argos", "EN>DE:local" or
+// "*>KO:deepl".
+func parseEngineRoute(rule string) (engineRoute, error) {
+	pair, name, ok := strings.Cut(rule, ":")
+	if !ok || strings.TrimSpace(name) == "" {
+		return engineRoute{}, fmt.Errorf("%q has no engine, expected e.g. JA<>ZH:engine", rule)
+	}
+	route := engineRoute{Engine: strings.ToLower(strings.TrimSpace(name))}
+	source, target, both := strings.Cut(pair, "<>")
+	if !both {
+		if source, target, ok = strings.Cut(pair, ">"); !ok {
+			return engineRoute{}, fmt.Errorf("%q has no language pair, expected e.g. JA<>ZH:engine or EN>DE:engine", rule)
+		}
+	}
+	route.Both = both
+	route.SourceLang, route.TargetLang = strings.TrimSpace(source), strings.TrimSpace(target)
+	for _, lang := range []*string{&route.SourceLang, &route.TargetLang} {
+		if *lang == "*" {
+			*lang = ""
+		}
+	}
+	return route, nil
+}
+
+func (r engineRoute) matches(sourceLang, targetLang string) bool {
+	if r.SourceLang != "" && sourceLang == "" {
+		return false
+	}
+	if languageMatches(r.SourceLang, sourceLang) && languageMatches(r.TargetLang, targetLang) {
+		return true
+	}
+	return r.Both && sourceLang != "" && languageMatches(r.SourceLang, targetLang) && languageMatches(r.TargetLang, sourceLang)
+}
+
+// selectEngine returns the engine asked for by the request, or else the
+// engine of the first route matching its language pair, or ENGINE.
+func selectEngine(params TranslateParams) (string, engine, error) {
+	name := strings.ToLower(params.Engine)
+	if name == "" {
+		name = routeEngine(params.SourceLang, params.TargetLang)
+	}
+	selected, ok := engines[name]
+	if !ok {
+		return name, nil, &translateError{Code: 400, Message: fmt.Sprintf("Unknown engine %q", name)}
+	}
+	return name, selected, nil
+}
+
+func routeEngine(sourceLang, targetLang string) string {
+	if strings.EqualFold(sourceLang, "auto") {
+		sourceLang = ""
+	}
+	for _, route := range cfg().EngineRoutes {
+		if route.matches(sourceLang, targetLang) {
+			return route.Engine
+		}
+	}
+	return cfg().Engine
+}
+
+// unknownEngines lists the engines named by ENGINE and ENGINE_ROUTES that
+// are not loaded.
+func unknownEngines(config *Config) []string {
+	names := []string{config.Engine}
+	for _, route := range config.EngineRoutes {
+		names = append(names, route.Engine)
+	}
+	var unknown []string
+	for _, name := range names {
+		if _, ok := engines[name]; !ok && !slices.Contains(unknown, name) {
+			unknown = append(unknown, name)
+		}
+	}
+	return unknown
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"html"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Values of the html_entities request option.
+const (
+	EntitiesKeep      = "keep"
+	EntitiesDecode    = "decode"
+	EntitiesRoundtrip = "roundtrip"
+)
+
+// entityPattern matches named and numeric HTML character references.
+var entityPattern = regexp.MustCompile(`&(?:[A-Za-z][A-Za-z0-9]*|#[0-9]+|#[xX][0-9A-Fa-f]+);`)
+
+func isValidEntitiesMode(mode string) bool {
+	switch mode {
+	case "", EntitiesKeep, EntitiesDecode, EntitiesRoundtrip:
+		return true
+	}
+	return false
+}
+
+// decodeEntities turns HTML entities in the input into the characters they
+// stand for, so the upstream translates "&amp;" as "&". In roundtrip mode it
+// also returns a replacer restoring the entities the input held, in the
+// form they were written in, or nil when it held none.
+func decodeEntities(text, mode string) (string, *strings.Replacer) {
+	if mode != EntitiesDecode && mode != EntitiesRoundtrip {
+		return text, nil
+	}
+	if mode == EntitiesDecode {
+		return html.UnescapeString(text), nil
+	}
+
+	entities := make(map[string]string)
+	for _, entity := range entityPattern.FindAllString(text, -1) {
+		char := html.UnescapeString(entity)
+		if _, seen := entities[char]; !seen && char != entity {
+			entities[char] = entity
+		}
+	}
+	if len(entities) == 0 {
+		return text, nil
+	}
+	chars := slices.Sorted(maps.Keys(entities))
+	pairs := make([]string, 0, 2*len(chars))
+	for _, char := range chars {
+		pairs = append(pairs, char, entities[char])
+	}
+	return html.UnescapeString(text), strings.NewReplacer(pairs...)
+}
+
+// encodeEntities restores in the translated texts of the response the
+// entities the input held, as returned by decodeEntities.
+func encodeEntities(response *TranslateResponse, restore *strings.Replacer) {
+	if restore == nil {
+		return
+	}
+
+	response.Data = restore.Replace(response.Data)
+	for i := range response.Alternatives {
+		response.Alternatives[i] = restore.Replace(response.Alternatives[i])
+	}
+	for i := range response.Sentences {
+		item := &response.Sentences[i]
+		item.Source = restore.Replace(item.Source)
+		item.Text = restore.Replace(item.Text)
+		for j := range item.Alternatives {
+			item.Alternatives[j] = restore.Replace(item.Alternatives[j])
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"math"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// lengthRatios are the typical lengths in characters of a text in a
+// language, relative to the same text in English. They are rough averages,
+// good enough to size buffers and budgets, not to lay out a page.
+var lengthRatios = map[string]float64{
+	"BG": 1.1, "CS": 1.0, "DA": 1.05, "DE": 1.2, "EL": 1.15, "ES": 1.15,
+	"ET": 1.0, "FI": 1.1, "FR": 1.15, "HU": 1.1, "ID": 1.1, "IT": 1.1,
+	"JA": 0.55, "KO": 0.6, "LT": 1.05, "LV": 1.05, "NB": 1.05, "NL": 1.15,
+	"PL": 1.1, "PT": 1.15, "RO": 1.1, "RU": 1.1, "SK": 1.0, "SL": 1.0,
+	"SV": 1.05, "TR": 1.05, "UK": 1.1, "ZH": 0.35,
+}
+
+// lengthRatio returns the length ratio of a language, 1 for English and
+// languages without one, such as "auto".
+func lengthRatio(lang string) float64 {
+	if ratio, ok := lengthRatios[baseLanguage(lang)]; ok {
+		return ratio
+	}
+	return 1
+}
+
+// EstimateRequest is a /translate request, or the texts of a batch with
+// its options, to estimate the cost of.
+type EstimateRequest struct {
+	TranslateParams
+	Texts []string `json:"texts"`
+}
+
+type EstimateResponse struct {
+	Code int `json:"code"`
+
+	Texts      int `json:"texts"`
+	Characters int `json:"characters"`
+	// BillableCharacters leaves out the texts answered without calling
+	// the upstream, from the cache or as passthrough.
+	BillableCharacters int `json:"billable_characters"`
+	Cached             int `json:"cached"`
+	// Chunks are the texts or sentences sent upstream, in UpstreamCalls
+	// calls.
+	Chunks        int `json:"chunks"`
+	UpstreamCalls int `json:"upstream_calls"`
+	// OutputCharacters is the expected length of the translations.
+	OutputCharacters int `json:"output_characters"`
+
+	Quota []capProjection `json:"quota,omitempty"`
+}
+
+// estimate adds the cost of translating params to response, counting like
+// translateParams and translateText do.
+func estimate(params TranslateParams, response *EstimateResponse) *translateError {
+	if failure := checkOptions(params); failure != nil {
+		return failure
+	}
+	if cfg().NormalizeInput {
+		params.Text = sanitizeText(params.Text, cfg().CollapseWhitespace)
+	}
+	key := requestKey(params)
+	params.Text, _ = decodeEntities(params.Text, params.HTMLEntities)
+	if params.Text == "" {
+		return nil
+	}
+
+	characters := utf8.RuneCountInString(params.Text)
+	response.Texts++
+	response.Characters += characters
+	response.OutputCharacters += int(math.Round(float64(characters) * lengthRatio(params.TargetLang) / lengthRatio(params.SourceLang)))
+	if cfg().SameLangPassthrough && isSameLanguage(params.SourceLang, params.TargetLang) {
+		return nil
+	}
+	if _, ok := translations.Get(key); ok {
+		response.Cached++
+		return nil
+	}
+	response.BillableCharacters += characters
+
+	name, _, err := selectEngine(params)
+	var failure *translateError
+	if errors.As(err, &failure) {
+		return failure
+	}
+	switch {
+	case name == EngineDeepL && useSplitText(params):
+		sentences := 0
+		for _, line := range splitLines(params.Text) {
+			sentences += len(splitSentences(line.Text))
+		}
+		response.Chunks += sentences
+		response.UpstreamCalls += 1 + (sentences+jobsPerCall-1)/jobsPerCall
+	case params.Sentences:
+		response.Chunks += len(splitSentences(params.Text))
+		response.UpstreamCalls++
+	case params.PreserveWhitespace:
+		response.Chunks += len(splitLines(params.Text))
+		response.UpstreamCalls++
+	default:
+		response.Chunks++
+		response.UpstreamCalls++
+	}
+	return nil
+}
+
+// handleEstimate answers what translating a request would cost, without
+// translating it: its characters, the chunks and upstream calls it takes,
+// the expected length of the translation and how it would leave the
+// character caps of the caller.
+func handleEstimate(c *fiber.Ctx) error {
+	var request EstimateRequest
+	if err := c.BodyParser(&request); err != nil {
+		log.Printf("Error parsing request body: %v", err)
+		return c.Status(400).JSON(fiber.Map{"code": 400, "message": "Invalid request body"})
+	}
+	params := request.TranslateParams
+	applyKeyDefaults(c, &params)
+	applyCompatMode(&params)
+
+	texts := request.Texts
+	if len(texts) == 0 {
+		texts = []string{params.Text}
+	}
+	response := EstimateResponse{Code: 200}
+	for _, text := range texts {
+		params.Text = text
+		if failure := estimate(params, &response); failure != nil {
+			return c.Status(failure.Code).JSON(fiber.Map{"code": failure.Code, "message": failure.Message})
+		}
+	}
+	if response.Texts == 0 {
+		return c.Status(404).JSON(fiber.Map{"code": 404, "message": "No Translate Text Found"})
+	}
+	response.Quota = characterCaps.project(meterKey(c), response.BillableCharacters)
+	return c.JSON(response)
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// requestKey identifies a translation request by its text, languages and
+// options. Identical requests get identical keys, whatever their ID.
+func requestKey(params TranslateParams) string {
+	params.ID = 0
+	params.SourceLang = strings.ToUpper(params.SourceLang)
+	params.TargetLang = strings.ToUpper(params.TargetLang)
+
+	data, _ := jsonMarshal(params)
+	// Requests pinned to an endpoint are told apart from others.
+	if params.endpoint != "" {
+		data = append(data, params.endpoint...)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// translationETag is a weak validator, as the upstream may word the same
+// translation slightly differently between calls.
+func translationETag(params TranslateParams) string {
+	return `W/"` + requestKey(params)[:32] + `"`
+}
+
+// etagMatches implements the weak comparison of If-None-Match.
+func etagMatches(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// TestNotModifiedAfterChecks checks that If-None-Match doesn't answer 304 to
+// requests the language guard or Idempotency-Key would reject.
+func TestNotModifiedAfterChecks(t *testing.T) {
+	withUpstream(t, mockUpstream(0))
+	app := newCompatApp()
+
+	send := func(body string, headers map[string]string) *http.Response {
+		t.Helper()
+		request := httptest.NewRequest(http.MethodPost, "/translate", strings.NewReader(body))
+		request.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		for name, value := range headers {
+			request.Header.Set(name, value)
+		}
+		response, err := app.Test(request, -1)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		return response
+	}
+
+	first := `{"text": "etag first", "source_lang": "EN", "target_lang": "DE"}`
+	second := `{"text": "etag second", "source_lang": "EN", "target_lang": "DE"}`
+	response := send(first, map[string]string{"Idempotency-Key": "etag-key"})
+	etag := response.Header.Get(fiber.HeaderETag)
+	if response.StatusCode != 200 || etag == "" {
+		t.Fatalf("first request: status %d, ETag %q", response.StatusCode, etag)
+	}
+	if response := send(first, map[string]string{fiber.HeaderIfNoneMatch: etag}); response.StatusCode != fiber.StatusNotModified {
+		t.Errorf("matching If-None-Match: status %d, want 304", response.StatusCode)
+	}
+
+	withConfig(t, func(c *Config) { c.AllowedTargetLangs = []string{"FR"} })
+	if response := send(first, map[string]string{fiber.HeaderIfNoneMatch: etag}); response.StatusCode != 403 {
+		t.Errorf("disallowed target: status %d, want 403", response.StatusCode)
+	}
+	withConfig(t, func(c *Config) { c.AllowedTargetLangs = nil })
+
+	response = send(second, nil)
+	secondETag := response.Header.Get(fiber.HeaderETag)
+	headers := map[string]string{fiber.HeaderIfNoneMatch: secondETag, "Idempotency-Key": "etag-key"}
+	if response := send(second, headers); response.StatusCode != 422 {
+		t.Errorf("reused Idempotency-Key: status %d, want 422", response.StatusCode)
+	}
+}
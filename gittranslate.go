@@ -0,0 +1,360 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// paragraph is a run of segments of a document translated together.
+// Translations is set when the paragraph is unchanged and its existing
+// translation is reused.
+type paragraph struct {
+	start, end   int
+	translations []string
+}
+
+// textParagraphs groups the segments of a text document into paragraphs,
+// each starting after a blank or verbatim line.
+func textParagraphs(doc *textDocument) []paragraph {
+	var paragraphs []paragraph
+	for i := range doc.segments {
+		if i == 0 || strings.Count(doc.gaps[i], "\n") > 1 {
+			paragraphs = append(paragraphs, paragraph{start: i})
+		}
+		paragraphs[len(paragraphs)-1].end = i + 1
+	}
+	return paragraphs
+}
+
+func paragraphsEnd(paragraphs []paragraph) int {
+	if len(paragraphs) == 0 {
+		return 0
+	}
+	return paragraphs[len(paragraphs)-1].end
+}
+
+// mergeMarkdown splits doc into paragraphs, with the translations of those
+// already in previous taken from translated, the translation of previous.
+// Its segments must line up with those of previous.
+func mergeMarkdown(previous []byte, doc document, translated []byte) ([]paragraph, error) {
+	paragraphs := textParagraphs(doc.(*textDocument))
+	if previous == nil || translated == nil {
+		return paragraphs, nil
+	}
+
+	before, err := parseMarkdownDocument(previous, documentOptions{})
+	if err != nil {
+		return nil, err
+	}
+	after, err := parseMarkdownDocument(translated, documentOptions{})
+	if err != nil {
+		return nil, err
+	}
+	sources, translations := before.Segments(), after.Segments()
+	if len(sources) != len(translations) {
+		return nil, fmt.Errorf("the translation has %d segments for %d in the source, edit it to match or remove it", len(translations), len(sources))
+	}
+	known := make(map[string][]string)
+	for _, p := range textParagraphs(before.(*textDocument)) {
+		key := strings.Join(sources[p.start:p.end], "\n")
+		if _, ok := known[key]; !ok {
+			known[key] = translations[p.start:p.end]
+		}
+	}
+
+	segments := doc.Segments()
+	for i, p := range paragraphs {
+		paragraphs[i].translations = known[strings.Join(segments[p.start:p.end], "\n")]
+	}
+	return paragraphs, nil
+}
+
+// poMessage is a msgstr field of a gettext catalog. Key identifies it by
+// context, msgid and plural index.
+type poMessage struct {
+	Key   string
+	MsgID string
+	Value string
+	Fuzzy bool
+}
+
+// poMessages lists the msgstr fields of a catalog, in the order
+// parsePODocument reads them.
+func poMessages(data []byte) []poMessage {
+	var messages []poMessage
+	var context, entryContext, msgid string
+	fuzzy, entryFuzzy := false, false
+	lines := strings.Split(string(data), "\n")
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimRight(lines[i], "\r")
+		if strings.HasPrefix(line, "#,") && strings.Contains(line, "fuzzy") {
+			fuzzy = true
+		}
+		match := poField.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		value, _ := strconv.Unquote(match[3])
+		for i+1 < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[i+1]), `"`) {
+			part, _ := strconv.Unquote(strings.TrimSpace(lines[i+1]))
+			value += part
+			i++
+		}
+		switch keyword := match[1]; {
+		case keyword == "msgctxt":
+			context = value
+		case keyword == "msgid":
+			msgid, entryContext, entryFuzzy = value, context, fuzzy
+			context, fuzzy = "", false
+		case strings.HasPrefix(keyword, "msgstr"):
+			key := msgid + "\x00" + match[2]
+			if entryContext != "" {
+				key = entryContext + "\x04" + key
+			}
+			messages = append(messages, poMessage{Key: key, MsgID: msgid, Value: value, Fuzzy: entryFuzzy})
+		}
+	}
+	return messages
+}
+
+// mergePO makes each untranslated message of current a paragraph, with the
+// translation of the same message in translated when it has one that
+// isn't fuzzy.
+func mergePO(current, translated []byte) []paragraph {
+	known := make(map[string]string)
+	for _, message := range poMessages(translated) {
+		if message.Value != "" && !message.Fuzzy {
+			known[message.Key] = message.Value
+		}
+	}
+	var paragraphs []paragraph
+	for _, message := range poMessages(current) {
+		if message.Value != "" || strings.TrimSpace(message.MsgID) == "" {
+			continue
+		}
+		p := paragraph{start: len(paragraphs), end: len(paragraphs) + 1}
+		if translation, ok := known[message.Key]; ok {
+			p.translations = []string{translation}
+		}
+		paragraphs = append(paragraphs, p)
+	}
+	return paragraphs
+}
+
+// gitChange is a file changed between two commits.
+type gitChange struct {
+	Status string
+	Path   string
+}
+
+// gitChanges lists the files under dir changed between two commits, with
+// paths relative to the working directory. Renamed files are listed as
+// deleted and added.
+func gitChanges(since, until, dir string) ([]gitChange, error) {
+	output, err := gitOutput("diff", "--name-status", "--no-renames", "--relative", "-z", since, until, "--", dir)
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.Split(strings.TrimSuffix(string(output), "\x00"), "\x00")
+	var changes []gitChange
+	for i := 0; i+1 < len(fields); i += 2 {
+		changes = append(changes, gitChange{Status: fields[i], Path: fields[i+1]})
+	}
+	return changes, nil
+}
+
+// gitFile returns a file as of a commit, or nil if it didn't exist then.
+func gitFile(ref, path string) ([]byte, error) {
+	spec := ref + ":./" + filepath.ToSlash(path)
+	if _, err := gitOutput("cat-file", "-e", spec); err != nil {
+		return nil, nil
+	}
+	return gitOutput("show", spec)
+}
+
+func gitOutput(args ...string) ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command("git", args...)
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return nil, fmt.Errorf("git %s: %s", args[0], message)
+		}
+		return nil, fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return output, nil
+}
+
+// gitTranslateCommand brings the translations of Markdown pages and gettext
+// catalogs in line with the changes made to their sources between two
+// commits, translating only the paragraphs and messages that changed.
+func gitTranslateCommand() (*flag.FlagSet, func() error) {
+	flags := flag.NewFlagSet("git-translate", flag.ContinueOnError)
+	client := clientFlags(flags)
+	since := flags.String("since", "", "commit the translations are in line with")
+	until := flags.String("until", "HEAD", "commit to bring the translations in line with")
+	src := flags.String("src", "content/en", "directory of the source files")
+	out := flags.String("out", "content/{lang}", "directory of the translated files, {lang} standing for the target language")
+	source := flags.String("source", "", "source language (detected by default)")
+	targets := flags.String("target", "", "comma-separated target languages")
+	dryRun := flags.Bool("dry-run", false, "list the paragraphs to translate without translating them")
+
+	return flags, func() error {
+		langs := splitList(strings.ToUpper(*targets))
+		switch {
+		case *since == "":
+			return errors.New("-since is required")
+		case len(langs) == 0:
+			return errors.New("-target is required")
+		case len(langs) > 1 && !strings.Contains(*out, "{lang}"):
+			return errors.New("-out must contain {lang} for several target languages")
+		}
+		changes, err := gitChanges(*since, *until, *src)
+		if err != nil {
+			return err
+		}
+		client.http.Timeout = 5 * time.Minute
+
+		translated, reused, failed := 0, 0, 0
+		for _, change := range changes {
+			format, ok := detectDocumentFormat("", change.Path, "")
+			if !ok || (format.Name != "md" && format.Name != "po") {
+				continue
+			}
+			rel, err := filepath.Rel(*src, change.Path)
+			if err != nil {
+				return err
+			}
+			// Catalogs are translated from their template.
+			if ext := filepath.Ext(rel); strings.EqualFold(ext, ".pot") {
+				rel = strings.TrimSuffix(rel, ext) + ".po"
+			}
+			if change.Status == "D" {
+				fmt.Fprintf(os.Stderr, "%s: removed, its translations are left as they are\n", change.Path)
+				continue
+			}
+			previous, err := gitFile(*since, change.Path)
+			if err != nil {
+				return err
+			}
+			current, err := gitFile(*until, change.Path)
+			if err != nil {
+				return err
+			}
+			doc, err := format.Parse(current, documentOptions{})
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", change.Path, err)
+				failed++
+				continue
+			}
+
+			for _, lang := range langs {
+				target := filepath.Join(strings.ReplaceAll(*out, "{lang}", strings.ToLower(lang)), rel)
+				existing, err := os.ReadFile(target)
+				if err != nil && !os.IsNotExist(err) {
+					return err
+				}
+				var paragraphs []paragraph
+				if format.Name == "po" {
+					paragraphs, err = mergePO(current, existing), nil
+				} else {
+					paragraphs, err = mergeMarkdown(previous, doc, existing)
+				}
+				if err == nil && paragraphsEnd(paragraphs) != len(doc.Segments()) {
+					err = errors.New("failed to split the source into paragraphs")
+				}
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "%s: %v\n", target, err)
+					failed++
+					continue
+				}
+
+				count := 0
+				for _, p := range paragraphs {
+					if p.translations == nil {
+						count++
+					}
+				}
+				if *dryRun {
+					if count > 0 {
+						fmt.Printf("%s -> %s: %d of %d paragraphs\n", change.Path, target, count, len(paragraphs))
+					}
+					translated += count
+					reused += len(paragraphs) - count
+					continue
+				}
+
+				params := TranslateParams{SourceLang: strings.ToUpper(*source), TargetLang: lang}
+				err = translateParagraphs(client, params, doc.Segments(), paragraphs)
+				var rendered []byte
+				if err == nil {
+					translations := make([]string, 0, len(doc.Segments()))
+					for _, p := range paragraphs {
+						translations = append(translations, p.translations...)
+					}
+					rendered, err = doc.Render(translations)
+				}
+				if err == nil {
+					err = os.MkdirAll(filepath.Dir(target), 0o755)
+				}
+				if err == nil {
+					err = os.WriteFile(target, rendered, 0o644)
+				}
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "%s: %v\n", target, err)
+					failed++
+					continue
+				}
+				fmt.Printf("%s -> %s: %d of %d paragraphs\n", change.Path, target, count, len(paragraphs))
+				translated += count
+				reused += len(paragraphs) - count
+			}
+		}
+
+		verb := "translated"
+		if *dryRun {
+			verb = "to translate"
+		}
+		fmt.Fprintf(os.Stderr, "%d paragraphs %s, %d kept, %d files failed\n", translated, verb, reused, failed)
+		if failed > 0 {
+			return fmt.Errorf("%d files failed", failed)
+		}
+		return nil
+	}
+}
+
+// translateParagraphs translates the paragraphs without translations, one
+// request each with their segments as lines.
+func translateParagraphs(client *cliClient, params TranslateParams, segments []string, paragraphs []paragraph) error {
+	params.PreserveWhitespace = true
+	for i, p := range paragraphs {
+		if p.translations != nil {
+			continue
+		}
+		params.Text = strings.Join(segments[p.start:p.end], "\n")
+		result, err := client.translate(params)
+		if err != nil {
+			return err
+		}
+		// Segments of several lines, such as gettext messages, are
+		// paragraphs of their own.
+		lines := []string{result.Data}
+		if p.end-p.start > 1 {
+			lines = strings.Split(result.Data, "\n")
+		}
+		if len(lines) != p.end-p.start {
+			return fmt.Errorf("translation of %q has %d lines, want %d", params.Text, len(lines), p.end-p.start)
+		}
+		paragraphs[i].translations = lines
+	}
+	return nil
+}
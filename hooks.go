@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os/exec"
+	"strings"
+)
+
+// Hook stages and failure policies.
+const (
+	HookPre  = "pre"
+	HookPost = "post"
+
+	HookReject = "reject"
+	HookSkip   = "skip"
+)
+
+// hookPayload is sent to a hook as JSON, which answers with the same object
+// holding the text to use instead.
+type hookPayload struct {
+	Stage      string `json:"stage"`
+	Text       string `json:"text"`
+	SourceLang string `json:"source_lang"`
+	TargetLang string `json:"target_lang"`
+}
+
+var hookClient = &http.Client{}
+
+// isWebhook reports whether a hook is a URL rather than a command.
+func isWebhook(hook string) bool {
+	return strings.HasPrefix(hook, "http://") || strings.HasPrefix(hook, "https://")
+}
+
+// translateWithHooks translates params, passing the request through the
+// transform scripts and PRE_HOOK before it is sent upstream, and the
+// translation through POST_HOOK and the scripts.
+func translateWithHooks(params TranslateParams) TranslateResponse {
+	transform, err := newScriptTransform()
+	if err != nil {
+		log.Printf("Error loading scripts: %v", err)
+		return TranslateResponse{Code: 500, Message: "Transform scripts failed"}
+	}
+	defer transform.release()
+
+	request := scriptRequest{Text: params.Text, SourceLang: params.SourceLang, TargetLang: params.TargetLang}
+	if err := transform.request(&request); err != nil {
+		if failed := hookFailed("Transform script", err); failed != nil {
+			return *failed
+		}
+	} else {
+		params.Text, params.SourceLang, params.TargetLang = request.Text, request.SourceLang, request.TargetLang
+	}
+
+	if hook := cfg().PreHook; hook != "" {
+		text, err := runHook(hook, hookPayload{Stage: HookPre, Text: params.Text, SourceLang: params.SourceLang, TargetLang: params.TargetLang})
+		if err != nil {
+			if failed := hookFailed("Pre-processing hook", err); failed != nil {
+				return *failed
+			}
+		} else {
+			params.Text = text
+		}
+	}
+
+	response := translateText(params)
+	if response.Code != 200 {
+		return response
+	}
+
+	if hook := cfg().PostHook; hook != "" {
+		text, err := runHook(hook, hookPayload{Stage: HookPost, Text: response.Data, SourceLang: response.SourceLang, TargetLang: response.TargetLang})
+		if err != nil {
+			if failed := hookFailed("Post-processing hook", err); failed != nil {
+				return *failed
+			}
+		} else {
+			response.Data = text
+		}
+	}
+
+	result := scriptResponse{Text: response.Data, SourceLang: response.SourceLang, TargetLang: response.TargetLang, Alternatives: response.Alternatives}
+	if err := transform.response(&result); err != nil {
+		if failed := hookFailed("Transform script", err); failed != nil {
+			return *failed
+		}
+	} else {
+		response.Data, response.SourceLang, response.TargetLang, response.Alternatives = result.Text, result.SourceLang, result.TargetLang, result.Alternatives
+	}
+	return response
+}
+
+// hookFailed logs the failure of a hook or script and returns the response
+// to fail the request with, or nil when HOOK_FAILURE is skip.
+func hookFailed(name string, err error) *TranslateResponse {
+	log.Printf("Error running %s: %v", strings.ToLower(name), err)
+	if cfg().HookFailure == HookSkip {
+		return nil
+	}
+	return &TranslateResponse{Code: 502, Message: name + " failed"}
+}
+
+// runHook sends payload to a webhook or to the standard input of a command,
+// and returns the text of its answer. The hook must answer within
+// HOOK_TIMEOUT.
+func runHook(hook string, payload hookPayload) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), cfg().HookTimeout)
+	defer cancel()
+
+	body, err := jsonMarshal(payload)
+	if err != nil {
+		return "", err
+	}
+	var output []byte
+	if isWebhook(hook) {
+		output, err = postHook(ctx, hook, body)
+	} else {
+		output, err = execHook(ctx, hook, body)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	var answer hookPayload
+	if err := jsonUnmarshal(output, &answer); err != nil {
+		return "", fmt.Errorf("invalid answer from hook: %w", err)
+	}
+	return answer.Text, nil
+}
+
+func postHook(ctx context.Context, url string, body []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := hookClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("hook answered %s", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 16<<20))
+}
+
+// execHook runs command, split on spaces and without a shell.
+func execHook(ctx context.Context, command string, body []byte) ([]byte, error) {
+	args := strings.Fields(command)
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdin = bytes.NewReader(body)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	output, err := cmd.Output()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return nil, fmt.Errorf("hook timed out after %v", cfg().HookTimeout)
+	}
+	if err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return nil, fmt.Errorf("%w: %s", err, message)
+		}
+		return nil, err
+	}
+	return output, nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// idempotencyConflictMessage answers a key reused for a different request.
+const idempotencyConflictMessage = "Idempotency-Key was already used for a different request"
+
+// idempotencyEntry holds the outcome of the first request seen with a key.
+// done is closed once result is available.
+type idempotencyEntry struct {
+	key         string
+	fingerprint string
+	expires     time.Time
+	done        chan struct{}
+	result      TranslateResponse
+}
+
+// idempotencyStore remembers translation results by Idempotency-Key so that
+// retried requests get the stored result instead of a second upstream call.
+// It holds at most maxKeys keys, dropping the oldest to make room.
+type idempotencyStore struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	maxKeys int
+	entries map[string]*idempotencyEntry
+	// order holds the entries oldest first, as they all live for ttl. It
+	// may still hold entries already dropped from the map.
+	order []*idempotencyEntry
+}
+
+var idempotency = newIdempotencyStore(cfg().IdempotencyTTL, cfg().IdempotencyMaxKeys)
+
+func newIdempotencyStore(ttl time.Duration, maxKeys int) *idempotencyStore {
+	return &idempotencyStore{
+		ttl:     ttl,
+		maxKeys: maxKeys,
+		entries: make(map[string]*idempotencyEntry),
+	}
+}
+
+// do runs fn once per key, where key is the Idempotency-Key scoped to the
+// caller. Later calls with the same key wait for and return the first
+// result, reporting replayed as true. A key reused for a different request
+// is reported as a conflict. Failed results are not kept, so the client can
+// retry them.
+func (s *idempotencyStore) do(key, fingerprint string, fn func() TranslateResponse) (result TranslateResponse, replayed, conflict bool) {
+	now := time.Now()
+
+	s.mu.Lock()
+	if entry, ok := s.entries[key]; ok && now.Before(entry.expires) {
+		s.mu.Unlock()
+		if entry.fingerprint != fingerprint {
+			return TranslateResponse{}, false, true
+		}
+		<-entry.done
+		return entry.result, true, false
+	}
+
+	for len(s.entries) >= max(s.maxKeys, 1) {
+		s.dropOldest()
+	}
+	entry := &idempotencyEntry{
+		key:         key,
+		fingerprint: fingerprint,
+		expires:     now.Add(s.ttl),
+		done:        make(chan struct{}),
+	}
+	s.entries[key] = entry
+	s.order = append(s.order, entry)
+	s.mu.Unlock()
+
+	entry.result = fn()
+	close(entry.done)
+
+	if entry.result.Code != 200 {
+		s.mu.Lock()
+		if s.entries[key] == entry {
+			delete(s.entries, key)
+		}
+		s.mu.Unlock()
+	}
+	return entry.result, false, false
+}
+
+// conflicts reports whether key is held by a different request, without
+// waiting for its result.
+func (s *idempotencyStore) conflicts(key, fingerprint string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.entries[key]
+	return ok && time.Now().Before(entry.expires) && entry.fingerprint != fingerprint
+}
+
+// dropOldest removes the oldest entry. Callers must hold the lock.
+func (s *idempotencyStore) dropOldest() {
+	for len(s.order) > 0 {
+		entry := s.order[0]
+		s.order[0] = nil
+		s.order = s.order[1:]
+		if s.entries[entry.key] == entry {
+			delete(s.entries, entry.key)
+			return
+		}
+	}
+}
+
+// sweep drops expired entries every interval, walking only the expired
+// ones as the entries are kept oldest first.
+func (s *idempotencyStore) sweep(interval time.Duration) {
+	for now := range time.Tick(interval) {
+		s.mu.Lock()
+		for len(s.order) > 0 && now.After(s.order[0].expires) {
+			s.dropOldest()
+		}
+		s.mu.Unlock()
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"strings"
+)
+
+// Formality values of the web client's commonJobParams.
+const (
+	FormalityFormal   = "formal"
+	FormalityInformal = "informal"
+)
+
+// CommonJobParams are the style options the web client sends along with the
+// texts. Requests setting none of them leave them out, as the web client
+// does when its options are untouched.
+type CommonJobParams struct {
+	Mode            string `json:"mode"`
+	WasSpoken       bool   `json:"wasSpoken"`
+	TranscribeAs    string `json:"transcribe_as"`
+	RegionalVariant string `json:"regionalVariant,omitempty"`
+	Formality       string `json:"formality,omitempty"`
+	AdvancedMode    bool   `json:"advancedMode,omitempty"`
+}
+
+// normalizeFormality maps the formality names of the DeepL API to those of
+// the web client. Unknown names are returned unchanged.
+func normalizeFormality(formality string) string {
+	switch formality = strings.ToLower(strings.TrimSpace(formality)); formality {
+	case "more", "prefer_more":
+		return FormalityFormal
+	case "less", "prefer_less":
+		return FormalityInformal
+	case "default":
+		return ""
+	}
+	return formality
+}
+
+// regionalVariant returns the variant of UPSTREAM_VARIANTS for a target
+// language without a region, if any.
+func regionalVariant(targetLang string) string {
+	// Target languages with a region already pick their variant.
+	if strings.ContainsAny(targetLang, "-_") {
+		return ""
+	}
+	for _, variant := range cfg().UpstreamVariants {
+		if baseLanguage(variant) == baseLanguage(targetLang) {
+			return variant
+		}
+	}
+	return ""
+}
+
+// jobParams returns the commonJobParams of a request: its own options, with
+// UPSTREAM_FORMALITY, UPSTREAM_VARIANTS and UPSTREAM_ADVANCED_MODE for
+// those it leaves out, or nil when none is set.
+func jobParams(params TranslateParams) *CommonJobParams {
+	job := CommonJobParams{
+		Mode:            "translate",
+		WasSpoken:       params.WasSpoken,
+		RegionalVariant: params.RegionalVariant,
+		Formality:       normalizeFormality(params.Formality),
+		AdvancedMode:    params.AdvancedMode || cfg().UpstreamAdvanced,
+	}
+	if job.Formality == "" {
+		job.Formality = normalizeFormality(cfg().UpstreamFormality)
+	}
+	if job.RegionalVariant == "" {
+		job.RegionalVariant = regionalVariant(params.TargetLang)
+	}
+	if !job.WasSpoken && job.RegionalVariant == "" && job.Formality == "" && !job.AdvancedMode {
+		return nil
+	}
+	// The web client writes variants such as "en-US".
+	if lang, region, ok := strings.Cut(job.RegionalVariant, "-"); ok {
+		job.RegionalVariant = strings.ToLower(lang) + "-" + strings.ToUpper(region)
+	}
+	return &job
+}
+
+// isValidJobParams reports whether the style options of a request can be
+// sent upstream: a known formality, and a regional variant of the target
+// language.
+func isValidJobParams(params TranslateParams) bool {
+	switch normalizeFormality(params.Formality) {
+	case "", FormalityFormal, FormalityInformal:
+	default:
+		return false
+	}
+	variant := params.RegionalVariant
+	if variant == "" {
+		return true
+	}
+	_, region, ok := strings.Cut(variant, "-")
+	return ok && region != "" && baseLanguage(variant) == baseLanguage(params.TargetLang)
+}
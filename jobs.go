@@ -0,0 +1,524 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+)
+
+// Job states.
+const (
+	JobQueued  = "queued"
+	JobRunning = "running"
+	JobDone    = "done"
+	JobFailed  = "failed"
+)
+
+// Job is a batch of texts translated in the background by the worker pool.
+type Job struct {
+	ID        string              `json:"id"`
+	Status    string              `json:"status"`
+	Total     int                 `json:"total"`
+	Completed int                 `json:"completed"`
+	Failed    int                 `json:"failed"`
+	CreatedAt time.Time           `json:"created_at"`
+	UpdatedAt time.Time           `json:"updated_at"`
+	Input     string              `json:"input,omitempty"`
+	Output    string              `json:"output,omitempty"`
+	Bilingual string              `json:"bilingual,omitempty"`
+	Error     string              `json:"error,omitempty"`
+	Results   []TranslateResponse `json:"results,omitempty"`
+
+	params  TranslateParams
+	texts   []string
+	savedAt time.Time
+	// done is closed when a job someone waits for finishes. Such jobs
+	// aren't checkpointed, as their results are lost with the caller on a
+	// restart anyway.
+	done chan struct{}
+}
+
+// jobRecord is the on-disk checkpoint of a job.
+type jobRecord struct {
+	Job
+	Params   TranslateParams `json:"params"`
+	Texts    []string        `json:"texts"`
+	UsageKey string          `json:"usage_key,omitempty"`
+}
+
+// JobRequest submits a job. The texts come either from Texts or from the
+// object at Input; with Output set, the translations are written there,
+// as a bilingual export if Bilingual names a layout.
+type JobRequest struct {
+	TranslateParams
+	Texts     []string `json:"texts"`
+	Input     string   `json:"input"`
+	Output    string   `json:"output"`
+	Bilingual string   `json:"bilingual"`
+}
+
+// jobQueue runs jobs on a fixed pool of workers and keeps finished jobs
+// around for cfg().JobTTL so their results can be fetched.
+type jobQueue struct {
+	mu      sync.Mutex
+	jobs    map[string]*Job
+	queue   chan *Job
+	running int
+}
+
+var jobs = &jobQueue{
+	jobs:  make(map[string]*Job),
+	queue: make(chan *Job, cfg().JobQueueSize),
+}
+
+func (q *jobQueue) start(workers int) {
+	for i := 0; i < workers; i++ {
+		go func() {
+			for job := range q.queue {
+				q.mu.Lock()
+				q.running++
+				q.mu.Unlock()
+
+				q.run(job)
+
+				q.mu.Lock()
+				q.running--
+				q.mu.Unlock()
+			}
+		}()
+	}
+}
+
+// drain waits up to timeout for the queued and running jobs to finish, and
+// reports whether they did.
+func (q *jobQueue) drain(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		stats := q.stats()
+		if stats.Queued == 0 && stats.Running == 0 {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// submit queues a job. It returns false when the queue is full.
+func (q *jobQueue) submit(request JobRequest) (*Job, bool) {
+	now := time.Now()
+	job := &Job{
+		ID:        utils.UUIDv4(),
+		Status:    JobQueued,
+		Total:     len(request.Texts),
+		CreatedAt: now,
+		UpdatedAt: now,
+		Input:     request.Input,
+		Output:    request.Output,
+		Bilingual: request.Bilingual,
+		params:    request.TranslateParams,
+		texts:     request.Texts,
+	}
+
+	if !q.enqueue(job) {
+		return nil, false
+	}
+	return job, true
+}
+
+// translate runs texts through the worker pool as a job and waits for it,
+// so synchronous work such as documents shares JOB_WORKERS and the queue
+// metrics with submitted jobs. It returns false when the queue is full.
+func (q *jobQueue) translate(params TranslateParams, texts []string) ([]TranslateResponse, bool) {
+	now := time.Now()
+	job := &Job{
+		ID:        utils.UUIDv4(),
+		Status:    JobQueued,
+		Total:     len(texts),
+		CreatedAt: now,
+		UpdatedAt: now,
+		params:    params,
+		texts:     texts,
+		done:      make(chan struct{}),
+	}
+	if !q.enqueue(job) {
+		return nil, false
+	}
+	<-job.done
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.jobs, job.ID)
+	return job.Results, true
+}
+
+// enqueue registers a job and hands it to the workers. It returns false
+// when the queue is full.
+func (q *jobQueue) enqueue(job *Job) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.sweep(job.CreatedAt)
+
+	select {
+	case q.queue <- job:
+		q.jobs[job.ID] = job
+		if cfg().JobsDir != "" && job.done == nil {
+			if err := saveJob(job); err != nil {
+				log.Printf("Error saving job %s: %v", job.ID, err)
+			}
+		}
+		return true
+	default:
+		return false
+	}
+}
+
+// run translates the texts of a job with up to cfg().JobConcurrency requests
+// in flight.
+// Texts already translated before a restart are skipped.
+func (q *jobQueue) run(job *Job) {
+	if job.Input != "" && job.texts == nil {
+		texts, err := readJobInput(job.Input)
+		if err != nil {
+			q.fail(job, fmt.Errorf("failed to read input: %w", err))
+			return
+		}
+		q.update(job, func() {
+			job.texts = texts
+			job.Total = len(texts)
+		})
+	}
+
+	q.update(job, func() {
+		job.Status = JobRunning
+		if len(job.Results) != len(job.texts) {
+			job.Results = make([]TranslateResponse, len(job.texts))
+		}
+		job.Completed, job.Failed = 0, 0
+		for _, result := range job.Results {
+			if result.Code == 200 {
+				job.Completed++
+			}
+		}
+	})
+
+	sem := make(chan struct{}, max(cfg().JobConcurrency, 1))
+	var wg sync.WaitGroup
+	for i, text := range job.texts {
+		if job.Results[i].Code == 200 {
+			continue
+		}
+		if strings.TrimSpace(text) == "" {
+			q.update(job, func() {
+				job.Results[i] = TranslateResponse{Code: 200, Message: "success", Data: text}
+				job.Completed++
+			})
+			continue
+		}
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int, text string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			params := job.params
+			params.Text = text
+			result := translate(params)
+			q.update(job, func() {
+				job.Results[i] = result
+				job.Completed++
+				if result.Code != 200 {
+					job.Failed++
+				}
+			})
+		}(i, text)
+	}
+	wg.Wait()
+
+	var outputErr error
+	if job.Output != "" {
+		outputErr = q.writeOutput(job)
+	}
+
+	q.update(job, func() {
+		switch {
+		case outputErr != nil:
+			job.Status = JobFailed
+			job.Error = fmt.Sprintf("failed to write output: %v", outputErr)
+		case job.Failed == job.Total && job.Total > 0:
+			job.Status = JobFailed
+		default:
+			job.Status = JobDone
+		}
+		job.savedAt = time.Time{}
+	})
+	if job.done != nil {
+		close(job.done)
+		return
+	}
+	log.Printf("Job %s finished: %d/%d texts translated", job.ID, job.Completed-job.Failed, job.Total)
+}
+
+func (q *jobQueue) fail(job *Job, err error) {
+	log.Printf("Job %s failed: %v", job.ID, err)
+	q.update(job, func() {
+		job.Status = JobFailed
+		job.Error = err.Error()
+		job.savedAt = time.Time{}
+	})
+}
+
+// readJobInput loads the texts of a job from an object: a JSON array of
+// strings for .json objects, otherwise one text per line.
+func readJobInput(location string) ([]string, error) {
+	client, err := newS3Client()
+	if err != nil {
+		return nil, err
+	}
+	data, err := client.GetObject(location)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.HasSuffix(location, ".json") {
+		var texts []string
+		if err := jsonUnmarshal(data, &texts); err != nil {
+			return nil, fmt.Errorf("expected a JSON array of strings: %w", err)
+		}
+		return texts, nil
+	}
+	return strings.Split(string(data), "\n"), nil
+}
+
+// writeOutput stores the translations of a job in the same shape as its
+// input. Texts that failed to translate are written untranslated.
+func (q *jobQueue) writeOutput(job *Job) error {
+	client, err := newS3Client()
+	if err != nil {
+		return err
+	}
+
+	q.mu.Lock()
+	translations := job.translations()
+	q.mu.Unlock()
+
+	if job.Bilingual != "" {
+		export := renderBilingual(job.Bilingual, job.texts, translations)
+		return client.PutObject(job.Output, export.Data, export.ContentType)
+	}
+	if strings.HasSuffix(job.Output, ".json") {
+		data, err := jsonMarshal(translations)
+		if err != nil {
+			return err
+		}
+		return client.PutObject(job.Output, data, "application/json")
+	}
+	return client.PutObject(job.Output, []byte(strings.Join(translations, "\n")), "text/plain; charset=utf-8")
+}
+
+// translations returns the translated texts of a job, keeping the source
+// text where the translation failed or hasn't finished.
+func (j *Job) translations() []string {
+	translations := append([]string(nil), j.texts...)
+	for i, result := range j.Results {
+		if result.Code == 200 {
+			translations[i] = result.Data
+		}
+	}
+	return translations
+}
+
+// update applies change to the job and checkpoints it, at most once per
+// second while it is running.
+func (q *jobQueue) update(job *Job, change func()) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	change()
+	job.UpdatedAt = time.Now()
+
+	if cfg().JobsDir != "" && job.done == nil && job.UpdatedAt.Sub(job.savedAt) >= time.Second {
+		if err := saveJob(job); err != nil {
+			log.Printf("Error saving job %s: %v", job.ID, err)
+		}
+		job.savedAt = job.UpdatedAt
+	}
+}
+
+func jobPath(id string) string {
+	return filepath.Join(cfg().JobsDir, id+".json")
+}
+
+// saveJob writes the checkpoint of a job. Callers must hold the lock.
+func saveJob(job *Job) error {
+	data, err := jsonMarshal(jobRecord{Job: *job, Params: job.params, Texts: job.texts, UsageKey: job.params.usageKey})
+	if err != nil {
+		return err
+	}
+	tmp := jobPath(job.ID) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, jobPath(job.ID))
+}
+
+// restore loads the checkpointed jobs from cfg().JobsDir and queues the
+// unfinished ones again, so a restart resumes them where they left off.
+func (q *jobQueue) restore() error {
+	if err := os.MkdirAll(cfg().JobsDir, 0o700); err != nil {
+		return err
+	}
+	paths, err := filepath.Glob(filepath.Join(cfg().JobsDir, "*.json"))
+	if err != nil {
+		return err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var record jobRecord
+		if err := jsonUnmarshal(data, &record); err != nil {
+			log.Printf("Skipping unreadable job checkpoint %s: %v", path, err)
+			continue
+		}
+
+		job := record.Job
+		job.params, job.texts = record.Params, record.Texts
+		job.params.usageKey = record.UsageKey
+		q.jobs[job.ID] = &job
+		if job.Status == JobDone || job.Status == JobFailed {
+			continue
+		}
+
+		job.Status = JobQueued
+		select {
+		case q.queue <- &job:
+			log.Printf("Resuming job %s at %d/%d texts", job.ID, job.Completed, job.Total)
+		default:
+			log.Printf("Job queue is full, job %s stays paused until restart", job.ID)
+		}
+	}
+	return nil
+}
+
+// get returns a snapshot of the job that is safe to serialize.
+func (q *jobQueue) get(id string) (Job, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job, ok := q.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	snapshot := *job
+	snapshot.Results = append([]TranslateResponse(nil), job.Results...)
+	return snapshot, true
+}
+
+// sweep forgets finished jobs older than cfg().JobTTL. Callers must hold the
+// lock.
+func (q *jobQueue) sweep(now time.Time) {
+	for id, job := range q.jobs {
+		finished := job.Status == JobDone || job.Status == JobFailed
+		if finished && now.Sub(job.UpdatedAt) > cfg().JobTTL {
+			delete(q.jobs, id)
+			if cfg().JobsDir != "" {
+				if err := os.Remove(jobPath(id)); err != nil && !os.IsNotExist(err) {
+					log.Printf("Error removing job %s: %v", id, err)
+				}
+			}
+		}
+	}
+}
+
+// JobStats is the admin view of the worker pool.
+type JobStats struct {
+	Queued  int `json:"queued"`
+	Running int `json:"running"`
+	Workers int `json:"workers"`
+}
+
+func (q *jobQueue) stats() JobStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return JobStats{
+		Queued:  len(q.queue),
+		Running: q.running,
+		Workers: cfg().JobWorkers,
+	}
+}
+
+func handleCreateJob(c *fiber.Ctx) error {
+	var request JobRequest
+	if err := c.BodyParser(&request); err != nil {
+		return c.Status(400).JSON(fiber.Map{"code": 400, "message": "Invalid request body"})
+	}
+	applyKeyDefaults(c, &request.TranslateParams)
+	if len(request.Texts) == 0 && request.Input == "" {
+		return c.Status(400).JSON(fiber.Map{"code": 400, "message": "No texts to translate"})
+	}
+	if len(request.Texts) > 0 && request.Input != "" {
+		return c.Status(400).JSON(fiber.Map{"code": 400, "message": "Use either texts or input, not both"})
+	}
+	for _, location := range []string{request.Input, request.Output} {
+		if location == "" {
+			continue
+		}
+		if _, _, err := parseS3Location(location); err != nil {
+			return c.Status(400).JSON(fiber.Map{"code": 400, "message": err.Error()})
+		}
+		// The server's S3 credentials would otherwise let anyone read or
+		// overwrite any object they can reach.
+		if !isAdmin(c) && !s3LocationAllowed(location) {
+			return c.Status(403).JSON(fiber.Map{"code": 403, "message": fmt.Sprintf("Location %q is not allowed", location)})
+		}
+	}
+	if request.Bilingual != "" && !isValidBilingualLayout(request.Bilingual) {
+		return c.Status(400).JSON(fiber.Map{"code": 400, "message": "Invalid bilingual layout: " + request.Bilingual})
+	}
+
+	request.usageKey = meterRequest(c)
+	request.client = clientKey(c)
+	job, ok := jobs.submit(request)
+	if !ok {
+		return c.Status(503).JSON(fiber.Map{"code": 503, "message": "Job queue is full, please try again later"})
+	}
+	snapshot, _ := jobs.get(job.ID)
+	return c.Status(202).JSON(snapshot)
+}
+
+func handleGetJob(c *fiber.Ctx) error {
+	job, ok := jobs.get(c.Params("id"))
+	if !ok {
+		return c.Status(404).JSON(fiber.Map{"code": 404, "message": "Job not found"})
+	}
+	return c.JSON(job)
+}
+
+// handleJobBilingual downloads the texts of a job next to their
+// translations, in the layout given by the layout query parameter.
+func handleJobBilingual(c *fiber.Ctx) error {
+	job, ok := jobs.get(c.Params("id"))
+	if !ok {
+		return c.Status(404).JSON(fiber.Map{"code": 404, "message": "Job not found"})
+	}
+	layout := c.Query("layout", BilingualTable)
+	if !isValidBilingualLayout(layout) {
+		return c.Status(400).JSON(fiber.Map{"code": 400, "message": "Invalid layout: " + layout})
+	}
+
+	export := renderBilingual(layout, job.texts, job.translations())
+	c.Attachment(job.ID + ".bilingual" + export.Extension)
+	c.Set(fiber.HeaderContentType, export.ContentType)
+	return c.Send(export.Data)
+}
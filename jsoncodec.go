@@ -0,0 +1,21 @@
+//go:build !gojson
+
+package main
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// jsonMarshal and jsonUnmarshal encode and decode the bodies of API requests
+// and responses and of upstream calls. Building with `-tags gojson` swaps in
+// github.com/goccy/go-json, which is faster on large batches.
+var (
+	jsonMarshal   = json.Marshal
+	jsonUnmarshal = json.Unmarshal
+)
+
+// jsonEncode writes the encoding of v to w, followed by a newline.
+func jsonEncode(w io.Writer, v any) error {
+	return json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,18 @@
+//go:build gojson
+
+package main
+
+import (
+	"io"
+
+	"github.com/goccy/go-json"
+)
+
+var (
+	jsonMarshal   = json.Marshal
+	jsonUnmarshal = json.Unmarshal
+)
+
+func jsonEncode(w io.Writer, v any) error {
+	return json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// benchmarkTexts is a batch the size immersive-translate sends in a burst.
+func benchmarkTexts() []string {
+	texts := make([]string, 50)
+	for i := range texts {
+		texts[i] = strings.Repeat("The quick brown fox jumps over the lazy dog. ", 4)
+	}
+	return texts
+}
+
+// Run with and without -tags gojson to compare the codecs.
+
+func BenchmarkJSONMarshalRequest(b *testing.B) {
+	config := createRequestConfig("EN", "DE", benchmarkTexts())
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := jsonMarshal(config); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkJSONUnmarshalResult(b *testing.B) {
+	var result upstreamResult
+	result.Result.Lang = "EN"
+	for _, text := range benchmarkTexts() {
+		result.Result.Texts = append(result.Result.Texts, upstreamText{Text: text})
+	}
+	data, err := jsonMarshal(result)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var decoded upstreamResult
+		if err := jsonUnmarshal(data, &decoded); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkJSONMarshalResponse(b *testing.B) {
+	response := TranslateResponse{
+		Code:         200,
+		Message:      "success",
+		Data:         strings.Join(benchmarkTexts(), "\n"),
+		SourceLang:   "EN",
+		TargetLang:   "DE",
+		Alternatives: benchmarkTexts()[:MaxAlternatives],
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := jsonMarshal(response); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkJSONUnmarshalParams(b *testing.B) {
+	data := []byte(`{"text": "` + strings.Join(benchmarkTexts(), `\n`) + `", "source_lang": "EN", "target_lang": "DE", "alternatives": true}`)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var params TranslateParams
+		if err := jsonUnmarshal(data, &params); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
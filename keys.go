@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// apiToken is an entry of API_TOKENS. Tokens given as "name:token" have a
+// name, by which their options and usage are configured and reported.
+type apiToken struct {
+	Name, Token string
+}
+
+func parseAPITokens(value string) []apiToken {
+	var tokens []apiToken
+	for _, item := range splitList(value) {
+		if name, token, ok := strings.Cut(item, ":"); ok && name != "" && token != "" {
+			tokens = append(tokens, apiToken{Name: name, Token: token})
+		} else {
+			tokens = append(tokens, apiToken{Token: item})
+		}
+	}
+	return tokens
+}
+
+// callerName names the key of a request: the id of its signing key or the
+// name of its bearer token. Other requests have none.
+func callerName(c *fiber.Ctx) string {
+	if id, ok := c.Locals(signingKeyLocal).(string); ok {
+		return id
+	}
+	if token, ok := strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Bearer "); ok {
+		if known, ok := lookupAPIToken(token); ok {
+			return known.Name
+		}
+	}
+	return ""
+}
+
+// keyOptions are the options a key's requests get when they leave them out,
+// and the languages they are restricted to.
+type keyOptions struct {
+	SourceLang   string `json:"source_lang"`
+	TargetLang   string `json:"target_lang"`
+	Engine       string `json:"engine"`
+	HTMLEntities string `json:"html_entities"`
+
+	SourceLangs []string `json:"source_langs"`
+	TargetLangs []string `json:"target_langs"`
+}
+
+// keyDefaults holds the options of KEY_DEFAULTS_FILE by key name, or nil
+// when none is configured. They are replaced when the config is reloaded.
+var keyDefaults atomic.Pointer[map[string]keyOptions]
+
+// loadKeyDefaults reads a JSON object of options by key name, such as
+// {"team-a": {"target_lang": "DE"}}.
+func loadKeyDefaults(path string) (map[string]keyOptions, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open key defaults: %w", err)
+	}
+	defer file.Close()
+
+	var defaults map[string]keyOptions
+	decoder := json.NewDecoder(file)
+	// An option this server doesn't know would otherwise be ignored
+	// silently.
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&defaults); err != nil {
+		return nil, fmt.Errorf("invalid key defaults: %w", err)
+	}
+	for name, options := range defaults {
+		if !isValidEntitiesMode(options.HTMLEntities) {
+			return nil, fmt.Errorf("invalid html_entities %q for %s", options.HTMLEntities, name)
+		}
+	}
+	return defaults, nil
+}
+
+// applyKeyDefaults fills in the options a request left out from the
+// defaults of its key.
+func applyKeyDefaults(c *fiber.Ctx, params *TranslateParams) {
+	all := keyDefaults.Load()
+	if all == nil {
+		return
+	}
+	name := callerName(c)
+	if name == "" {
+		return
+	}
+	defaults, ok := (*all)[name]
+	if !ok {
+		return
+	}
+	fill := func(option *string, value string) {
+		if strings.TrimSpace(*option) == "" {
+			*option = value
+		}
+	}
+	fill(&params.SourceLang, defaults.SourceLang)
+	fill(&params.TargetLang, defaults.TargetLang)
+	fill(&params.Engine, defaults.Engine)
+	fill(&params.HTMLEntities, defaults.HTMLEntities)
+}
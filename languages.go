@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// languageAllowed reports whether lang is in allowed, where a language
+// without a region such as "EN" allows all of its variants. An empty list
+// allows every language.
+func languageAllowed(allowed []string, lang string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	lang = strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(lang), "_", "-"))
+	for _, entry := range allowed {
+		entry = strings.ToUpper(strings.ReplaceAll(entry, "_", "-"))
+		if entry == lang || !strings.ContainsRune(entry, '-') && entry == baseLanguage(lang) {
+			return true
+		}
+	}
+	return false
+}
+
+// languageRestrictions returns the source and target languages allowed on
+// this server and for the key of params, for every list that is set.
+func languageRestrictions(params TranslateParams) (sources, targets [][]string) {
+	if list := cfg().AllowedSourceLangs; len(list) > 0 {
+		sources = append(sources, list)
+	}
+	if list := cfg().AllowedTargetLangs; len(list) > 0 {
+		targets = append(targets, list)
+	}
+	if all := keyDefaults.Load(); all != nil && params.usageKey != "" {
+		if options, ok := (*all)[params.usageKey]; ok {
+			if len(options.SourceLangs) > 0 {
+				sources = append(sources, options.SourceLangs)
+			}
+			if len(options.TargetLangs) > 0 {
+				targets = append(targets, options.TargetLangs)
+			}
+		}
+	}
+	return sources, targets
+}
+
+// checkLanguages refuses a translation from source to target when the server
+// or the key of params doesn't allow either. An automatically detected
+// source is checked once it is known, so an empty source passes.
+func checkLanguages(params TranslateParams, source, target string) *translateError {
+	sources, targets := languageRestrictions(params)
+	for _, allowed := range targets {
+		if !languageAllowed(allowed, target) {
+			return &translateError{Code: 403, Message: fmt.Sprintf("Target language %s is not allowed, use one of %s", strings.ToUpper(target), strings.Join(allowed, ", "))}
+		}
+	}
+	if source == "" || strings.EqualFold(source, "auto") {
+		return nil
+	}
+	for _, allowed := range sources {
+		if !languageAllowed(allowed, source) {
+			return &translateError{Code: 403, Message: fmt.Sprintf("Source language %s is not allowed, use one of %s", strings.ToUpper(source), strings.Join(allowed, ", "))}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ScriptFilterItem is an entry of an Alfred Script Filter result, a format
+// Raycast and other launchers read as well.
+type ScriptFilterItem struct {
+	UID      string            `json:"uid,omitempty"`
+	Title    string            `json:"title"`
+	Subtitle string            `json:"subtitle,omitempty"`
+	Arg      string            `json:"arg,omitempty"`
+	Valid    bool              `json:"valid"`
+	Text     map[string]string `json:"text,omitempty"`
+}
+
+// ScriptFilterResponse is the body of GET /launcher.
+type ScriptFilterResponse struct {
+	Items []ScriptFilterItem `json:"items"`
+}
+
+// handleLauncher translates the text in the q (or text) query parameter and
+// lists the translation and its alternatives as Script Filter items. Errors
+// are reported as a single invalid item so launchers show them inline.
+func handleLauncher(c *fiber.Ctx) error {
+	text := c.Query("q", c.Query("text"))
+	if strings.TrimSpace(text) == "" {
+		return c.JSON(ScriptFilterResponse{Items: []ScriptFilterItem{{
+			Title:    "Type a text to translate",
+			Subtitle: "DeepLX",
+		}}})
+	}
+
+	params := TranslateParams{
+		Text:       text,
+		SourceLang: c.Query("source_lang"),
+		TargetLang: c.Query("target_lang"),
+	}
+	applyKeyDefaults(c, &params)
+	if params.TargetLang == "" {
+		params.TargetLang = "EN"
+	}
+	params.usageKey = meterRequest(c)
+	params.client = clientKey(c)
+	result := translate(params)
+	if result.Code != 200 {
+		return c.JSON(ScriptFilterResponse{Items: []ScriptFilterItem{{
+			Title:    "Translation failed",
+			Subtitle: result.Message,
+		}}})
+	}
+
+	pair := strings.ToUpper(result.SourceLang) + " → " + strings.ToUpper(params.TargetLang)
+	items := []ScriptFilterItem{launcherItem("translation", result.Data, pair)}
+	for i, alternative := range result.Alternatives {
+		items = append(items, launcherItem("alternative-"+strconv.Itoa(i+1), alternative, pair+" · alternative"))
+	}
+	return c.JSON(ScriptFilterResponse{Items: items})
+}
+
+func launcherItem(uid, text, subtitle string) ScriptFilterItem {
+	return ScriptFilterItem{
+		UID:      uid,
+		Title:    text,
+		Subtitle: subtitle,
+		Arg:      text,
+		Valid:    true,
+		Text:     map[string]string{"copy": text, "largetype": text},
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// EngineLocal is the engine calling the model server of LOCAL_MODEL_URL.
+const EngineLocal = "local"
+
+// Language code styles sent to the local model server.
+const (
+	LocalCodesFlores = "flores"
+	LocalCodesDeepL  = "deepl"
+)
+
+// floresCodes maps DeepL language codes to the FLORES-200 codes NLLB
+// models expect.
+var floresCodes = map[string]string{
+	"AR": "arb_Arab", "BG": "bul_Cyrl", "CS": "ces_Latn", "DA": "dan_Latn",
+	"DE": "deu_Latn", "EL": "ell_Grek", "EN": "eng_Latn", "ES": "spa_Latn",
+	"ET": "est_Latn", "FI": "fin_Latn", "FR": "fra_Latn", "HU": "hun_Latn",
+	"ID": "ind_Latn", "IT": "ita_Latn", "JA": "jpn_Jpan", "KO": "kor_Hang",
+	"LT": "lit_Latn", "LV": "lvs_Latn", "NB": "nob_Latn", "NL": "nld_Latn",
+	"PL": "pol_Latn", "PT": "por_Latn", "RO": "ron_Latn", "RU": "rus_Cyrl",
+	"SK": "slk_Latn", "SL": "slv_Latn", "SV": "swe_Latn", "TR": "tur_Latn",
+	"UK": "ukr_Cyrl", "ZH": "zho_Hans", "ZH-HANS": "zho_Hans", "ZH-HANT": "zho_Hant",
+}
+
+// floresCode returns the FLORES-200 code of a DeepL language code. Other
+// codes, such as FLORES-200 codes given by the client, are sent unchanged.
+func floresCode(lang string) string {
+	if code, ok := floresCodes[strings.ToUpper(lang)]; ok {
+		return code
+	}
+	if code, ok := floresCodes[baseLanguage(lang)]; ok {
+		return code
+	}
+	return lang
+}
+
+// deeplCodes maps FLORES-200 codes back to the shortest DeepL code, so that
+// the detected language is reported as DeepL would.
+var deeplCodes = func() map[string]string {
+	codes := make(map[string]string, len(floresCodes))
+	for deepl, flores := range floresCodes {
+		if existing, ok := codes[flores]; !ok || len(deepl) < len(existing) {
+			codes[flores] = deepl
+		}
+	}
+	return codes
+}()
+
+// localRequest is POSTed to LOCAL_MODEL_URL. SourceLang is empty when the
+// language is to be detected.
+type localRequest struct {
+	Texts      []string `json:"texts"`
+	SourceLang string   `json:"source_lang"`
+	TargetLang string   `json:"target_lang"`
+}
+
+// localReply is the answer of the model server, with one translation per
+// text and optionally the detected source language.
+type localReply struct {
+	Texts      []string `json:"texts"`
+	SourceLang string   `json:"source_lang"`
+}
+
+var localClient = &http.Client{}
+
+// localEngine translates with a model running next to the server, such as
+// NLLB served by CTranslate2, so translation keeps working offline. Its
+// translations are marked low quality.
+type localEngine struct{}
+
+func (localEngine) translate(params TranslateParams, texts []string) (upstreamResult, error) {
+	var result upstreamResult
+
+	request := localRequest{Texts: texts, SourceLang: params.SourceLang, TargetLang: params.TargetLang}
+	if strings.EqualFold(request.SourceLang, "auto") {
+		request.SourceLang = ""
+	}
+	if cfg().LocalModelCodes == LocalCodesFlores {
+		request.TargetLang = floresCode(request.TargetLang)
+		if request.SourceLang != "" {
+			request.SourceLang = floresCode(request.SourceLang)
+		}
+	}
+
+	reply, err := postLocalModel(request)
+	if err != nil {
+		log.Printf("Error calling local model: %v", err)
+		return result, &translateError{Code: 500, Message: "Request failed"}
+	}
+	if len(reply.Texts) != len(texts) {
+		log.Printf("Local model returned %d texts for %d", len(reply.Texts), len(texts))
+		return result, &translateError{Code: 500, Message: "Failed to decode response"}
+	}
+
+	for _, text := range reply.Texts {
+		result.Result.Texts = append(result.Result.Texts, upstreamText{Text: text})
+	}
+	result.Result.Lang = reply.SourceLang
+	if code, ok := deeplCodes[reply.SourceLang]; ok && cfg().LocalModelCodes == LocalCodesFlores {
+		result.Result.Lang = code
+	}
+	return result, nil
+}
+
+func postLocalModel(request localRequest) (localReply, error) {
+	var reply localReply
+	body, err := jsonMarshal(request)
+	if err != nil {
+		return reply, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg().LocalModelTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg().LocalModelURL, bytes.NewReader(body))
+	if err != nil {
+		return reply, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := localClient.Do(req)
+	if err != nil {
+		return reply, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 16<<20))
+	if err != nil {
+		return reply, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return reply, fmt.Errorf("model server answered %s: %.200s", resp.Status, data)
+	}
+	return reply, jsonUnmarshal(data, &reply)
+}
+
+// shouldFallBack reports whether a failed DeepL translation is retried with
+// the local model: when DeepL could not be reached or rejected the request
+// for its rate limit, not when the request itself was invalid.
+func shouldFallBack(name string, failure *translateError) bool {
+	if name != EngineDeepL || !cfg().LocalModelFallback {
+		return false
+	}
+	if _, ok := engines[EngineLocal]; !ok {
+		return false
+	}
+	return failure.Code == http.StatusTooManyRequests || failure.Code >= 500
+}
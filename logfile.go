@@ -0,0 +1,123 @@
+package main
+
+import (
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/logger"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// accessLogFormat is one line per request. The path leaves out the query,
+// which may hold the text to translate. Syslog and the journal record the
+// time themselves.
+const (
+	accessLogFormat     = "${time} " + accessLogLineFormat
+	accessLogLineFormat = "${ip} \"${method} ${path}\" ${status} ${bytesSent} ${latency} ${locals:requestid}\n"
+)
+
+// ACCESS_LOG values sending the access log to a log sink instead of a file.
+const (
+	AccessLogSyslog   = "syslog"
+	AccessLogJournald = "journald"
+)
+
+// openLogFile opens path for appending log lines, rotating it by LOG_MAX_SIZE
+// and LOG_MAX_AGE. Preforked processes would each rotate the same file, so
+// with prefork the file is only appended to and rotation is left to tools
+// such as logrotate.
+func openLogFile(path string) (io.Writer, error) {
+	config := cfg()
+	if config.Prefork {
+		return os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	}
+	const mib = 1 << 20
+	const day = 24 * time.Hour
+	return &lumberjack.Logger{
+		Filename:   path,
+		MaxSize:    max(int((config.LogMaxSize+mib-1)/mib), 1),
+		MaxAge:     int((config.LogMaxAge + day - 1) / day),
+		MaxBackups: config.LogMaxBackups,
+		LocalTime:  true,
+		Compress:   config.LogCompress,
+	}, nil
+}
+
+// openLogs sends the application log to LOG_FILE, LOG_SYSLOG and the
+// journal, whichever are set, or leaves it on standard error. Either way,
+// lines are redacted before they are written.
+func openLogs() {
+	config := cfg()
+	var sinks logFanout
+	if config.LogFile != "" {
+		file, err := openLogFile(config.LogFile)
+		if err != nil {
+			log.Fatalf("Error opening log file: %v", err)
+		}
+		sinks = append(sinks, timestampWriter{file})
+	}
+	if config.LogSyslog != "" {
+		sink, err := newSyslogWriter(config.LogSyslog, config.LogSyslogFacility, "")
+		if err != nil {
+			log.Fatalf("Error opening syslog: %v", err)
+		}
+		sinks = append(sinks, sink)
+	}
+	if config.LogJournald {
+		sink, err := newJournalWriter("")
+		if err != nil {
+			log.Fatalf("Error opening the journal: %v", err)
+		}
+		sinks = append(sinks, sink)
+	}
+	if len(sinks) == 0 {
+		log.SetOutput(redactingWriter{log.Writer()})
+		return
+	}
+	// Sinks that need the date get it from timestampWriter.
+	log.SetFlags(0)
+	log.SetOutput(redactingWriter{sinks})
+}
+
+// accessLog returns the middleware writing one line per request to
+// ACCESS_LOG, or nil when no access log is configured.
+func accessLog() fiber.Handler {
+	config := cfg()
+	format := accessLogLineFormat
+	var output io.Writer
+	var err error
+	switch config.AccessLog {
+	case "":
+		return nil
+	case AccessLogSyslog:
+		output, err = newSyslogWriter(config.LogSyslog, config.LogSyslogFacility, "access")
+	case AccessLogJournald:
+		output, err = newJournalWriter("access")
+	default:
+		format = accessLogFormat
+		output, err = openLogFile(config.AccessLog)
+	}
+	if err != nil {
+		log.Fatalf("Error opening access log: %v", err)
+	}
+	return logger.New(logger.Config{
+		Format:     format,
+		TimeFormat: time.RFC3339,
+		// Fiber pads the latency for its console format and reports the
+		// Content-Length header, which isn't set yet, as bytes sent.
+		CustomTags: map[string]logger.LogFunc{
+			logger.TagLatency: func(output logger.Buffer, _ *fiber.Ctx, data *logger.Data, _ string) (int, error) {
+				return output.WriteString(data.Stop.Sub(data.Start).Round(time.Microsecond).String())
+			},
+			logger.TagBytesSent: func(output logger.Buffer, c *fiber.Ctx, _ *logger.Data, _ string) (int, error) {
+				return output.WriteString(strconv.Itoa(len(c.Response().Body())))
+			},
+		},
+		Output:        redactingWriter{output},
+		DisableColors: true,
+	})
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// logIdentifier is the APP-NAME of syslog messages and the
+// SYSLOG_IDENTIFIER of journal entries.
+const logIdentifier = "deeplx"
+
+// journalSocket is where journald receives entries in its native protocol.
+const journalSocket = "/run/systemd/journal/socket"
+
+// Syslog severities used for log lines.
+const (
+	severityError = 3
+	severityInfo  = 6
+)
+
+// syslogFacilities maps LOG_SYSLOG_FACILITY names to facility codes.
+var syslogFacilities = map[string]int{
+	"user": 1, "daemon": 3, "auth": 4, "syslog": 5,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// logSeverity tells errors from other log lines the way the event log
+// writer of the Windows service does.
+func logSeverity(line string) int {
+	if strings.HasPrefix(line, "Error") {
+		return severityError
+	}
+	return severityInfo
+}
+
+// logFanout writes every line to all sinks. A failing sink doesn't keep the
+// others from getting the line, and there is nowhere to report it.
+type logFanout []io.Writer
+
+func (f logFanout) Write(p []byte) (int, error) {
+	for _, sink := range f {
+		sink.Write(p)
+	}
+	return len(p), nil
+}
+
+// timestampWriter prefixes lines with the date and time the log package
+// would add, for sinks that don't record it themselves.
+type timestampWriter struct {
+	w io.Writer
+}
+
+func (w timestampWriter) Write(p []byte) (int, error) {
+	line := append([]byte(time.Now().Format("2006/01/02 15:04:05 ")), p...)
+	if _, err := w.w.Write(line); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// syslogWriter sends lines as RFC 5424 messages to a syslog server over
+// UDP, TCP or a Unix socket. MsgID tells access log lines apart.
+type syslogWriter struct {
+	network, addr string
+	facility      int
+	msgID         string
+	hostname      string
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// newSyslogWriter parses an address such as udp://logs:514, tcp://logs:601
+// or unix:///dev/log. The connection is made on the first line.
+func newSyslogWriter(address, facility, msgID string) (*syslogWriter, error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, err
+	}
+	w := &syslogWriter{network: u.Scheme, addr: u.Host, msgID: msgID}
+	switch u.Scheme {
+	case "udp", "tcp":
+		if u.Port() == "" {
+			return nil, fmt.Errorf("%q has no port", address)
+		}
+	case "unix":
+		// Local daemons such as rsyslog read datagrams from /dev/log.
+		w.network, w.addr = "unixgram", u.Path
+	default:
+		return nil, fmt.Errorf("%q must use udp://, tcp:// or unix://", address)
+	}
+	code, ok := syslogFacilities[strings.ToLower(facility)]
+	if !ok {
+		return nil, fmt.Errorf("unknown syslog facility %q", facility)
+	}
+	w.facility = code
+	w.hostname, _ = os.Hostname()
+	if w.hostname == "" {
+		w.hostname = "-"
+	}
+	if w.msgID == "" {
+		w.msgID = "-"
+	}
+	return w, nil
+}
+
+func (w *syslogWriter) Write(p []byte) (int, error) {
+	line := strings.TrimRight(string(p), "\n")
+	message := fmt.Sprintf("<%d>1 %s %s %s %d %s - %s",
+		w.facility*8+logSeverity(line), time.Now().Format("2006-01-02T15:04:05.000000Z07:00"),
+		w.hostname, logIdentifier, os.Getpid(), w.msgID, line)
+	// Over TCP, messages are framed by their length (RFC 6587).
+	if w.network == "tcp" {
+		message = strconv.Itoa(len(message)) + " " + message
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	// A connection the server closed is only noticed when writing to it,
+	// so each line is retried once on a new connection.
+	for attempt := 0; ; attempt++ {
+		if w.conn == nil {
+			conn, err := net.DialTimeout(w.network, w.addr, 5*time.Second)
+			if err != nil {
+				return 0, err
+			}
+			w.conn = conn
+		}
+		_, err := w.conn.Write([]byte(message))
+		if err == nil {
+			return len(p), nil
+		}
+		w.conn.Close()
+		w.conn = nil
+		if attempt > 0 {
+			return 0, err
+		}
+	}
+}
+
+// journalWriter sends lines to journald in its native protocol, with their
+// priority and, for the access log, DEEPLX_LOG=access.
+type journalWriter struct {
+	kind string
+	conn *net.UnixConn
+}
+
+func newJournalWriter(kind string) (*journalWriter, error) {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: journalSocket, Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+	return &journalWriter{kind: kind, conn: conn}, nil
+}
+
+func (w *journalWriter) Write(p []byte) (int, error) {
+	line := strings.TrimRight(string(p), "\n")
+	var entry bytes.Buffer
+	journalField(&entry, "MESSAGE", line)
+	journalField(&entry, "PRIORITY", strconv.Itoa(logSeverity(line)))
+	journalField(&entry, "SYSLOG_IDENTIFIER", logIdentifier)
+	journalField(&entry, "SYSLOG_PID", strconv.Itoa(os.Getpid()))
+	if w.kind != "" {
+		journalField(&entry, "DEEPLX_LOG", w.kind)
+	}
+	if _, err := w.conn.Write(entry.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// journalField appends a field. Values spanning lines are sent with their
+// length in front, as the protocol requires.
+func journalField(entry *bytes.Buffer, name, value string) {
+	if !strings.Contains(value, "\n") {
+		entry.WriteString(name + "=" + value + "\n")
+		return
+	}
+	entry.WriteString(name + "\n")
+	binary.Write(entry, binary.LittleEndian, uint64(len(value)))
+	entry.WriteString(value + "\n")
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Parts of speech guessed for looked up words and their senses.
+const (
+	PartNoun      = "noun"
+	PartVerb      = "verb"
+	PartAdjective = "adjective"
+	PartAdverb    = "adverb"
+)
+
+// lookupMaxLength is the longest text /lookup takes, in characters, as
+// languages written without spaces have no words to count.
+const lookupMaxLength = 64
+
+// LookupSense is one translation of a looked up word.
+type LookupSense struct {
+	Text         string `json:"text"`
+	PartOfSpeech string `json:"part_of_speech,omitempty"`
+}
+
+// LookupResponse is the body of /lookup, shaped for dictionary popups.
+type LookupResponse struct {
+	Code         int           `json:"code"`
+	Message      string        `json:"message"`
+	Word         string        `json:"word,omitempty"`
+	SourceLang   string        `json:"source_lang,omitempty"`
+	TargetLang   string        `json:"target_lang,omitempty"`
+	PartOfSpeech string        `json:"part_of_speech,omitempty"`
+	Senses       []LookupSense `json:"senses,omitempty"`
+	Romanized    string        `json:"romanized,omitempty"`
+	AudioURL     string        `json:"audio_url,omitempty"`
+}
+
+// partOfSpeechRules are the cues a language's words give about their part
+// of speech. They are guesses: a word matching none gets no part of speech.
+type partOfSpeechRules struct {
+	// articles precede nouns, and particles such as "to" precede verbs.
+	articles, particles []string
+	// capitalNouns is set for languages capitalizing every noun.
+	capitalNouns bool
+
+	verbSuffixes, adjectiveSuffixes, adverbSuffixes []string
+}
+
+var partOfSpeechByLang = map[string]partOfSpeechRules{
+	"EN": {
+		articles:          []string{"the", "a", "an"},
+		particles:         []string{"to"},
+		adjectiveSuffixes: []string{"ous", "ful", "ive", "able", "ible", "less", "ish"},
+		adverbSuffixes:    []string{"ly"},
+	},
+	"DE": {
+		articles:          []string{"der", "die", "das", "ein", "eine"},
+		capitalNouns:      true,
+		verbSuffixes:      []string{"en", "ern", "eln"},
+		adjectiveSuffixes: []string{"lich", "ig", "isch", "bar", "los", "sam"},
+	},
+	"FR": {
+		articles:          []string{"le", "la", "les", "l'", "un", "une"},
+		verbSuffixes:      []string{"er", "ir", "re"},
+		adjectiveSuffixes: []string{"eux", "euse", "ique", "able"},
+		adverbSuffixes:    []string{"ement"},
+	},
+	"ES": {
+		articles:          []string{"el", "la", "los", "las", "un", "una"},
+		verbSuffixes:      []string{"ar", "er", "ir"},
+		adjectiveSuffixes: []string{"oso", "osa", "ble"},
+		adverbSuffixes:    []string{"mente"},
+	},
+	"IT": {
+		articles:          []string{"il", "lo", "la", "i", "gli", "le", "un", "uno", "una", "l'"},
+		verbSuffixes:      []string{"are", "ere", "ire"},
+		adjectiveSuffixes: []string{"oso", "osa", "bile"},
+		adverbSuffixes:    []string{"mente"},
+	},
+}
+
+// guessPartOfSpeech guesses the part of speech of a word or short phrase in
+// lang from its article or particle, capitalization and ending.
+func guessPartOfSpeech(lang, text string) string {
+	lang, _, _ = strings.Cut(strings.ToUpper(lang), "-")
+	rules, ok := partOfSpeechByLang[lang]
+	if !ok {
+		return ""
+	}
+	words := strings.Fields(text)
+	if len(words) == 0 {
+		return ""
+	}
+	first := strings.ToLower(words[0])
+	switch {
+	case len(words) > 1 && slices.Contains(rules.articles, first):
+		return PartNoun
+	case len(words) > 1 && slices.Contains(rules.particles, first):
+		return PartVerb
+	case slices.ContainsFunc(rules.articles, func(article string) bool {
+		return strings.HasSuffix(article, "'") && strings.HasPrefix(first, article)
+	}):
+		return PartNoun
+	case len(words) > 1:
+		return ""
+	}
+
+	word := strings.TrimFunc(words[0], unicode.IsPunct)
+	if rules.capitalNouns {
+		if r, _ := utf8.DecodeRuneInString(word); unicode.IsUpper(r) {
+			return PartNoun
+		}
+	}
+	lower := strings.ToLower(word)
+	// The stem must be longer than the ending, so short words such as
+	// "fly" aren't taken for adverbs.
+	ends := func(suffixes []string) bool {
+		return slices.ContainsFunc(suffixes, func(suffix string) bool {
+			return strings.HasSuffix(lower, suffix) && utf8.RuneCountInString(lower) > utf8.RuneCountInString(suffix)+2
+		})
+	}
+	switch {
+	case ends(rules.adverbSuffixes):
+		return PartAdverb
+	case ends(rules.adjectiveSuffixes):
+		return PartAdjective
+	case ends(rules.verbSuffixes):
+		return PartVerb
+	}
+	return ""
+}
+
+// lookupWord translates a single word or short phrase and lists its senses,
+// the translation and its alternatives, with their guessed parts of speech.
+func lookupWord(params TranslateParams) LookupResponse {
+	word := strings.TrimSpace(params.Text)
+	if word == "" {
+		return LookupResponse{Code: 404, Message: "No Translate Text Found"}
+	}
+	if len(strings.Fields(word)) > cfg().LookupMaxWords || utf8.RuneCountInString(word) > lookupMaxLength {
+		return LookupResponse{
+			Code:    400,
+			Message: fmt.Sprintf("Lookups take a word or a phrase of up to %d words and %d characters", cfg().LookupMaxWords, lookupMaxLength),
+		}
+	}
+
+	params.Text = word
+	params.Sentences, params.PreserveWhitespace, params.Confidence = false, false, false
+	result := translate(params)
+	if result.Code != 200 {
+		return LookupResponse{Code: result.Code, Message: result.Message}
+	}
+
+	response := LookupResponse{
+		Code:         200,
+		Message:      "success",
+		Word:         word,
+		SourceLang:   result.SourceLang,
+		TargetLang:   result.TargetLang,
+		PartOfSpeech: guessPartOfSpeech(result.SourceLang, word),
+		Romanized:    result.Romanized,
+	}
+	for _, text := range append([]string{result.Data}, result.Alternatives...) {
+		response.Senses = append(response.Senses, LookupSense{
+			Text:         text,
+			PartOfSpeech: guessPartOfSpeech(result.TargetLang, text),
+		})
+	}
+	return response
+}
+
+// handleLookup looks up the text of a JSON body, or of the text (or q) query
+// parameter of GET requests, which popups can load without a body.
+func handleLookup(c *fiber.Ctx) error {
+	var params TranslateParams
+	if c.Method() == fiber.MethodGet {
+		params = TranslateParams{
+			Text:       c.Query("text", c.Query("q")),
+			SourceLang: c.Query("source_lang"),
+			TargetLang: c.Query("target_lang"),
+			Romanize:   c.QueryBool("romanize"),
+			TTS:        c.QueryBool("tts"),
+		}
+	} else if err := c.BodyParser(&params); err != nil {
+		log.Printf("Error parsing request body: %v", err)
+		return c.Status(400).JSON(LookupResponse{
+			Code:    400,
+			Message: "Invalid request body",
+		})
+	}
+
+	applyKeyDefaults(c, &params)
+	if params.TargetLang == "" {
+		params.TargetLang = "EN"
+	}
+	params.usageKey = meterRequest(c)
+	params.client = clientKey(c)
+	result := lookupWord(params)
+	if params.TTS && result.Code == 200 && ttsEnabled() {
+		result.AudioURL = audioURL(c, result.Senses[0].Text, result.TargetLang)
+	}
+	return c.Status(result.Code).JSON(result)
+}
@@ -1,21 +1,38 @@
 package main
 
 import (
-	"encoding/json"
+	"bytes"
+	"errors"
 	"fmt"
-	"io"
 	"log"
 	"math/rand"
+	"net"
 	"net/http"
+	"os"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
 )
 
 const (
 	DeeplApiEndpoint = "https://ideepl.vercel.app/jsonrpc"
 	MaxAlternatives  = 3
+
+	// MethodFree is reported in the method field like other DeepLX servers
+	// do for the free web API.
+	MethodFree = "Free"
+
+	// TooManyRequestsMessage is the message DeepLX clients show when DeepL
+	// answers 429.
+	TooManyRequestsMessage = "Too many requests, your IP has been blocked by DeepL temporarily, please don't request it frequently in a short time."
+
+	EngineDeepL = "deepl"
 )
 
 type RequestConfig struct {
@@ -23,35 +40,188 @@ type RequestConfig struct {
 	Method  string `json:"method"`
 	ID      int64  `json:"id"`
 	Params  struct {
-		Texts []struct {
-			Text                string `json:"text"`
-			RequestAlternatives int    `json:"requestAlternatives"`
-		} `json:"texts"`
-		Timestamp int64  `json:"timestamp"`
-		Splitting string `json:"splitting"`
+		Texts     []RequestText `json:"texts"`
+		Timestamp int64         `json:"timestamp"`
+		Splitting string        `json:"splitting"`
 		Lang      struct {
 			SourceLangUserSelected string `json:"source_lang_user_selected"`
 			TargetLang             string `json:"target_lang"`
 		} `json:"lang"`
+
+		// CommonJobParams is nil for requests without style options.
+		CommonJobParams *CommonJobParams `json:"commonJobParams,omitempty"`
 	} `json:"params"`
 }
 
+type RequestText struct {
+	Text                string `json:"text"`
+	RequestAlternatives int    `json:"requestAlternatives"`
+}
+
 type TranslateParams struct {
+	// ID is echoed in the response, as clients of other DeepLX servers
+	// (such as Bob and Easydict) expect.
+	ID int64 `json:"id,omitempty"`
+
 	Text       string `json:"text"`
 	SourceLang string `json:"source_lang"`
 	TargetLang string `json:"target_lang"`
+	Sentences  bool   `json:"sentences"`
+	Confidence bool   `json:"confidence"`
+
+	PreserveWhitespace bool   `json:"preserve_whitespace"`
+	HTMLEntities       string `json:"html_entities"`
+
+	// Engine picks a backend by name instead of ENGINE.
+	Engine string `json:"engine,omitempty"`
+
+	// MaxAlternatives caps the number of alternatives returned, and
+	// RankAlternatives orders them by "distance" or "length" instead of as
+	// the upstream listed them.
+	MaxAlternatives  int    `json:"max_alternatives,omitempty"`
+	RankAlternatives string `json:"rank_alternatives,omitempty"`
+
+	// Romanize adds the translation in the Latin alphabet, for languages
+	// written in other scripts.
+	Romanize bool `json:"romanize,omitempty"`
+	// TTS adds an audio_url the translation can be listened to at, when a
+	// TTS backend is configured.
+	TTS bool `json:"tts,omitempty"`
+
+	// Formality, RegionalVariant, WasSpoken and AdvancedMode are the style
+	// options of the web client, sent upstream in commonJobParams.
+	Formality       string `json:"formality,omitempty"`
+	RegionalVariant string `json:"regional_variant,omitempty"`
+	WasSpoken       bool   `json:"was_spoken,omitempty"`
+	AdvancedMode    bool   `json:"advanced_mode,omitempty"`
+
+	// entities restores the HTML entities decoded from Text in roundtrip
+	// mode.
+	entities *strings.Replacer
+	// usageKey is the key the translation is metered and capped under, if
+	// any.
+	usageKey string
+	// endpoint is the upstream endpoint an admin pinned the request to.
+	endpoint string
+	// client identifies the caller, to keep it on one upstream target with
+	// sticky sessions.
+	client string
+}
+
+// SentenceResult pairs one source sentence with its translation.
+type SentenceResult struct {
+	Source       string   `json:"source"`
+	Text         string   `json:"text"`
+	Alternatives []string `json:"alternatives,omitempty"`
+	Confidence   *float64 `json:"confidence,omitempty"`
+	Gap          bool     `json:"gap,omitempty"`
 }
 
 type TranslateResponse struct {
 	Code         int      `json:"code"`
+	ID           int64    `json:"id,omitempty"`
+	Method       string   `json:"method,omitempty"`
 	Message      string   `json:"message"`
 	Data         string   `json:"data,omitempty"`
 	SourceLang   string   `json:"source_lang,omitempty"`
 	TargetLang   string   `json:"target_lang,omitempty"`
 	Alternatives []string `json:"alternatives,omitempty"`
+	Passthrough  bool     `json:"passthrough,omitempty"`
+	Confidence   *float64 `json:"confidence,omitempty"`
+	Profanity    bool     `json:"profanity,omitempty"`
+	Romanized    string   `json:"romanized,omitempty"`
+	AudioURL     string   `json:"audio_url,omitempty"`
+
+	Sentences []SentenceResult `json:"sentences,omitempty"`
+
+	Engine     string `json:"engine,omitempty"`
+	LowQuality bool   `json:"low_quality,omitempty"`
+	Partial    bool   `json:"partial,omitempty"`
+	Cached     bool   `json:"cached"`
+	TookMs     int64  `json:"took_ms"`
+	RequestID  string `json:"request_id,omitempty"`
+}
+
+type upstreamText struct {
+	Text         string `json:"text"`
+	Alternatives []struct {
+		Text string `json:"text"`
+	} `json:"alternatives"`
+}
+
+type upstreamResult struct {
+	Result struct {
+		Texts []upstreamText `json:"texts"`
+		Lang  string         `json:"lang"`
+	} `json:"result"`
+}
+
+// Clock tells the time. Requests are built with one, so tests can fix it.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// lockedSource is a rand.Source safe for concurrent use.
+type lockedSource struct {
+	mu     sync.Mutex
+	source rand.Source
+}
+
+func (s *lockedSource) Int63() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.source.Int63()
+}
+
+func (s *lockedSource) Seed(seed int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.source.Seed(seed)
+}
+
+// sequenceSource is a rand.Source counting up from a random start, like the
+// request IDs of a web client session.
+type sequenceSource struct {
+	next atomic.Int64
+}
+
+func newSequenceSource() *sequenceSource {
+	source := &sequenceSource{}
+	source.next.Store(rand.Int63n(100000))
+	return source
+}
+
+func (s *sequenceSource) Int63() int64 {
+	return s.next.Add(1) - 1
+}
+
+func (s *sequenceSource) Seed(seed int64) {
+	s.next.Store(seed)
+}
+
+// requestBuilder builds the JSON-RPC requests sent upstream, drawing their
+// IDs from ids and their timestamps from clock.
+type requestBuilder struct {
+	ids   rand.Source
+	clock Clock
+}
+
+var upstreamRequests = requestBuilder{
+	ids:   &lockedSource{source: rand.NewSource(time.Now().UnixNano())},
+	clock: systemClock{},
 }
 
-func createRequestConfig(sourceLang, targetLang string) RequestConfig {
+func createRequestConfig(sourceLang, targetLang string, texts []string) RequestConfig {
+	return upstreamRequests.config(sourceLang, targetLang, texts)
+}
+
+func (b requestBuilder) config(sourceLang, targetLang string, texts []string) RequestConfig {
 	if sourceLang == "" {
 		sourceLang = "auto"
 	}
@@ -62,16 +232,16 @@ func createRequestConfig(sourceLang, targetLang string) RequestConfig {
 	config := RequestConfig{
 		Jsonrpc: "2.0",
 		Method:  "LMT_handle_texts",
-		ID:      rand.Int63n(100000) + 100000*1000,
+		ID:      newRequestID(b.ids),
 	}
 
-	config.Params.Texts = []struct {
-		Text                string `json:"text"`
-		RequestAlternatives int    `json:"requestAlternatives"`
-	}{{
-		Text:                "",
-		RequestAlternatives: MaxAlternatives,
-	}}
+	config.Params.Texts = make([]RequestText, 0, len(texts))
+	for _, text := range texts {
+		config.Params.Texts = append(config.Params.Texts, RequestText{
+			Text:                text,
+			RequestAlternatives: MaxAlternatives,
+		})
+	}
 	config.Params.Splitting = "newlines"
 	config.Params.Lang.SourceLangUserSelected = strings.ToUpper(sourceLang)
 	config.Params.Lang.TargetLang = strings.ToUpper(targetLang)
@@ -79,9 +249,78 @@ func createRequestConfig(sourceLang, targetLang string) RequestConfig {
 	return config
 }
 
-func calculateTimestamp(text string) int64 {
-	timestamp := time.Now().UnixMilli()
-	count := int64(strings.Count(text, "i"))
+// randomID returns an ID in the range the DeepL web client uses.
+func randomID() int64 {
+	return newRequestID(upstreamRequests.ids)
+}
+
+func newRequestID(ids rand.Source) int64 {
+	return ids.Int63()%100000 + 100000*1000
+}
+
+// methodSpaced reports whether the web client writes a space before the
+// colon after "method" in a request with this ID.
+func methodSpaced(id int64) bool {
+	return (id+5)%29 == 0 || (id+5)%29 == 3 || (id+3)%13 == 0
+}
+
+// baseLanguage returns the primary subtag of a language code, so that
+// "en-US" and "EN" compare equal.
+func baseLanguage(lang string) string {
+	lang = strings.ToUpper(strings.TrimSpace(lang))
+	if i := strings.IndexAny(lang, "-_"); i >= 0 {
+		lang = lang[:i]
+	}
+	return lang
+}
+
+func isSameLanguage(sourceLang, targetLang string) bool {
+	source := baseLanguage(sourceLang)
+	return source != "" && source != "AUTO" && source == baseLanguage(targetLang)
+}
+
+// detectedSourceLang reports the language the upstream detected when the
+// caller asked for automatic detection.
+func detectedSourceLang(requested, detected string) string {
+	if detected != "" && (requested == "" || strings.EqualFold(requested, "auto")) {
+		return detected
+	}
+	return requested
+}
+
+// TimestampV1 is the algorithm of the web client deriving the request
+// timestamp from the number of letters i in the texts.
+const TimestampV1 = "v1"
+
+// timestampCounters count the letters of a text that round the timestamp of
+// its request, by TIMESTAMP_ALGORITHM. v1 counts like the web client's
+// text.split("i").length - 1, which splits UTF-16 code units and so only
+// counts U+0069: emoji, CJK and letters such as ı or í never count.
+var timestampCounters = map[string]func(text string) int64{
+	TimestampV1: func(text string) int64 {
+		var count int64
+		for _, r := range text {
+			if r == 'i' {
+				count++
+			}
+		}
+		return count
+	},
+}
+
+// timestampCount counts the letters of text rounding its timestamp with
+// the configured algorithm.
+func timestampCount(text string) int64 {
+	count, ok := timestampCounters[cfg().TimestampAlgorithm]
+	if !ok {
+		count = timestampCounters[TimestampV1]
+	}
+	return count(text)
+}
+
+func calculateTimestamp(text string, clock Clock) int64 {
+	timestamp := clock.Now().UnixMilli()
+	count := timestampCount(text)
 
 	if count != 0 {
 		return timestamp - (timestamp % (count + 1)) + (count + 1)
@@ -89,27 +328,89 @@ func calculateTimestamp(text string) int64 {
 	return timestamp
 }
 
-func buildRequestBody(params TranslateParams) (string, error) {
-	config := createRequestConfig(params.SourceLang, params.TargetLang)
-	config.Params.Texts[0].Text = params.Text
-	config.Params.Timestamp = calculateTimestamp(params.Text)
+func buildRequestBody(params TranslateParams, texts []string) (string, error) {
+	return upstreamRequests.build(params, texts)
+}
 
-	jsonBytes, err := json.Marshal(config)
-	if err != nil {
+func (b requestBuilder) build(params TranslateParams, texts []string) (string, error) {
+	config := b.config(params.SourceLang, params.TargetLang, texts)
+	config.Params.CommonJobParams = jobParams(params)
+	config.Params.Timestamp = calculateTimestamp(strings.Join(texts, ""), b.clock)
+	return encodeRequest(config, config.ID)
+}
+
+// encodeRequest marshals a JSON-RPC request with the given id, spacing
+// "method" as the web client does for it.
+func encodeRequest(request any, id int64) (string, error) {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	if err := jsonEncode(buf, request); err != nil {
 		return "", fmt.Errorf("failed to marshal request config: %w", err)
 	}
-	body := string(jsonBytes)
+	data := bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
 
-	if (config.ID+5)%29 == 0 || (config.ID+5)%29 == 3 || (config.ID+3)%13 == 0 {
-		body = strings.Replace(body, `"method":"`, `"method" : "`, 1)
-	} else {
-		body = strings.Replace(body, `"method":"`, `"method": "`, 1)
+	method := `"method": "`
+	if methodSpaced(id) {
+		method = `"method" : "`
 	}
 
-	return body, nil
+	// The body is built in one allocation, as it outlives the buffer.
+	var body strings.Builder
+	body.Grow(len(data) + len(method))
+	if before, after, found := bytes.Cut(data, []byte(`"method":"`)); found {
+		body.Write(before)
+		body.WriteString(method)
+		body.Write(after)
+	} else {
+		body.Write(data)
+	}
+	return body.String(), nil
 }
 
 func translate(params TranslateParams) TranslateResponse {
+	if failure := checkLanguages(params, params.SourceLang, params.TargetLang); failure != nil {
+		return TranslateResponse{
+			Code:    failure.Code,
+			Message: failure.Message,
+		}
+	}
+	result := translateParams(params, false)
+	// A detected source language is only known after translating.
+	if result.Code == 200 {
+		if failure := checkLanguages(params, result.SourceLang, params.TargetLang); failure != nil {
+			return TranslateResponse{
+				Code:    failure.Code,
+				Message: failure.Message,
+			}
+		}
+	}
+	meterTranslation(params, result)
+	// Romanizing is cheap, so cached translations are stored without it.
+	if params.Romanize && result.Code == 200 {
+		result.Romanized = romanize(result.TargetLang, result.Data)
+	}
+	return result
+}
+
+// translateParams translates params, answering from the cache unless
+// refresh is set. A successful translation replaces the cached one.
+func translateParams(params TranslateParams, refresh bool) TranslateResponse {
+	requested := params
+	if cfg().NormalizeInput {
+		params.Text = sanitizeText(params.Text, cfg().CollapseWhitespace)
+	}
+
+	if failure := checkOptions(params); failure != nil {
+		return TranslateResponse{
+			Code:    failure.Code,
+			Message: failure.Message,
+		}
+	}
+	// Inputs differing only in their entities are restored differently, so
+	// the key is taken before decoding.
+	key := requestKey(params)
+	params.Text, params.entities = decodeEntities(params.Text, params.HTMLEntities)
+
 	if params.Text == "" {
 		return TranslateResponse{
 			Code:    404,
@@ -117,108 +418,569 @@ func translate(params TranslateParams) TranslateResponse {
 		}
 	}
 
-	body, err := buildRequestBody(params)
-	if err != nil {
-		log.Printf("Error building request body: %v", err)
+	if cfg().SameLangPassthrough && isSameLanguage(params.SourceLang, params.TargetLang) {
+		return passthroughResponse(params, params.SourceLang)
+	}
+
+	// Pinned requests are for finding out what an endpoint answers, so
+	// they bypass the cache.
+	pinned := params.endpoint != ""
+	refresh = refresh || pinned
+	if cfg().CacheTTL > 0 && cfg().WarmTop > 0 && !refresh {
+		history.record(key, requested, cfg().WarmTop)
+	}
+	if cached, ok := translations.Get(key); ok && !refresh {
+		metrics.count("cache.hits")
+		cached.Cached = true
+		return cached
+	}
+	if cfg().CacheTTL > 0 && !refresh {
+		metrics.count("cache.misses")
+	}
+
+	// Only translations sent upstream count against the character caps.
+	characters := utf8.RuneCountInString(params.Text)
+	if failure := characterCaps.reserve(params.usageKey, characters); failure != nil {
 		return TranslateResponse{
-			Code:    500,
-			Message: "Failed to build request body",
+			Code:    failure.Code,
+			Message: failure.Message,
+		}
+	}
+	response := translateWithHooks(params)
+	if response.Code != 200 {
+		characterCaps.release(params.usageKey, characters)
+	}
+	// Low quality and partial translations are not cached, so DeepL
+	// translates the text again once it is reachable.
+	if response.Code == 200 && !response.LowQuality && !response.Partial && !pinned {
+		translations.Set(key, response)
+	}
+	return response
+}
+
+// checkOptions reports the options of a request that are invalid.
+func checkOptions(params TranslateParams) *translateError {
+	if !isValidEntitiesMode(params.HTMLEntities) {
+		return &translateError{Code: 400, Message: "Invalid html_entities option"}
+	}
+	if params.MaxAlternatives < 0 || !isValidRanking(params.RankAlternatives) {
+		return &translateError{Code: 400, Message: "Invalid max_alternatives or rank_alternatives option"}
+	}
+	if !isValidJobParams(params) {
+		return &translateError{Code: 400, Message: "Invalid formality or regional_variant option"}
+	}
+	return nil
+}
+
+// translateText sends the prepared text to DeepL and post-processes the
+// result.
+func translateText(params TranslateParams) TranslateResponse {
+	texts := []string{params.Text}
+	var segments []sentence
+	switch {
+	case params.Sentences:
+		segments = splitSentences(params.Text)
+	case params.PreserveWhitespace:
+		segments = splitLines(params.Text)
+	}
+	if len(segments) > 0 {
+		texts = make([]string, len(segments))
+		for i, segment := range segments {
+			texts[i] = segment.Text
 		}
 	}
 
-	resp, err := http.Post(
-		DeeplApiEndpoint,
-		"application/json; charset=utf-8",
-		strings.NewReader(body),
-	)
+	name, selected, err := selectEngine(params)
+	var result upstreamResult
+	var gaps []int
+	switch {
+	case err != nil:
+	case name == EngineDeepL && useSplitText(params):
+		// The upstream's sentences replace those split here, but the
+		// local model still falls back on these.
+		var split []sentence
+		if split, result, gaps, err = translateSplitText(params); err == nil {
+			segments = split
+		}
+	default:
+		result, err = selected.translate(params, texts)
+	}
+	var failure *translateError
+	if err != nil && !errors.As(err, &failure) {
+		failure = &translateError{Code: 500, Message: "Request failed"}
+	}
+	if err != nil && params.endpoint == "" && shouldFallBack(name, failure) {
+		log.Printf("DeepL failed with %d, translating with the local model", failure.Code)
+		name = EngineLocal
+		result, err = engines[EngineLocal].translate(params, texts)
+		if err != nil && !errors.As(err, &failure) {
+			failure = &translateError{Code: 500, Message: "Request failed"}
+		}
+	}
 	if err != nil {
-		log.Printf("Error making HTTP request: %v", err)
 		return TranslateResponse{
-			Code:    500,
-			Message: "Request failed",
+			Code:    failure.Code,
+			Message: failure.Message,
 		}
 	}
-	defer func(Body io.ReadCloser) {
-		err := Body.Close()
-		if err != nil {
-			log.Printf("Error closing response body: %v", err)
+
+	// Without a source language, whether the text already is in the target
+	// language is only known from the language the upstream detected.
+	detected := detectedSourceLang(params.SourceLang, result.Result.Lang)
+	if cfg().SameLangPassthrough && isSameLanguage(detected, params.TargetLang) {
+		response := passthroughResponse(params, detected)
+		response.Engine = name
+		return response
+	}
+
+	layout := segments
+	if len(layout) == 0 {
+		layout = lineLayout(len(result.Result.Texts))
+	}
+
+	response := TranslateResponse{
+		Code:         200,
+		Message:      "success",
+		Data:         assembleText(layout, result.Result.Texts, -1),
+		SourceLang:   detected,
+		TargetLang:   params.TargetLang,
+		Alternatives: combineAlternatives(layout, result.Result.Texts),
+		Engine:       name,
+		LowQuality:   name == EngineLocal,
+		Partial:      len(gaps) > 0,
+	}
+	if params.Sentences && len(segments) > 0 {
+		response.Sentences = alignSentences(segments, result.Result.Texts)
+		for _, i := range gaps {
+			response.Sentences[i].Gap = true
 		}
-	}(resp.Body)
+	}
+	applyTerms(&response)
+	applyProfanityFilter(&response)
+	encodeEntities(&response, params.entities)
+	if params.Confidence {
+		addConfidence(params.Text, &response)
+	}
+	// Duplicates still count towards the confidence, as agreement.
+	refineAlternatives(params, &response)
+	return response
+}
+
+// translateError is a translation failure with the response code and
+// message to report to the client.
+type translateError struct {
+	Code    int
+	Message string
+}
+
+func (e *translateError) Error() string {
+	return fmt.Sprintf("%d: %s", e.Code, e.Message)
+}
+
+// fetchTexts translates texts, batched with concurrent requests for the same
+// language pair when micro-batching is enabled and the source language is
+// given.
+func fetchTexts(params TranslateParams, texts []string) (upstreamResult, error) {
+	// DeepL detects one language per call, which would be reported for
+	// every text of a batch, so requests relying on detection are sent
+	// on their own.
+	detect := params.SourceLang == "" || strings.EqualFold(params.SourceLang, "auto")
+	if cfg().BatchWindow > 0 && !detect && params.endpoint == "" {
+		return batches.submit(params, texts)
+	}
+	return callDeepL(params, texts)
+}
+
+// callDeepL translates texts in a single upstream call.
+func callDeepL(params TranslateParams, texts []string) (upstreamResult, error) {
+	var result upstreamResult
+	if err := callUpstream(params, textsRequest(params, texts), &result); err != nil {
+		return result, err
+	}
+
+	if len(result.Result.Texts) == 0 {
+		log.Printf("Upstream returned no texts")
+		return result, &translateError{Code: 500, Message: "Empty translation result"}
+	}
+	return result, nil
+}
 
-	if resp.StatusCode == http.StatusOK {
-		var result struct {
-			Result struct {
-				Texts []struct {
-					Text         string `json:"text"`
-					Alternatives []struct {
-						Text string `json:"text"`
-					} `json:"alternatives"`
-				} `json:"texts"`
-			} `json:"result"`
+// passthroughResponse returns the text untranslated, as it already is in
+// the target language.
+func passthroughResponse(params TranslateParams, sourceLang string) TranslateResponse {
+	response := TranslateResponse{
+		Code:        200,
+		Message:     "success",
+		Data:        params.Text,
+		SourceLang:  sourceLang,
+		TargetLang:  params.TargetLang,
+		Passthrough: true,
+	}
+	encodeEntities(&response, params.entities)
+	return response
+}
+
+// callUpstream sends a request made for params upstream and decodes the
+// answer into result.
+func callUpstream(params TranslateParams, body requestBody, result any) error {
+	reply := sendUpstream(params, body)
+	defer reply.release()
+	if reply.Err != nil {
+		return &translateError{Code: 500, Message: "Request failed"}
+	}
+
+	if reply.Status != http.StatusOK {
+		message := "Unknown error."
+		if reply.Status == 429 {
+			message = TooManyRequestsMessage
 		}
+		return &translateError{Code: reply.Status, Message: message}
+	}
 
-		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-			log.Printf("Error decoding response: %v", err)
-			return TranslateResponse{
-				Code:    500,
-				Message: "Failed to decode response",
-			}
+	if err := jsonUnmarshal(reply.Body, result); err != nil {
+		log.Printf("Error decoding response: %v", err)
+		return &translateError{Code: 500, Message: "Failed to decode response"}
+	}
+	return nil
+}
+
+func handleTranslate(c *fiber.Ctx) error {
+	start := time.Now()
+
+	var params TranslateParams
+	get := c.Method() == fiber.MethodGet
+	if get {
+		params = translateQueryParams(c)
+		if params.Text == "" {
+			return c.SendString("Please use POST method :)")
 		}
+	} else if err := c.BodyParser(&params); err != nil {
+		log.Printf("Error parsing request body: %v", err)
+		return sendTranslateResponse(c, TranslateResponse{
+			Code:    400,
+			Message: "Invalid request body",
+		})
+	}
 
-		alternatives := make([]string, 0)
-		if len(result.Result.Texts) > 0 && len(result.Result.Texts[0].Alternatives) > 0 {
-			for _, alt := range result.Result.Texts[0].Alternatives {
-				alternatives = append(alternatives, alt.Text)
-			}
+	if failure := pinEndpoint(c, &params); failure != nil {
+		return sendTranslateResponse(c, TranslateResponse{
+			Code:    failure.Code,
+			Message: failure.Message,
+		})
+	}
+	applyKeyDefaults(c, &params)
+	applyCompatMode(&params)
+	params.usageKey = meterRequest(c)
+	params.client = clientKey(c)
+
+	// A 304 must not hide an answer the request would get otherwise, so
+	// the checks that don't need a translation come first.
+	if failure := checkLanguages(params, params.SourceLang, params.TargetLang); failure != nil {
+		return sendTranslateResponse(c, TranslateResponse{
+			Code:    failure.Code,
+			Message: failure.Message,
+		})
+	}
+	caller, request := clientKey(c), requestKey(params)
+	key := c.Get("Idempotency-Key")
+	if key != "" && idempotency.conflicts(caller+"|"+key, request) {
+		return sendTranslateResponse(c, TranslateResponse{
+			Code:    422,
+			Message: idempotencyConflictMessage,
+		})
+	}
+
+	etag := translationETag(params)
+	if etagMatches(c.Get(fiber.HeaderIfNoneMatch), etag) {
+		if get {
+			setCacheHeaders(c, params, 200)
 		}
+		c.Set(fiber.HeaderETag, etag)
+		return c.SendStatus(fiber.StatusNotModified)
+	}
 
-		return TranslateResponse{
-			Code:         200,
-			Message:      "success",
-			Data:         result.Result.Texts[0].Text,
-			SourceLang:   params.SourceLang,
-			TargetLang:   params.TargetLang,
-			Alternatives: alternatives,
+	var result TranslateResponse
+	replay, repeated := duplicates.check(caller, request)
+	if repeated && replay == nil {
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(cfg().DuplicateWindow.Seconds())))
+		return sendTranslateResponse(c, TranslateResponse{
+			Code:    429,
+			Message: "Too many identical requests, please try again later.",
+		})
+	}
+	if repeated {
+		// Callers repeating a request too often get the last answer
+		// without calling the upstream, even with the cache disabled.
+		c.Set("X-Duplicate-Request", "true")
+		result = *replay
+		result.Cached = true
+	} else if key != "" {
+		// Keys are scoped to the caller, so callers picking the same key
+		// don't get each other's results.
+		stored, replayed, conflict := idempotency.do(caller+"|"+key, request, func() TranslateResponse {
+			return translate(params)
+		})
+		if conflict {
+			return sendTranslateResponse(c, TranslateResponse{
+				Code:    422,
+				Message: idempotencyConflictMessage,
+			})
 		}
+		if replayed {
+			c.Set("Idempotent-Replayed", "true")
+		}
+		result = stored
+	} else {
+		result = translate(params)
+	}
+	if !repeated {
+		duplicates.remember(caller, request, result)
 	}
 
-	message := "Unknown error."
-	if resp.StatusCode == 429 {
-		message = "Too many requests, please try again later."
+	if result.Code == 200 {
+		c.Set(fiber.HeaderETag, etag)
 	}
+	if result.Code == 429 && cfg().UpstreamCooldown > 0 {
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(cfg().UpstreamCooldown.Seconds())))
+	}
+	if result.Cached {
+		c.Set("X-Cache", "HIT")
+	} else {
+		c.Set("X-Cache", "MISS")
+	}
+	result.ID = params.ID
+	if result.ID == 0 {
+		result.ID = randomID()
+	}
+	if result.Code == 200 {
+		result.Method = MethodFree
+	}
+	if params.TTS && result.Code == 200 && ttsEnabled() {
+		result.AudioURL = audioURL(c, result.Data, result.TargetLang)
+	}
+	if get {
+		setCacheHeaders(c, params, result.Code)
+	}
+	result.RequestID = requestID(c)
+	result.TookMs = time.Since(start).Milliseconds()
+	return sendTranslateResponse(c, result)
+}
 
-	return TranslateResponse{
-		Code:    resp.StatusCode,
-		Message: message,
+// sendTranslateResponse answers a /translate request in the schema picked
+// by COMPAT.
+func sendTranslateResponse(c *fiber.Ctx, result TranslateResponse) error {
+	if cfg().Compat == CompatLegacy {
+		return c.Status(result.Code).JSON(legacyResponse(result))
 	}
+	return c.Status(result.Code).JSON(result)
+}
+
+func requestID(c *fiber.Ctx) string {
+	id, _ := c.Locals("requestid").(string)
+	return id
 }
 
 func main() {
-	app := fiber.New()
+	if len(os.Args) > 1 {
+		runCommand(os.Args[1], os.Args[2:])
+		return
+	}
+	serve()
+}
 
-	app.Get("/", func(c *fiber.Ctx) error {
-		return c.SendString("Developed by StardustAlN. More info: https://github.com/StardustAlN/DeepLX-Go")
-	})
+// serve runs the HTTP server and the enabled bots.
+func serve() {
+	if cfg().LogRedactFile != "" {
+		rules, err := loadRedactionRules(cfg().LogRedactFile)
+		if err != nil {
+			log.Fatalf("Error loading redaction rules: %v", err)
+		}
+		redactions.Store(&rules)
+	}
+	openLogs()
+	setMaxProcs()
+	tuneGC(cfg())
+	if chaosEnabled() {
+		log.Printf("Fault injection is enabled: upstream calls will be delayed and failed on purpose")
+	}
+	if dir := cfg().UpstreamRecordDir; dir != "" {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			log.Fatalf("Error creating upstream record directory: %v", err)
+		}
+		log.Printf("Recording upstream calls to %s", dir)
+	}
+
+	if cfg().TermsFile != "" {
+		if err := terms.load(cfg().TermsFile); err != nil {
+			log.Fatalf("Error loading terms: %v", err)
+		}
+	}
+
+	if cfg().ProfanityWordlist != "" {
+		filter, err := loadProfanityFilter(cfg().ProfanityWordlist, cfg().ProfanityMode)
+		if err != nil {
+			log.Fatalf("Error loading profanity filter: %v", err)
+		}
+		profanity.Store(filter)
+	}
+
+	if cfg().RomanizeDir != "" {
+		dicts, err := loadRomanizationDicts(cfg().RomanizeDir)
+		if err != nil {
+			log.Fatalf("Error loading romanization dictionaries: %v", err)
+		}
+		romanizationDicts.Store(&dicts)
+	}
+	if cfg().KeyDefaultsFile != "" {
+		defaults, err := loadKeyDefaults(cfg().KeyDefaultsFile)
+		if err != nil {
+			log.Fatalf("Error loading key defaults: %v", err)
+		}
+		keyDefaults.Store(&defaults)
+	}
+
+	if cfg().ScriptsDir != "" {
+		set, err := loadScripts(cfg().ScriptsDir)
+		if err != nil {
+			log.Fatalf("Error loading scripts: %v", err)
+		}
+		scripts.Store(set)
+	}
+
+	if cfg().LocalModelURL != "" {
+		engines[EngineLocal] = localEngine{}
+	}
+	if cfg().PluginsDir != "" {
+		if err := loadPlugins(cfg().PluginsDir); err != nil {
+			log.Fatalf("Error loading plugins: %v", err)
+		}
+	}
+	if unknown := unknownEngines(cfg()); len(unknown) > 0 {
+		log.Fatalf("Unknown engine(s): %s", strings.Join(unknown, ", "))
+	}
+
+	if cfg().RedisURL != "" {
+		store, err := newRedisStorage(cfg().RedisURL)
+		if err != nil {
+			log.Fatalf("Error connecting to redis: %v", err)
+		}
+		sharedStore = store
+	}
+
+	if cfg().QuarantineFailures > 0 {
+		go upstreams.probeQuarantined(cfg().ProbeInterval)
+	}
 
-	app.Get("/translate", func(c *fiber.Ctx) error {
-		return c.SendString("Please use POST method :)")
+	app := fiber.New(fiber.Config{
+		Prefork:      cfg().Prefork,
+		BodyLimit:    cfg().BodyLimit,
+		Concurrency:  cfg().Concurrency,
+		ReadTimeout:  cfg().ReadTimeout,
+		WriteTimeout: cfg().WriteTimeout,
+		IdleTimeout:  cfg().IdleTimeout,
+		JSONEncoder:  jsonMarshal,
+		JSONDecoder:  jsonUnmarshal,
 	})
+	app.Use(requestid.New())
+	if handler := accessLog(); handler != nil {
+		app.Use(handler)
+	}
+	app.Use(recordRequest)
+	app.Use(logSampledRequest)
+	app.Use(verifySignature)
 
-	app.Post("/translate", func(c *fiber.Ctx) error {
-		var params TranslateParams
-		if err := c.BodyParser(&params); err != nil {
-			log.Printf("Error parsing request body: %v", err)
-			return c.Status(400).JSON(TranslateResponse{
-				Code:    400,
-				Message: "Invalid request body",
-			})
+	app.Get("/", handleRoot)
+
+	currentLimiter.Store(newRateLimiter())
+	app.Get("/translate", checkMaintenance, rateLimit, warnQuota, handleTranslate)
+	app.Post("/translate", checkMaintenance, rateLimit, warnQuota, handleTranslate)
+
+	app.Post("/estimate", rateLimit, handleEstimate)
+	app.Post("/diff", checkMaintenance, rateLimit, warnQuota, handleDiff)
+	app.Post("/qa", checkMaintenance, rateLimit, warnQuota, handleQA)
+
+	app.Get("/launcher", checkMaintenance, rateLimit, warnQuota, handleLauncher)
+
+	app.Get("/lookup", checkMaintenance, rateLimit, warnQuota, handleLookup)
+	app.Post("/lookup", checkMaintenance, rateLimit, warnQuota, handleLookup)
+
+	app.Get("/tts/:id", rateLimit, handleTTS)
+
+	// Preforked processes would each resume the same checkpointed jobs.
+	if cfg().JobsDir != "" && !cfg().Prefork {
+		afterHandover(func() {
+			if err := jobs.restore(); err != nil {
+				log.Fatalf("Error restoring jobs: %v", err)
+			}
+		})
+	}
+	jobs.start(cfg().JobWorkers)
+	app.Post("/jobs", checkMaintenance, rateLimit, warnQuota, handleCreateJob)
+	app.Get("/jobs/:id", handleGetJob)
+	app.Get("/jobs/:id/bilingual", handleJobBilingual)
+	app.Get("/jobs/:id/consistency", handleJobConsistency)
+
+	app.Post("/document", checkMaintenance, rateLimit, warnQuota, handleDocument)
+
+	if cfg().SlackSigningSecret != "" {
+		app.Post("/slack/command", checkMaintenance, handleSlackCommand)
+	}
+
+	app.Get("/ui", handleUI)
+	registerLoginRoutes(app)
+	registerAdminRoutes(app)
+
+	// With prefork, the bots run in the parent process only.
+	if cfg().TelegramToken != "" && !fiber.IsChild() {
+		go newTelegramBot(cfg().TelegramToken, cfg().TelegramTargetLang).run()
+	}
+	if cfg().DiscordToken != "" && !fiber.IsChild() {
+		if err := startDiscordBot(cfg().DiscordToken); err != nil {
+			log.Fatalf("Error starting Discord bot: %v", err)
 		}
+	}
+
+	go idempotency.sweep(min(cfg().IdempotencyTTL, time.Minute))
+	if cfg().CacheTTL > 0 {
+		go warmCache(cfg().CacheTTL)
+	}
+	go watchConfig()
+	go exportMetrics()
+	go exportUsagePeriodically()
+	go watchUpstreamSchema()
+	if getEnv("SECRETS_URL", "") != "" {
+		go refreshRemoteSettings()
+	}
 
-		result := translate(params)
-		return c.Status(result.Code).JSON(result)
+	// Preforked processes each open their own listener, so socket
+	// activation, upgrades and graceful shutdown are not available.
+	if cfg().Prefork {
+		app.Hooks().OnListen(func(fiber.ListenData) error {
+			notifyReady(&net.TCPAddr{IP: net.IPv4zero, Port: 8080})
+			return nil
+		})
+		if err := app.Listen(":8080"); err != nil {
+			log.Fatalf("Error starting server: %v", err)
+		}
+		return
+	}
+
+	ln, err := listen()
+	if err != nil {
+		log.Fatalf("Error starting server: %v", err)
+	}
+	app.Hooks().OnListen(func(fiber.ListenData) error {
+		if err := notifyUpgradeReady(); err != nil {
+			log.Printf("Error reporting upgrade readiness: %v", err)
+		}
+		notifyReady(ln.Addr())
+		return nil
 	})
 
-	if err := app.Listen(":8080"); err != nil {
+	stopped := make(chan struct{})
+	go handleSignals(app, ln, stopped)
+	if err := app.Listener(ln); err != nil {
 		log.Fatalf("Error starting server: %v", err)
 	}
+	<-stopped
 }
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// MaintenanceMessage is reported while in maintenance mode when the admin
+// gives no message.
+const MaintenanceMessage = "The server is under maintenance, please try again later."
+
+// maintenanceMode is set while translation routes are switched off.
+type maintenanceMode struct {
+	Message string    `json:"message"`
+	Since   time.Time `json:"since"`
+	// RetryAfter is sent as Retry-After in seconds, when set.
+	RetryAfter int `json:"retry_after,omitempty"`
+}
+
+// sharedMaintenanceTTL is how long a replica trusts the maintenance mode it
+// read from the shared store, as for upstream cooldowns.
+const sharedMaintenanceTTL = time.Second
+
+// maintenanceState holds the current maintenance mode, or nil while serving.
+// The mode is kept in sharedStore when Redis is configured, so it applies to
+// every replica.
+type maintenanceState struct {
+	mu   sync.Mutex
+	mode *maintenanceMode
+	// expires is when the mode read from sharedStore is read again.
+	expires time.Time
+}
+
+var maintenance = &maintenanceState{}
+
+// load returns the current maintenance mode.
+func (s *maintenanceState) load() *maintenanceMode {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if sharedStore == nil || now.Before(s.expires) {
+		return s.mode
+	}
+	data, err := sharedStore.Get("maintenance")
+	if err != nil {
+		// The last mode read stays in force until Redis answers.
+		log.Printf("Error reading maintenance mode: %v", err)
+		return s.mode
+	}
+	var mode *maintenanceMode
+	if data != nil {
+		mode = new(maintenanceMode)
+		if err := json.Unmarshal(data, mode); err != nil {
+			log.Printf("Error decoding maintenance mode: %v", err)
+			mode = nil
+		}
+	}
+	s.mode, s.expires = mode, now.Add(sharedMaintenanceTTL)
+	return mode
+}
+
+// swap sets the maintenance mode, nil to switch it off, and returns the
+// previous one.
+func (s *maintenanceState) swap(mode *maintenanceMode) (*maintenanceMode, error) {
+	before := s.load()
+	if sharedStore != nil {
+		var err error
+		if mode == nil {
+			err = sharedStore.Delete("maintenance")
+		} else {
+			data, _ := json.Marshal(mode)
+			err = sharedStore.Set("maintenance", data, 0)
+		}
+		if err != nil {
+			return before, err
+		}
+	}
+	s.mu.Lock()
+	s.mode, s.expires = mode, time.Now().Add(sharedMaintenanceTTL)
+	s.mu.Unlock()
+	return before, nil
+}
+
+// checkMaintenance rejects translation requests while in maintenance mode.
+func checkMaintenance(c *fiber.Ctx) error {
+	mode := maintenance.load()
+	if mode == nil {
+		return c.Next()
+	}
+	if mode.RetryAfter > 0 {
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(mode.RetryAfter))
+	}
+	return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+		"code":    fiber.StatusServiceUnavailable,
+		"message": mode.Message,
+	})
+}
+
+func handleGetMaintenance(c *fiber.Ctx) error {
+	mode := maintenance.load()
+	if mode == nil {
+		return c.JSON(fiber.Map{"enabled": false})
+	}
+	return c.JSON(fiber.Map{
+		"enabled":     true,
+		"message":     mode.Message,
+		"since":       mode.Since,
+		"retry_after": mode.RetryAfter,
+	})
+}
+
+func handleStartMaintenance(c *fiber.Ctx) error {
+	var mode maintenanceMode
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&mode); err != nil || mode.RetryAfter < 0 {
+			return c.Status(400).JSON(fiber.Map{"code": 400, "message": "Invalid request body"})
+		}
+	}
+	if mode.Message == "" {
+		mode.Message = MaintenanceMessage
+	}
+	// Since comes from the clock, not the body, and stays when an admin
+	// changes the message of a maintenance already under way.
+	mode.Since = time.Now()
+	if current := maintenance.load(); current != nil {
+		mode.Since = current.Since
+	}
+	before, err := maintenance.swap(&mode)
+	if err != nil {
+		log.Printf("Error storing maintenance mode: %v", err)
+		return c.Status(500).JSON(fiber.Map{"code": 500, "message": "Failed to store maintenance mode"})
+	}
+	log.Printf("Maintenance mode on: %s", mode.Message)
+	auditAdmin(c, "maintenance.start", "", before, &mode)
+	return handleGetMaintenance(c)
+}
+
+func handleStopMaintenance(c *fiber.Ctx) error {
+	before, err := maintenance.swap(nil)
+	if err != nil {
+		log.Printf("Error storing maintenance mode: %v", err)
+		return c.Status(500).JSON(fiber.Map{"code": 500, "message": "Failed to store maintenance mode"})
+	}
+	if before != nil {
+		log.Printf("Maintenance mode off")
+		auditAdmin(c, "maintenance.stop", "", before, nil)
+	}
+	return handleGetMaintenance(c)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// TestMaintenanceMode checks that the start of maintenance comes from the
+// clock and that the mode reaches other replicas through the shared store.
+func TestMaintenanceMode(t *testing.T) {
+	withSharedStore(t)
+	previous := maintenance
+	maintenance = &maintenanceState{}
+	t.Cleanup(func() { maintenance = previous })
+
+	app := fiber.New()
+	app.Get("/admin/maintenance", handleGetMaintenance)
+	app.Put("/admin/maintenance", handleStartMaintenance)
+	app.Delete("/admin/maintenance", handleStopMaintenance)
+	app.Post("/translate", checkMaintenance, func(c *fiber.Ctx) error { return c.SendString("ok") })
+	send := func(method, path, body string) (*http.Response, map[string]any) {
+		t.Helper()
+		request := httptest.NewRequest(method, path, strings.NewReader(body))
+		request.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		response, err := app.Test(request, -1)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		var decoded map[string]any
+		_ = json.NewDecoder(response.Body).Decode(&decoded)
+		return response, decoded
+	}
+
+	start := time.Now()
+	_, state := send(http.MethodPut, "/admin/maintenance", `{"message": "Upgrading", "retry_after": 60, "since": "2000-01-01T00:00:00Z"}`)
+	since, err := time.Parse(time.RFC3339Nano, state["since"].(string))
+	if err != nil || since.Before(start.Add(-time.Second)) {
+		t.Errorf("since = %v, want the time of the request", state["since"])
+	}
+
+	// Another replica reads the mode from the shared store.
+	maintenance = &maintenanceState{}
+	response, body := send(http.MethodPost, "/translate", `{}`)
+	if response.StatusCode != 503 || body["message"] != "Upgrading" || response.Header.Get(fiber.HeaderRetryAfter) != "60" {
+		t.Errorf("translate in maintenance: status %d, body %v, Retry-After %q", response.StatusCode, body, response.Header.Get(fiber.HeaderRetryAfter))
+	}
+
+	send(http.MethodDelete, "/admin/maintenance", "")
+	maintenance = &maintenanceState{}
+	if response, _ := send(http.MethodPost, "/translate", `{}`); response.StatusCode != 200 {
+		t.Errorf("translate after maintenance: status %d, want 200", response.StatusCode)
+	}
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"math/rand"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// StatsD dialects metrics are pushed in.
+const (
+	StatsdPlain = "statsd"
+	StatsdDog   = "dogstatsd"
+)
+
+// statsdPacketSize keeps packets within a typical Ethernet MTU, so agents
+// receive them unfragmented.
+const statsdPacketSize = 1432
+
+// maxTimings caps the samples kept per timer between two flushes. Further
+// samples replace kept ones at random and the rest are sent with a sample
+// rate, so the agent still counts every call.
+const maxTimings = 1000
+
+// metricTag qualifies a metric, such as the route of a request.
+type metricTag struct {
+	Key, Value string
+}
+
+// metricKey identifies a series: its name and, for DogStatsD, its tags.
+type metricKey struct {
+	name, tags string
+}
+
+type timingSamples struct {
+	values []float64
+	seen   int
+}
+
+// metricsExporter aggregates counters and timings and pushes them to
+// STATSD_ADDR every STATSD_INTERVAL, along with gauges read at that time.
+type metricsExporter struct {
+	mu       sync.Mutex
+	counters map[metricKey]int64
+	timings  map[metricKey]*timingSamples
+
+	// conn is only used by the export loop.
+	addr      string
+	conn      net.Conn
+	lastError string
+}
+
+var metrics = &metricsExporter{
+	counters: make(map[metricKey]int64),
+	timings:  make(map[metricKey]*timingSamples),
+}
+
+func metricsEnabled() bool {
+	return cfg().StatsdAddr != ""
+}
+
+// key formats a series for the configured dialect. Plain StatsD has no
+// tags, so their values are appended to the name instead.
+func (m *metricsExporter) key(name string, tags []metricTag) metricKey {
+	config := cfg()
+	name = config.StatsdPrefix + name
+	if config.StatsdFormat != StatsdDog {
+		for _, tag := range tags {
+			name += "." + metricSegment(tag.Value)
+		}
+		return metricKey{name: name}
+	}
+
+	all := append([]string{}, config.StatsdTags...)
+	for _, tag := range tags {
+		all = append(all, tag.Key+":"+strings.NewReplacer(",", "_", "|", "_", "#", "_").Replace(tag.Value))
+	}
+	return metricKey{name: name, tags: strings.Join(all, ",")}
+}
+
+// metricSegment turns a tag value such as /jobs/:id into a name segment
+// such as jobs_id.
+func metricSegment(value string) string {
+	segment := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' {
+			return r
+		}
+		return '_'
+	}, strings.Trim(value, "/"))
+	segment = strings.Trim(segment, "_")
+	for strings.Contains(segment, "__") {
+		segment = strings.ReplaceAll(segment, "__", "_")
+	}
+	if segment == "" {
+		return "root"
+	}
+	return segment
+}
+
+// count increments a counter.
+func (m *metricsExporter) count(name string, tags ...metricTag) {
+	if !metricsEnabled() {
+		return
+	}
+	key := m.key(name, tags)
+	m.mu.Lock()
+	m.counters[key]++
+	m.mu.Unlock()
+}
+
+// timing records a duration sample.
+func (m *metricsExporter) timing(name string, took time.Duration, tags ...metricTag) {
+	if !metricsEnabled() {
+		return
+	}
+	key := m.key(name, tags)
+	ms := float64(took.Microseconds()) / 1000
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	samples := m.timings[key]
+	if samples == nil {
+		samples = &timingSamples{}
+		m.timings[key] = samples
+	}
+	samples.seen++
+	if len(samples.values) < maxTimings {
+		samples.values = append(samples.values, ms)
+	} else if i := rand.Intn(samples.seen); i < maxTimings {
+		samples.values[i] = ms
+	}
+}
+
+// exportMetrics flushes the metrics every STATSD_INTERVAL while STATSD_ADDR
+// is set. Both are read again after each flush, so reloads apply them.
+func exportMetrics() {
+	timer := time.NewTimer(cfg().StatsdInterval)
+	for range timer.C {
+		if metricsEnabled() {
+			metrics.flush()
+		}
+		timer.Reset(cfg().StatsdInterval)
+	}
+}
+
+// flush sends the counters and timings gathered since the last flush and
+// the current gauges.
+func (m *metricsExporter) flush() {
+	lines := m.gauges()
+
+	m.mu.Lock()
+	counters, timings := m.counters, m.timings
+	m.counters = make(map[metricKey]int64, len(counters))
+	m.timings = make(map[metricKey]*timingSamples, len(timings))
+	m.mu.Unlock()
+
+	for key, value := range counters {
+		lines = append(lines, key.line(strconv.FormatInt(value, 10), "c", 1))
+	}
+	for key, samples := range timings {
+		rate := float64(len(samples.values)) / float64(samples.seen)
+		for _, value := range samples.values {
+			lines = append(lines, key.line(strconv.FormatFloat(value, 'f', -1, 64), "ms", rate))
+		}
+	}
+
+	if err := m.send(lines); err != nil {
+		if err.Error() != m.lastError {
+			log.Printf("Error sending metrics to %s: %v", cfg().StatsdAddr, err)
+		}
+		m.lastError = err.Error()
+		return
+	}
+	m.lastError = ""
+}
+
+// gauges reads the state reported at every flush: jobs, upstream targets
+// by state and the size of the cache.
+func (m *metricsExporter) gauges() []string {
+	jobStats := jobs.stats()
+	lines := []string{
+		m.key("jobs.queued", nil).line(strconv.Itoa(jobStats.Queued), "g", 1),
+		m.key("jobs.running", nil).line(strconv.Itoa(jobStats.Running), "g", 1),
+	}
+
+	// Every state is reported, so a state no target is in anymore drops to
+	// 0 instead of keeping its last value.
+	counts := make(map[string]int)
+	for _, target := range upstreams.stats() {
+		counts[target.State]++
+	}
+	for _, state := range []string{"healthy", "cooling_down", "quarantined", "disabled"} {
+		lines = append(lines, m.key("upstream.targets", []metricTag{{"state", state}}).line(strconv.Itoa(counts[state]), "g", 1))
+	}
+
+	if cfg().CacheTTL > 0 {
+		lines = append(lines, m.key("cache.entries", nil).line(strconv.Itoa(translations.Len()), "g", 1))
+	}
+	return lines
+}
+
+// line formats one metric in the StatsD line protocol.
+func (k metricKey) line(value, kind string, rate float64) string {
+	line := k.name + ":" + value + "|" + kind
+	if rate < 1 {
+		line += "|@" + strconv.FormatFloat(rate, 'f', 4, 64)
+	}
+	if k.tags != "" {
+		line += "|#" + k.tags
+	}
+	return line
+}
+
+// send writes lines in as few packets as fit, connecting again when
+// STATSD_ADDR changed.
+func (m *metricsExporter) send(lines []string) error {
+	if addr := cfg().StatsdAddr; m.conn == nil || m.addr != addr {
+		if m.conn != nil {
+			m.conn.Close()
+			m.conn = nil
+		}
+		conn, err := net.Dial("udp", addr)
+		if err != nil {
+			return err
+		}
+		m.conn, m.addr = conn, addr
+	}
+
+	var failed error
+	var packet []byte
+	write := func() {
+		if len(packet) == 0 {
+			return
+		}
+		if _, err := m.conn.Write(packet); err != nil && failed == nil {
+			failed = err
+		}
+		packet = packet[:0]
+	}
+	for _, line := range lines {
+		if len(packet) > 0 && len(packet)+1+len(line) > statsdPacketSize {
+			write()
+		}
+		if len(packet) > 0 {
+			packet = append(packet, '\n')
+		}
+		packet = append(packet, line...)
+	}
+	write()
+	return failed
+}
+
+// recordRequest counts requests and measures their duration by route and
+// status.
+func recordRequest(c *fiber.Ctx) error {
+	if !metricsEnabled() {
+		return c.Next()
+	}
+	start := time.Now()
+	err := c.Next()
+
+	status := c.Response().StatusCode()
+	route := c.Route().Path
+	if err != nil {
+		var fiberErr *fiber.Error
+		status = fiber.StatusInternalServerError
+		if errors.As(err, &fiberErr) {
+			status = fiberErr.Code
+		}
+		// Requests no route matched end in this middleware's own route.
+		if status == fiber.StatusNotFound && route == "/" {
+			route = "unmatched"
+		}
+	}
+	metrics.count("requests", metricTag{"route", route}, metricTag{"status", strconv.Itoa(status)})
+	metrics.timing("request.duration", time.Since(start), metricTag{"route", route})
+	return err
+}
+
+// recordUpstream counts an upstream call by target and outcome and measures
+// its duration.
+func recordUpstream(target *upstreamTarget, took time.Duration, reply upstreamReply) {
+	if !metricsEnabled() {
+		return
+	}
+	result := "ok"
+	switch {
+	case reply.Status == 429:
+		result = "rate_limited"
+	case !reply.ok():
+		result = "error"
+	}
+	tags := []metricTag{{"endpoint", metricHost(target.Endpoint)}}
+	if target.Proxy != "" {
+		tags = append(tags, metricTag{"proxy", metricHost(target.Proxy)})
+	}
+	metrics.count("upstream.calls", append(tags, metricTag{"result", result})...)
+	metrics.timing("upstream.duration", took, tags...)
+}
+
+// metricHost reduces an endpoint or proxy URL to its host, leaving out
+// paths and credentials.
+func metricHost(rawURL string) string {
+	if u, err := url.Parse(rawURL); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return rawURL
+}
@@ -0,0 +1,559 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Cookies of the OIDC login: the state of a login in progress, and the
+// session of a user who logged in.
+const (
+	loginCookie   = "deeplx_login"
+	sessionCookie = "deeplx_session"
+)
+
+// loginTimeout is how long a user may take to log in at the provider.
+const loginTimeout = 10 * time.Minute
+
+// sessionUserLocal holds the sessionUser of requests authenticated by a
+// session cookie.
+const sessionUserLocal = "sessionUser"
+
+// oidcDiscovery is the part of a provider's discovery document the login
+// flow uses.
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// oidcProvider caches the discovery document and signing keys of
+// OIDC_ISSUER. Both are fetched again when the issuer changes on reload.
+type oidcProvider struct {
+	mu          sync.Mutex
+	issuer      string
+	discovery   oidcDiscovery
+	keys        map[string]crypto.PublicKey
+	keysFetched time.Time
+}
+
+var oidc = &oidcProvider{}
+
+var oidcClient = &http.Client{Timeout: 10 * time.Second}
+
+// oidcEnabled reports whether users log in to the admin pages through
+// OIDC_ISSUER.
+func oidcEnabled() bool {
+	config := cfg()
+	return config.OIDCIssuer != "" && config.OIDCClientID != "" && config.OIDCClientSecret != "" && config.OIDCRedirectURL != ""
+}
+
+// discover returns the discovery document of OIDC_ISSUER.
+func (p *oidcProvider) discover() (oidcDiscovery, error) {
+	issuer := cfg().OIDCIssuer
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.issuer == issuer {
+		return p.discovery, nil
+	}
+
+	var discovery oidcDiscovery
+	if err := getJSON(strings.TrimRight(issuer, "/")+"/.well-known/openid-configuration", &discovery); err != nil {
+		return discovery, fmt.Errorf("failed to discover %s: %w", issuer, err)
+	}
+	if strings.TrimRight(discovery.Issuer, "/") != strings.TrimRight(issuer, "/") {
+		return discovery, fmt.Errorf("%s reports issuer %q", issuer, discovery.Issuer)
+	}
+	p.issuer, p.discovery, p.keys = issuer, discovery, nil
+	return discovery, nil
+}
+
+// key returns the provider's signing key with the given id. Providers rotate
+// their keys, so an unknown id fetches the key set again, at most once a
+// minute.
+func (p *oidcProvider) key(id string) (crypto.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key, ok := p.keys[id]; ok {
+		return key, nil
+	}
+	if p.keys != nil && time.Since(p.keysFetched) < time.Minute {
+		return nil, fmt.Errorf("unknown signing key %q", id)
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := getJSON(p.discovery.JWKSURI, &set); err != nil {
+		return nil, fmt.Errorf("failed to fetch signing keys: %w", err)
+	}
+	p.keys, p.keysFetched = make(map[string]crypto.PublicKey), time.Now()
+	for _, key := range set.Keys {
+		// Keys of other types, such as encryption keys, are skipped.
+		if public, err := key.publicKey(); err == nil {
+			p.keys[key.ID] = public
+		}
+	}
+	if key, ok := p.keys[id]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", id)
+}
+
+// minRSAKeyBits is the smallest RSA signing key accepted from a provider.
+const minRSAKeyBits = 2048
+
+// jsonWebKey is an RSA or P-256 key of a provider's key set.
+type jsonWebKey struct {
+	ID    string `json:"kid"`
+	Type  string `json:"kty"`
+	Use   string `json:"use"`
+	N     string `json:"n"`
+	E     string `json:"e"`
+	Curve string `json:"crv"`
+	X     string `json:"x"`
+	Y     string `json:"y"`
+}
+
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	if k.Use != "" && k.Use != "sig" {
+		return nil, fmt.Errorf("key %q is not for signatures", k.ID)
+	}
+	number := func(value string) (*big.Int, error) {
+		data, err := base64.RawURLEncoding.DecodeString(value)
+		return new(big.Int).SetBytes(data), err
+	}
+	switch {
+	case k.Type == "RSA":
+		n, err := number(k.N)
+		if err != nil {
+			return nil, err
+		}
+		// Shorter keys can be factored, so tokens signed with them could
+		// be forged.
+		if n.BitLen() < minRSAKeyBits {
+			return nil, fmt.Errorf("RSA key %q has only %d bits", k.ID, n.BitLen())
+		}
+		e, err := number(k.E)
+		if err != nil || !e.IsInt64() {
+			return nil, fmt.Errorf("invalid exponent of key %q", k.ID)
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case k.Type == "EC" && k.Curve == "P-256":
+		x, err := number(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := number(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %s %s", k.Type, k.Curve)
+}
+
+// audience is the aud claim, which is a string or an array of strings.
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var one string
+	if json.Unmarshal(data, &one) == nil {
+		*a = audience{one}
+		return nil
+	}
+	return json.Unmarshal(data, (*[]string)(a))
+}
+
+// idClaims are the claims of an ID token the login checks.
+type idClaims struct {
+	Issuer        string   `json:"iss"`
+	Audience      audience `json:"aud"`
+	Expires       int64    `json:"exp"`
+	Nonce         string   `json:"nonce"`
+	Subject       string   `json:"sub"`
+	Email         string   `json:"email"`
+	EmailVerified *bool    `json:"email_verified"`
+	Name          string   `json:"name"`
+}
+
+// verifyIDToken checks the signature, issuer, audience, expiry and nonce of
+// an ID token and returns its claims. Tokens signed with RS256 or ES256 are
+// accepted.
+func verifyIDToken(token, nonce string) (idClaims, error) {
+	var claims idClaims
+	discovery, err := oidc.discover()
+	if err != nil {
+		return claims, err
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return claims, errors.New("malformed ID token")
+	}
+	var header struct {
+		Algorithm string `json:"alg"`
+		KeyID     string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return claims, fmt.Errorf("malformed ID token header: %w", err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return claims, fmt.Errorf("malformed ID token signature: %w", err)
+	}
+	key, err := oidc.key(header.KeyID)
+	if err != nil {
+		return claims, err
+	}
+
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	valid := false
+	switch header.Algorithm {
+	case "RS256":
+		if key, ok := key.(*rsa.PublicKey); ok {
+			valid = rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) == nil
+		}
+	case "ES256":
+		if key, ok := key.(*ecdsa.PublicKey); ok && len(signature) == 64 {
+			r, s := new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])
+			valid = ecdsa.Verify(key, digest[:], r, s)
+		}
+	default:
+		return claims, fmt.Errorf("unsupported ID token algorithm %q", header.Algorithm)
+	}
+	if !valid {
+		return claims, errors.New("invalid ID token signature")
+	}
+
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return claims, fmt.Errorf("malformed ID token claims: %w", err)
+	}
+	switch {
+	case claims.Issuer != discovery.Issuer:
+		return claims, fmt.Errorf("ID token issued by %q", claims.Issuer)
+	case !slices.Contains(claims.Audience, cfg().OIDCClientID):
+		return claims, errors.New("ID token issued for another client")
+	// A minute of leeway allows for clocks running apart.
+	case time.Now().After(time.Unix(claims.Expires, 0).Add(time.Minute)):
+		return claims, errors.New("ID token expired")
+	case !hmac.Equal([]byte(claims.Nonce), []byte(nonce)):
+		return claims, errors.New("ID token for another login")
+	case claims.Subject == "":
+		return claims, errors.New("ID token without subject")
+	}
+	return claims, nil
+}
+
+func decodeSegment(segment string, into any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, into)
+}
+
+func getJSON(target string, into any) error {
+	resp, err := oidcClient.Get(target)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(into)
+}
+
+// loginState is kept in loginCookie between sending the user to the
+// provider and the callback.
+type loginState struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	Next     string `json:"next"`
+	Expires  int64  `json:"exp"`
+}
+
+// sessionUser is kept in sessionCookie.
+type sessionUser struct {
+	Subject string `json:"sub"`
+	Email   string `json:"email,omitempty"`
+	Name    string `json:"name,omitempty"`
+	Expires int64  `json:"exp"`
+}
+
+// newSessionUser starts the session of the user an ID token was issued to.
+// Only addresses the provider reports as verified count, as others could be
+// claimed by anyone; a token without email_verified counts as unverified.
+func newSessionUser(claims idClaims) sessionUser {
+	user := sessionUser{
+		Subject: claims.Subject,
+		Name:    claims.Name,
+		Expires: time.Now().Add(cfg().OIDCSessionTTL).Unix(),
+	}
+	if claims.EmailVerified != nil && *claims.EmailVerified {
+		user.Email = claims.Email
+	}
+	return user
+}
+
+// actor names the user in the audit log.
+func (u sessionUser) actor() string {
+	if u.Email != "" {
+		return u.Email
+	}
+	return u.Subject
+}
+
+// userAllowed reports whether a user may use the admin pages: by email
+// address or its @domain in OIDC_ALLOWED_USERS, or by subject. "*" allows
+// every user of the provider.
+func userAllowed(user sessionUser) bool {
+	for _, allowed := range cfg().OIDCAllowedUsers {
+		if allowed == "*" || allowed == user.Subject {
+			return true
+		}
+		if user.Email == "" {
+			continue
+		}
+		if strings.EqualFold(allowed, user.Email) ||
+			strings.HasPrefix(allowed, "@") && strings.HasSuffix(strings.ToLower(user.Email), strings.ToLower(allowed)) {
+			return true
+		}
+	}
+	return false
+}
+
+// sessionKey signs cookies. It is derived from OIDC_CLIENT_SECRET, so all
+// processes and replicas accept each other's cookies, and changing the
+// secret ends all sessions.
+func sessionKey() []byte {
+	mac := hmac.New(sha256.New, []byte(cfg().OIDCClientSecret))
+	mac.Write([]byte("deeplx session"))
+	return mac.Sum(nil)
+}
+
+// signCookie encodes a value as base64 JSON followed by its signature.
+func signCookie(value any) string {
+	data, _ := json.Marshal(value)
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	mac := hmac.New(sha256.New, sessionKey())
+	mac.Write([]byte(payload))
+	return payload + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// readCookie decodes a cookie written by signCookie, reporting false when
+// its signature doesn't match.
+func readCookie(cookie string, into any) bool {
+	payload, signature, ok := strings.Cut(cookie, ".")
+	if !ok {
+		return false
+	}
+	mac := hmac.New(sha256.New, sessionKey())
+	mac.Write([]byte(payload))
+	expected := base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(signature), []byte(expected)) && decodeSegment(payload, into) == nil
+}
+
+// setCookie sets a cookie on the path, secure when OIDC_REDIRECT_URL uses
+// HTTPS. maxAge 0 removes the cookie.
+func setCookie(c *fiber.Ctx, name, value, path string, maxAge time.Duration) {
+	cookie := &fiber.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		HTTPOnly: true,
+		Secure:   strings.HasPrefix(cfg().OIDCRedirectURL, "https://"),
+		// Lax sends the cookie along when the provider redirects back, but
+		// not with requests other sites make.
+		SameSite: fiber.CookieSameSiteLaxMode,
+	}
+	if maxAge > 0 {
+		cookie.Expires = time.Now().Add(maxAge)
+	} else {
+		cookie.Expires = time.Unix(0, 0)
+	}
+	c.Cookie(cookie)
+}
+
+// currentSession returns the user of a request with a valid session cookie.
+// Users removed from OIDC_ALLOWED_USERS lose access on the next request.
+// Cookies sent with state-changing requests from another origin are
+// ignored, as sites on the same domain can make the browser send them.
+func currentSession(c *fiber.Ctx) (sessionUser, bool) {
+	var user sessionUser
+	cookie := c.Cookies(sessionCookie)
+	if cookie == "" || !oidcEnabled() {
+		return user, false
+	}
+	if origin := c.Get(fiber.HeaderOrigin); origin != "" && c.Method() != fiber.MethodGet && c.Method() != fiber.MethodHead {
+		if redirect, err := url.Parse(cfg().OIDCRedirectURL); err != nil || origin != redirect.Scheme+"://"+redirect.Host {
+			return user, false
+		}
+	}
+	if !readCookie(cookie, &user) || time.Now().Unix() >= user.Expires || !userAllowed(user) {
+		return user, false
+	}
+	return user, true
+}
+
+// randomToken returns 32 random bytes in base64.
+func randomToken() string {
+	data := make([]byte, 32)
+	rand.Read(data)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// localPath returns next when it is a path on this server, so the login
+// can't be used to redirect users elsewhere.
+func localPath(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/admin/dashboard"
+	}
+	return next
+}
+
+// handleLogin sends the user to the provider to log in, with PKCE, and back
+// to the path in next afterwards.
+func handleLogin(c *fiber.Ctx) error {
+	if !oidcEnabled() {
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+	discovery, err := oidc.discover()
+	if err != nil {
+		log.Printf("Error starting login: %v", err)
+		return c.Status(502).JSON(fiber.Map{"code": 502, "message": "The login provider is unavailable"})
+	}
+
+	state := loginState{
+		State:    randomToken(),
+		Nonce:    randomToken(),
+		Verifier: randomToken(),
+		Next:     localPath(c.Query("next")),
+		Expires:  time.Now().Add(loginTimeout).Unix(),
+	}
+	setCookie(c, loginCookie, signCookie(state), "/", loginTimeout)
+
+	challenge := sha256.Sum256([]byte(state.Verifier))
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {cfg().OIDCClientID},
+		"redirect_uri":          {cfg().OIDCRedirectURL},
+		"scope":                 {"openid email profile"},
+		"state":                 {state.State},
+		"nonce":                 {state.Nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	separator := "?"
+	if strings.Contains(discovery.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return c.Redirect(discovery.AuthorizationEndpoint+separator+query.Encode(), fiber.StatusFound)
+}
+
+// handleLoginCallback completes the login: it exchanges the code for an ID
+// token, checks that the user is allowed and starts a session.
+func handleLoginCallback(c *fiber.Ctx) error {
+	if !oidcEnabled() {
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+	var state loginState
+	if !readCookie(c.Cookies(loginCookie), &state) || time.Now().Unix() >= state.Expires ||
+		!hmac.Equal([]byte(state.State), []byte(c.Query("state"))) {
+		return c.Status(400).JSON(fiber.Map{"code": 400, "message": "Login expired or started elsewhere, please try again"})
+	}
+	setCookie(c, loginCookie, "", "/", 0)
+	if reason := c.Query("error"); reason != "" {
+		return c.Status(401).JSON(fiber.Map{"code": 401, "message": "Login failed: " + reason})
+	}
+
+	claims, err := exchangeCode(c.Query("code"), state)
+	if err != nil {
+		log.Printf("Error completing login: %v", err)
+		return c.Status(401).JSON(fiber.Map{"code": 401, "message": "Login failed"})
+	}
+	user := newSessionUser(claims)
+	if !userAllowed(user) {
+		log.Printf("Login of %s refused, not in OIDC_ALLOWED_USERS", user.actor())
+		return c.Status(403).JSON(fiber.Map{"code": 403, "message": "Your account may not use this server"})
+	}
+
+	setCookie(c, sessionCookie, signCookie(user), "/", cfg().OIDCSessionTTL)
+	writeAudit(auditEntry{Actor: user.actor(), IP: c.IP(), Action: "session.login"})
+	return c.Redirect(state.Next, fiber.StatusFound)
+}
+
+// exchangeCode redeems an authorization code at the token endpoint and
+// returns the claims of the verified ID token.
+func exchangeCode(code string, state loginState) (idClaims, error) {
+	discovery, err := oidc.discover()
+	if err != nil {
+		return idClaims{}, err
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {cfg().OIDCRedirectURL},
+		"code_verifier": {state.Verifier},
+	}
+	req, err := http.NewRequest(http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return idClaims{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(cfg().OIDCClientID), url.QueryEscape(cfg().OIDCClientSecret))
+
+	resp, err := oidcClient.Do(req)
+	if err != nil {
+		return idClaims{}, err
+	}
+	defer resp.Body.Close()
+	var tokens struct {
+		IDToken     string `json:"id_token"`
+		Error       string `json:"error"`
+		Description string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokens); err != nil {
+		return idClaims{}, fmt.Errorf("invalid token response (%s): %w", resp.Status, err)
+	}
+	if tokens.IDToken == "" {
+		return idClaims{}, fmt.Errorf("no ID token (%s): %s %s", resp.Status, tokens.Error, tokens.Description)
+	}
+	return verifyIDToken(tokens.IDToken, state.Nonce)
+}
+
+// handleLogout ends the session.
+func handleLogout(c *fiber.Ctx) error {
+	if user, ok := currentSession(c); ok {
+		writeAudit(auditEntry{Actor: user.actor(), IP: c.IP(), Action: "session.logout"})
+	}
+	setCookie(c, sessionCookie, "", "/", 0)
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func registerLoginRoutes(app *fiber.App) {
+	app.Get("/auth/login", handleLogin)
+	app.Get("/auth/callback", handleLoginCallback)
+	app.Post("/auth/logout", handleLogout)
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// testProvider is an OIDC provider serving discovery and a key set.
+type testProvider struct {
+	server *httptest.Server
+	rsa    *rsa.PrivateKey
+	ec     *ecdsa.PrivateKey
+	weak   *rsa.PrivateKey
+}
+
+// newTestProvider starts a provider with an RSA key "rsa", a P-256 key "ec"
+// and a 1024-bit RSA key "weak", and makes it the OIDC_ISSUER of a test.
+func newTestProvider(t *testing.T) *testProvider {
+	t.Helper()
+	p := &testProvider{}
+	var err error
+	if p.rsa, err = rsa.GenerateKey(rand.Reader, 2048); err != nil {
+		t.Fatal(err)
+	}
+	if p.weak, err = rsa.GenerateKey(rand.Reader, 1024); err != nil {
+		t.Fatal(err)
+	}
+	if p.ec, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader); err != nil {
+		t.Fatal(err)
+	}
+	encode := func(n *big.Int) string { return base64.RawURLEncoding.EncodeToString(n.Bytes()) }
+	rsaKey := func(id string, key *rsa.PublicKey) jsonWebKey {
+		return jsonWebKey{ID: id, Type: "RSA", Use: "sig", N: encode(key.N), E: encode(big.NewInt(int64(key.E)))}
+	}
+	keys := []jsonWebKey{
+		rsaKey("rsa", &p.rsa.PublicKey),
+		rsaKey("weak", &p.weak.PublicKey),
+		{ID: "ec", Type: "EC", Curve: "P-256", X: encode(p.ec.X), Y: encode(p.ec.Y)},
+	}
+
+	mux := http.NewServeMux()
+	p.server = httptest.NewServer(mux)
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(oidcDiscovery{Issuer: p.server.URL, JWKSURI: p.server.URL + "/keys"})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"keys": keys})
+	})
+
+	previous := oidc
+	oidc = &oidcProvider{}
+	withConfig(t, func(c *Config) {
+		c.OIDCIssuer = p.server.URL
+		c.OIDCClientID = "deeplx"
+	})
+	t.Cleanup(func() {
+		oidc = previous
+		p.server.Close()
+	})
+	return p
+}
+
+// sign returns an ID token with the claims, signed with the key named in
+// kid using alg.
+func (p *testProvider) sign(t *testing.T, alg, kid string, claims map[string]any) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	var signature []byte
+	var err error
+	switch kid {
+	case "rsa", "weak":
+		key := p.rsa
+		if kid == "weak" {
+			key = p.weak
+		}
+		signature, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	case "ec":
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, p.ec, digest[:])
+		signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// TestVerifyIDToken checks the signature, algorithm, issuer, audience,
+// expiry and nonce checks of ID tokens.
+func TestVerifyIDToken(t *testing.T) {
+	p := newTestProvider(t)
+	claims := func(change func(map[string]any)) map[string]any {
+		c := map[string]any{
+			"iss":   p.server.URL,
+			"aud":   "deeplx",
+			"exp":   time.Now().Add(time.Hour).Unix(),
+			"nonce": "n0nce",
+			"sub":   "user-1",
+		}
+		if change != nil {
+			change(c)
+		}
+		return c
+	}
+	tamper := func(token string) string {
+		parts := strings.Split(token, ".")
+		payload, _ := json.Marshal(claims(func(c map[string]any) { c["sub"] = "admin" }))
+		return parts[0] + "." + base64.RawURLEncoding.EncodeToString(payload) + "." + parts[2]
+	}
+	// swapAlgorithm keeps the RSA signature but names another algorithm.
+	swapAlgorithm := func(token, alg string) string {
+		parts := strings.Split(token, ".")
+		header, _ := json.Marshal(map[string]string{"alg": alg, "kid": "rsa"})
+		return base64.RawURLEncoding.EncodeToString(header) + "." + parts[1] + "." + parts[2]
+	}
+
+	for _, test := range []struct {
+		name  string
+		token string
+		valid bool
+	}{
+		{"RS256", p.sign(t, "RS256", "rsa", claims(nil)), true},
+		{"ES256", p.sign(t, "ES256", "ec", claims(nil)), true},
+		{"audience in a list", p.sign(t, "RS256", "rsa", claims(func(c map[string]any) { c["aud"] = []string{"other", "deeplx"} })), true},
+		{"expired within leeway", p.sign(t, "RS256", "rsa", claims(func(c map[string]any) { c["exp"] = time.Now().Add(-30 * time.Second).Unix() })), true},
+		{"tampered claims", tamper(p.sign(t, "RS256", "rsa", claims(nil))), false},
+		{"algorithm of another key", p.sign(t, "ES256", "rsa", claims(nil)), false},
+		{"HS256", swapAlgorithm(p.sign(t, "RS256", "rsa", claims(nil)), "HS256"), false},
+		{"none", swapAlgorithm(p.sign(t, "RS256", "rsa", claims(nil)), "none"), false},
+		{"weak RSA key", p.sign(t, "RS256", "weak", claims(nil)), false},
+		{"wrong issuer", p.sign(t, "RS256", "rsa", claims(func(c map[string]any) { c["iss"] = "https://evil.example" })), false},
+		{"wrong audience", p.sign(t, "RS256", "rsa", claims(func(c map[string]any) { c["aud"] = "other" })), false},
+		{"expired", p.sign(t, "RS256", "rsa", claims(func(c map[string]any) { c["exp"] = time.Now().Add(-2 * time.Minute).Unix() })), false},
+		{"wrong nonce", p.sign(t, "RS256", "rsa", claims(func(c map[string]any) { c["nonce"] = "other" })), false},
+		{"no subject", p.sign(t, "RS256", "rsa", claims(func(c map[string]any) { delete(c, "sub") })), false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			verified, err := verifyIDToken(test.token, "n0nce")
+			if test.valid && (err != nil || verified.Subject != "user-1") {
+				t.Errorf("rejected: %v", err)
+			}
+			if !test.valid && err == nil {
+				t.Errorf("accepted %+v", verified)
+			}
+		})
+	}
+}
+
+// TestSessionUserEmail checks that only verified addresses reach the session.
+func TestSessionUserEmail(t *testing.T) {
+	verified, unverified := true, false
+	for _, test := range []struct {
+		name     string
+		verified *bool
+		want     string
+	}{
+		{"verified", &verified, "ana@example.com"},
+		{"unverified", &unverified, ""},
+		{"not stated", nil, ""},
+	} {
+		user := newSessionUser(idClaims{Subject: "ana", Email: "ana@example.com", EmailVerified: test.verified})
+		if user.Email != test.want {
+			t.Errorf("%s: email %q, want %q", test.name, user.Email, test.want)
+		}
+	}
+
+	withConfig(t, func(c *Config) { c.OIDCAllowedUsers = []string{"@example.com"} })
+	if userAllowed(newSessionUser(idClaims{Subject: "eve", Email: "eve@example.com"})) {
+		t.Error("an address without email_verified was allowed")
+	}
+}
+
+// TestUILogin checks that with OIDC, only logged in users get the web UI.
+func TestUILogin(t *testing.T) {
+	withConfig(t, func(c *Config) {
+		c.OIDCIssuer = "https://login.example"
+		c.OIDCClientID = "deeplx"
+		c.OIDCClientSecret = "s3cret"
+		c.OIDCRedirectURL = "https://deeplx.example/auth/callback"
+		c.OIDCAllowedUsers = []string{"ana"}
+	})
+	app := fiber.New()
+	app.Get("/ui", handleUI)
+
+	response, err := app.Test(httptest.NewRequest(http.MethodGet, "/ui", nil), -1)
+	if err != nil || response.StatusCode != fiber.StatusFound || response.Header.Get(fiber.HeaderLocation) != "/auth/login?next=/ui" {
+		t.Errorf("without a session: %v %v", response.StatusCode, response.Header.Get(fiber.HeaderLocation))
+	}
+
+	request := httptest.NewRequest(http.MethodGet, "/ui", nil)
+	request.AddCookie(&http.Cookie{Name: sessionCookie, Value: signCookie(sessionUser{Subject: "ana", Expires: time.Now().Add(time.Hour).Unix()})})
+	if response, err := app.Test(request, -1); err != nil || response.StatusCode != 200 {
+		t.Errorf("with a session: status %v, %v", response.StatusCode, err)
+	}
+}
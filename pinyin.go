@@ -0,0 +1,231 @@
+package main
+
+// basePinyin romanizes common Chinese characters, and words whose
+// characters are read otherwise in them, so Chinese is romanized without
+// ROMANIZE_DIR. Words of a zh.tsv in ROMANIZE_DIR take precedence over the
+// same or shorter words here.
+var basePinyin = newRomanizationDict(map[string]string{
+	// Characters, the most frequent first.
+	"的": "de", "一": "yī", "是": "shì", "不": "bù", "了": "le", "人": "rén", "我": "wǒ", "在": "zài", "有": "yǒu", "他": "tā",
+	"这": "zhè", "个": "gè", "们": "men", "中": "zhōng", "来": "lái", "上": "shàng", "大": "dà", "为": "wèi", "和": "hé", "国": "guó",
+	"地": "dì", "到": "dào", "以": "yǐ", "说": "shuō", "时": "shí", "要": "yào", "就": "jiù", "出": "chū", "会": "huì", "可": "kě",
+	"也": "yě", "你": "nǐ", "对": "duì", "生": "shēng", "能": "néng", "而": "ér", "子": "zǐ", "那": "nà", "得": "de", "于": "yú",
+	"着": "zhe", "下": "xià", "自": "zì", "之": "zhī", "年": "nián", "过": "guò", "发": "fā", "后": "hòu", "作": "zuò", "里": "lǐ",
+	"用": "yòng", "道": "dào", "行": "xíng", "所": "suǒ", "然": "rán", "家": "jiā", "种": "zhǒng", "事": "shì", "成": "chéng", "方": "fāng",
+	"多": "duō", "经": "jīng", "么": "me", "去": "qù", "法": "fǎ", "学": "xué", "如": "rú", "都": "dōu", "同": "tóng", "现": "xiàn",
+	"当": "dāng", "没": "méi", "动": "dòng", "面": "miàn", "起": "qǐ", "看": "kàn", "定": "dìng", "天": "tiān", "分": "fēn", "还": "hái",
+	"进": "jìn", "好": "hǎo", "小": "xiǎo", "部": "bù", "其": "qí", "些": "xiē", "主": "zhǔ", "样": "yàng", "理": "lǐ", "心": "xīn",
+	"她": "tā", "本": "běn", "前": "qián", "开": "kāi", "但": "dàn", "因": "yīn", "只": "zhǐ", "从": "cóng", "想": "xiǎng", "实": "shí",
+	"日": "rì", "军": "jūn", "者": "zhě", "意": "yì", "无": "wú", "力": "lì", "它": "tā", "与": "yǔ", "长": "cháng", "把": "bǎ",
+	"机": "jī", "十": "shí", "民": "mín", "第": "dì", "公": "gōng", "此": "cǐ", "已": "yǐ", "工": "gōng", "使": "shǐ", "情": "qíng",
+	"明": "míng", "性": "xìng", "知": "zhī", "全": "quán", "三": "sān", "又": "yòu", "关": "guān", "点": "diǎn", "正": "zhèng", "业": "yè",
+	"外": "wài", "将": "jiāng", "两": "liǎng", "高": "gāo", "间": "jiān", "由": "yóu", "问": "wèn", "很": "hěn", "最": "zuì", "重": "zhòng",
+	"并": "bìng", "物": "wù", "手": "shǒu", "应": "yīng", "战": "zhàn", "向": "xiàng", "头": "tóu", "文": "wén", "体": "tǐ", "政": "zhèng",
+	"美": "měi", "相": "xiāng", "见": "jiàn", "被": "bèi", "利": "lì", "什": "shén", "二": "èr", "等": "děng", "产": "chǎn", "或": "huò",
+	"新": "xīn", "己": "jǐ", "制": "zhì", "身": "shēn", "果": "guǒ", "加": "jiā", "西": "xī", "斯": "sī", "月": "yuè", "话": "huà",
+	"合": "hé", "回": "huí", "特": "tè", "代": "dài", "内": "nèi", "信": "xìn", "表": "biǎo", "化": "huà", "老": "lǎo", "给": "gěi",
+	"世": "shì", "位": "wèi", "次": "cì", "度": "dù", "门": "mén", "任": "rèn", "常": "cháng", "先": "xiān", "海": "hǎi", "通": "tōng",
+	"教": "jiào", "儿": "ér", "原": "yuán", "东": "dōng", "声": "shēng", "提": "tí", "立": "lì", "及": "jí", "比": "bǐ", "员": "yuán",
+	"解": "jiě", "水": "shuǐ", "名": "míng", "真": "zhēn", "论": "lùn", "处": "chù", "走": "zǒu", "义": "yì", "各": "gè", "入": "rù",
+	"几": "jǐ", "口": "kǒu", "认": "rèn", "条": "tiáo", "平": "píng", "系": "xì", "气": "qì", "题": "tí", "活": "huó", "尔": "ěr",
+	"更": "gèng", "别": "bié", "打": "dǎ", "女": "nǚ", "变": "biàn", "四": "sì", "神": "shén", "总": "zǒng", "何": "hé", "电": "diàn",
+	"数": "shù", "安": "ān", "少": "shǎo", "报": "bào", "才": "cái", "结": "jié", "反": "fǎn", "受": "shòu", "目": "mù", "太": "tài",
+	"量": "liàng", "再": "zài", "感": "gǎn", "建": "jiàn", "务": "wù", "做": "zuò", "接": "jiē", "必": "bì", "场": "chǎng", "件": "jiàn",
+	"计": "jì", "管": "guǎn", "期": "qī", "市": "shì", "直": "zhí", "德": "dé", "资": "zī", "命": "mìng", "山": "shān", "金": "jīn",
+	"指": "zhǐ", "克": "kè", "许": "xǔ", "统": "tǒng", "区": "qū", "保": "bǎo", "至": "zhì", "队": "duì", "形": "xíng", "社": "shè",
+	"便": "biàn", "空": "kōng", "决": "jué", "治": "zhì", "展": "zhǎn", "马": "mǎ", "科": "kē", "司": "sī", "五": "wǔ", "基": "jī",
+	"眼": "yǎn", "书": "shū", "非": "fēi", "则": "zé", "听": "tīng", "白": "bái", "却": "què", "界": "jiè", "达": "dá", "光": "guāng",
+	"放": "fàng", "强": "qiáng", "即": "jí", "像": "xiàng", "难": "nán", "且": "qiě", "权": "quán", "思": "sī", "王": "wáng", "象": "xiàng",
+	"完": "wán", "设": "shè", "式": "shì", "色": "sè", "路": "lù", "记": "jì", "南": "nán", "品": "pǐn", "住": "zhù", "告": "gào",
+	"类": "lèi", "求": "qiú", "据": "jù", "程": "chéng", "北": "běi", "边": "biān", "死": "sǐ", "张": "zhāng", "该": "gāi", "交": "jiāo",
+	"规": "guī", "万": "wàn", "取": "qǔ", "拉": "lā", "格": "gé", "望": "wàng", "觉": "jué", "术": "shù", "领": "lǐng", "共": "gòng",
+	"确": "què", "传": "chuán", "师": "shī", "观": "guān", "清": "qīng", "今": "jīn", "切": "qiè", "院": "yuàn", "让": "ràng", "识": "shí",
+	"候": "hòu", "带": "dài", "导": "dǎo", "争": "zhēng", "运": "yùn", "笑": "xiào", "飞": "fēi", "风": "fēng", "步": "bù", "改": "gǎi",
+	"收": "shōu", "根": "gēn", "干": "gàn", "造": "zào", "言": "yán", "联": "lián", "持": "chí", "组": "zǔ", "每": "měi", "济": "jì",
+	"车": "chē", "亲": "qīn", "极": "jí", "林": "lín", "服": "fú", "快": "kuài", "办": "bàn", "议": "yì", "往": "wǎng", "元": "yuán",
+	"英": "yīng", "士": "shì", "证": "zhèng", "近": "jìn", "失": "shī", "转": "zhuǎn", "夫": "fū", "令": "lìng", "准": "zhǔn", "布": "bù",
+	"始": "shǐ", "怎": "zěn", "呢": "ne", "存": "cún", "未": "wèi", "远": "yuǎn", "叫": "jiào", "台": "tái", "单": "dān", "影": "yǐng",
+	"具": "jù", "罗": "luó", "字": "zì", "爱": "ài", "击": "jī", "流": "liú", "备": "bèi", "兵": "bīng", "连": "lián", "调": "diào",
+	"深": "shēn", "商": "shāng", "算": "suàn", "质": "zhì", "团": "tuán", "集": "jí", "百": "bǎi", "需": "xū", "价": "jià", "花": "huā",
+	"党": "dǎng", "华": "huá", "城": "chéng", "石": "shí", "级": "jí", "整": "zhěng", "府": "fǔ", "离": "lí", "况": "kuàng", "亚": "yà",
+	"请": "qǐng", "技": "jì", "际": "jì", "约": "yuē", "示": "shì", "复": "fù", "病": "bìng", "息": "xī", "究": "jiū", "线": "xiàn",
+	"似": "sì", "官": "guān", "火": "huǒ", "断": "duàn", "精": "jīng", "满": "mǎn", "支": "zhī", "视": "shì", "消": "xiāo", "越": "yuè",
+	"器": "qì", "容": "róng", "照": "zhào", "须": "xū", "九": "jiǔ", "增": "zēng", "研": "yán", "写": "xiě", "称": "chēng", "企": "qǐ",
+	"八": "bā", "功": "gōng", "吗": "ma", "包": "bāo", "片": "piàn", "史": "shǐ", "委": "wěi", "乎": "hū", "查": "chá", "轻": "qīng",
+	"易": "yì", "早": "zǎo", "曾": "céng", "除": "chú", "农": "nóng", "找": "zhǎo", "装": "zhuāng", "广": "guǎng", "显": "xiǎn", "吧": "ba",
+	"阿": "ā", "李": "lǐ", "标": "biāo", "谈": "tán", "吃": "chī", "图": "tú", "念": "niàn", "六": "liù", "引": "yǐn", "历": "lì",
+	"首": "shǒu", "医": "yī", "局": "jú", "突": "tū", "专": "zhuān", "费": "fèi", "号": "hào", "尽": "jìn", "另": "lìng", "周": "zhōu",
+	"较": "jiào", "注": "zhù", "语": "yǔ", "仅": "jǐn", "考": "kǎo", "落": "luò", "青": "qīng", "随": "suí", "选": "xuǎn", "列": "liè",
+	"武": "wǔ", "红": "hóng", "响": "xiǎng", "虽": "suī", "推": "tuī", "势": "shì", "参": "cān", "希": "xī", "古": "gǔ", "众": "zhòng",
+	"构": "gòu", "房": "fáng", "半": "bàn", "节": "jié", "土": "tǔ", "投": "tóu", "某": "mǒu", "案": "àn", "黑": "hēi", "维": "wéi",
+	"革": "gé", "划": "huà", "敌": "dí", "致": "zhì", "陈": "chén", "律": "lǜ", "足": "zú", "态": "tài", "护": "hù", "七": "qī",
+	"兴": "xīng", "派": "pài", "孩": "hái", "验": "yàn", "责": "zé", "营": "yíng", "星": "xīng", "够": "gòu", "章": "zhāng", "音": "yīn",
+	"跟": "gēn", "志": "zhì", "底": "dǐ", "站": "zhàn", "严": "yán", "巴": "bā", "例": "lì", "防": "fáng", "族": "zú", "供": "gōng",
+	"效": "xiào", "续": "xù", "施": "shī", "留": "liú", "讲": "jiǎng", "型": "xíng", "料": "liào", "终": "zhōng", "答": "dá", "紧": "jǐn",
+	"黄": "huáng", "绝": "jué", "奇": "qí", "察": "chá", "母": "mǔ", "京": "jīng", "段": "duàn", "依": "yī", "批": "pī", "群": "qún",
+	"项": "xiàng", "故": "gù", "按": "àn", "河": "hé", "米": "mǐ", "围": "wéi", "江": "jiāng", "织": "zhī", "害": "hài", "斗": "dòu",
+	"双": "shuāng", "境": "jìng", "客": "kè", "纪": "jì", "采": "cǎi", "举": "jǔ", "杀": "shā", "攻": "gōng", "父": "fù", "苏": "sū",
+	"密": "mì", "低": "dī", "朝": "cháo", "友": "yǒu", "诉": "sù", "止": "zhǐ", "细": "xì", "愿": "yuàn", "千": "qiān", "值": "zhí",
+	"仍": "réng", "男": "nán", "钱": "qián", "破": "pò", "网": "wǎng", "热": "rè", "助": "zhù", "倒": "dào", "育": "yù", "属": "shǔ",
+	"坐": "zuò", "帝": "dì", "限": "xiàn", "船": "chuán", "脸": "liǎn", "职": "zhí", "速": "sù", "刻": "kè", "乐": "lè", "否": "fǒu",
+	"刚": "gāng", "威": "wēi", "毛": "máo", "状": "zhuàng", "率": "lǜ", "甚": "shèn", "独": "dú", "球": "qiú", "般": "bān", "普": "pǔ",
+	"怕": "pà", "弹": "dàn", "校": "xiào", "苦": "kǔ", "创": "chuàng", "假": "jiǎ", "久": "jiǔ", "错": "cuò", "承": "chéng", "印": "yìn",
+	"晚": "wǎn", "兰": "lán", "试": "shì", "股": "gǔ", "拿": "ná", "脑": "nǎo", "预": "yù", "谁": "shéi", "益": "yì", "阳": "yáng",
+	"若": "ruò", "哪": "nǎ", "微": "wēi", "尼": "ní", "继": "jì", "送": "sòng", "急": "jí", "血": "xuè", "惊": "jīng", "伤": "shāng",
+	"素": "sù", "药": "yào", "适": "shì", "波": "bō", "夜": "yè", "省": "shěng", "初": "chū", "喜": "xǐ", "卫": "wèi", "源": "yuán",
+	"食": "shí", "险": "xiǎn", "待": "dài", "述": "shù", "陆": "lù", "习": "xí", "置": "zhì", "居": "jū", "劳": "láo", "财": "cái",
+	"环": "huán", "排": "pái", "福": "fú", "纳": "nà", "欢": "huān", "雷": "léi", "警": "jǐng", "获": "huò", "模": "mó", "充": "chōng",
+	"负": "fù", "云": "yún", "停": "tíng", "木": "mù", "游": "yóu", "龙": "lóng", "树": "shù", "疑": "yí", "层": "céng", "冷": "lěng",
+	"洲": "zhōu", "冲": "chōng", "射": "shè", "略": "lüè", "范": "fàn", "竟": "jìng", "句": "jù", "室": "shì", "异": "yì", "激": "jī",
+	"汉": "hàn", "村": "cūn", "哈": "hā", "策": "cè", "演": "yǎn", "简": "jiǎn", "卡": "kǎ", "罪": "zuì", "判": "pàn", "担": "dān",
+	"州": "zhōu", "静": "jìng", "退": "tuì", "既": "jì", "衣": "yī", "您": "nín", "宗": "zōng", "积": "jī", "余": "yú", "痛": "tòng",
+	"检": "jiǎn", "差": "chà", "富": "fù", "灵": "líng", "协": "xié", "角": "jiǎo", "占": "zhàn", "配": "pèi", "征": "zhēng", "修": "xiū",
+	"皮": "pí", "挥": "huī", "胜": "shèng", "降": "jiàng", "阶": "jiē", "审": "shěn", "沉": "chén", "坚": "jiān", "善": "shàn", "妈": "mā",
+	"刘": "liú", "读": "dú", "啊": "a", "超": "chāo", "免": "miǎn", "压": "yā", "银": "yín", "买": "mǎi", "皇": "huáng", "养": "yǎng",
+	"伊": "yī", "怀": "huái", "执": "zhí", "副": "fù", "乱": "luàn", "抗": "kàng", "犯": "fàn", "追": "zhuī", "帮": "bāng", "宣": "xuān",
+	"佛": "fó", "岁": "suì", "航": "háng", "优": "yōu", "怪": "guài", "香": "xiāng", "著": "zhù", "田": "tián", "铁": "tiě", "控": "kòng",
+	"税": "shuì", "左": "zuǒ", "右": "yòu", "份": "fèn", "穿": "chuān", "艺": "yì", "背": "bèi", "阵": "zhèn", "草": "cǎo", "脚": "jiǎo",
+	"概": "gài", "恶": "è", "块": "kuài", "顿": "dùn", "敢": "gǎn", "守": "shǒu", "酒": "jiǔ", "岛": "dǎo", "托": "tuō", "央": "yāng",
+	"户": "hù", "烈": "liè", "洋": "yáng", "哥": "gē", "索": "suǒ", "胡": "hú", "款": "kuǎn", "靠": "kào", "评": "píng", "版": "bǎn",
+	"宝": "bǎo", "座": "zuò", "释": "shì", "景": "jǐng", "顾": "gù", "弟": "dì", "登": "dēng", "货": "huò", "互": "hù", "付": "fù",
+	"伯": "bó", "慢": "màn", "欧": "ōu", "换": "huàn", "闻": "wén", "危": "wēi", "忙": "máng", "核": "hé", "暗": "àn", "姐": "jiě",
+	"介": "jiè", "坏": "huài", "讨": "tǎo", "丽": "lì", "良": "liáng", "序": "xù", "升": "shēng", "监": "jiān", "临": "lín", "亮": "liàng",
+	"露": "lù", "永": "yǒng", "呼": "hū", "味": "wèi", "野": "yě", "架": "jià", "域": "yù", "沙": "shā", "掉": "diào", "括": "kuò",
+	"舰": "jiàn", "鱼": "yú", "杂": "zá", "误": "wù", "湾": "wān", "吉": "jí", "减": "jiǎn", "编": "biān", "楚": "chǔ", "肯": "kěn",
+	"测": "cè", "败": "bài", "屋": "wū", "跑": "pǎo", "梦": "mèng", "散": "sàn", "温": "wēn", "困": "kùn", "剑": "jiàn", "渐": "jiàn",
+	"封": "fēng", "救": "jiù", "贵": "guì", "枪": "qiāng", "缺": "quē", "楼": "lóu", "县": "xiàn", "尚": "shàng", "毫": "háo", "移": "yí",
+	"娘": "niáng", "朋": "péng", "画": "huà", "班": "bān", "智": "zhì", "亦": "yì", "耳": "ěr", "恩": "ēn", "短": "duǎn", "掌": "zhǎng",
+	"恐": "kǒng", "遗": "yí", "固": "gù", "席": "xí", "松": "sōng", "秘": "mì", "谢": "xiè", "鲁": "lǔ", "遇": "yù", "康": "kāng",
+	"虑": "lǜ", "幸": "xìng", "均": "jūn", "销": "xiāo", "钟": "zhōng", "诗": "shī", "藏": "cáng", "赶": "gǎn", "剧": "jù", "票": "piào",
+	"损": "sǔn", "忽": "hū", "巨": "jù", "炮": "pào", "旧": "jiù", "端": "duān", "探": "tàn", "湖": "hú", "录": "lù", "叶": "yè",
+	"春": "chūn", "乡": "xiāng", "附": "fù", "吸": "xī", "予": "yǔ", "礼": "lǐ", "港": "gǎng", "雨": "yǔ", "呀": "ya", "板": "bǎn",
+	"庭": "tíng", "妇": "fù", "归": "guī", "睛": "jīng", "饭": "fàn", "额": "é", "含": "hán", "顺": "shùn", "输": "shū", "摇": "yáo",
+	"招": "zhāo", "婚": "hūn", "脱": "tuō", "补": "bǔ", "谓": "wèi", "督": "dū", "毒": "dú", "油": "yóu", "疗": "liáo", "旅": "lǚ",
+	"泽": "zé", "材": "cái", "灭": "miè", "逐": "zhú", "莫": "mò", "笔": "bǐ", "亡": "wáng", "鲜": "xiān", "词": "cí", "圣": "shèng",
+	"择": "zé", "寻": "xún", "厂": "chǎng", "睡": "shuì", "博": "bó", "勒": "lè", "烟": "yān", "授": "shòu", "诺": "nuò", "伦": "lún",
+	"岸": "àn", "奥": "ào", "唐": "táng", "卖": "mài", "俄": "é", "炸": "zhà", "载": "zài", "洛": "luò", "健": "jiàn", "堂": "táng",
+	"旁": "páng", "宫": "gōng", "喝": "hē", "借": "jiè", "君": "jūn", "禁": "jìn", "阴": "yīn", "园": "yuán", "谋": "móu", "宋": "sòng",
+	"避": "bì", "抓": "zhuā", "荣": "róng", "姑": "gū", "孙": "sūn", "逃": "táo", "牙": "yá", "束": "shù", "跳": "tiào", "顶": "dǐng",
+	"玉": "yù", "镇": "zhèn", "雪": "xuě", "午": "wǔ", "练": "liàn", "迫": "pò", "爷": "yé", "篇": "piān", "肉": "ròu", "嘴": "zuǐ",
+	"馆": "guǎn", "遍": "biàn", "凡": "fán", "础": "chǔ", "洞": "dòng", "卷": "juǎn", "坦": "tǎn", "牛": "niú", "宁": "níng", "纸": "zhǐ",
+	"诸": "zhū", "训": "xùn", "私": "sī", "庄": "zhuāng", "祖": "zǔ", "丝": "sī", "翻": "fān", "暴": "bào", "森": "sēn", "塔": "tǎ",
+	"默": "mò", "握": "wò", "戏": "xì", "隐": "yǐn", "熟": "shú", "骨": "gǔ", "访": "fǎng", "弱": "ruò", "蒙": "méng", "歌": "gē",
+	"店": "diàn", "鬼": "guǐ", "软": "ruǎn", "典": "diǎn", "欲": "yù", "萨": "sà", "伙": "huǒ", "遭": "zāo", "盘": "pán", "爸": "bà",
+	"扩": "kuò", "盖": "gài", "弄": "nòng", "雄": "xióng", "稳": "wěn", "忘": "wàng", "亿": "yì", "刺": "cì", "拥": "yōng", "徒": "tú",
+	"姆": "mǔ", "杨": "yáng", "齐": "qí", "赛": "sài", "趣": "qù", "曲": "qǔ", "刀": "dāo", "床": "chuáng", "迎": "yíng", "冰": "bīng",
+	"虚": "xū", "玩": "wán", "析": "xī", "窗": "chuāng", "醒": "xǐng", "妻": "qī", "透": "tòu", "购": "gòu", "替": "tì", "塞": "sāi",
+	"努": "nǔ", "休": "xiū", "虎": "hǔ", "扬": "yáng", "途": "tú", "侵": "qīn", "刑": "xíng", "绿": "lǜ", "兄": "xiōng", "迅": "xùn",
+	"套": "tào", "贸": "mào", "毕": "bì", "唯": "wéi", "谷": "gǔ", "轮": "lún", "库": "kù", "迹": "jì", "尤": "yóu", "竞": "jìng",
+	"街": "jiē", "促": "cù", "延": "yán", "震": "zhèn", "弃": "qì", "甲": "jiǎ", "伟": "wěi", "麻": "má", "川": "chuān", "申": "shēn",
+	"缓": "huǎn", "潜": "qián", "闪": "shǎn", "售": "shòu", "灯": "dēng", "针": "zhēn", "哲": "zhé", "络": "luò", "抵": "dǐ", "朱": "zhū",
+	"埃": "āi", "抱": "bào", "鼓": "gǔ", "植": "zhí", "纯": "chún", "夏": "xià", "忍": "rěn", "页": "yè", "杰": "jié", "筑": "zhù",
+	"折": "zhé", "郑": "zhèng", "贝": "bèi", "尊": "zūn", "吴": "wú", "秀": "xiù", "混": "hùn", "臣": "chén", "雅": "yǎ", "振": "zhèn",
+	"染": "rǎn", "盛": "shèng", "怒": "nù", "舞": "wǔ", "圆": "yuán", "搞": "gǎo", "狂": "kuáng", "措": "cuò", "姓": "xìng", "残": "cán",
+	"秋": "qiū", "培": "péi", "迷": "mí", "诚": "chéng", "宽": "kuān", "宇": "yǔ", "猛": "měng", "摆": "bǎi", "梅": "méi", "毁": "huǐ",
+	"伸": "shēn", "摩": "mó", "盟": "méng", "末": "mò", "乃": "nǎi", "悲": "bēi", "拍": "pāi", "丁": "dīng", "赵": "zhào", "硬": "yìng",
+	"麦": "mài", "蒋": "jiǎng", "操": "cāo", "耶": "yē", "阻": "zǔ", "订": "dìng", "彩": "cǎi", "抽": "chōu", "赞": "zàn", "魔": "mó",
+	"纷": "fēn", "沿": "yán", "喊": "hǎn", "违": "wéi", "妹": "mèi", "浪": "làng", "汇": "huì", "币": "bì", "丰": "fēng", "蓝": "lán",
+	"殊": "shū", "献": "xiàn", "桌": "zhuō", "啦": "la", "瓦": "wǎ", "莱": "lái", "援": "yuán", "译": "yì", "夺": "duó", "汽": "qì",
+	"烧": "shāo", "距": "jù", "裁": "cái", "偏": "piān", "符": "fú", "勇": "yǒng", "触": "chù", "课": "kè", "敬": "jìng", "哭": "kū",
+	"懂": "dǒng", "墙": "qiáng", "袭": "xí", "召": "zhào", "罚": "fá", "侠": "xiá", "厅": "tīng", "拜": "bài", "巧": "qiǎo", "侧": "cè",
+	"韩": "hán", "冒": "mào", "债": "zhài", "曼": "màn", "融": "róng", "惯": "guàn", "享": "xiǎng", "戴": "dài", "童": "tóng", "犹": "yóu",
+	"乘": "chéng", "挂": "guà", "奖": "jiǎng", "绍": "shào", "厚": "hòu", "纵": "zòng", "障": "zhàng", "讯": "xùn", "涉": "shè", "彻": "chè",
+	"刊": "kān", "丈": "zhàng", "爆": "bào", "乌": "wū", "役": "yì", "描": "miáo", "洗": "xǐ", "玛": "mǎ", "患": "huàn", "妙": "miào",
+	"镜": "jìng", "唱": "chàng", "烦": "fán", "签": "qiān", "仙": "xiān", "彼": "bǐ", "弗": "fú", "症": "zhèng", "仿": "fǎng", "倾": "qīng",
+	"牌": "pái", "陷": "xiàn", "鸟": "niǎo", "轰": "hōng", "咱": "zán", "菜": "cài", "闭": "bì", "奋": "fèn", "庆": "qìng", "撤": "chè",
+	"泪": "lèi", "茶": "chá", "疾": "jí", "缘": "yuán", "播": "bō", "朗": "lǎng", "杜": "dù", "奶": "nǎi", "季": "jì", "丹": "dān",
+	"狗": "gǒu", "尾": "wěi", "仪": "yí", "偷": "tōu", "奔": "bēn", "珠": "zhū", "虫": "chóng", "驻": "zhù", "孔": "kǒng", "宜": "yí",
+	"艾": "ài", "桥": "qiáo", "淡": "dàn", "翼": "yì", "恨": "hèn", "繁": "fán", "寒": "hán", "伴": "bàn", "叹": "tàn", "旦": "dàn",
+	"愈": "yù", "潮": "cháo", "粮": "liáng", "缩": "suō", "罢": "bà", "聚": "jù", "径": "jìng", "恰": "qià", "挑": "tiāo", "袋": "dài",
+	"灰": "huī", "捕": "bǔ", "徐": "xú", "珍": "zhēn", "幕": "mù", "映": "yìng", "裂": "liè", "泰": "tài", "隔": "gé", "启": "qǐ",
+	"尖": "jiān", "忠": "zhōng", "累": "lèi", "炎": "yán", "暂": "zàn", "估": "gū", "泛": "fàn", "荒": "huāng", "偿": "cháng", "横": "héng",
+	"拒": "jù", "瑞": "ruì", "忆": "yì", "孤": "gū", "鼻": "bí", "闹": "nào", "羊": "yáng", "呆": "dāi", "厉": "lì", "衡": "héng",
+	"胞": "bāo", "零": "líng", "穷": "qióng", "舍": "shě", "码": "mǎ", "赫": "hè", "婆": "pó", "魂": "hún", "灾": "zāi", "洪": "hóng",
+	"腿": "tuǐ", "胆": "dǎn", "津": "jīn", "俗": "sú", "辩": "biàn", "胸": "xiōng", "晓": "xiǎo", "劲": "jìn", "贫": "pín", "仁": "rén",
+	"偶": "ǒu", "辑": "jí", "邦": "bāng", "恢": "huī", "赖": "lài", "圈": "quān", "摸": "mō", "仰": "yǎng", "润": "rùn", "堆": "duī",
+	"碰": "pèng", "艇": "tǐng", "稍": "shāo", "迟": "chí", "辆": "liàng", "废": "fèi", "净": "jìng", "凶": "xiōng", "署": "shǔ", "壁": "bì",
+	"御": "yù", "奉": "fèng", "旋": "xuán", "冬": "dōng", "矿": "kuàng", "抬": "tái", "蛋": "dàn", "晨": "chén", "伏": "fú", "吹": "chuī",
+	"鸡": "jī", "倍": "bèi", "糊": "hú", "秦": "qín", "盾": "dùn", "杯": "bēi", "租": "zū", "骑": "qí", "乏": "fá", "隆": "lóng",
+	"诊": "zhěn", "奴": "nú", "摄": "shè", "丧": "sàng", "污": "wū", "渡": "dù", "旗": "qí", "甘": "gān", "耐": "nài", "凭": "píng",
+	"扎": "zhā", "抢": "qiǎng", "绪": "xù", "粗": "cū", "肩": "jiān", "梁": "liáng", "幻": "huàn", "菲": "fēi", "皆": "jiē", "碎": "suì",
+	"宙": "zhòu", "叔": "shū", "岩": "yán", "荡": "dàng", "综": "zōng", "爬": "pá", "荷": "hé", "悉": "xī", "蒂": "dì", "返": "fǎn",
+	"井": "jǐng", "壮": "zhuàng", "薄": "báo", "悄": "qiāo", "扫": "sǎo", "敏": "mǐn", "碍": "ài", "殖": "zhí", "详": "xiáng", "迪": "dí",
+	"矛": "máo", "霍": "huò", "允": "yǔn", "幅": "fú", "撒": "sā", "剩": "shèng", "凯": "kǎi", "颗": "kē", "骂": "mà", "赏": "shǎng",
+	"液": "yè", "番": "fān", "箱": "xiāng", "贴": "tiē", "漫": "màn", "酸": "suān", "郎": "láng", "腰": "yāo", "舒": "shū", "眉": "méi",
+	"忧": "yōu", "浮": "fú", "辛": "xīn", "恋": "liàn", "餐": "cān", "吓": "xià", "挺": "tǐng", "励": "lì", "辞": "cí", "艘": "sōu",
+	"键": "jiàn", "伍": "wǔ", "峰": "fēng", "尺": "chǐ", "昨": "zuó", "黎": "lí", "辈": "bèi", "贯": "guàn", "侦": "zhēn", "滑": "huá",
+	"券": "quàn", "崇": "chóng", "扰": "rǎo", "宪": "xiàn", "绕": "rào", "趋": "qū", "慈": "cí", "乔": "qiáo", "阅": "yuè", "汗": "hàn",
+	"枝": "zhī", "拖": "tuō", "墨": "mò", "胁": "xié", "插": "chā", "箭": "jiàn", "腊": "là", "粉": "fěn", "泥": "ní", "氏": "shì",
+	"彭": "péng", "拔": "bá", "骗": "piàn", "凤": "fèng", "慧": "huì", "媒": "méi", "佩": "pèi", "愤": "fèn", "扑": "pū", "龄": "líng",
+	"驱": "qū", "惜": "xī", "豪": "háo", "掩": "yǎn", "兼": "jiān", "跃": "yuè", "尸": "shī", "肃": "sù", "帕": "pà", "驶": "shǐ",
+	"堡": "bǎo", "届": "jiè", "欣": "xīn", "惠": "huì", "册": "cè", "储": "chǔ", "飘": "piāo", "桑": "sāng", "闲": "xián", "惨": "cǎn",
+	"洁": "jié", "踪": "zōng", "勃": "bó", "宾": "bīn", "频": "pín", "仇": "chóu", "磨": "mó", "递": "dì", "邪": "xié", "撞": "zhuàng",
+	"拟": "nǐ", "滚": "gǔn", "奏": "zòu", "巡": "xún", "颜": "yán", "剂": "jì", "绩": "jì", "贡": "gòng", "疯": "fēng", "坡": "pō",
+	"瞧": "qiáo", "截": "jié", "燃": "rán", "焦": "jiāo", "殿": "diàn", "伪": "wěi", "柳": "liǔ", "锁": "suǒ", "逼": "bī", "颇": "pō",
+	"昏": "hūn", "劝": "quàn", "呈": "chéng", "搜": "sōu", "勤": "qín", "戒": "jiè", "驾": "jià", "漂": "piāo", "饮": "yǐn", "曹": "cáo",
+	"朵": "duǒ", "仔": "zǎi", "柔": "róu", "俩": "liǎ", "孟": "mèng", "腐": "fǔ", "幼": "yòu", "践": "jiàn", "籍": "jí", "牧": "mù",
+	"凉": "liáng", "牲": "shēng", "佳": "jiā", "娜": "nà", "浓": "nóng", "芳": "fāng", "稿": "gǎo", "竹": "zhú", "腹": "fù", "跌": "diē",
+	"逻": "luó", "垂": "chuí", "遵": "zūn", "脉": "mài", "貌": "mào", "柏": "bǎi", "狱": "yù", "猜": "cāi", "怜": "lián", "惑": "huò",
+	"陶": "táo", "兽": "shòu", "帐": "zhàng", "饰": "shì", "贷": "dài", "昌": "chāng", "叙": "xù", "躺": "tǎng", "钢": "gāng", "沟": "gōu",
+	"寄": "jì", "扶": "fú", "铺": "pū", "邓": "dèng", "寿": "shòu", "惧": "jù", "询": "xún", "汤": "tāng", "盗": "dào", "肥": "féi",
+	"尝": "cháng", "匆": "cōng", "辉": "huī", "奈": "nài", "扣": "kòu", "廷": "tíng", "澳": "ào", "嘛": "ma", "董": "dǒng", "迁": "qiān",
+	"凝": "níng", "慰": "wèi", "厌": "yàn", "脏": "zāng", "腾": "téng", "幽": "yōu", "怨": "yuàn", "鞋": "xié", "丢": "diū", "埋": "mái",
+	"泉": "quán", "涌": "yǒng", "辖": "xiá", "躲": "duǒ", "晋": "jìn", "紫": "zǐ", "艰": "jiān", "魏": "wèi", "吾": "wú", "慌": "huāng",
+	"祝": "zhù", "邮": "yóu", "吐": "tǔ", "狠": "hěn", "鉴": "jiàn", "曰": "yuē", "械": "xiè", "咬": "yǎo", "邻": "lín", "赤": "chì",
+	"挤": "jǐ", "弯": "wān", "椅": "yǐ", "陪": "péi", "割": "gē", "揭": "jiē", "韦": "wéi", "悟": "wù", "聪": "cōng", "雾": "wù",
+	"锋": "fēng", "梯": "tī", "猫": "māo", "祥": "xiáng", "阔": "kuò", "誉": "yù", "筹": "chóu", "丛": "cóng", "牵": "qiān", "鸣": "míng",
+	"沈": "shěn", "阁": "gé", "穆": "mù", "屈": "qū", "旨": "zhǐ", "袖": "xiù", "猎": "liè", "臂": "bì", "蛇": "shé", "贺": "hè",
+	"柱": "zhù", "抛": "pāo", "鼠": "shǔ", "瑟": "sè", "戈": "gē", "牢": "láo", "逊": "xùn", "迈": "mài", "欺": "qī", "吨": "dūn",
+	"琴": "qín", "衰": "shuāi", "瓶": "píng", "恼": "nǎo", "燕": "yàn", "仲": "zhòng", "诱": "yòu", "狼": "láng", "池": "chí", "疼": "téng",
+	"卢": "lú", "仗": "zhàng", "冠": "guān", "粒": "lì", "遥": "yáo", "吕": "lǚ", "玄": "xuán", "尘": "chén", "冯": "féng", "抚": "fǔ",
+	"浅": "qiǎn", "敦": "dūn", "纠": "jiū", "钻": "zuān", "晶": "jīng", "岂": "qǐ", "峡": "xiá", "苍": "cāng", "喷": "pēn", "耗": "hào",
+	"凌": "líng", "敲": "qiāo", "菌": "jūn", "赔": "péi", "涂": "tú", "粹": "cuì", "扁": "biǎn", "亏": "kuī", "寂": "jì", "煤": "méi",
+	"熊": "xióng", "恭": "gōng", "湿": "shī", "循": "xún", "暖": "nuǎn", "糖": "táng", "赋": "fù", "抑": "yì", "秩": "zhì", "帽": "mào",
+	"哀": "āi", "宿": "sù", "踏": "tà", "烂": "làn", "袁": "yuán", "侯": "hóu", "抖": "dǒu", "夹": "jiā", "昆": "kūn", "肝": "gān",
+	"擦": "cā", "猪": "zhū", "炼": "liàn", "恒": "héng", "慎": "shèn", "搬": "bān", "纽": "niǔ", "纹": "wén", "玻": "bō", "渔": "yú",
+	"磁": "cí", "铜": "tóng", "齿": "chǐ", "跨": "kuà", "押": "yā", "怖": "bù", "漠": "mò", "疲": "pí", "叛": "pàn", "遣": "qiǎn",
+	"兹": "zī", "祭": "jì", "醉": "zuì", "拳": "quán", "弥": "mí", "斜": "xié", "档": "dàng", "稀": "xī", "捷": "jié", "肤": "fū",
+	"疫": "yì", "肿": "zhǒng", "豆": "dòu", "削": "xuē", "岗": "gǎng", "晃": "huàng", "吞": "tūn", "宏": "hóng", "癌": "ái", "肚": "dù",
+	"隶": "lì", "履": "lǚ", "涨": "zhǎng", "耀": "yào", "扭": "niǔ", "坛": "tán", "拨": "bō", "沃": "wò", "绘": "huì", "伐": "fá",
+	"堪": "kān", "仆": "pú", "郭": "guō", "牺": "xī", "歼": "jiān", "墓": "mù", "雇": "gù", "廉": "lián", "契": "qì", "拼": "pīn",
+	"惩": "chéng", "捉": "zhuō", "覆": "fù", "刷": "shuā", "劫": "jié", "嫌": "xián", "瓜": "guā", "歇": "xiē", "雕": "diāo", "闷": "mèn",
+	"乳": "rǔ", "串": "chuàn", "娃": "wá", "缴": "jiǎo", "唤": "huàn", "赢": "yíng", "莲": "lián", "霸": "bà", "桃": "táo", "妥": "tuǒ",
+	"瘦": "shòu", "搭": "dā", "赴": "fù", "岳": "yuè", "嘉": "jiā", "舱": "cāng", "俊": "jùn", "址": "zhǐ", "庞": "páng", "耕": "gēng",
+	"锐": "ruì", "缝": "fèng", "悔": "huǐ", "邀": "yāo", "玲": "líng", "惟": "wéi", "斥": "chì", "宅": "zhái", "添": "tiān", "挖": "wā",
+	"呵": "hē", "讼": "sòng", "氧": "yǎng", "浩": "hào", "羽": "yǔ", "斤": "jīn", "酷": "kù", "掠": "lüè", "妖": "yāo", "祸": "huò",
+	"侍": "shì", "乙": "yǐ", "妨": "fáng", "贪": "tān", "挣": "zhèng", "汪": "wāng", "尿": "niào", "莉": "lì", "悬": "xuán", "唇": "chún",
+	"翰": "hàn", "仓": "cāng", "轨": "guǐ", "枚": "méi", "盐": "yán", "览": "lǎn", "傅": "fù", "帅": "shuài", "庙": "miào", "芬": "fēn",
+	"屏": "píng", "寺": "sì", "胖": "pàng", "璃": "lí", "愚": "yú", "滴": "dī", "疏": "shū", "萧": "xiāo", "姿": "zī", "颤": "chàn",
+	"丑": "chǒu", "劣": "liè", "柯": "kē", "寸": "cùn", "扔": "rēng", "盯": "dīng", "辱": "rǔ", "匹": "pǐ", "俱": "jù", "辨": "biàn",
+	"饿": "è", "蜂": "fēng", "哦": "ó", "腔": "qiāng", "郁": "yù", "溃": "kuì", "谨": "jǐn", "糟": "zāo", "葛": "gé", "苗": "miáo",
+	"肠": "cháng", "忌": "jì", "溜": "liū", "鸿": "hóng", "爵": "jué", "鹏": "péng", "鹰": "yīng", "笼": "lóng", "丘": "qiū", "桂": "guì",
+	"滋": "zī", "聊": "liáo", "挡": "dǎng", "纲": "gāng", "肌": "jī", "茨": "cí", "壳": "ké", "痕": "hén", "碗": "wǎn", "穴": "xué",
+	"膀": "bǎng", "卧": "wò", "罩": "zhào", "谱": "pǔ", "捧": "pěng", "虹": "hóng", "湘": "xiāng", "哎": "āi", "逢": "féng", "嘿": "hēi",
+	"浙": "zhè", "沪": "hù", "粤": "yuè", "闽": "mǐn", "鲍": "bào", "婴": "yīng", "卓": "zhuó", "芝": "zhī", "拓": "tuò", "冈": "gāng",
+	"冻": "dòng", "饱": "bǎo", "旬": "xún", "肺": "fèi", "吵": "chǎo", "锦": "jǐn", "勾": "gōu", "瞬": "shùn", "寓": "yù", "诞": "dàn",
+	"涛": "tāo", "敞": "chǎng", "秒": "miǎo", "拾": "shí", "蜜": "mì", "惹": "rě", "瞎": "xiā", "姻": "yīn", "诈": "zhà", "柴": "chái",
+	"鞭": "biān", "戚": "qī", "饼": "bǐng", "谊": "yì", "卜": "bǔ", "宴": "yàn", "嫁": "jià", "熙": "xī", "贼": "zéi", "萄": "táo",
+	"葡": "pú", "柜": "guì", "锅": "guō", "瓷": "cí", "蓄": "xù", "芽": "yá", "坑": "kēng", "狐": "hú", "膜": "mó", "脆": "cuì",
+	"桶": "tǒng", "哇": "wa", "蚁": "yǐ", "蝶": "dié", "蝴": "hú", "咖": "kā", "啡": "fēi", "蕉": "jiāo", "橙": "chéng", "柠": "níng",
+	"檬": "méng", "莓": "méi", "梨": "lí", "杏": "xìng", "枣": "zǎo", "薯": "shǔ", "葱": "cōng", "蒜": "suàn", "椒": "jiāo", "醋": "cù",
+	"酱": "jiàng", "汁": "zhī", "泳": "yǒng", "渴": "kě", "裤": "kù", "厨": "chú", "厕": "cè", "俺": "ǎn", "喂": "wèi", "嗨": "hāi",
+	"拐": "guǎi", "澡": "zǎo", "筷": "kuài", "勺": "sháo", "甜": "tián", "咸": "xián", "辣": "là", "饺": "jiǎo", "馒": "mán", "粥": "zhōu",
+	"糕": "gāo", "啤": "pí", "苹": "píng",
+
+	// Words.
+	"什么": "shén me", "为什么": "wèi shén me", "因为": "yīn wèi", "为了": "wèi le", "成为": "chéng wéi", "认为": "rèn wéi",
+	"以为": "yǐ wéi", "作为": "zuò wéi", "银行": "yín háng", "长大": "zhǎng dà", "校长": "xiào zhǎng", "觉得": "jué de",
+	"睡觉": "shuì jiào", "还是": "hái shì", "了解": "liǎo jiě", "音乐": "yīn yuè", "乐器": "yuè qì", "会计": "kuài jì",
+	"得到": "dé dào", "获得": "huò dé", "取得": "qǔ dé", "重新": "chóng xīn", "重复": "chóng fù", "着急": "zháo jí",
+	"睡着": "shuì zháo", "的确": "dí què", "目的": "mù dì", "爱好": "ài hào", "好奇": "hào qí", "朝鲜": "cháo xiǎn",
+	"便宜": "pián yi", "空调": "kōng tiáo", "调整": "tiáo zhěng", "差不多": "chà bu duō", "出差": "chū chāi", "头发": "tóu fa",
+	"大夫": "dài fu", "角色": "jué sè", "首都": "shǒu dū", "都市": "dū shì", "干净": "gān jìng", "饼干": "bǐng gān",
+	"几乎": "jī hū", "应用": "yìng yòng", "教书": "jiāo shū", "弹琴": "tán qín", "尽管": "jǐn guǎn", "处理": "chǔ lǐ",
+	"假期": "jià qī", "放假": "fàng jià", "照相": "zhào xiàng", "西藏": "xī zàng", "东西": "dōng xi", "朋友": "péng you",
+	"谢谢": "xiè xie", "妈妈": "mā ma", "爸爸": "bà ba", "哥哥": "gē ge", "姐姐": "jiě jie", "弟弟": "dì di",
+	"妹妹": "mèi mei", "先生": "xiān sheng", "衣服": "yī fu", "地方": "dì fang", "时候": "shí hou", "漂亮": "piào liang",
+	"意思": "yì si", "认识": "rèn shi", "知道": "zhī dào", "一样": "yī yàng", "不客气": "bù kè qi", "种植": "zhòng zhí",
+	"行业": "háng yè", "高兴": "gāo xìng", "喜欢": "xǐ huan", "明白": "míng bai", "月亮": "yuè liang", "学生": "xué sheng",
+	"孩子": "hái zi", "桌子": "zhuō zi", "椅子": "yǐ zi", "儿子": "ér zi", "妻子": "qī zi", "房子": "fáng zi",
+	"鼻子": "bí zi", "杯子": "bēi zi", "日子": "rì zi", "样子": "yàng zi", "馒头": "mán tou", "石头": "shí tou",
+})
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// pluginRequest is written to a plugin's standard input as one line of
+// JSON per translation.
+type pluginRequest struct {
+	ID         int64    `json:"id"`
+	Texts      []string `json:"texts"`
+	SourceLang string   `json:"source_lang"`
+	TargetLang string   `json:"target_lang"`
+}
+
+// pluginReply is read from a plugin's standard output, one line of JSON per
+// request, in any order.
+type pluginReply struct {
+	ID         int64    `json:"id"`
+	Texts      []string `json:"texts"`
+	SourceLang string   `json:"source_lang"`
+	Error      string   `json:"error"`
+}
+
+// pluginEngine translates with an external program. PLUGIN_INSTANCES copies
+// of it run, and each request goes to the one with the fewest requests in
+// flight.
+type pluginEngine struct {
+	name      string
+	instances []*pluginProcess
+}
+
+// loadPlugins registers every executable file of dir as an engine named
+// after the file, without its extension.
+func loadPlugins(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || !info.Mode().IsRegular() || !isExecutable(info) {
+			continue
+		}
+		name := strings.ToLower(strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name())))
+		if _, ok := engines[name]; ok {
+			return fmt.Errorf("plugin %s conflicts with engine %s", entry.Name(), name)
+		}
+
+		plugin := &pluginEngine{name: name}
+		for range max(cfg().PluginInstances, 1) {
+			plugin.instances = append(plugin.instances, &pluginProcess{
+				name: name,
+				path: filepath.Join(dir, entry.Name()),
+			})
+		}
+		engines[name] = plugin
+		log.Printf("Loaded plugin engine %s", name)
+	}
+	return nil
+}
+
+func (e *pluginEngine) translate(params TranslateParams, texts []string) (upstreamResult, error) {
+	var result upstreamResult
+
+	process := e.instances[0]
+	for _, instance := range e.instances[1:] {
+		if instance.inFlight.Load() < process.inFlight.Load() {
+			process = instance
+		}
+	}
+	reply, err := process.call(pluginRequest{Texts: texts, SourceLang: params.SourceLang, TargetLang: params.TargetLang})
+	if err != nil {
+		log.Printf("Error calling plugin %s: %v", e.name, err)
+		return result, &translateError{Code: 500, Message: "Request failed"}
+	}
+	if reply.Error != "" {
+		return result, &translateError{Code: 500, Message: reply.Error}
+	}
+	if len(reply.Texts) != len(texts) {
+		log.Printf("Plugin %s returned %d texts for %d", e.name, len(reply.Texts), len(texts))
+		return result, &translateError{Code: 500, Message: "Failed to decode response"}
+	}
+
+	for _, text := range reply.Texts {
+		result.Result.Texts = append(result.Result.Texts, upstreamText{Text: text})
+	}
+	result.Result.Lang = reply.SourceLang
+	return result, nil
+}
+
+// pluginProcess is a running copy of a plugin. It is started on first use,
+// and again on the next request after it exits.
+type pluginProcess struct {
+	name     string
+	path     string
+	inFlight atomic.Int64
+	nextID   atomic.Int64
+
+	mu      sync.Mutex
+	stdin   io.WriteCloser
+	pending map[int64]chan pluginReply
+}
+
+func (p *pluginProcess) call(request pluginRequest) (pluginReply, error) {
+	p.inFlight.Add(1)
+	defer p.inFlight.Add(-1)
+
+	request.ID = p.nextID.Add(1)
+	line, err := jsonMarshal(request)
+	if err != nil {
+		return pluginReply{}, err
+	}
+	replies := make(chan pluginReply, 1)
+
+	p.mu.Lock()
+	if p.stdin == nil {
+		if err := p.start(); err != nil {
+			p.mu.Unlock()
+			return pluginReply{}, err
+		}
+	}
+	p.pending[request.ID] = replies
+	_, err = p.stdin.Write(append(line, '\n'))
+	p.mu.Unlock()
+	if err != nil {
+		p.forget(request.ID)
+		return pluginReply{}, err
+	}
+
+	timer := time.NewTimer(cfg().PluginTimeout)
+	defer timer.Stop()
+	select {
+	case reply, ok := <-replies:
+		if !ok {
+			return pluginReply{}, errors.New("plugin exited")
+		}
+		return reply, nil
+	case <-timer.C:
+		p.forget(request.ID)
+		return pluginReply{}, fmt.Errorf("no reply within %v", cfg().PluginTimeout)
+	}
+}
+
+func (p *pluginProcess) forget(id int64) {
+	p.mu.Lock()
+	delete(p.pending, id)
+	p.mu.Unlock()
+}
+
+// start runs the plugin. Callers must hold p.mu.
+func (p *pluginProcess) start() error {
+	cmd := exec.Command(p.path)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	p.stdin = stdin
+	p.pending = make(map[int64]chan pluginReply)
+	go p.read(cmd, stdin, stdout)
+	return nil
+}
+
+// read delivers the replies of the plugin until it exits, then fails the
+// requests still waiting.
+func (p *pluginProcess) read(cmd *exec.Cmd, stdin io.WriteCloser, stdout io.Reader) {
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(nil, 16<<20)
+	for scanner.Scan() {
+		var reply pluginReply
+		if err := jsonUnmarshal(scanner.Bytes(), &reply); err != nil {
+			log.Printf("Error decoding reply of plugin %s: %v", p.name, err)
+			continue
+		}
+		p.mu.Lock()
+		if replies, ok := p.pending[reply.ID]; ok {
+			delete(p.pending, reply.ID)
+			replies <- reply
+		}
+		p.mu.Unlock()
+	}
+
+	stdin.Close()
+	err := cmd.Wait()
+	log.Printf("Plugin %s exited: %v", p.name, err)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, replies := range p.pending {
+		close(replies)
+	}
+	p.pending = nil
+	p.stdin = nil
+}
@@ -0,0 +1,11 @@
+package main
+
+import (
+	"io/fs"
+	"path/filepath"
+	"strings"
+)
+
+func isExecutable(info fs.FileInfo) bool {
+	return strings.EqualFold(filepath.Ext(info.Name()), ".exe")
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+	"unicode"
+	"unicode/utf8"
+)
+
+// profanityFilter masks or flags words from a configured wordlist in the
+// translated output.
+type profanityFilter struct {
+	words map[string]struct{}
+	mask  bool
+}
+
+// profanity is the filter in effect, or nil when none is configured. It is
+// replaced when the config is reloaded.
+var profanity atomic.Pointer[profanityFilter]
+
+// loadProfanityFilter reads a wordlist with one word per line. Blank lines
+// and lines starting with # are ignored.
+func loadProfanityFilter(path, mode string) (*profanityFilter, error) {
+	if mode != "mask" && mode != "flag" {
+		return nil, fmt.Errorf("invalid profanity mode %q, expected mask or flag", mode)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open profanity wordlist: %w", err)
+	}
+	defer file.Close()
+
+	filter := &profanityFilter{
+		words: make(map[string]struct{}),
+		mask:  mode == "mask",
+	}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		word := strings.TrimSpace(scanner.Text())
+		if word == "" || strings.HasPrefix(word, "#") {
+			continue
+		}
+		filter.words[strings.ToLower(word)] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read profanity wordlist: %w", err)
+	}
+	return filter, nil
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsNumber(r) || r == '\''
+}
+
+// filter returns text with listed words masked (in mask mode) and whether
+// any listed word was found.
+func (f *profanityFilter) filter(text string) (string, bool) {
+	var out strings.Builder
+	found := false
+
+	for len(text) > 0 {
+		end := strings.IndexFunc(text, func(r rune) bool { return !isWordRune(r) })
+		if end == 0 {
+			_, size := utf8.DecodeRuneInString(text)
+			out.WriteString(text[:size])
+			text = text[size:]
+			continue
+		}
+		if end < 0 {
+			end = len(text)
+		}
+
+		word := text[:end]
+		if _, ok := f.words[strings.ToLower(word)]; ok {
+			found = true
+			if f.mask {
+				word = strings.Repeat("*", utf8.RuneCountInString(word))
+			}
+		}
+		out.WriteString(word)
+		text = text[end:]
+	}
+
+	return out.String(), found
+}
+
+// applyProfanityFilter filters every translated text of the response and
+// flags it when profanity was found.
+func applyProfanityFilter(response *TranslateResponse) {
+	filter := profanity.Load()
+	if filter == nil {
+		return
+	}
+
+	apply := func(text *string) {
+		filtered, found := filter.filter(*text)
+		*text = filtered
+		response.Profanity = response.Profanity || found
+	}
+
+	apply(&response.Data)
+	for i := range response.Alternatives {
+		apply(&response.Alternatives[i])
+	}
+	for i := range response.Sentences {
+		item := &response.Sentences[i]
+		apply(&item.Text)
+		for j := range item.Alternatives {
+			apply(&item.Alternatives[j])
+		}
+	}
+}
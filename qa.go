@@ -0,0 +1,79 @@
+package main
+
+import (
+	"log"
+	"math"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type QAResponse struct {
+	Code            int     `json:"code"`
+	Message         string  `json:"message"`
+	SourceLang      string  `json:"source_lang,omitempty"`
+	TargetLang      string  `json:"target_lang,omitempty"`
+	Translation     string  `json:"translation,omitempty"`
+	BackTranslation string  `json:"back_translation,omitempty"`
+	Similarity      float64 `json:"similarity"`
+	Suspect         bool    `json:"suspect"`
+}
+
+// backTranslate translates the text to the target language and back to the
+// source language, and scores how close the round trip is to the input.
+func backTranslate(params TranslateParams) QAResponse {
+	forward := translate(TranslateParams{
+		Text:       params.Text,
+		SourceLang: params.SourceLang,
+		TargetLang: params.TargetLang,
+		usageKey:   params.usageKey,
+	})
+	if forward.Code != 200 {
+		return QAResponse{Code: forward.Code, Message: forward.Message}
+	}
+	if forward.SourceLang == "" || strings.EqualFold(forward.SourceLang, "auto") {
+		return QAResponse{
+			Code:    400,
+			Message: "Could not detect the source language, please set source_lang",
+		}
+	}
+
+	backward := translate(TranslateParams{
+		Text:       forward.Data,
+		SourceLang: forward.TargetLang,
+		TargetLang: forward.SourceLang,
+		usageKey:   params.usageKey,
+	})
+	if backward.Code != 200 {
+		return QAResponse{Code: backward.Code, Message: backward.Message}
+	}
+
+	score := math.Round(similarity(params.Text, backward.Data)*100) / 100
+	return QAResponse{
+		Code:            200,
+		Message:         "success",
+		SourceLang:      forward.SourceLang,
+		TargetLang:      forward.TargetLang,
+		Translation:     forward.Data,
+		BackTranslation: backward.Data,
+		Similarity:      score,
+		Suspect:         score < cfg().QAThreshold,
+	}
+}
+
+func handleQA(c *fiber.Ctx) error {
+	var params TranslateParams
+	if err := c.BodyParser(&params); err != nil {
+		log.Printf("Error parsing request body: %v", err)
+		return c.Status(400).JSON(QAResponse{
+			Code:    400,
+			Message: "Invalid request body",
+		})
+	}
+
+	applyKeyDefaults(c, &params)
+	params.usageKey = meterRequest(c)
+	params.client = clientKey(c)
+	result := backTranslate(params)
+	return c.Status(result.Code).JSON(result)
+}
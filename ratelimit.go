@@ -0,0 +1,125 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/limiter"
+)
+
+// clientKey identifies the caller by its signing key or by its bearer token
+// when it is one of API_TOKENS, falling back to the client IP, so that made
+// up tokens don't get fresh budgets. Tokens are hashed so they never end up
+// in limiter storage.
+func clientKey(c *fiber.Ctx) string {
+	if id, ok := c.Locals(signingKeyLocal).(string); ok {
+		return "signed:" + id
+	}
+	if token, ok := strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Bearer "); ok {
+		if _, known := lookupAPIToken(token); known {
+			sum := sha256.Sum256([]byte(token))
+			return "key:" + hex.EncodeToString(sum[:8])
+		}
+	}
+	return "ip:" + c.IP()
+}
+
+// lookupAPIToken returns the entry of API_TOKENS matching token.
+func lookupAPIToken(token string) (apiToken, bool) {
+	var match apiToken
+	valid := false
+	for _, known := range cfg().APITokens {
+		// Every token is compared, so the time taken doesn't tell which
+		// one matched.
+		if subtle.ConstantTimeCompare([]byte(token), []byte(known.Token)) == 1 {
+			match, valid = known, true
+		}
+	}
+	return match, token != "" && valid
+}
+
+// newRateLimiter limits each caller to cfg().RateLimit requests per window. The
+// limiter reports the budget in X-RateLimit-Limit, X-RateLimit-Remaining and
+// X-RateLimit-Reset headers.
+func newRateLimiter() fiber.Handler {
+	if cfg().RateLimit <= 0 {
+		return func(c *fiber.Ctx) error {
+			return c.Next()
+		}
+	}
+
+	return limiter.New(limiter.Config{
+		Max:          cfg().RateLimit,
+		Expiration:   cfg().RateLimitWindow,
+		KeyGenerator: clientKey,
+		Storage:      sharedStore,
+		LimitReached: func(c *fiber.Ctx) error {
+			return c.Status(429).JSON(TranslateResponse{
+				Code:    429,
+				Message: "Too many requests, please try again later.",
+			})
+		},
+	})
+}
+
+// currentLimiter holds the limiter of the current config. It is rebuilt when
+// a reload changes the limit, which resets counts not kept in Redis.
+var currentLimiter atomic.Value
+
+// rateLimit applies the current limiter.
+func rateLimit(c *fiber.Ctx) error {
+	return currentLimiter.Load().(fiber.Handler)(c)
+}
+
+// callerWindow counts the requests of a caller in the current window.
+type callerWindow struct {
+	Count int
+	Reset time.Time
+}
+
+// callerLimiter applies cfg().RateLimit to callers outside the HTTP API, such
+// as chat bot users. Counters live in sharedStore when Redis is configured,
+// so the limits hold across replicas.
+type callerLimiter struct {
+	mu      sync.Mutex
+	windows map[string]callerWindow
+}
+
+var callerLimits = &callerLimiter{windows: make(map[string]callerWindow)}
+
+// allow counts a request by the caller identified by key and reports
+// whether it is within the limit.
+func (l *callerLimiter) allow(key string) bool {
+	if cfg().RateLimit <= 0 {
+		return true
+	}
+
+	now := time.Now()
+	if counter, ok := sharedStore.(sharedCounter); ok {
+		// When Redis fails, the replica counts on its own.
+		if count, _, err := counter.Increment("limit:"+key, 1, now.Add(cfg().RateLimitWindow)); err == nil {
+			return count <= cfg().RateLimit
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	window := l.windows[key]
+	if !now.Before(window.Reset) {
+		window = callerWindow{Reset: now.Add(cfg().RateLimitWindow)}
+	}
+	window.Count++
+	for k, w := range l.windows {
+		if !now.Before(w.Reset) {
+			delete(l.windows, k)
+		}
+	}
+	l.windows[key] = window
+	return window.Count <= cfg().RateLimit
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryStore stands in for Redis as the shared store. Values set with an
+// expiry are kept regardless.
+type memoryStore struct {
+	mu      sync.Mutex
+	values  map[string][]byte
+	windows map[string]callerWindow
+}
+
+// withSharedStore makes a memoryStore the shared store for the length of a
+// test.
+func withSharedStore(t testing.TB) *memoryStore {
+	t.Helper()
+	store := &memoryStore{values: make(map[string][]byte), windows: make(map[string]callerWindow)}
+	previous := sharedStore
+	sharedStore = store
+	t.Cleanup(func() { sharedStore = previous })
+	return store
+}
+
+func (m *memoryStore) Increment(key string, n int, reset time.Time) (int, time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	window, ok := m.windows[key]
+	if !ok || !time.Now().Before(window.Reset) {
+		window = callerWindow{Reset: reset}
+	}
+	window.Count = max(window.Count+n, 0)
+	m.windows[key] = window
+	return window.Count, window.Reset, nil
+}
+
+func (m *memoryStore) Get(key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.values[key], nil
+}
+
+func (m *memoryStore) Set(key string, value []byte, _ time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.values[key] = value
+	return nil
+}
+
+func (m *memoryStore) Delete(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.values, key)
+	return nil
+}
+
+func (*memoryStore) Reset() error { return nil }
+func (*memoryStore) Close() error { return nil }
+
+// TestCallerLimiter checks that callers are limited separately, in memory and
+// through the shared store.
+func TestCallerLimiter(t *testing.T) {
+	withConfig(t, func(c *Config) {
+		c.RateLimit = 2
+		c.RateLimitWindow = time.Minute
+	})
+	for _, shared := range []bool{false, true} {
+		var store *memoryStore
+		if shared {
+			store = withSharedStore(t)
+		}
+		limits := &callerLimiter{windows: make(map[string]callerWindow)}
+		for i, want := range []bool{true, true, false} {
+			if got := limits.allow("chat:alice"); got != want {
+				t.Errorf("shared %v: request %d allowed = %v, want %v", shared, i+1, got, want)
+			}
+		}
+		if !limits.allow("chat:bob") {
+			t.Errorf("shared %v: another caller was limited", shared)
+		}
+		if shared && store.windows["limit:chat:alice"].Count != 3 {
+			t.Errorf("shared count = %+v, want 3", store.windows["limit:chat:alice"])
+		}
+		if shared && len(limits.windows) != 0 {
+			t.Errorf("shared limiter counted locally: %+v", limits.windows)
+		}
+	}
+}
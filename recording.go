@@ -0,0 +1,234 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// upstreamExchange is an upstream call saved by UPSTREAM_RECORD_DIR: the
+// JSON-RPC body the server built, byte for byte, and the answer it got.
+type upstreamExchange struct {
+	Recorded time.Time `json:"recorded"`
+	// Endpoint is the host called, without its path or credentials.
+	Endpoint string `json:"endpoint"`
+	Request  string `json:"request"`
+	Status   int    `json:"status"`
+	Response string `json:"response"`
+	// Redacted is set when LOG_REDACT_FILE rules changed the bodies, so the
+	// request no longer holds the texts its timestamp was derived from.
+	Redacted bool `json:"redacted,omitempty"`
+}
+
+// recordExchange saves an answered upstream call to UPSTREAM_RECORD_DIR,
+// with the LOG_REDACT_FILE rules applied to both bodies. Headers and
+// proxies are left out.
+func recordExchange(target *upstreamTarget, body string, reply upstreamReply) {
+	dir := cfg().UpstreamRecordDir
+	if dir == "" || reply.Err != nil {
+		return
+	}
+	exchange := upstreamExchange{
+		Recorded: time.Now().UTC(),
+		Endpoint: metricHost(target.Endpoint),
+		Request:  redact(body),
+		Status:   reply.Status,
+		Response: redact(string(reply.Body)),
+	}
+	exchange.Redacted = exchange.Request != body || exchange.Response != string(reply.Body)
+
+	data, err := json.MarshalIndent(exchange, "", "  ")
+	if err != nil {
+		log.Printf("Error recording upstream call: %v", err)
+		return
+	}
+	name := strconv.FormatInt(exchange.Recorded.UnixNano(), 10) + ".json"
+	if err := os.WriteFile(filepath.Join(dir, name), data, 0o600); err != nil {
+		log.Printf("Error recording upstream call: %v", err)
+	}
+}
+
+// loadExchanges reads the recorded calls of dir, in file name order, which
+// is the order they were recorded in.
+func loadExchanges(dir string) ([]upstreamExchange, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	exchanges := make([]upstreamExchange, 0, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var exchange upstreamExchange
+		if err := json.Unmarshal(data, &exchange); err != nil {
+			return nil, fmt.Errorf("%s: %w", filepath.Base(path), err)
+		}
+		exchanges = append(exchanges, exchange)
+	}
+	return exchanges, nil
+}
+
+// replayKey identifies a JSON-RPC request by what it asks for, leaving out
+// the id and timestamp, which change on every call.
+func replayKey(body string) (string, error) {
+	var request map[string]any
+	if err := json.Unmarshal([]byte(body), &request); err != nil {
+		return "", err
+	}
+	delete(request, "id")
+	if params, ok := request["params"].(map[string]any); ok {
+		delete(params, "timestamp")
+	}
+	key, err := json.Marshal(request)
+	return string(key), err
+}
+
+// checkRequestBody checks that a JSON-RPC body carries the quirks of the
+// DeepL web client the server imitates: a method it calls, an id in its
+// range, a timestamp rounded to a multiple of one more than the letters
+// counted by TIMESTAMP_ALGORITHM in the texts, and a space before the colon
+// after "method" for some ids. The timestamp isn't checked when the texts
+// were redacted.
+func checkRequestBody(body string, redacted bool) error {
+	var request struct {
+		Jsonrpc string `json:"jsonrpc"`
+		Method  string `json:"method"`
+		ID      int64  `json:"id"`
+		Params  struct {
+			Timestamp int64 `json:"timestamp"`
+		} `json:"params"`
+	}
+	if err := json.Unmarshal([]byte(body), &request); err != nil {
+		return err
+	}
+	var texts []string
+	timestamped := true
+	switch request.Method {
+	case "LMT_handle_texts":
+		var config RequestConfig
+		if err := json.Unmarshal([]byte(body), &config); err != nil {
+			return err
+		}
+		for _, text := range config.Params.Texts {
+			texts = append(texts, text.Text)
+		}
+	case "LMT_handle_jobs":
+		var jobs handleJobsRequest
+		if err := json.Unmarshal([]byte(body), &jobs); err != nil {
+			return err
+		}
+		for _, job := range jobs.Params.Jobs {
+			for _, sentence := range job.Sentences {
+				texts = append(texts, sentence.Text)
+			}
+		}
+	case "LMT_split_text":
+		timestamped = false
+	default:
+		return fmt.Errorf("unexpected method %q", request.Method)
+	}
+	if request.Jsonrpc != "2.0" {
+		return fmt.Errorf("unexpected jsonrpc %q", request.Jsonrpc)
+	}
+	if request.ID < 100000*1000 || request.ID >= 100000*1001 {
+		return fmt.Errorf("id %d is out of range", request.ID)
+	}
+
+	if strings.Contains(body, `"method" : "`) != methodSpaced(request.ID) {
+		return fmt.Errorf("method spacing doesn't match id %d", request.ID)
+	}
+
+	if timestamped && !redacted {
+		var count int64
+		for _, text := range texts {
+			count += timestampCount(text)
+		}
+		if count != 0 && request.Params.Timestamp%(count+1) != 0 {
+			return fmt.Errorf("timestamp %d is not a multiple of %d", request.Params.Timestamp, count+1)
+		}
+	}
+	return nil
+}
+
+func replayCommand() (*flag.FlagSet, func() error) {
+	flags := flag.NewFlagSet("replay", flag.ContinueOnError)
+	addr := flags.String("addr", "127.0.0.1:9000", "address to listen on")
+	dir := flags.String("dir", "", "directory of calls recorded with UPSTREAM_RECORD_DIR")
+
+	return flags, func() error {
+		if *dir == "" {
+			return errors.New("-dir is required")
+		}
+		handler, count, err := replayUpstream(*dir)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Replaying %d recorded calls; run the server with DEEPL_ENDPOINTS=http://%s/jsonrpc\n", count, *addr)
+		return http.ListenAndServe(*addr, handler)
+	}
+}
+
+// replayUpstream answers JSON-RPC calls with the recorded answer to the same
+// request, whatever its id and timestamp. Requests asked for more than once
+// get their recorded answers in turn, the last one repeating. Every request
+// is checked with checkRequestBody, so regressions in building them show up
+// in the log. Requests that weren't recorded get 404.
+func replayUpstream(dir string) (http.Handler, int, error) {
+	exchanges, err := loadExchanges(dir)
+	if err != nil {
+		return nil, 0, err
+	}
+	answers := make(map[string][]upstreamExchange)
+	for _, exchange := range exchanges {
+		key, err := replayKey(exchange.Request)
+		if err != nil {
+			return nil, 0, fmt.Errorf("recorded request from %v: %w", exchange.Recorded, err)
+		}
+		answers[key] = append(answers[key], exchange)
+	}
+
+	var mu sync.Mutex
+	served := make(map[string]int)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := checkRequestBody(string(body), false); err != nil {
+			log.Printf("Request doesn't look like the web client's: %v", err)
+		}
+		key, err := replayKey(string(body))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		recorded := answers[key]
+		n := served[key]
+		served[key]++
+		mu.Unlock()
+		if len(recorded) == 0 {
+			log.Printf("No recorded call for %s", body)
+			http.Error(w, "no recorded call for this request", http.StatusNotFound)
+			return
+		}
+		exchange := recorded[min(n, len(recorded)-1)]
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(exchange.Status)
+		io.WriteString(w, exchange.Response)
+	}), len(exchanges), nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// TestRecordedRequests checks the upstream calls recorded in
+// testdata/upstream, and that the requests built for the same texts today
+// still match them but for their id and timestamp.
+func TestRecordedRequests(t *testing.T) {
+	exchanges, err := loadExchanges("testdata/upstream")
+	if err != nil {
+		t.Fatalf("loading recordings: %v", err)
+	}
+	if len(exchanges) == 0 {
+		t.Fatal("no recordings in testdata/upstream")
+	}
+	for _, exchange := range exchanges {
+		if err := checkRequestBody(exchange.Request, exchange.Redacted); err != nil {
+			t.Errorf("recorded request %s: %v", exchange.Request, err)
+			continue
+		}
+		want, err := replayKey(exchange.Request)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var recorded RequestConfig
+		if err := json.Unmarshal([]byte(exchange.Request), &recorded); err != nil {
+			t.Fatal(err)
+		}
+		params := TranslateParams{
+			SourceLang: recorded.Params.Lang.SourceLangUserSelected,
+			TargetLang: recorded.Params.Lang.TargetLang,
+		}
+		var texts []string
+		for _, text := range recorded.Params.Texts {
+			texts = append(texts, text.Text)
+		}
+		// Ids are random, so enough requests are built to get both
+		// spellings of "method".
+		for i := 0; i < 100; i++ {
+			body, err := buildRequestBody(params, texts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := checkRequestBody(body, false); err != nil {
+				t.Fatalf("built request %s: %v", body, err)
+			}
+			if got, _ := replayKey(body); got != want {
+				t.Fatalf("built request %s differs from recorded %s", body, exchange.Request)
+			}
+		}
+	}
+}
+
+// TestReplayUpstream records calls to the mock upstream and replays them.
+func TestReplayUpstream(t *testing.T) {
+	dir := t.TempDir()
+	withConfig(t, func(config *Config) { config.UpstreamRecordDir = dir })
+	withUpstream(t, mockUpstream(0))
+	params := TranslateParams{SourceLang: "EN", TargetLang: "DE"}
+	texts := []string{"Sign in", "Forgot your password?"}
+	recorded, err := callDeepL(params, texts)
+	if err != nil {
+		t.Fatalf("calling the mock upstream: %v", err)
+	}
+
+	handler, count, err := replayUpstream(dir)
+	if err != nil {
+		t.Fatalf("loading recordings: %v", err)
+	}
+	if count != 1 {
+		t.Fatalf("recorded %d calls, want 1", count)
+	}
+	withConfig(t, func(config *Config) { config.UpstreamRecordDir = "" })
+	withUpstream(t, handler)
+	replayed, err := callDeepL(params, texts)
+	if err != nil {
+		t.Fatalf("calling the replayed upstream: %v", err)
+	}
+	if len(replayed.Result.Texts) != 2 || replayed.Result.Texts[1].Text != recorded.Result.Texts[1].Text {
+		t.Errorf("replayed %+v, recorded %+v", replayed, recorded)
+	}
+	if _, err := callDeepL(params, []string{"Unrecorded"}); err == nil {
+		t.Error("an unrecorded request was answered")
+	}
+}
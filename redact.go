@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"os"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// requestLogLimit caps the request and response bodies in a sampled
+// request log line.
+const requestLogLimit = 2048
+
+// redactedText replaces matches of rules without a replacement.
+const redactedText = "[REDACTED]"
+
+// redactionRule replaces matches of a pattern in log lines. The replacement
+// may refer to groups of the pattern as $1 or ${name}.
+type redactionRule struct {
+	pattern     *regexp.Regexp
+	replacement string
+}
+
+// redactions are the rules in effect, or nil when none are configured. They
+// are replaced when the config is reloaded.
+var redactions atomic.Pointer[[]redactionRule]
+
+// loadRedactionRules reads a file with one rule per line: a regular
+// expression, optionally followed by " => " and its replacement. Blank lines
+// and lines starting with # are ignored.
+func loadRedactionRules(path string) ([]redactionRule, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open redaction rules: %w", err)
+	}
+	defer file.Close()
+
+	var rules []redactionRule
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		expr, replacement, found := strings.Cut(text, " => ")
+		if !found {
+			replacement = redactedText
+		}
+		pattern, err := regexp.Compile(strings.TrimSpace(expr))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		rules = append(rules, redactionRule{pattern: pattern, replacement: strings.TrimSpace(replacement)})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read redaction rules: %w", err)
+	}
+	return rules, nil
+}
+
+// redact applies the rules in effect to a log line.
+func redact(line string) string {
+	rules := redactions.Load()
+	if rules == nil {
+		return line
+	}
+	for _, rule := range *rules {
+		line = rule.pattern.ReplaceAllString(line, rule.replacement)
+	}
+	return line
+}
+
+// redactingWriter redacts every line before it reaches a log sink.
+type redactingWriter struct {
+	w io.Writer
+}
+
+func (w redactingWriter) Write(p []byte) (int, error) {
+	if redactions.Load() == nil {
+		return w.w.Write(p)
+	}
+	if _, err := io.WriteString(w.w, redact(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// logSampledRequest logs the bodies of a share LOG_SAMPLE_RATE of requests
+// and their responses, for debugging on instances too busy to log every
+// request.
+func logSampledRequest(c *fiber.Ctx) error {
+	rate := cfg().LogSampleRate
+	if rate <= 0 || rand.Float64() >= rate {
+		return c.Next()
+	}
+	err := c.Next()
+	log.Printf("Request %s %s %s: %s -> %d %s", requestID(c), c.Method(), c.OriginalURL(),
+		loggedBody(c.Get(fiber.HeaderContentType), c.Body()),
+		c.Response().StatusCode(),
+		loggedBody(string(c.Response().Header.ContentType()), c.Response().Body()))
+	return err
+}
+
+// loggedBody returns a body for a log line: JSON and text bodies truncated
+// to requestLogLimit, and only the size of others such as uploads.
+func loggedBody(contentType string, body []byte) string {
+	if len(body) == 0 {
+		return "(empty)"
+	}
+	mediaType, _, _ := strings.Cut(strings.ToLower(contentType), ";")
+	mediaType = strings.TrimSpace(mediaType)
+	if mediaType != fiber.MIMEApplicationJSON && !strings.HasPrefix(mediaType, "text/") && mediaType != fiber.MIMEApplicationForm {
+		return fmt.Sprintf("(%d bytes of %s)", len(body), cmp.Or(mediaType, "unknown type"))
+	}
+	text := strings.ReplaceAll(string(body), "\n", `\n`)
+	if len(text) > requestLogLimit {
+		end := requestLogLimit
+		for end > 0 && !utf8.RuneStart(text[end]) {
+			end--
+		}
+		text = text[:end] + "…"
+	}
+	return text
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+const redisKeyPrefix = "deeplx:"
+
+// redisStorage implements fiber.Storage on top of Redis, so rate limits and
+// upstream cooldowns are shared by every replica using the same Redis.
+type redisStorage struct {
+	client *redis.Client
+}
+
+// sharedStore holds state shared between replicas. It is nil when no Redis
+// is configured and every replica keeps its own state.
+var sharedStore fiber.Storage
+
+// sharedCounter is implemented by shared stores that update counters in a
+// single step, so replicas counting at the same time don't overwrite each
+// other's counts.
+type sharedCounter interface {
+	// Increment adds n to the counter at key and returns the new count and
+	// when the counter expires. A new counter starts at 0 and expires at
+	// reset. Counts don't go below 0, and an n of 0 reads the counter.
+	Increment(key string, n int, reset time.Time) (int, time.Time, error)
+}
+
+// incrementScript adds ARGV[1] to the counter KEYS[1], letting a new one
+// expire at ARGV[2] in Unix milliseconds, and returns the count and the
+// milliseconds left. Redis runs scripts atomically.
+var incrementScript = redis.NewScript(`
+local count = redis.call("INCRBY", KEYS[1], ARGV[1])
+if count < 0 then
+	redis.call("SET", KEYS[1], 0)
+	count = 0
+end
+if redis.call("PTTL", KEYS[1]) < 0 then
+	redis.call("PEXPIREAT", KEYS[1], ARGV[2])
+end
+return {count, redis.call("PTTL", KEYS[1])}
+`)
+
+func newRedisStorage(rawURL string) (*redisStorage, error) {
+	options, err := redis.ParseURL(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redis url: %w", err)
+	}
+
+	client := redis.NewClient(options)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		return nil, fmt.Errorf("failed to connect to redis: %w", err)
+	}
+	return &redisStorage{client: client}, nil
+}
+
+func (s *redisStorage) Get(key string) ([]byte, error) {
+	if key == "" {
+		return nil, nil
+	}
+	value, err := s.client.Get(context.Background(), redisKeyPrefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	return value, err
+}
+
+func (s *redisStorage) Set(key string, value []byte, exp time.Duration) error {
+	if key == "" || len(value) == 0 {
+		return nil
+	}
+	return s.client.Set(context.Background(), redisKeyPrefix+key, value, exp).Err()
+}
+
+func (s *redisStorage) Increment(key string, n int, reset time.Time) (int, time.Time, error) {
+	now := time.Now()
+	values, err := incrementScript.Run(context.Background(), s.client, []string{redisKeyPrefix + key}, n, reset.UnixMilli()).Int64Slice()
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	return int(values[0]), now.Add(time.Duration(values[1]) * time.Millisecond), nil
+}
+
+func (s *redisStorage) Delete(key string) error {
+	if key == "" {
+		return nil
+	}
+	return s.client.Del(context.Background(), redisKeyPrefix+key).Err()
+}
+
+// Reset removes every key written by this storage, leaving other data in
+// the Redis database alone.
+func (s *redisStorage) Reset() error {
+	ctx := context.Background()
+	iter := s.client.Scan(ctx, 0, redisKeyPrefix+"*", 100).Iterator()
+	for iter.Next(ctx) {
+		if err := s.client.Del(ctx, iter.Val()).Err(); err != nil {
+			return err
+		}
+	}
+	return iter.Err()
+}
+
+func (s *redisStorage) Close() error {
+	return s.client.Close()
+}
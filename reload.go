@@ -0,0 +1,221 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// configReloadDelay lets an editor finish writing the config file before it
+// is read.
+const configReloadDelay = 250 * time.Millisecond
+
+var reloadMu sync.Mutex
+
+// reloadConfig fetches the remote settings and applies the config again,
+// recording the changed settings in the audit log with reason.
+// When SECRETS_URL can't be reached, the settings fetched last are kept.
+func reloadConfig(reason string) error {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	before := settingSnapshot()
+	previous := remoteSettings.load()
+	if getEnv("SECRETS_URL", "") != "" {
+		settings, err := fetchRemoteSettings()
+		if err != nil {
+			log.Printf("Error fetching secrets: %v", err)
+		} else {
+			remoteSettings.store(settings)
+		}
+	}
+	if err := applyConfig(); err != nil {
+		remoteSettings.store(previous)
+		return err
+	}
+	auditReload(reason, before)
+	return nil
+}
+
+// applyConfig reads the environment, remote settings and config file again
+// and applies the settings that can change at runtime: upstream endpoints
+// and proxies, rate limits, the admin token, terms, the profanity filter,
+// key defaults, log redaction rules and transform scripts, and the options
+// read per request. An invalid config file is rejected as a whole and the
+// running settings are kept. Requests in flight complete with the settings
+// they started with. Callers must hold reloadMu.
+func applyConfig() error {
+	previousFile := configFile.load()
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read config file: %w", err)
+		}
+		if problems := checkConfigFile(data); len(problems) > 0 {
+			for _, problem := range problems {
+				log.Printf("Invalid config file %s, %v", path, problem)
+			}
+			return fmt.Errorf("%d problem(s) found in %s", len(problems), path)
+		}
+		entries, _ := parseConfigFile(data)
+		configFile.store(configValues(entries))
+	}
+
+	previous, next := cfg(), loadConfig()
+	if err := upstreams.reconfigure(next.Endpoints, next.Proxies); err != nil {
+		configFile.store(previousFile)
+		return fmt.Errorf("invalid upstreams: %w", err)
+	}
+	currentConfig.Store(next)
+	tuneGC(next)
+
+	if next.RateLimit != previous.RateLimit || next.RateLimitWindow != previous.RateLimitWindow {
+		currentLimiter.Store(newRateLimiter())
+	}
+	if next.TermsFile != "" {
+		if err := terms.load(next.TermsFile); err != nil {
+			log.Printf("Error reloading terms: %v", err)
+		}
+	}
+	if next.ProfanityWordlist == "" {
+		profanity.Store(nil)
+	} else if filter, err := loadProfanityFilter(next.ProfanityWordlist, next.ProfanityMode); err != nil {
+		log.Printf("Error reloading profanity filter: %v", err)
+	} else {
+		profanity.Store(filter)
+	}
+
+	if next.KeyDefaultsFile == "" {
+		keyDefaults.Store(nil)
+	} else if defaults, err := loadKeyDefaults(next.KeyDefaultsFile); err != nil {
+		log.Printf("Error reloading key defaults: %v", err)
+	} else {
+		keyDefaults.Store(&defaults)
+	}
+
+	if next.RomanizeDir == "" {
+		romanizationDicts.Store(nil)
+	} else if dicts, err := loadRomanizationDicts(next.RomanizeDir); err != nil {
+		log.Printf("Error reloading romanization dictionaries: %v", err)
+	} else {
+		romanizationDicts.Store(&dicts)
+	}
+
+	if next.LogRedactFile == "" {
+		redactions.Store(nil)
+	} else if rules, err := loadRedactionRules(next.LogRedactFile); err != nil {
+		log.Printf("Error reloading redaction rules: %v", err)
+	} else {
+		redactions.Store(&rules)
+	}
+
+	if next.ScriptsDir == "" {
+		scripts.Store(nil)
+	} else if set, err := loadScripts(next.ScriptsDir); err != nil {
+		log.Printf("Error reloading scripts: %v", err)
+	} else {
+		scripts.Store(set)
+	}
+	if unknown := unknownEngines(next); len(unknown) > 0 {
+		log.Printf("Unknown engine(s): %s, requests routed to them will fail", strings.Join(unknown, ", "))
+	}
+
+	for _, setting := range []struct {
+		name    string
+		changed bool
+	}{
+		{"CACHE_TTL", next.CacheTTL != previous.CacheTTL},
+		{"CACHE_SIZE", next.CacheSize != previous.CacheSize},
+		{"IDEMPOTENCY_TTL", next.IdempotencyTTL != previous.IdempotencyTTL},
+		{"IDEMPOTENCY_MAX_KEYS", next.IdempotencyMaxKeys != previous.IdempotencyMaxKeys},
+		{"JOB_WORKERS", next.JobWorkers != previous.JobWorkers},
+		{"JOB_QUEUE_SIZE", next.JobQueueSize != previous.JobQueueSize},
+		{"JOBS_DIR", next.JobsDir != previous.JobsDir},
+		{"REDIS_URL", next.RedisURL != previous.RedisURL},
+		{"PROBE_INTERVAL", next.ProbeInterval != previous.ProbeInterval},
+		{"TELEGRAM_TOKEN", next.TelegramToken != previous.TelegramToken},
+		{"DISCORD_TOKEN", next.DiscordToken != previous.DiscordToken},
+		{"SLACK_SIGNING_SECRET", (next.SlackSigningSecret == "") != (previous.SlackSigningSecret == "")},
+		{"PREFORK", next.Prefork != previous.Prefork},
+		{"LOG_FILE", next.LogFile != previous.LogFile},
+		{"ACCESS_LOG", next.AccessLog != previous.AccessLog},
+		{"LOG_MAX_SIZE", next.LogMaxSize != previous.LogMaxSize},
+		{"LOG_MAX_AGE", next.LogMaxAge != previous.LogMaxAge},
+		{"LOG_MAX_BACKUPS", next.LogMaxBackups != previous.LogMaxBackups},
+		{"LOG_COMPRESS", next.LogCompress != previous.LogCompress},
+		{"LOG_SYSLOG", next.LogSyslog != previous.LogSyslog},
+		{"LOG_SYSLOG_FACILITY", next.LogSyslogFacility != previous.LogSyslogFacility},
+		{"LOG_JOURNALD", next.LogJournald != previous.LogJournald},
+		{"BODY_LIMIT", next.BodyLimit != previous.BodyLimit},
+		{"CONCURRENCY", next.Concurrency != previous.Concurrency},
+		{"READ_TIMEOUT", next.ReadTimeout != previous.ReadTimeout},
+		{"WRITE_TIMEOUT", next.WriteTimeout != previous.WriteTimeout},
+		{"IDLE_TIMEOUT", next.IdleTimeout != previous.IdleTimeout},
+		{"LOCAL_MODEL_URL", (next.LocalModelURL == "") != (previous.LocalModelURL == "")},
+		{"PLUGINS_DIR", next.PluginsDir != previous.PluginsDir},
+		{"PLUGIN_INSTANCES", next.PluginInstances != previous.PluginInstances},
+	} {
+		if setting.changed {
+			log.Printf("%s changed, restart the server to apply it", setting.name)
+		}
+	}
+	return nil
+}
+
+// watchConfig reloads the config on SIGHUP and whenever the file named by
+// CONFIG_FILE changes.
+func watchConfig() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+
+	// Editors often replace the file instead of writing to it, so the
+	// directory is watched rather than the file.
+	path := os.Getenv("CONFIG_FILE")
+	var changes <-chan fsnotify.Event
+	var watchErrors <-chan error
+	if path != "" {
+		path = filepath.Clean(path)
+		watcher, err := fsnotify.NewWatcher()
+		if err == nil {
+			err = watcher.Add(filepath.Dir(path))
+		}
+		if err != nil {
+			log.Printf("Error watching config file: %v", err)
+		} else {
+			changes, watchErrors = watcher.Events, watcher.Errors
+		}
+	}
+
+	reload := func(reason string) {
+		if err := reloadConfig(reason); err != nil {
+			log.Printf("Error reloading config: %v", err)
+			return
+		}
+		log.Printf("Reloaded config (%s)", reason)
+	}
+
+	var pending <-chan time.Time
+	for {
+		select {
+		case <-signals:
+			reload("SIGHUP")
+		case event := <-changes:
+			if filepath.Clean(event.Name) == path && event.Has(fsnotify.Write|fsnotify.Create) {
+				pending = time.After(configReloadDelay)
+			}
+		case err := <-watchErrors:
+			log.Printf("Error watching config file: %v", err)
+		case <-pending:
+			pending = nil
+			reload(path + " changed")
+		}
+	}
+}
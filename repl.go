@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const replHelp = `Type a line to translate it. Commands:
+  :to <lang>    set the target language
+  :from <lang>  set the source language (auto to detect)
+  :alt          toggle showing alternatives
+  :history      show the translations of this session
+  :help         show this help
+  :quit         leave`
+
+// replEntry is a translation made in the REPL.
+type replEntry struct {
+	Source, Translation, SourceLang, TargetLang string
+}
+
+func replCommand() (*flag.FlagSet, func() error) {
+	flags := flag.NewFlagSet("repl", flag.ContinueOnError)
+	client := clientFlags(flags)
+	output := outputFlags(flags)
+	source := flags.String("source", "", "source language (detected by default)")
+	target := flags.String("target", "EN-US", "target language")
+	alternatives := flags.Bool("alternatives", false, "show alternatives")
+
+	return flags, func() error {
+		params := TranslateParams{SourceLang: strings.ToUpper(*source), TargetLang: strings.ToUpper(*target)}
+		var history []replEntry
+
+		// With machine-readable output, only results go to stdout.
+		console := os.Stdout
+		if output.machine() {
+			console = os.Stderr
+		}
+
+		fmt.Fprintln(console, replHelp)
+		scanner := bufio.NewScanner(os.Stdin)
+		for {
+			fmt.Fprintf(console, "%s→%s> ", replLang(params.SourceLang), params.TargetLang)
+			if !scanner.Scan() {
+				fmt.Fprintln(console)
+				return scanner.Err()
+			}
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" {
+				continue
+			}
+
+			if command, argument, ok := strings.Cut(line+" ", " "); strings.HasPrefix(line, ":") && ok {
+				argument = strings.ToUpper(strings.TrimSpace(argument))
+				switch command {
+				case ":to":
+					if argument == "" {
+						fmt.Fprintln(console, "Usage: :to <lang>")
+						continue
+					}
+					params.TargetLang = argument
+				case ":from":
+					if argument == "AUTO" {
+						argument = ""
+					}
+					params.SourceLang = argument
+				case ":alt":
+					*alternatives = !*alternatives
+					if *alternatives {
+						fmt.Fprintln(console, "Alternatives on")
+					} else {
+						fmt.Fprintln(console, "Alternatives off")
+					}
+				case ":history":
+					for i, entry := range history {
+						fmt.Fprintf(console, "%3d  [%s→%s] %s\n     %s\n", i+1, replLang(entry.SourceLang), entry.TargetLang, entry.Source, entry.Translation)
+					}
+				case ":help":
+					fmt.Fprintln(console, replHelp)
+				case ":quit", ":q", ":exit":
+					return nil
+				default:
+					fmt.Fprintf(console, "Unknown command %s, try :help\n", command)
+				}
+				continue
+			}
+
+			params.Text = line
+			result, err := client.translate(params)
+			if err != nil {
+				fmt.Fprintf(console, "Error: %v\n", err)
+				continue
+			}
+			if err := output.print(line, result); err != nil {
+				return err
+			}
+			if *alternatives && !output.machine() {
+				for _, alternative := range result.Alternatives {
+					fmt.Println("  ~ " + alternative)
+				}
+			}
+			history = append(history, replEntry{
+				Source:      line,
+				Translation: result.Data,
+				SourceLang:  result.SourceLang,
+				TargetLang:  params.TargetLang,
+			})
+		}
+	}
+}
+
+func replLang(lang string) string {
+	if lang == "" {
+		return "auto"
+	}
+	return lang
+}
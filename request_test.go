@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf16"
+)
+
+// fixedSource is a rand.Source always returning the same number.
+type fixedSource int64
+
+func (s fixedSource) Int63() int64 { return int64(s) }
+
+func (fixedSource) Seed(int64) {}
+
+// fixedClock is a Clock stopped at one instant.
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time { return time.Time(c) }
+
+// TestBuildRequestBody checks the quirks of the web client in requests built
+// with fixed IDs and a fixed clock.
+func TestBuildRequestBody(t *testing.T) {
+	clock := fixedClock(time.UnixMilli(1700000000000))
+	for _, test := range []struct {
+		name      string
+		source    fixedSource
+		text      string
+		id        int64
+		timestamp int64
+		spaced    bool
+	}{
+		{"plain", 0, "Hello", 100000000, 1700000000000, false},
+		{"id+3 divisible by 13", 1, "Hello", 100000001, 1700000000000, true},
+		{"id+5 is 3 modulo 29", 2, "Hello", 100000002, 1700000000000, true},
+		{"id+5 divisible by 29", 28, "Hello", 100000028, 1700000000000, true},
+		{"source wraps into range", 100003, "Hello", 100000003, 1700000000000, false},
+		// Two "i" round the timestamp up to a multiple of three.
+		{"timestamp rounded", 0, "Sign in", 100000000, 1700000000001, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			builder := requestBuilder{ids: test.source, clock: clock}
+			body, err := builder.build(TranslateParams{SourceLang: "EN", TargetLang: "DE"}, []string{test.text})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var request RequestConfig
+			if err := jsonUnmarshal([]byte(body), &request); err != nil {
+				t.Fatalf("body %s is not JSON: %v", body, err)
+			}
+			if request.ID != test.id {
+				t.Errorf("id = %d, want %d", request.ID, test.id)
+			}
+			if request.Params.Timestamp != test.timestamp {
+				t.Errorf("timestamp = %d, want %d", request.Params.Timestamp, test.timestamp)
+			}
+			if spaced := strings.Contains(body, `"method" : "`); spaced != test.spaced {
+				t.Errorf("body %s has a spaced method: %v, want %v", body, spaced, test.spaced)
+			}
+			if err := checkRequestBody(body, false); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// TestTargetRequestIDs checks that a target numbers its requests in
+// sequence, like the calls of a web client session.
+func TestTargetRequestIDs(t *testing.T) {
+	target, err := newUpstreamTarget("http://127.0.0.1:9000/jsonrpc", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var previous int64
+	for i := 0; i < 3; i++ {
+		body, err := target.requestBody(TranslateParams{TargetLang: "DE"}, []string{"Hello"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var request RequestConfig
+		if err := jsonUnmarshal([]byte(body), &request); err != nil {
+			t.Fatalf("body %s is not JSON: %v", body, err)
+		}
+		// IDs wrap around at the end of their range.
+		if i > 0 && request.ID != previous+1 && request.ID != 100000*1000 {
+			t.Errorf("id %d follows %d", request.ID, previous)
+		}
+		previous = request.ID
+	}
+}
+
+// TestTimestampCount compares the v1 count with the web client's
+// text.split("i").length - 1, which splits UTF-16 code units.
+func TestTimestampCount(t *testing.T) {
+	for _, text := range []string{
+		"Sign in",
+		"🙂 will it 🙂",
+		"日本語 is fine",
+		"ıíİI ïi",
+		"𝔦 math italic i",
+		"\xffinvalid\xfe",
+		"",
+	} {
+		var want int64
+		for _, unit := range utf16.Encode([]rune(text)) {
+			if unit == 'i' {
+				want++
+			}
+		}
+		if got := timestampCounters[TimestampV1](text); got != want {
+			t.Errorf("count(%q) = %d, want %d", text, got, want)
+		}
+	}
+}
+
+// TestJobParams checks that style options reach the request only when set.
+func TestJobParams(t *testing.T) {
+	withConfig(t, func(config *Config) { config.UpstreamVariants = []string{"en-GB"} })
+	for _, test := range []struct {
+		name   string
+		params TranslateParams
+		want   string
+	}{
+		{"none", TranslateParams{TargetLang: "DE"}, ""},
+		{"formality alias", TranslateParams{TargetLang: "DE", Formality: "more"}, `"formality":"formal"`},
+		{"configured variant", TranslateParams{TargetLang: "EN"}, `"regionalVariant":"en-GB"`},
+		{"region in target", TranslateParams{TargetLang: "EN-US"}, ""},
+		{"advanced mode", TranslateParams{TargetLang: "DE", AdvancedMode: true}, `"advancedMode":true`},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			body, err := buildRequestBody(test.params, []string{"Hello"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.Contains(body, "commonJobParams"); got != (test.want != "") {
+				t.Errorf("body %s has commonJobParams: %v", body, got)
+			}
+			if !strings.Contains(body, test.want) {
+				t.Errorf("body %s lacks %s", body, test.want)
+			}
+		})
+	}
+}
+
+// TestSplitText translates a long text with LMT_split_text and
+// LMT_handle_jobs, checking the requests and the layout of the result.
+func TestSplitText(t *testing.T) {
+	withConfig(t, func(config *Config) { config.SplitTextThreshold = 10 })
+	var methods []string
+	mock := mockUpstream(0)
+	withUpstream(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var request RequestConfig
+		jsonUnmarshal(body, &request)
+		methods = append(methods, request.Method)
+		if err := checkRequestBody(string(body), false); err != nil {
+			t.Errorf("request %s: %v", body, err)
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		mock.ServeHTTP(w, r)
+	}))
+
+	params := TranslateParams{TargetLang: "DE", Sentences: true}
+	params.Text = "  Sign in. It is fine!\n\nSecond line."
+	response := translateText(params)
+	if want := "  [DE] Sign in. [DE] It is fine!\n\n[DE] Second line."; response.Data != want {
+		t.Errorf("data = %q, want %q", response.Data, want)
+	}
+	if len(response.Sentences) != 3 || response.Sentences[1].Source != "It is fine!" {
+		t.Errorf("sentences = %+v", response.Sentences)
+	}
+	if strings.Join(methods, ",") != "LMT_split_text,LMT_handle_jobs" {
+		t.Errorf("methods = %v", methods)
+	}
+}
+
+// TestSplitTextGaps checks that a failing chunk of a long text is retried
+// alone and, failing again, leaves gaps in a partial result.
+func TestSplitTextGaps(t *testing.T) {
+	withConfig(t, func(config *Config) {
+		config.SplitTextThreshold = 10
+		config.GapMarker = "[gap]"
+	})
+	var lines []string
+	for i := 1; i <= jobsPerCall+10; i++ {
+		lines = append(lines, "Line "+strconv.Itoa(i)+".")
+	}
+	params := TranslateParams{Text: strings.Join(lines, "\n"), TargetLang: "DE", Sentences: true}
+
+	for _, failures := range []int{1, 2} {
+		calls := 0
+		mock := mockUpstream(0)
+		withUpstream(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			// Fails the calls for the second chunk.
+			if bytes.Contains(body, []byte(`"text":"Line 51.","id":51`)) {
+				if calls++; calls <= failures {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			mock.ServeHTTP(w, r)
+		}))
+
+		response := translateText(params)
+		if response.Code != 200 || response.Partial != (failures == 2) {
+			t.Fatalf("%d failures: code %d, partial %v", failures, response.Code, response.Partial)
+		}
+		want := "[DE] Line 51."
+		if failures == 2 {
+			want = "[gap]"
+		}
+		if got := strings.Split(response.Data, "\n"); got[49] != "[DE] Line 50." || got[50] != want || got[59] != strings.Replace(want, "51", "60", 1) {
+			t.Errorf("%d failures: lines %q, %q, %q", failures, got[49], got[50], got[59])
+		}
+		if response.Sentences[50].Gap != (failures == 2) || response.Sentences[49].Gap {
+			t.Errorf("%d failures: gaps %+v", failures, response.Sentences[49:51])
+		}
+	}
+}
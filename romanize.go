@@ -0,0 +1,418 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"unicode"
+	"unicode/utf8"
+)
+
+// romanizationDict maps words to their romanized readings, for scripts that
+// can't be romanized letter by letter, such as Chinese characters and kanji.
+type romanizationDict struct {
+	readings map[string]string
+	// longest is the length in runes of the longest word.
+	longest int
+}
+
+// romanizationDicts holds the dictionaries of ROMANIZE_DIR by language, or
+// nil when none is configured. They are replaced when the config is
+// reloaded.
+var romanizationDicts atomic.Pointer[map[string]*romanizationDict]
+
+// loadRomanizationDicts reads the files of dir named after a language, such
+// as zh.tsv, holding a word and its reading separated by a tab on each line.
+func loadRomanizationDicts(dir string) (map[string]*romanizationDict, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.tsv"))
+	if err != nil {
+		return nil, err
+	}
+	dicts := make(map[string]*romanizationDict)
+	for _, path := range paths {
+		lang := strings.ToUpper(strings.TrimSuffix(filepath.Base(path), ".tsv"))
+		dict, err := loadRomanizationDict(path)
+		if err != nil {
+			return nil, err
+		}
+		dicts[lang] = dict
+	}
+	return dicts, nil
+}
+
+func loadRomanizationDict(path string) (*romanizationDict, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open romanization dictionary: %w", err)
+	}
+	defer file.Close()
+
+	readings := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		word, reading, ok := strings.Cut(text, "\t")
+		word, reading = strings.TrimSpace(word), strings.TrimSpace(reading)
+		if !ok || word == "" || reading == "" {
+			return nil, fmt.Errorf("%s:%d: expected a word and its reading separated by a tab", path, line)
+		}
+		readings[word] = reading
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read romanization dictionary: %w", err)
+	}
+	return newRomanizationDict(readings), nil
+}
+
+func newRomanizationDict(readings map[string]string) *romanizationDict {
+	dict := &romanizationDict{readings: readings}
+	for word := range readings {
+		dict.longest = max(dict.longest, utf8.RuneCountInString(word))
+	}
+	return dict
+}
+
+// lookup returns the reading of the longest word at the start of text and
+// the number of runes it spans.
+func (d *romanizationDict) lookup(text []rune) (string, int) {
+	if d == nil {
+		return "", 0
+	}
+	for n := min(d.longest, len(text)); n > 0; n-- {
+		if reading, ok := d.readings[string(text[:n])]; ok {
+			return reading, n
+		}
+	}
+	return "", 0
+}
+
+// romanize renders text in the Latin alphabet for learners of lang, or
+// returns "" when lang isn't romanized. Korean and Cyrillic are romanized
+// letter by letter and Japanese kana by Hepburn. Chinese is romanized with
+// basePinyin and the dictionary in ROMANIZE_DIR, kanji with the dictionary
+// only. Text with a character or kanji neither knows isn't romanized, as
+// learners can't read a romanization mixing in characters.
+func romanize(lang, text string) string {
+	lang, _, _ = strings.Cut(strings.ToUpper(lang), "-")
+	var dict *romanizationDict
+	if dicts := romanizationDicts.Load(); dicts != nil {
+		dict = (*dicts)[lang]
+	}
+	switch lang {
+	case "JA":
+		return tidySpaces(romanizeJapanese(text, dict))
+	case "ZH":
+		return tidySpaces(romanizeChinese(text, dict))
+	case "KO":
+		return romanizeKorean(text)
+	case "RU", "UK", "BG":
+		return romanizeCyrillic(lang, text)
+	}
+	return ""
+}
+
+// tidySpaces drops the spaces added after CJK punctuation where the text
+// already had one or a line ends.
+func tidySpaces(text string) string {
+	for strings.Contains(text, "  ") {
+		text = strings.ReplaceAll(text, "  ", " ")
+	}
+	text = strings.ReplaceAll(text, " \n", "\n")
+	return strings.TrimRight(text, " ")
+}
+
+// romanizeChinese replaces the words of dict and basePinyin with their
+// readings, separated by spaces, or returns "" when a character has no
+// reading.
+func romanizeChinese(text string, dict *romanizationDict) string {
+	runes := []rune(text)
+	var out strings.Builder
+	// A reading is set apart from the words and readings next to it.
+	afterReading := false
+	for i := 0; i < len(runes); {
+		reading, n := dict.lookup(runes[i:])
+		if base, baseN := basePinyin.lookup(runes[i:]); baseN > n {
+			reading, n = base, baseN
+		}
+		if n > 0 {
+			if out.Len() > 0 && !unicode.IsSpace(runes[i-1]) && !unicode.IsPunct(runes[i-1]) {
+				out.WriteByte(' ')
+			}
+			out.WriteString(reading)
+			afterReading = true
+			i += n
+			continue
+		}
+		if unicode.Is(unicode.Han, runes[i]) {
+			return ""
+		}
+		if afterReading && !unicode.IsSpace(runes[i]) && !unicode.IsPunct(runes[i]) {
+			out.WriteByte(' ')
+		}
+		out.WriteString(fullWidthPunctuation(runes[i]))
+		afterReading = false
+		i++
+	}
+	return out.String()
+}
+
+// fullWidthPunctuation returns the ASCII punctuation of a CJK one, followed
+// by the space CJK punctuation implies.
+func fullWidthPunctuation(r rune) string {
+	switch r {
+	case '。':
+		return ". "
+	case '、', '，':
+		return ", "
+	case '！':
+		return "! "
+	case '？':
+		return "? "
+	case '：':
+		return ": "
+	case '；':
+		return "; "
+	case '「', '」', '『', '』', '“', '”':
+		return `"`
+	case '（':
+		return "("
+	case '）':
+		return ")"
+	case '　':
+		return " "
+	case '・':
+		return "-"
+	}
+	return string(r)
+}
+
+// kanaRomaji is the Hepburn romanization of hiragana. Katakana is looked up
+// as the matching hiragana.
+var kanaRomaji = map[rune]string{
+	'あ': "a", 'い': "i", 'う': "u", 'え': "e", 'お': "o",
+	'か': "ka", 'き': "ki", 'く': "ku", 'け': "ke", 'こ': "ko",
+	'が': "ga", 'ぎ': "gi", 'ぐ': "gu", 'げ': "ge", 'ご': "go",
+	'さ': "sa", 'し': "shi", 'す': "su", 'せ': "se", 'そ': "so",
+	'ざ': "za", 'じ': "ji", 'ず': "zu", 'ぜ': "ze", 'ぞ': "zo",
+	'た': "ta", 'ち': "chi", 'つ': "tsu", 'て': "te", 'と': "to",
+	'だ': "da", 'ぢ': "ji", 'づ': "zu", 'で': "de", 'ど': "do",
+	'な': "na", 'に': "ni", 'ぬ': "nu", 'ね': "ne", 'の': "no",
+	'は': "ha", 'ひ': "hi", 'ふ': "fu", 'へ': "he", 'ほ': "ho",
+	'ば': "ba", 'び': "bi", 'ぶ': "bu", 'べ': "be", 'ぼ': "bo",
+	'ぱ': "pa", 'ぴ': "pi", 'ぷ': "pu", 'ぺ': "pe", 'ぽ': "po",
+	'ま': "ma", 'み': "mi", 'む': "mu", 'め': "me", 'も': "mo",
+	'や': "ya", 'ゆ': "yu", 'よ': "yo",
+	'ら': "ra", 'り': "ri", 'る': "ru", 'れ': "re", 'ろ': "ro",
+	'わ': "wa", 'ゐ': "i", 'ゑ': "e", 'を': "o", 'ん': "n", 'ゔ': "vu",
+	'ぁ': "a", 'ぃ': "i", 'ぅ': "u", 'ぇ': "e", 'ぉ': "o", 'ゎ': "wa",
+	'ゃ': "ya", 'ゅ': "yu", 'ょ': "yo",
+}
+
+// romanizeJapanese romanizes kana by Hepburn, and the words of dict by their
+// readings, or returns "" when a kanji has no reading.
+func romanizeJapanese(text string, dict *romanizationDict) string {
+	runes := []rune(text)
+	var out []string
+	double := false // after a small tsu
+	for i := 0; i < len(runes); i++ {
+		if reading, n := dict.lookup(runes[i:]); n > 0 {
+			out = append(out, reading)
+			i += n - 1
+			continue
+		}
+		if unicode.Is(unicode.Han, runes[i]) {
+			return ""
+		}
+		original, r := runes[i], runes[i]
+		if r >= 'ァ' && r <= 'ヶ' {
+			r -= 'ァ' - 'ぁ'
+		}
+		switch {
+		case r == 'っ':
+			double = true
+			continue
+		case r == 'ー' && len(out) > 0:
+			// Long vowels are written by repeating the vowel.
+			last := out[len(out)-1]
+			out[len(out)-1] = last + last[len(last)-1:]
+			continue
+		case (r == 'ゃ' || r == 'ゅ' || r == 'ょ') && len(out) > 0 && strings.HasSuffix(out[len(out)-1], "i"):
+			base := strings.TrimSuffix(out[len(out)-1], "i")
+			vowel := kanaRomaji[r][1:]
+			// A small tsu before doubles them, as in matcha.
+			if !strings.HasSuffix(base, "sh") && !strings.HasSuffix(base, "ch") && !strings.HasSuffix(base, "j") {
+				vowel = "y" + vowel
+			}
+			out[len(out)-1] = base + vowel
+			continue
+		case (r == 'ぁ' || r == 'ぃ' || r == 'ぇ' || r == 'ぉ') && len(out) > 0 && len(out[len(out)-1]) > 1:
+			// Small vowels replace the vowel of the kana before, as in
+			// ファ (fa) and ティ (ti).
+			last := out[len(out)-1]
+			out[len(out)-1] = last[:len(last)-1] + kanaRomaji[r]
+			continue
+		}
+
+		romaji, ok := kanaRomaji[r]
+		if !ok {
+			romaji = fullWidthPunctuation(original)
+		} else if original == 'は' && isParticle(runes, i) {
+			romaji = "wa"
+		} else if original == 'へ' && isParticle(runes, i) {
+			romaji = "e"
+		} else if r == 'ん' && i+1 < len(runes) && startsWithVowelOrY(runes[i+1]) {
+			romaji = "n'"
+		}
+		if double && ok {
+			if strings.HasPrefix(romaji, "ch") {
+				romaji = "t" + romaji
+			} else {
+				romaji = romaji[:1] + romaji
+			}
+		}
+		double = false
+		out = append(out, romaji)
+	}
+	return strings.Join(out, "")
+}
+
+// isParticle reports whether the は or へ at i is likely the particle read
+// wa or e: one ending a kanji or katakana word, or a phrase, as in 私は and
+// こんにちは. Kana words ending in は aren't told apart from particles.
+func isParticle(runes []rune, i int) bool {
+	if i == 0 || !isJapaneseLetter(runes[i-1]) {
+		return false
+	}
+	return !isHiragana(runes[i-1]) || i+1 == len(runes) || !isJapaneseLetter(runes[i+1])
+}
+
+func isHiragana(r rune) bool {
+	return unicode.Is(unicode.Hiragana, r)
+}
+
+func isJapaneseLetter(r rune) bool {
+	return isHiragana(r) || unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Han, r) || r == 'ー'
+}
+
+func startsWithVowelOrY(r rune) bool {
+	if r >= 'ァ' && r <= 'ヶ' {
+		r -= 'ァ' - 'ぁ'
+	}
+	romaji := kanaRomaji[r]
+	return romaji != "" && strings.ContainsRune("aiueoy", rune(romaji[0]))
+}
+
+// Revised Romanization of the parts of a Hangul syllable.
+var (
+	hangulInitials = []string{"g", "kk", "n", "d", "tt", "r", "m", "b", "pp", "s", "ss", "", "j", "jj", "ch", "k", "t", "p", "h"}
+	hangulVowels   = []string{"a", "ae", "ya", "yae", "eo", "e", "yeo", "ye", "o", "wa", "wae", "oe", "yo", "u", "wo", "we", "wi", "yu", "eu", "ui", "i"}
+	hangulFinals   = []string{"", "k", "k", "k", "n", "n", "n", "t", "l", "k", "m", "l", "l", "l", "p", "l", "m", "p", "p", "t", "t", "ng", "t", "t", "k", "t", "p", "t"}
+	// hangulLinked is how a single final consonant is read when the next
+	// syllable starts with a vowel.
+	hangulLinked = map[int]string{1: "g", 2: "kk", 4: "n", 7: "d", 8: "r", 16: "m", 17: "b", 19: "s", 20: "ss", 22: "j", 23: "ch", 24: "k", 25: "t", 26: "p", 27: ""}
+)
+
+// liquidized reports whether a final consonant and the initial consonant
+// after it are both pronounced l, as ㄹ next to ㄴ or ㄹ is.
+func liquidized(final, initial int) bool {
+	return final == 8 && (initial == 2 || initial == 5) || final == 4 && initial == 5
+}
+
+// romanizeKorean romanizes Hangul by the Revised Romanization, linking a
+// final consonant to a following vowel and reading ㄹ next to ㄴ as l, as
+// they are pronounced. Other sound changes are not applied.
+func romanizeKorean(text string) string {
+	runes := []rune(text)
+	var out strings.Builder
+	for i, r := range runes {
+		if r < 0xAC00 || r > 0xD7A3 {
+			out.WriteString(fullWidthPunctuation(r))
+			continue
+		}
+		code := int(r - 0xAC00)
+		initial, vowel, final := code/588, code%588/28, code%28
+
+		if i > 0 && runes[i-1] >= 0xAC00 && runes[i-1] <= 0xD7A3 {
+			previous := int(runes[i-1]-0xAC00) % 28
+			_, linked := hangulLinked[previous]
+			switch {
+			case initial == 11 && linked:
+				// The final was already written as this syllable's initial.
+			case liquidized(previous, initial):
+				out.WriteString("l")
+			default:
+				out.WriteString(hangulInitials[initial])
+			}
+		} else {
+			out.WriteString(hangulInitials[initial])
+		}
+		out.WriteString(hangulVowels[vowel])
+
+		next := -1
+		if i+1 < len(runes) && runes[i+1] >= 0xAC00 && runes[i+1] <= 0xD7A3 {
+			next = int(runes[i+1]-0xAC00) / 588
+		}
+		if linked, ok := hangulLinked[final]; ok && next == 11 {
+			out.WriteString(linked)
+		} else if liquidized(final, next) {
+			out.WriteString("l")
+		} else {
+			out.WriteString(hangulFinals[final])
+		}
+	}
+	return out.String()
+}
+
+// cyrillicLatin is the romanization of Russian letters, which Ukrainian and
+// Bulgarian override where they differ.
+var cyrillicLatin = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "yo",
+	'ж': "zh", 'з': "z", 'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m",
+	'н': "n", 'о': "o", 'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u",
+	'ф': "f", 'х': "kh", 'ц': "ts", 'ч': "ch", 'ш': "sh", 'щ': "shch",
+	'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "yu", 'я': "ya",
+}
+
+var cyrillicOverrides = map[string]map[rune]string{
+	"UK": {'г': "h", 'ґ': "g", 'е': "e", 'є': "ye", 'и': "y", 'і': "i", 'ї': "yi", 'х': "kh", '\'': "", '’': ""},
+	"BG": {'ъ': "a", 'щ': "sht", 'х': "h", 'ь': "y"},
+}
+
+// ukrainianMedial is how the Ukrainian letters starting with y at the start
+// of a word are romanized after its first letter, as in Київ (Kyiv).
+var ukrainianMedial = map[rune]string{'є': "ie", 'ї': "i", 'й': "i", 'ю': "iu", 'я': "ia"}
+
+// romanizeCyrillic transliterates the Cyrillic letters of text, keeping
+// capital letters capitalized.
+func romanizeCyrillic(lang, text string) string {
+	var out strings.Builder
+	inWord := false
+	for _, r := range text {
+		lower := unicode.ToLower(r)
+		afterLetter := inWord
+		// Apostrophes are part of Ukrainian words, as in м'ята.
+		inWord = unicode.IsLetter(r) || r == '\'' || r == '’'
+		latin, ok := ukrainianMedial[lower]
+		if !ok || lang != "UK" || !afterLetter {
+			latin, ok = cyrillicOverrides[lang][lower]
+		}
+		if !ok {
+			latin, ok = cyrillicLatin[lower]
+		}
+		if !ok {
+			out.WriteRune(r)
+			continue
+		}
+		if lower != r && latin != "" {
+			latin = strings.ToUpper(latin[:1]) + latin[1:]
+		}
+		out.WriteString(latin)
+	}
+	return out.String()
+}
@@ -0,0 +1,79 @@
+package main
+
+import "testing"
+
+// withRomanizationDicts makes dicts the dictionaries of ROMANIZE_DIR for the
+// length of a test.
+func withRomanizationDicts(t *testing.T, dicts map[string]*romanizationDict) {
+	t.Helper()
+	previous := romanizationDicts.Load()
+	romanizationDicts.Store(&dicts)
+	t.Cleanup(func() { romanizationDicts.Store(previous) })
+}
+
+func TestRomanize(t *testing.T) {
+	for _, test := range []struct {
+		lang, text, want string
+	}{
+		{"RU", "Привет, мир!", "Privet, mir!"},
+		{"RU", "Ёлка и Щука", "Yolka i Shchuka"},
+		{"RU", "Юрий Гагарин", "Yuriy Gagarin"},
+		{"UK", "Київ", "Kyiv"},
+		{"UK", "Україна", "Ukraina"},
+		{"UK", "Юрій", "Yurii"},
+		{"UK", "Європа і Ялта", "Yevropa i Yalta"},
+		{"UK", "Запоріжжя", "Zaporizhzhia"},
+		{"UK", "Знам'янка", "Znamianka"},
+		{"UK", "Йосип Гайовий", "Yosyp Haiovyi"},
+		{"BG", "България", "Balgariya"},
+		{"BG", "Щастие", "Shtastie"},
+		{"KO", "안녕하세요", "annyeonghaseyo"},
+		{"KO", "한국어", "hangugeo"},
+		{"KO", "신라", "silla"},
+		{"JA", "ひらがな", "hiragana"},
+		{"JA", "カタカナ", "katakana"},
+		{"JA", "きょう", "kyou"},
+		{"JA", "がっこう", "gakkou"},
+		{"JA", "まっちゃ", "matcha"},
+		{"JA", "きんえん", "kin'en"},
+		{"JA", "コーヒー", "koohii"},
+		{"JA", "ファン", "fan"},
+		{"JA", "こんにちは。", "konnichiwa."},
+		{"JA", "はい", "hai"},
+		{"JA", "へや", "heya"},
+		{"JA", "東京", ""},
+		{"ZH", "你好", "nǐ hǎo"},
+		{"ZH", "我爱你。", "wǒ ài nǐ."},
+		{"ZH", "中国人在银行工作", "zhōng guó rén zài yín háng gōng zuò"},
+		{"ZH", "我有3个朋友", "wǒ yǒu 3 gè péng you"},
+		{"ZH", "饕餮", ""},
+		{"ZH-HANS", "谢谢", "xiè xie"},
+		{"DE", "Hallo", ""},
+	} {
+		if got := romanize(test.lang, test.text); got != test.want {
+			t.Errorf("romanize(%s, %q) = %q, want %q", test.lang, test.text, got, test.want)
+		}
+	}
+}
+
+// TestRomanizeDicts checks that ROMANIZE_DIR dictionaries add readings, and
+// kanji words followed by particles.
+func TestRomanizeDicts(t *testing.T) {
+	withRomanizationDicts(t, map[string]*romanizationDict{
+		"ZH": newRomanizationDict(map[string]string{"饕餮": "tāo tiè", "银行": "yínháng"}),
+		"JA": newRomanizationDict(map[string]string{"私": "watashi", "東京": "Tōkyō", "行": "i"}),
+	})
+	for _, test := range []struct {
+		lang, text, want string
+	}{
+		{"ZH", "饕餮", "tāo tiè"},
+		{"ZH", "在银行", "zài yínháng"},
+		{"JA", "私はねこです", "watashiwanekodesu"},
+		{"JA", "東京へ行く", "Tōkyōeiku"},
+		{"JA", "私は学生", ""},
+	} {
+		if got := romanize(test.lang, test.text); got != test.want {
+			t.Errorf("romanize(%s, %q) = %q, want %q", test.lang, test.text, got, test.want)
+		}
+	}
+}
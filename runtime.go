@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path"
+	"runtime/debug"
+	"strconv"
+	"strings"
+
+	"go.uber.org/automaxprocs/maxprocs"
+)
+
+// setMaxProcs matches GOMAXPROCS to the CPU quota of the container, unless
+// the GOMAXPROCS environment variable is set.
+func setMaxProcs() {
+	if _, err := maxprocs.Set(maxprocs.Logger(log.Printf)); err != nil {
+		log.Printf("Error setting GOMAXPROCS: %v", err)
+	}
+}
+
+// tuneGC applies MEMORY_LIMIT and GC_PERCENT, unless the GOMEMLIMIT or GOGC
+// environment variables already configure the runtime.
+func tuneGC(config *Config) {
+	if _, ok := os.LookupEnv("GOGC"); !ok {
+		debug.SetGCPercent(config.GCPercent)
+	}
+	if _, ok := os.LookupEnv("GOMEMLIMIT"); ok || config.MemoryLimit == "" {
+		return
+	}
+	limit, err := parseMemoryLimit(config.MemoryLimit, cgroupMemoryLimit())
+	if err != nil {
+		log.Printf("Invalid MEMORY_LIMIT: %v", err)
+		return
+	}
+	if limit > 0 {
+		debug.SetMemoryLimit(limit)
+	} else {
+		debug.SetMemoryLimit(math.MaxInt64)
+	}
+}
+
+// parseMemoryLimit reads a size such as "512MiB" or "1GB", or a percentage
+// of the container's memory limit such as "90%". Without a container limit,
+// a percentage means no limit and 0 is returned.
+func parseMemoryLimit(value string, containerLimit int64) (int64, error) {
+	if percent, ok := strings.CutSuffix(value, "%"); ok {
+		n, err := strconv.ParseFloat(percent, 64)
+		if err != nil || n < 0 || n > 100 {
+			return 0, fmt.Errorf("%q is not a percentage between 0 and 100", value)
+		}
+		return int64(float64(containerLimit) * n / 100), nil
+	}
+
+	size, err := parseSize(value)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a size such as 512MiB or a percentage such as 90%%", value)
+	}
+	return size, nil
+}
+
+// parseSize reads a number of bytes with an optional unit, such as "4MiB",
+// "1GB" or "4096".
+func parseSize(value string) (int64, error) {
+	units := []struct {
+		suffix string
+		size   int64
+	}{
+		{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30},
+		{"KB", 1e3}, {"MB", 1e6}, {"GB", 1e9}, {"B", 1},
+	}
+	number, size := value, int64(1)
+	for _, unit := range units {
+		if n, ok := strings.CutSuffix(value, unit.suffix); ok {
+			number, size = strings.TrimSpace(n), unit.size
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(number, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", value)
+	}
+	return int64(n * float64(size)), nil
+}
+
+// cgroupMemoryLimit returns the memory limit of the cgroup the process runs
+// in, or 0 when it has none.
+func cgroupMemoryLimit() int64 {
+	var candidates []string
+	if file, err := os.Open("/proc/self/cgroup"); err == nil {
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			// cgroup v2 entries look like "0::/system.slice/deeplx.service".
+			if group, ok := strings.CutPrefix(scanner.Text(), "0::"); ok {
+				candidates = append(candidates, path.Join("/sys/fs/cgroup", group, "memory.max"))
+			}
+		}
+		file.Close()
+	}
+	candidates = append(candidates, "/sys/fs/cgroup/memory.max", "/sys/fs/cgroup/memory/memory.limit_in_bytes")
+
+	for _, candidate := range candidates {
+		data, err := os.ReadFile(candidate)
+		if err != nil {
+			continue
+		}
+		limit, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+		// "max" in cgroup v2, and a value near MaxInt64 in v1, mean no limit.
+		if err != nil || limit >= 1<<60 {
+			return 0
+		}
+		return limit
+	}
+	return 0
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// s3Client is a minimal S3 client covering what jobs need: reading and
+// writing whole objects, signed with AWS Signature Version 4. It works with
+// AWS S3 and S3-compatible stores such as MinIO.
+type s3Client struct {
+	endpoint  *url.URL
+	region    string
+	accessKey string
+	secretKey string
+	pathStyle bool
+}
+
+func newS3Client() (*s3Client, error) {
+	if cfg().S3AccessKey == "" || cfg().S3SecretKey == "" {
+		return nil, errors.New("S3_ACCESS_KEY and S3_SECRET_KEY are required for s3:// locations")
+	}
+	endpoint, err := url.Parse(cfg().S3Endpoint)
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid S3_ENDPOINT %q", cfg().S3Endpoint)
+	}
+	return &s3Client{
+		endpoint:  endpoint,
+		region:    cfg().S3Region,
+		accessKey: cfg().S3AccessKey,
+		secretKey: cfg().S3SecretKey,
+		pathStyle: cfg().S3PathStyle,
+	}, nil
+}
+
+// parseS3Location splits "s3://bucket/key" into bucket and key.
+func parseS3Location(location string) (bucket, key string, err error) {
+	rest, ok := strings.CutPrefix(location, "s3://")
+	if !ok {
+		return "", "", fmt.Errorf("unsupported location %q, expected s3://bucket/key", location)
+	}
+	bucket, key, _ = strings.Cut(rest, "/")
+	if bucket == "" || key == "" {
+		return "", "", fmt.Errorf("invalid location %q, expected s3://bucket/key", location)
+	}
+	return bucket, key, nil
+}
+
+// s3LocationAllowed reports whether location lies under one of
+// cfg().S3AllowedPrefixes. A prefix naming only a bucket covers the whole
+// bucket, but not other buckets that share its name as a prefix.
+func s3LocationAllowed(location string) bool {
+	if slices.Contains(strings.Split(location, "/"), "..") {
+		return false
+	}
+	for _, prefix := range cfg().S3AllowedPrefixes {
+		if !strings.Contains(strings.TrimPrefix(prefix, "s3://"), "/") {
+			prefix += "/"
+		}
+		if strings.HasPrefix(location, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *s3Client) objectURL(bucket, key string) *url.URL {
+	u := *c.endpoint
+	if c.pathStyle {
+		u.Path = "/" + bucket + "/" + key
+	} else {
+		u.Host = bucket + "." + u.Host
+		u.Path = "/" + key
+	}
+	u.RawPath = awsEscapePath(u.Path)
+	return &u
+}
+
+func (c *s3Client) GetObject(location string) ([]byte, error) {
+	bucket, key, err := parseS3Location(location)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.do(http.MethodGet, c.objectURL(bucket, key), nil, "")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("get %s: status %d: %s", location, resp.StatusCode, body)
+	}
+	return body, nil
+}
+
+func (c *s3Client) PutObject(location string, data []byte, contentType string) error {
+	bucket, key, err := parseS3Location(location)
+	if err != nil {
+		return err
+	}
+	resp, err := c.do(http.MethodPut, c.objectURL(bucket, key), data, contentType)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("put %s: status %d: %s", location, resp.StatusCode, body)
+	}
+	return nil
+}
+
+func (c *s3Client) do(method string, u *url.URL, body []byte, contentType string) (*http.Response, error) {
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	c.sign(req, body, time.Now().UTC())
+	return http.DefaultClient.Do(req)
+}
+
+// sign adds the Signature Version 4 headers to req.
+func (c *s3Client) sign(req *http.Request, body []byte, now time.Time) {
+	payloadHash := sha256Hex(body)
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		"",
+		"host:" + req.URL.Host,
+		"x-amz-content-sha256:" + payloadHash,
+		"x-amz-date:" + amzDate,
+		"",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + c.region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+c.secretKey), date)
+	key = hmacSHA256(key, c.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		c.accessKey, scope, signedHeaders, signature,
+	))
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// awsEscapePath percent-encodes everything but unreserved characters and
+// slashes, as Signature Version 4 requires.
+func awsEscapePath(path string) string {
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		ch := path[i]
+		if ch >= 'A' && ch <= 'Z' || ch >= 'a' && ch <= 'z' || ch >= '0' && ch <= '9' ||
+			ch == '-' || ch == '_' || ch == '.' || ch == '~' || ch == '/' {
+			b.WriteByte(ch)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", ch)
+		}
+	}
+	return b.String()
+}
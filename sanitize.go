@@ -0,0 +1,28 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// sanitizeText prepares input for the upstream: it normalizes to NFC so that
+// equivalent texts are sent (and cached) identically, drops control
+// characters other than tabs and line breaks, and optionally turns exotic
+// whitespace such as non-breaking or ideographic spaces into plain spaces.
+func sanitizeText(text string, collapseWhitespace bool) string {
+	text = norm.NFC.String(text)
+
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == '\n' || r == '\r' || r == '\t':
+			return r
+		case r == '\uFEFF' || unicode.IsControl(r):
+			return -1
+		case collapseWhitespace && unicode.IsSpace(r) && r != ' ':
+			return ' '
+		}
+		return r
+	}, text)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// schemaCanary holds the texts translated by the schema check.
+var schemaCanary = []string{"Hello, world.", "Good morning."}
+
+// schemaAlert is the body of generic webhooks told that the upstream
+// answer no longer matches what the server parses.
+type schemaAlert struct {
+	Alert    string   `json:"alert"`
+	Message  string   `json:"message"`
+	Problems []string `json:"problems,omitempty"`
+}
+
+// upstreamSchemaProblems lists how an upstream answer to a request for
+// texts strays from the shape the server parses. Fields it doesn't read
+// are ignored, so additions to the format pass.
+func upstreamSchemaProblems(body []byte, texts int) []string {
+	var response map[string]any
+	if err := jsonUnmarshal(body, &response); err != nil {
+		return []string{fmt.Sprintf("answer is not a JSON object: %v", err)}
+	}
+	if rpcError, ok := response["error"]; ok {
+		detail, _ := jsonMarshal(rpcError)
+		return []string{fmt.Sprintf("answer holds an error: %s", detail)}
+	}
+	result, ok := response["result"].(map[string]any)
+	if !ok {
+		return []string{"result is missing or not an object"}
+	}
+
+	var problems []string
+	if lang, ok := result["lang"].(string); !ok || lang == "" {
+		problems = append(problems, "result.lang is missing or not a string")
+	}
+	list, ok := result["texts"].([]any)
+	if !ok {
+		return append(problems, "result.texts is missing or not an array")
+	}
+	if len(list) != texts {
+		problems = append(problems, fmt.Sprintf("result.texts has %d entries for %d texts", len(list), texts))
+	}
+	for i, entry := range list {
+		text, ok := entry.(map[string]any)
+		if !ok {
+			problems = append(problems, fmt.Sprintf("result.texts[%d] is not an object", i))
+			continue
+		}
+		if value, ok := text["text"].(string); !ok || value == "" {
+			problems = append(problems, fmt.Sprintf("result.texts[%d].text is missing or not a string", i))
+		}
+		// Alternatives are optional, and null when there are none.
+		alternatives, ok := text["alternatives"].([]any)
+		if !ok && text["alternatives"] != nil {
+			problems = append(problems, fmt.Sprintf("result.texts[%d].alternatives is not an array", i))
+		}
+		for j, alternative := range alternatives {
+			if value, ok := alternative.(map[string]any); !ok || value["text"] == nil {
+				problems = append(problems, fmt.Sprintf("result.texts[%d].alternatives[%d].text is missing", i, j))
+			} else if _, ok := value["text"].(string); !ok {
+				problems = append(problems, fmt.Sprintf("result.texts[%d].alternatives[%d].text is not a string", i, j))
+			}
+		}
+	}
+	return problems
+}
+
+// checkUpstreamSchema translates the canary and checks the answer. Failed
+// calls are left to the error rate alert, so checked is only set when the
+// upstream answered.
+func checkUpstreamSchema() (problems []string, checked bool) {
+	reply := upstreams.call(textsRequest(TranslateParams{SourceLang: "EN", TargetLang: "DE"}, schemaCanary))
+	defer reply.release()
+	if !reply.ok() {
+		log.Printf("Schema check skipped, the upstream call failed with status %d: %v", reply.Status, reply.Err)
+		return nil, false
+	}
+	return upstreamSchemaProblems(reply.Body, len(schemaCanary)), true
+}
+
+// watchUpstreamSchema checks the upstream answer format every
+// SCHEMA_CHECK_INTERVAL, logging every failed check and posting to
+// ALERT_WEBHOOK when the format changes and again once it matches.
+func watchUpstreamSchema() {
+	failing := false
+	for {
+		interval := cfg().SchemaCheckInterval
+		if interval <= 0 {
+			time.Sleep(time.Minute)
+			continue
+		}
+		problems, checked := checkUpstreamSchema()
+		switch {
+		case !checked:
+		case len(problems) > 0:
+			message := "DeepLX-Go: the upstream answer format changed: " + strings.Join(problems, "; ")
+			log.Printf("Alert: %s", message)
+			if !failing && cfg().AlertWebhook != "" {
+				go sendAlert(cfg().AlertWebhook, cfg().AlertFormat, message, schemaAlert{Alert: "schema_changed", Message: message, Problems: problems})
+			}
+			failing = true
+		case failing:
+			message := "DeepLX-Go: the upstream answer format matches again"
+			log.Print(message)
+			if cfg().AlertWebhook != "" {
+				go sendAlert(cfg().AlertWebhook, cfg().AlertFormat, message, schemaAlert{Alert: "schema_restored", Message: message})
+			}
+			failing = false
+		}
+		time.Sleep(interval)
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+// scripts holds the transform scripts of SCRIPTS_DIR, or nil without any.
+var scripts atomic.Pointer[scriptSet]
+
+// scriptRequest is the request a transformRequest function may change.
+type scriptRequest struct {
+	Text       string `json:"text"`
+	SourceLang string `json:"source_lang"`
+	TargetLang string `json:"target_lang"`
+}
+
+// scriptResponse is the translation a transformResponse function may change.
+type scriptResponse struct {
+	Text         string   `json:"text"`
+	SourceLang   string   `json:"source_lang"`
+	TargetLang   string   `json:"target_lang"`
+	Alternatives []string `json:"alternatives"`
+}
+
+// scriptSet is the compiled scripts of a directory. JavaScript runtimes are
+// not safe for concurrent use, so every translation takes one from a pool.
+type scriptSet struct {
+	names    []string
+	programs []*goja.Program
+	vms      sync.Pool
+}
+
+// scriptVM is a runtime the scripts have run in, with the transform
+// functions they define in the order of the scripts.
+type scriptVM struct {
+	runtime   *goja.Runtime
+	requests  []scriptFunc
+	responses []scriptFunc
+}
+
+type scriptFunc struct {
+	script string
+	call   goja.Callable
+}
+
+// loadScripts compiles the *.js files of dir, in the order of their names,
+// and runs them once to check that they load.
+func loadScripts(dir string) (*scriptSet, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.js"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	set := &scriptSet{}
+	for _, path := range paths {
+		source, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		name := filepath.Base(path)
+		program, err := goja.Compile(name, string(source), true)
+		if err != nil {
+			return nil, err
+		}
+		set.names = append(set.names, name)
+		set.programs = append(set.programs, program)
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no *.js files in %s", dir)
+	}
+
+	vm, err := set.newVM()
+	if err != nil {
+		return nil, err
+	}
+	set.vms.Put(vm)
+	return set, nil
+}
+
+func (s *scriptSet) newVM() (*scriptVM, error) {
+	vm := &scriptVM{runtime: goja.New()}
+	vm.runtime.SetFieldNameMapper(goja.TagFieldNameMapper("json", true))
+	vm.runtime.Set("log", func(args ...any) {
+		log.Println(append([]any{"Script:"}, args...)...)
+	})
+	for i, program := range s.programs {
+		name := s.names[i]
+		if _, err := vm.runtime.RunProgram(program); err != nil {
+			return nil, err
+		}
+
+		// Scripts share the global scope, so the functions of each are
+		// collected before the next one runs.
+		if fn, ok := goja.AssertFunction(vm.runtime.Get("transformRequest")); ok {
+			vm.requests = append(vm.requests, scriptFunc{name, fn})
+		}
+		if fn, ok := goja.AssertFunction(vm.runtime.Get("transformResponse")); ok {
+			vm.responses = append(vm.responses, scriptFunc{name, fn})
+		}
+		vm.runtime.Set("transformRequest", goja.Undefined())
+		vm.runtime.Set("transformResponse", goja.Undefined())
+	}
+	return vm, nil
+}
+
+// scriptTransform runs the scripts for one translation. Its state object is
+// passed to every call, so that a script can restore in the response what
+// it protected in the request.
+type scriptTransform struct {
+	set   *scriptSet
+	vm    *scriptVM
+	state goja.Value
+}
+
+// newScriptTransform returns nil when there are no scripts.
+func newScriptTransform() (*scriptTransform, error) {
+	set := scripts.Load()
+	if set == nil {
+		return nil, nil
+	}
+	vm, ok := set.vms.Get().(*scriptVM)
+	if !ok {
+		var err error
+		if vm, err = set.newVM(); err != nil {
+			return nil, err
+		}
+	}
+	return &scriptTransform{set: set, vm: vm, state: vm.runtime.NewObject()}, nil
+}
+
+func (t *scriptTransform) request(request *scriptRequest) error {
+	if t == nil {
+		return nil
+	}
+	for _, fn := range t.vm.requests {
+		if err := t.call(fn, request); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *scriptTransform) response(response *scriptResponse) error {
+	if t == nil {
+		return nil
+	}
+	for _, fn := range t.vm.responses {
+		if err := t.call(fn, response); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// call runs fn with the object it transforms, interrupting it after
+// SCRIPT_TIMEOUT.
+func (t *scriptTransform) call(fn scriptFunc, object any) error {
+	runtime := t.vm.runtime
+	done := make(chan struct{})
+	timer := time.AfterFunc(cfg().ScriptTimeout, func() {
+		runtime.Interrupt("timed out")
+		close(done)
+	})
+	_, err := fn.call(goja.Undefined(), runtime.ToValue(object), t.state)
+	if !timer.Stop() {
+		// The interrupt fired, possibly after the call returned.
+		<-done
+		runtime.ClearInterrupt()
+	}
+
+	var interrupted *goja.InterruptedError
+	if errors.As(err, &interrupted) {
+		return fmt.Errorf("%s timed out after %v", fn.script, cfg().ScriptTimeout)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", fn.script, err)
+	}
+	return nil
+}
+
+// release returns the runtime to the pool.
+func (t *scriptTransform) release() {
+	if t != nil {
+		t.set.vms.Put(t.vm)
+	}
+}
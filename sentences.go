@@ -0,0 +1,199 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+// sentence is one unit of a split input text. Lead and Sep hold the
+// whitespace around the sentence so the translated text can be reassembled
+// with the original layout.
+type sentence struct {
+	Lead string
+	Text string
+	Sep  string
+}
+
+func isSentenceTerminator(r rune) bool {
+	switch r {
+	case '.', '!', '?', '…':
+		return true
+	}
+	return false
+}
+
+// isFullwidthTerminator reports whether r ends a sentence on its own, as
+// CJK punctuation is not followed by whitespace.
+func isFullwidthTerminator(r rune) bool {
+	switch r {
+	case '。', '！', '？':
+		return true
+	}
+	return false
+}
+
+// abbreviations are words commonly written with a period that doesn't end
+// the sentence, in lower case and without their final period.
+var abbreviations = map[string]bool{
+	"mr": true, "mrs": true, "ms": true, "dr": true, "prof": true, "st": true,
+	"jr": true, "sr": true, "vs": true, "etc": true, "e.g": true, "i.e": true,
+	"cf": true, "approx": true, "no": true, "fig": true, "vol": true,
+	"inc": true, "ltd": true, "co": true, "corp": true, "dept": true,
+	"z.b": true, "bzw": true, "usw": true, "ca": true, "nr": true,
+}
+
+// isAbbreviation reports whether the period at runes[end] belongs to an
+// abbreviation or an initial such as the "J." of "J. Smith", rather than
+// ending a sentence.
+func isAbbreviation(runes []rune, end int) bool {
+	start := end
+	for start > 0 && !unicode.IsSpace(runes[start-1]) {
+		start--
+	}
+	word := strings.TrimLeftFunc(string(runes[start:end]), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if abbreviations[strings.ToLower(word)] {
+		return true
+	}
+	letters := []rune(word)
+	return len(letters) == 1 && unicode.IsUpper(letters[0])
+}
+
+// splitSentences splits text into sentences at terminal punctuation followed
+// by whitespace and at line breaks. Whitespace-only input yields no sentences.
+// A period after an abbreviation or an initial doesn't end a sentence.
+func splitSentences(text string) []sentence {
+	runes := []rune(text)
+	var segments []sentence
+
+	i := 0
+	for i < len(runes) && unicode.IsSpace(runes[i]) {
+		i++
+	}
+	lead := string(runes[:i])
+
+	for i < len(runes) {
+		start := i
+		for i < len(runes) {
+			r := runes[i]
+			if r == '\n' {
+				break
+			}
+			i++
+			if isFullwidthTerminator(r) {
+				break
+			}
+			if isSentenceTerminator(r) && (i == len(runes) || unicode.IsSpace(runes[i])) {
+				if r == '.' && i < len(runes) && isAbbreviation(runes, i-1) {
+					continue
+				}
+				break
+			}
+		}
+		end := i
+		for i < len(runes) && unicode.IsSpace(runes[i]) {
+			i++
+		}
+		segments = append(segments, sentence{
+			Text: string(runes[start:end]),
+			Sep:  string(runes[end:i]),
+		})
+	}
+
+	if len(segments) > 0 {
+		segments[0].Lead = lead
+	}
+	return segments
+}
+
+// splitLines splits text into its non-blank lines. Indentation, trailing
+// whitespace and blank lines end up in Lead and Sep, so translating each line
+// separately keeps the exact line structure of the input.
+func splitLines(text string) []sentence {
+	var segments []sentence
+
+	trimmed := strings.TrimLeftFunc(text, unicode.IsSpace)
+	lead := text[:len(text)-len(trimmed)]
+	for trimmed != "" {
+		end := strings.IndexByte(trimmed, '\n')
+		if end < 0 {
+			end = len(trimmed)
+		}
+		line := strings.TrimRightFunc(trimmed[:end], unicode.IsSpace)
+		rest := strings.TrimLeftFunc(trimmed[len(line):], unicode.IsSpace)
+
+		segments = append(segments, sentence{
+			Text: line,
+			Sep:  trimmed[len(line) : len(trimmed)-len(rest)],
+		})
+		trimmed = rest
+	}
+
+	if len(segments) > 0 {
+		segments[0].Lead = lead
+	}
+	return segments
+}
+
+// lineLayout describes count upstream texts joined by newlines, which is how
+// the upstream splits a single text into several segments.
+func lineLayout(count int) []sentence {
+	layout := make([]sentence, count)
+	for i := 0; i < count-1; i++ {
+		layout[i].Sep = "\n"
+	}
+	return layout
+}
+
+// assembleText rebuilds the full translation from the upstream texts using
+// the whitespace recorded in layout, discarding any whitespace the upstream
+// added or kept around each text. With alt >= 0, the alt-th alternative of
+// each segment is used where available, falling back to the main translation.
+func assembleText(layout []sentence, texts []upstreamText, alt int) string {
+	var data strings.Builder
+	for i, segment := range layout {
+		data.WriteString(segment.Lead)
+		if i < len(texts) {
+			text := texts[i].Text
+			if alt >= 0 && alt < len(texts[i].Alternatives) {
+				text = texts[i].Alternatives[alt].Text
+			}
+			data.WriteString(strings.TrimSpace(text))
+		}
+		data.WriteString(segment.Sep)
+	}
+	return data.String()
+}
+
+// combineAlternatives builds full-text alternatives from the alternatives of
+// every segment, so long inputs keep the alternatives of all their parts.
+func combineAlternatives(layout []sentence, texts []upstreamText) []string {
+	count := 0
+	for _, text := range texts {
+		count = max(count, len(text.Alternatives))
+	}
+
+	alternatives := make([]string, 0, count)
+	for alt := 0; alt < count; alt++ {
+		alternatives = append(alternatives, assembleText(layout, texts, alt))
+	}
+	return alternatives
+}
+
+// alignSentences pairs each source sentence with the upstream text at the
+// same index.
+func alignSentences(segments []sentence, texts []upstreamText) []SentenceResult {
+	sentences := make([]SentenceResult, 0, len(segments))
+	for i, segment := range segments {
+		item := SentenceResult{Source: segment.Text}
+		if i < len(texts) {
+			item.Text = texts[i].Text
+			for _, alt := range texts[i].Alternatives {
+				item.Alternatives = append(item.Alternatives, alt.Text)
+			}
+		}
+		sentences = append(sentences, item)
+	}
+	return sentences
+}
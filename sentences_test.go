@@ -0,0 +1,37 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestSplitSentences checks where texts are split, and that abbreviations
+// and initials keep their sentence together.
+func TestSplitSentences(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		text string
+		want []string
+	}{
+		{"terminators", "Hello. How are you? Fine!", []string{"Hello.", "How are you?", "Fine!"}},
+		{"title", "Dr. Smith is here. He waits.", []string{"Dr. Smith is here.", "He waits."}},
+		{"latin", "Use a tag, e.g. <b>, or i.e. bold. Done.", []string{"Use a tag, e.g. <b>, or i.e. bold.", "Done."}},
+		{"parenthesized", "Some fruit (e.g. apples) is sold. More later.", []string{"Some fruit (e.g. apples) is sold.", "More later."}},
+		{"initials", "J. R. R. Tolkien wrote it. It is long.", []string{"J. R. R. Tolkien wrote it.", "It is long."}},
+		{"lower case word", "It is big. it is red.", []string{"It is big.", "it is red."}},
+		{"decimal", "It costs 3.50 euros. Cheap.", []string{"It costs 3.50 euros.", "Cheap."}},
+		{"fullwidth", "你好。再见。", []string{"你好。", "再见。"}},
+		{"lines", "One\nTwo", []string{"One", "Two"}},
+		{"blank", "  \n ", nil},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var got []string
+			for _, segment := range splitSentences(test.text) {
+				got = append(got, segment.Text)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("splitSentences(%q) = %q, want %q", test.text, got, test.want)
+			}
+		})
+	}
+}
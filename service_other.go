@@ -0,0 +1,8 @@
+//go:build !windows
+
+package main
+
+// platformCommands returns the commands only available on some platforms.
+func platformCommands() map[string]cliCommand {
+	return nil
+}
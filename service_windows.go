@@ -0,0 +1,243 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/windows/registry"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/eventlog"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// serviceStopTimeout is how long `deeplx service stop` waits for the service
+// to stop.
+const serviceStopTimeout = time.Minute
+
+func platformCommands() map[string]cliCommand {
+	return map[string]cliCommand{
+		"service": {Summary: "Install, start, stop or remove the Windows service", Args: []string{"install", "start", "stop", "remove"}, Setup: serviceCommand},
+	}
+}
+
+func serviceCommand() (*flag.FlagSet, func() error) {
+	flags := flag.NewFlagSet("service", flag.ContinueOnError)
+	name := flags.String("name", "deeplx", "name of the service")
+	configPath := flags.String("config", "", "config file the service loads, set as its CONFIG_FILE (install only)")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: deeplx service install|start|stop|remove [flags]")
+		flags.PrintDefaults()
+	}
+
+	return flags, func() error {
+		// Flags may follow the action, as in "service install --config x".
+		action := flags.Arg(0)
+		if err := flags.Parse(flags.Args()[min(1, flags.NArg()):]); err != nil {
+			return err
+		}
+
+		switch action {
+		case "install":
+			return installService(*name, *configPath)
+		case "remove":
+			return removeService(*name)
+		case "start":
+			return startService(*name)
+		case "stop":
+			return stopService(*name)
+		case "run":
+			// Run by the service control manager.
+			return runService(*name)
+		default:
+			flags.Usage()
+			return fmt.Errorf("unknown service command %q", action)
+		}
+	}
+}
+
+func installService(name, configPath string) error {
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+
+	if s, err := m.OpenService(name); err == nil {
+		s.Close()
+		return fmt.Errorf("service %s already exists", name)
+	}
+	s, err := m.CreateService(name, executable, mgr.Config{
+		DisplayName: "DeepLX",
+		Description: "DeepLX translation server",
+		StartType:   mgr.StartAutomatic,
+	}, "service", "run", "--name", name)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	// Services don't see the environment of the user installing them, so
+	// the config file is set in the service's own environment.
+	if configPath != "" {
+		if err := setServiceConfig(name, configPath); err != nil {
+			s.Delete()
+			return err
+		}
+	}
+	if err := eventlog.InstallAsEventCreate(name, eventlog.Error|eventlog.Warning|eventlog.Info); err != nil {
+		s.Delete()
+		return fmt.Errorf("failed to register event log source: %w", err)
+	}
+	fmt.Printf("Installed service %s\n", name)
+	return nil
+}
+
+func setServiceConfig(name, configPath string) error {
+	configPath, err := filepath.Abs(configPath)
+	if err != nil {
+		return err
+	}
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE, `SYSTEM\CurrentControlSet\Services\`+name, registry.SET_VALUE)
+	if err != nil {
+		return err
+	}
+	defer key.Close()
+	return key.SetStringsValue("Environment", []string{"CONFIG_FILE=" + configPath})
+}
+
+func removeService(name string) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(name)
+	if err != nil {
+		return fmt.Errorf("service %s is not installed", name)
+	}
+	defer s.Close()
+	if err := s.Delete(); err != nil {
+		return err
+	}
+	if err := eventlog.Remove(name); err != nil {
+		return fmt.Errorf("failed to remove event log source: %w", err)
+	}
+	fmt.Printf("Removed service %s\n", name)
+	return nil
+}
+
+func startService(name string) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(name)
+	if err != nil {
+		return fmt.Errorf("service %s is not installed", name)
+	}
+	defer s.Close()
+	return s.Start()
+}
+
+func stopService(name string) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(name)
+	if err != nil {
+		return fmt.Errorf("service %s is not installed", name)
+	}
+	defer s.Close()
+
+	status, err := s.Control(svc.Stop)
+	if err != nil {
+		return err
+	}
+	deadline := time.Now().Add(serviceStopTimeout)
+	for status.State != svc.Stopped {
+		if time.Now().After(deadline) {
+			return errors.New("timed out waiting for the service to stop")
+		}
+		time.Sleep(300 * time.Millisecond)
+		if status, err = s.Query(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runService runs the server under the service control manager, logging to
+// the event log.
+func runService(name string) error {
+	events, err := eventlog.Open(name)
+	if err != nil {
+		return err
+	}
+	defer events.Close()
+	log.SetFlags(0)
+	log.SetOutput(eventLogWriter{events})
+
+	return svc.Run(name, windowsService{})
+}
+
+// eventLogWriter writes log lines to the event log, as errors when they
+// report one.
+type eventLogWriter struct {
+	events *eventlog.Log
+}
+
+func (w eventLogWriter) Write(p []byte) (int, error) {
+	message := strings.TrimSpace(string(p))
+	write := w.events.Info
+	if strings.HasPrefix(message, "Error") {
+		write = w.events.Error
+	}
+	return len(p), write(1, message)
+}
+
+// windowsService serves until the service control manager asks it to stop.
+type windowsService struct{}
+
+func (windowsService) Execute(_ []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.StartPending}
+	stopped := make(chan struct{})
+	go func() {
+		serve()
+		close(stopped)
+	}()
+	status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+
+	for {
+		select {
+		case <-stopped:
+			return false, 0
+		case request := <-requests:
+			switch request.Cmd {
+			case svc.Interrogate:
+				status <- request.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				status <- svc.Status{State: svc.StopPending}
+				stopRequests <- syscall.SIGTERM
+				<-stopped
+				return false, 0
+			}
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Headers of signed requests.
+const (
+	HeaderSigningKey = "X-DeepLX-Key"
+	HeaderTimestamp  = "X-DeepLX-Timestamp"
+	HeaderNonce      = "X-DeepLX-Nonce"
+	HeaderSignature  = "X-DeepLX-Signature"
+)
+
+// signingKeyLocal holds the id of the key a request was signed with.
+const signingKeyLocal = "signingKey"
+
+// requestSignature signs a request with a key of SIGNING_KEYS: the hex
+// HMAC-SHA256 of the timestamp, nonce, method, path with query, and body,
+// each followed by a newline except the body. The nonce tells identical
+// requests sent within a second apart.
+func requestSignature(secret string, timestamp int64, nonce, method, uri string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "\n" + nonce + "\n" + method + "\n" + uri + "\n"))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// parseSigningKeys reads "id:secret" pairs.
+func parseSigningKeys(value string) map[string]string {
+	keys := make(map[string]string)
+	for _, item := range splitList(value) {
+		if id, secret, ok := strings.Cut(item, ":"); ok && id != "" && secret != "" {
+			keys[id] = secret
+		}
+	}
+	return keys
+}
+
+// signatureCache remembers the signatures accepted until their timestamp
+// leaves SIGNING_WINDOW, so a captured request can't be sent again. They are
+// kept in sharedStore when Redis is configured, so a request can't be
+// replayed against another replica either.
+type signatureCache struct {
+	mu      sync.Mutex
+	expires map[string]time.Time
+}
+
+var signatures = &signatureCache{expires: make(map[string]time.Time)}
+
+// remember records a signature until expires and reports whether it was
+// new.
+func (s *signatureCache) remember(signature string, expires time.Time) bool {
+	now := time.Now()
+	if counter, ok := sharedStore.(sharedCounter); ok {
+		// Counting the signature tells the first use apart in one step,
+		// even when copies reach several replicas at once.
+		if count, _, err := counter.Increment("signature:"+signature, 1, expires); err == nil {
+			return count == 1
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for seen, until := range s.expires {
+		if !now.Before(until) {
+			delete(s.expires, seen)
+		}
+	}
+	if _, ok := s.expires[signature]; ok {
+		return false
+	}
+	s.expires[signature] = expires
+	return true
+}
+
+// verifySignature checks requests carrying an X-DeepLX-Signature and
+// identifies their caller by the signing key, as an alternative to a bearer
+// token from API_TOKENS that never sends the secret. Requests without a
+// signature are left to the other checks.
+func verifySignature(c *fiber.Ctx) error {
+	signature := c.Get(HeaderSignature)
+	if signature == "" {
+		return c.Next()
+	}
+
+	id := c.Get(HeaderSigningKey)
+	secret, known := cfg().SigningKeys[id]
+	timestamp, err := strconv.ParseInt(c.Get(HeaderTimestamp), 10, 64)
+	signed := time.Unix(timestamp, 0)
+	if !known || err != nil || time.Since(signed).Abs() > cfg().SigningWindow ||
+		!hmac.Equal([]byte(signature), []byte(requestSignature(secret, timestamp, c.Get(HeaderNonce), c.Method(), c.OriginalURL(), c.Body()))) {
+		return c.Status(401).JSON(fiber.Map{"code": 401, "message": "Invalid request signature"})
+	}
+	if !signatures.remember(id+":"+signature, signed.Add(cfg().SigningWindow)) {
+		return c.Status(401).JSON(fiber.Map{"code": 401, "message": "Replayed request signature"})
+	}
+	c.Locals(signingKeyLocal, id)
+	return c.Next()
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// TestVerifySignature checks which signed requests are accepted, and that
+// an accepted signature can't be replayed, on the same or another replica.
+func TestVerifySignature(t *testing.T) {
+	withConfig(t, func(c *Config) {
+		c.SigningKeys = map[string]string{"cli": "s3cret"}
+		c.SigningWindow = 5 * time.Minute
+	})
+	app := fiber.New()
+	app.Post("/translate", verifySignature, func(c *fiber.Ctx) error {
+		id, _ := c.Locals(signingKeyLocal).(string)
+		return c.SendString(id)
+	})
+
+	type signed struct {
+		key, secret, nonce, uri, body string
+		age                           time.Duration
+		// sentURI and sentBody, when set, replace what was signed.
+		sentURI, sentBody string
+	}
+	send := func(request signed) (int, string) {
+		t.Helper()
+		timestamp := time.Now().Add(-request.age).Unix()
+		signature := requestSignature(request.secret, timestamp, request.nonce, http.MethodPost, request.uri, []byte(request.body))
+		uri, body := request.uri, request.body
+		if request.sentURI != "" {
+			uri = request.sentURI
+		}
+		if request.sentBody != "" {
+			body = request.sentBody
+		}
+		r := httptest.NewRequest(http.MethodPost, uri, strings.NewReader(body))
+		r.Header.Set(HeaderSigningKey, request.key)
+		r.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+		r.Header.Set(HeaderNonce, request.nonce)
+		r.Header.Set(HeaderSignature, signature)
+		response, err := app.Test(r, -1)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		data, _ := io.ReadAll(response.Body)
+		return response.StatusCode, string(data)
+	}
+
+	for _, test := range []struct {
+		name    string
+		request signed
+		status  int
+	}{
+		{"valid", signed{key: "cli", secret: "s3cret", nonce: "1", uri: "/translate", body: `{"text":"a"}`}, 200},
+		{"valid with query", signed{key: "cli", secret: "s3cret", nonce: "2", uri: "/translate?x=1", body: `{"text":"a"}`}, 200},
+		{"skew within window", signed{key: "cli", secret: "s3cret", nonce: "3", uri: "/translate", body: `{}`, age: 4 * time.Minute}, 200},
+		{"future within window", signed{key: "cli", secret: "s3cret", nonce: "4", uri: "/translate", body: `{}`, age: -4 * time.Minute}, 200},
+		{"too old", signed{key: "cli", secret: "s3cret", nonce: "5", uri: "/translate", body: `{}`, age: 6 * time.Minute}, 401},
+		{"too far ahead", signed{key: "cli", secret: "s3cret", nonce: "6", uri: "/translate", body: `{}`, age: -6 * time.Minute}, 401},
+		{"tampered body", signed{key: "cli", secret: "s3cret", nonce: "7", uri: "/translate", body: `{"text":"a"}`, sentBody: `{"text":"b"}`}, 401},
+		{"tampered query", signed{key: "cli", secret: "s3cret", nonce: "8", uri: "/translate?x=1", body: `{}`, sentURI: "/translate?x=2"}, 401},
+		{"wrong secret", signed{key: "cli", secret: "other", nonce: "9", uri: "/translate", body: `{}`}, 401},
+		{"unknown key", signed{key: "nobody", secret: "s3cret", nonce: "10", uri: "/translate", body: `{}`}, 401},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			status, body := send(test.request)
+			if status != test.status {
+				t.Errorf("status %d (%s), want %d", status, body, test.status)
+			}
+			if status == 200 && body != "cli" {
+				t.Errorf("caller %q, want cli", body)
+			}
+		})
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/translate", strings.NewReader(`{}`))
+	if response, err := app.Test(r, -1); err != nil || response.StatusCode != 200 {
+		t.Errorf("unsigned request was not passed on")
+	}
+
+	replayed := signed{key: "cli", secret: "s3cret", nonce: "replay", uri: "/translate", body: `{}`}
+	if status, _ := send(replayed); status != 200 {
+		t.Fatalf("first request: status %d", status)
+	}
+	if status, body := send(replayed); status != 401 || !strings.Contains(body, "Replayed") {
+		t.Errorf("replay: status %d (%s), want 401", status, body)
+	}
+
+	// Through the shared store, another replica rejects the replay too.
+	withSharedStore(t)
+	shared := signed{key: "cli", secret: "s3cret", nonce: "shared", uri: "/translate", body: `{}`}
+	if status, _ := send(shared); status != 200 {
+		t.Fatalf("first shared request: status %d", status)
+	}
+	previous := signatures
+	signatures = &signatureCache{expires: make(map[string]time.Time)}
+	t.Cleanup(func() { signatures = previous })
+	if status, _ := send(shared); status != 401 {
+		t.Errorf("replay on another replica: status %d, want 401", status)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const slackUsage = "Usage: `/translate <target language> <text>`, for example `/translate de hello world`."
+
+// slackAckTimeout is how long a command may take before it is acknowledged
+// and the translation is sent to its response_url instead. Slack gives up
+// on commands that are not answered within three seconds.
+const slackAckTimeout = 2500 * time.Millisecond
+
+// verifySlackSignature checks the X-Slack-Signature of a request against
+// the signing secret, rejecting requests older than five minutes to stop
+// replays.
+func verifySlackSignature(c *fiber.Ctx, secret string) bool {
+	timestamp, err := strconv.ParseInt(c.Get("X-Slack-Request-Timestamp"), 10, 64)
+	if err != nil || time.Since(time.Unix(timestamp, 0)).Abs() > 5*time.Minute {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("v0:" + strconv.FormatInt(timestamp, 10) + ":"))
+	mac.Write(c.Body())
+	expected := "v0=" + hex.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(expected), []byte(c.Get("X-Slack-Signature")))
+}
+
+// slackMessage is the reply to a slash command.
+type slackMessage struct {
+	ResponseType string `json:"response_type"`
+	Text         string `json:"text"`
+}
+
+// handleSlackCommand answers slash commands such as "/translate de hello
+// world" with the translation.
+func handleSlackCommand(c *fiber.Ctx) error {
+	if !verifySlackSignature(c, cfg().SlackSigningSecret) {
+		return c.Status(401).JSON(fiber.Map{"code": 401, "message": "Invalid Slack signature"})
+	}
+
+	lang, text, _ := strings.Cut(strings.TrimSpace(c.FormValue("text")), " ")
+	text = strings.TrimSpace(text)
+	if lang == "" || text == "" {
+		return c.JSON(slackMessage{ResponseType: "ephemeral", Text: slackUsage})
+	}
+	if !callerLimits.allow("slack:" + c.FormValue("team_id") + ":" + c.FormValue("user_id")) {
+		return c.JSON(slackMessage{ResponseType: "ephemeral", Text: "Too many requests, please try again later."})
+	}
+
+	replies := make(chan slackMessage, 1)
+	params := TranslateParams{Text: text, TargetLang: strings.ToUpper(lang)}
+	go func() {
+		result := translate(params)
+		if result.Code != 200 {
+			replies <- slackMessage{ResponseType: "ephemeral", Text: "Translation failed: " + result.Message}
+			return
+		}
+		replies <- slackMessage{ResponseType: cfg().SlackResponseType, Text: result.Data}
+	}()
+
+	select {
+	case reply := <-replies:
+		return c.JSON(reply)
+	case <-time.After(slackAckTimeout):
+		responseURL := c.FormValue("response_url")
+		go func() {
+			postSlackResponse(responseURL, <-replies)
+		}()
+		return c.SendStatus(200)
+	}
+}
+
+func postSlackResponse(responseURL string, reply slackMessage) {
+	if !strings.HasPrefix(responseURL, "https://hooks.slack.com/") {
+		log.Printf("Error posting Slack response: unexpected response_url %q", responseURL)
+		return
+	}
+	body, _ := json.Marshal(reply)
+	resp, err := http.Post(responseURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Printf("Error posting Slack response: %v", err)
+		return
+	}
+	resp.Body.Close()
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"net/netip"
+	"sync/atomic"
+)
+
+// sourceAddrKey is the context key of the local address an upstream
+// request connects from.
+type sourceAddrKey struct{}
+
+// sourceAddrIndex selects the entry of SOURCE_ADDRS the next upstream
+// request connects from.
+var sourceAddrIndex atomic.Uint64
+
+// parseSourceAddr reads an address such as "192.0.2.1", or a prefix such as
+// "2001:db8::/64" to connect from random addresses of.
+func parseSourceAddr(value string) (netip.Prefix, error) {
+	if addr, err := netip.ParseAddr(value); err == nil {
+		return netip.PrefixFrom(addr, addr.BitLen()), nil
+	}
+	prefix, err := netip.ParsePrefix(value)
+	return prefix.Masked(), err
+}
+
+// withSourceAddr picks the local address the request made with ctx connects
+// from, taking the entries of SOURCE_ADDRS in turn. ok is false when
+// SOURCE_ADDRS is unset.
+func withSourceAddr(ctx context.Context) (_ context.Context, ok bool) {
+	prefixes := cfg().SourceAddrs
+	if len(prefixes) == 0 {
+		return ctx, false
+	}
+	prefix := prefixes[(sourceAddrIndex.Add(1)-1)%uint64(len(prefixes))]
+	return context.WithValue(ctx, sourceAddrKey{}, randomAddr(prefix)), true
+}
+
+// randomAddr returns a random address of prefix.
+func randomAddr(prefix netip.Prefix) netip.Addr {
+	if prefix.IsSingleIP() {
+		return prefix.Addr()
+	}
+	b := prefix.Addr().AsSlice()
+	for bit := prefix.Bits(); bit < len(b)*8; bit++ {
+		if rand.Intn(2) == 1 {
+			b[bit/8] |= 0x80 >> (bit % 8)
+		}
+	}
+	addr, _ := netip.AddrFromSlice(b)
+	return addr
+}
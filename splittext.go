@@ -0,0 +1,281 @@
+package main
+
+import (
+	"log"
+	"strings"
+	"unicode/utf8"
+)
+
+// jobsPerCall caps the sentences sent in one LMT_handle_jobs call, so very
+// long texts are translated over several calls.
+const jobsPerCall = 50
+
+// jobContext is the number of sentences sent as context before a job.
+const jobContext = 5
+
+// langPreference is the language preference the web client sends, which
+// it leaves at its defaults.
+type langPreference struct {
+	Weight  map[string]float64 `json:"weight"`
+	Default string             `json:"default"`
+}
+
+// splitTextRequest asks the upstream to split texts into sentences, the
+// first call of the web client for long texts.
+type splitTextRequest struct {
+	Jsonrpc string `json:"jsonrpc"`
+	Method  string `json:"method"`
+	ID      int64  `json:"id"`
+	Params  struct {
+		Texts           []string        `json:"texts"`
+		CommonJobParams CommonJobParams `json:"commonJobParams"`
+		Lang            struct {
+			LangUserSelected string         `json:"lang_user_selected"`
+			Preference       langPreference `json:"preference"`
+		} `json:"lang"`
+	} `json:"params"`
+}
+
+// splitTextResult lists the sentences of every text, grouped in chunks.
+type splitTextResult struct {
+	Result struct {
+		Lang struct {
+			Detected string `json:"detected"`
+		} `json:"lang"`
+		Texts []splitTextChunks `json:"texts"`
+	} `json:"result"`
+}
+
+type splitTextChunks struct {
+	Chunks []struct {
+		Sentences []splitSentence `json:"sentences"`
+	} `json:"chunks"`
+}
+
+// splitSentence is a sentence split by the upstream. Prefix is the
+// whitespace before it.
+type splitSentence struct {
+	Prefix string `json:"prefix"`
+	Text   string `json:"text"`
+}
+
+// upstreamJob asks for the translation of one sentence, given the
+// sentences around it as context.
+type upstreamJob struct {
+	Kind               string        `json:"kind"`
+	Sentences          []jobSentence `json:"sentences"`
+	RawEnContextBefore []string      `json:"raw_en_context_before"`
+	RawEnContextAfter  []string      `json:"raw_en_context_after"`
+	PreferredNumBeams  int           `json:"preferred_num_beams"`
+}
+
+type jobSentence struct {
+	Text   string `json:"text"`
+	ID     int    `json:"id"`
+	Prefix string `json:"prefix"`
+}
+
+// handleJobsRequest translates the sentences split by LMT_split_text.
+type handleJobsRequest struct {
+	Jsonrpc string `json:"jsonrpc"`
+	Method  string `json:"method"`
+	ID      int64  `json:"id"`
+	Params  struct {
+		Jobs []upstreamJob `json:"jobs"`
+		Lang struct {
+			Preference         langPreference `json:"preference"`
+			SourceLangComputed string         `json:"source_lang_computed"`
+			TargetLang         string         `json:"target_lang"`
+		} `json:"lang"`
+		Priority        int              `json:"priority"`
+		CommonJobParams *CommonJobParams `json:"commonJobParams"`
+		Timestamp       int64            `json:"timestamp"`
+	} `json:"params"`
+}
+
+// handleJobsResult holds the beams of every job, best first.
+type handleJobsResult struct {
+	Result struct {
+		Translations []jobTranslation `json:"translations"`
+		SourceLang   string           `json:"source_lang"`
+	} `json:"result"`
+}
+
+type jobTranslation struct {
+	Beams []struct {
+		Sentences []struct {
+			Text string `json:"text"`
+		} `json:"sentences"`
+	} `json:"beams"`
+}
+
+func (b requestBuilder) splitText(params TranslateParams, texts []string) (string, error) {
+	var request splitTextRequest
+	request.Jsonrpc, request.Method, request.ID = "2.0", "LMT_split_text", newRequestID(b.ids)
+	request.Params.Texts = texts
+	request.Params.CommonJobParams.Mode = "translate"
+	request.Params.Lang.LangUserSelected = strings.ToUpper(params.SourceLang)
+	if request.Params.Lang.LangUserSelected == "" {
+		request.Params.Lang.LangUserSelected = "auto"
+	}
+	request.Params.Lang.Preference = langPreference{Weight: map[string]float64{}, Default: "default"}
+	return encodeRequest(request, request.ID)
+}
+
+func (b requestBuilder) handleJobs(params TranslateParams, sourceLang string, jobs []upstreamJob) (string, error) {
+	var request handleJobsRequest
+	request.Jsonrpc, request.Method, request.ID = "2.0", "LMT_handle_jobs", newRequestID(b.ids)
+	request.Params.Jobs = jobs
+	request.Params.Lang.Preference = langPreference{Weight: map[string]float64{}, Default: "default"}
+	request.Params.Lang.SourceLangComputed = strings.ToUpper(sourceLang)
+	request.Params.Lang.TargetLang = strings.ToUpper(params.TargetLang)
+	if request.Params.Lang.TargetLang == "" {
+		request.Params.Lang.TargetLang = "EN"
+	}
+	request.Params.Priority = 1
+	request.Params.CommonJobParams = jobParams(params)
+	if request.Params.CommonJobParams == nil {
+		request.Params.CommonJobParams = &CommonJobParams{Mode: "translate"}
+	}
+	var texts strings.Builder
+	for _, job := range jobs {
+		for _, sentence := range job.Sentences {
+			texts.WriteString(sentence.Text)
+		}
+	}
+	request.Params.Timestamp = calculateTimestamp(texts.String(), b.clock)
+	return encodeRequest(request, request.ID)
+}
+
+// useSplitText reports whether a text is long enough to be translated
+// sentence by sentence, as the web client does above SPLIT_TEXT_THRESHOLD.
+func useSplitText(params TranslateParams) bool {
+	threshold := cfg().SplitTextThreshold
+	return threshold > 0 && utf8.RuneCountInString(params.Text) > threshold
+}
+
+// translateSplitText translates a text with the web client's flow for long
+// texts: LMT_split_text splits its lines into sentences, and LMT_handle_jobs
+// translates them, jobsPerCall at a time. It returns the sentences, with the
+// whitespace of the text around them, their translations in the same order,
+// the other beams as alternatives, and the indexes of the sentences left as
+// GAP_MARKER because their chunk failed twice. It fails when every chunk did.
+func translateSplitText(params TranslateParams) ([]sentence, upstreamResult, []int, error) {
+	var result upstreamResult
+	lines := splitLines(params.Text)
+	texts := make([]string, len(lines))
+	for i, line := range lines {
+		texts[i] = line.Text
+	}
+
+	var split splitTextResult
+	err := callUpstream(params, func(target *upstreamTarget) (string, error) {
+		return target.builder().splitText(params, texts)
+	}, &split)
+	if err != nil {
+		return nil, result, nil, err
+	}
+	if len(split.Result.Texts) != len(lines) {
+		log.Printf("Upstream split %d texts into %d", len(lines), len(split.Result.Texts))
+		return nil, result, nil, &translateError{Code: 500, Message: "Failed to split text"}
+	}
+
+	var segments []sentence
+	for i, text := range split.Result.Texts {
+		first := len(segments)
+		for _, chunk := range text.Chunks {
+			for _, s := range chunk.Sentences {
+				segments = append(segments, sentence{Lead: s.Prefix, Text: s.Text})
+			}
+		}
+		if len(segments) == first {
+			// A line the upstream found no sentence in is kept as it is.
+			segments = append(segments, sentence{Text: lines[i].Text})
+		}
+		segments[first].Lead = lines[i].Lead + segments[first].Lead
+		segments[len(segments)-1].Sep = lines[i].Sep
+	}
+
+	sourceLang := params.SourceLang
+	if sourceLang == "" || strings.EqualFold(sourceLang, "auto") {
+		sourceLang = split.Result.Lang.Detected
+	}
+	result.Result.Lang = sourceLang
+
+	// A failed call only loses its own chunk: chunks are retried once,
+	// after the others, and those failing again are left as gaps.
+	result.Result.Texts = make([]upstreamText, len(segments))
+	var failed []int
+	for start := 0; start < len(segments); start += jobsPerCall {
+		if err = translateJobs(params, sourceLang, segments, start, result.Result.Texts); err != nil {
+			failed = append(failed, start)
+		}
+	}
+	var gaps []int
+	for _, start := range failed {
+		if err = translateJobs(params, sourceLang, segments, start, result.Result.Texts); err != nil {
+			log.Printf("Sentences %d to %d of a long text failed twice: %v", start+1, min(start+jobsPerCall, len(segments)), err)
+			for i := start; i < min(start+jobsPerCall, len(segments)); i++ {
+				result.Result.Texts[i].Text = cfg().GapMarker
+				gaps = append(gaps, i)
+			}
+		}
+	}
+	if len(gaps) == len(segments) {
+		return nil, result, nil, err
+	}
+	return segments, result, gaps, nil
+}
+
+// translateJobs translates the chunk of sentences starting at start into
+// texts, with one LMT_handle_jobs call.
+func translateJobs(params TranslateParams, sourceLang string, segments []sentence, start int, texts []upstreamText) error {
+	end := min(start+jobsPerCall, len(segments))
+	jobs := make([]upstreamJob, 0, end-start)
+	for i := start; i < end; i++ {
+		job := upstreamJob{
+			Kind:               "default",
+			Sentences:          []jobSentence{{Text: segments[i].Text, ID: i + 1, Prefix: segments[i].Lead}},
+			RawEnContextBefore: []string{},
+			RawEnContextAfter:  []string{},
+			PreferredNumBeams:  1 + MaxAlternatives,
+		}
+		for _, before := range segments[max(0, i-jobContext):i] {
+			job.RawEnContextBefore = append(job.RawEnContextBefore, before.Text)
+		}
+		if i+1 < len(segments) {
+			job.RawEnContextAfter = append(job.RawEnContextAfter, segments[i+1].Text)
+		}
+		jobs = append(jobs, job)
+	}
+
+	var translated handleJobsResult
+	err := callUpstream(params, func(target *upstreamTarget) (string, error) {
+		return target.builder().handleJobs(params, sourceLang, jobs)
+	}, &translated)
+	if err != nil {
+		return err
+	}
+	if len(translated.Result.Translations) != len(jobs) {
+		log.Printf("Upstream translated %d of %d jobs", len(translated.Result.Translations), len(jobs))
+		return &translateError{Code: 500, Message: "Empty translation result"}
+	}
+	for j, translation := range translated.Result.Translations {
+		var text upstreamText
+		for i, beam := range translation.Beams {
+			var words []string
+			for _, s := range beam.Sentences {
+				words = append(words, s.Text)
+			}
+			if i == 0 {
+				text.Text = strings.Join(words, " ")
+			} else {
+				text.Alternatives = append(text.Alternatives, struct {
+					Text string `json:"text"`
+				}{strings.Join(words, " ")})
+			}
+		}
+		texts[start+j] = text
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"hash/fnv"
+	"math"
+	"net/http/cookiejar"
+)
+
+// stickySession makes a target keep the cookies the upstream sets, like a
+// browser session.
+func stickySession(target *upstreamTarget) {
+	// cookiejar.New only fails for invalid options.
+	jar, _ := cookiejar.New(nil)
+	client := *target.client
+	client.Jar = jar
+	target.client = &client
+}
+
+// stickyTarget picks the target of a client by rendezvous hashing over the
+// targets in rotation, weighted like pick. A client keeps its target while
+// the target stays in rotation, and when one leaves, only its clients move.
+func (p *upstreamPool) stickyTarget(client string) *upstreamTarget {
+	var best *upstreamTarget
+	bestScore := math.Inf(-1)
+	for _, target := range p.available() {
+		hash := fnv.New64a()
+		hash.Write([]byte(client + "|" + target.Endpoint + "|" + target.Proxy))
+		// A uniform number in (0, 1) drawn from the hash.
+		u := (float64(hash.Sum64()>>11) + 0.5) / (1 << 53)
+		weight := target.weight()
+		if weight <= 0 {
+			weight = 1
+		}
+		if score := -weight / math.Log(u); score > bestScore {
+			best, bestScore = target, score
+		}
+	}
+	return best
+}
+
+// sessionTarget returns the target to send a request to with sticky
+// sessions, or nil when the pool picks it.
+func sessionTarget(params TranslateParams) *upstreamTarget {
+	if !cfg().StickySessions || params.client == "" || params.endpoint != "" {
+		return nil
+	}
+	return upstreams.stickyTarget(params.client)
+}
+
+// sendUpstream posts a request made for params: to the endpoint an admin
+// pinned it to, to the target of its client with sticky sessions, or to the
+// targets the pool picks.
+func sendUpstream(params TranslateParams, body requestBody) upstreamReply {
+	if target := sessionTarget(params); target != nil {
+		return postRequest(context.Background(), target, body)
+	}
+	if params.endpoint != "" {
+		return upstreams.callEndpoint(params.endpoint, body)
+	}
+	return upstreams.call(body)
+}
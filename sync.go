@@ -0,0 +1,190 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// syncState holds the hashes of the source pages as they were when last
+// translated, by page path relative to the source directory and by target
+// language.
+type syncState map[string]map[string]string
+
+func loadSyncState(path string) (syncState, error) {
+	state := make(syncState)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return state, nil
+}
+
+func (s syncState) save(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// isContentPage reports whether a file of a content tree is a Markdown page,
+// rather than a resource such as an image.
+func isContentPage(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".md", ".markdown":
+		return true
+	}
+	return false
+}
+
+// syncCommand translates the Markdown pages of a Hugo or Jekyll site into
+// the directories of the target languages. Pages whose source is unchanged
+// since they were last translated are skipped, so only edited pages cost
+// quota.
+func syncCommand() (*flag.FlagSet, func() error) {
+	flags := flag.NewFlagSet("sync", flag.ContinueOnError)
+	client := clientFlags(flags)
+	src := flags.String("src", "content/en", "directory of the source pages")
+	out := flags.String("out", "content/{lang}", "directory of the translated pages, {lang} standing for the target language")
+	source := flags.String("source", "", "source language (detected by default)")
+	targets := flags.String("target", "", "comma-separated target languages")
+	statePath := flags.String("state", ".deeplx-sync.json", "file holding the hashes of the pages last translated")
+	dryRun := flags.Bool("dry-run", false, "list the pages to translate without translating them")
+
+	return flags, func() error {
+		langs := splitList(strings.ToUpper(*targets))
+		if len(langs) == 0 {
+			return errors.New("-target is required")
+		}
+		if len(langs) > 1 && !strings.Contains(*out, "{lang}") {
+			return errors.New("-out must contain {lang} for several target languages")
+		}
+		state, err := loadSyncState(*statePath)
+		if err != nil {
+			return err
+		}
+		// Documents take longer than single texts.
+		client.http.Timeout = 10 * time.Minute
+
+		var pages []string
+		err = filepath.WalkDir(*src, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil || entry.IsDir() || !isContentPage(path) {
+				return err
+			}
+			rel, err := filepath.Rel(*src, path)
+			pages = append(pages, filepath.ToSlash(rel))
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		translated, unchanged, failed := 0, 0, 0
+		for _, page := range pages {
+			data, err := os.ReadFile(filepath.Join(*src, filepath.FromSlash(page)))
+			if err != nil {
+				return err
+			}
+			sum := sha256.Sum256(data)
+			hash := hex.EncodeToString(sum[:])
+
+			for _, lang := range langs {
+				dir := strings.ReplaceAll(*out, "{lang}", strings.ToLower(lang))
+				target := filepath.Join(dir, filepath.FromSlash(page))
+				if _, err := os.Stat(target); err == nil && state[page][lang] == hash {
+					unchanged++
+					continue
+				}
+				if *dryRun {
+					fmt.Printf("%s -> %s\n", page, target)
+					translated++
+					continue
+				}
+
+				params := TranslateParams{SourceLang: strings.ToUpper(*source), TargetLang: lang}
+				result, err := client.translateDocument(filepath.Base(page), data, "md", params)
+				if err == nil {
+					err = os.MkdirAll(filepath.Dir(target), 0o755)
+				}
+				if err == nil {
+					err = os.WriteFile(target, result, 0o644)
+				}
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "%s (%s): %v\n", page, lang, err)
+					failed++
+					continue
+				}
+				if state[page] == nil {
+					state[page] = make(map[string]string)
+				}
+				state[page][lang] = hash
+				// Saved after every page, so an interrupted run resumes
+				// where it stopped.
+				if err := state.save(*statePath); err != nil {
+					return err
+				}
+				fmt.Printf("%s -> %s\n", page, target)
+				translated++
+			}
+		}
+
+		// Translations of removed pages are left for the user to delete,
+		// and reported until they are.
+		var removed []string
+		for page := range state {
+			if _, err := os.Stat(filepath.Join(*src, filepath.FromSlash(page))); err == nil {
+				continue
+			}
+			for lang := range state[page] {
+				target := filepath.Join(strings.ReplaceAll(*out, "{lang}", strings.ToLower(lang)), filepath.FromSlash(page))
+				if _, err := os.Stat(target); err == nil {
+					removed = append(removed, target)
+				} else {
+					delete(state[page], lang)
+				}
+			}
+			if len(state[page]) == 0 {
+				delete(state, page)
+			}
+		}
+		sort.Strings(removed)
+		for _, target := range removed {
+			fmt.Fprintf(os.Stderr, "%s: source page removed\n", target)
+		}
+		if !*dryRun {
+			if err := state.save(*statePath); err != nil {
+				return err
+			}
+		}
+
+		verb := "translated"
+		if *dryRun {
+			verb = "to translate"
+		}
+		fmt.Fprintf(os.Stderr, "%d %s, %d unchanged, %d failed\n", translated, verb, unchanged, failed)
+		if failed > 0 {
+			return fmt.Errorf("%d pages failed", failed)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// sdNotify sends a state such as "READY=1" to systemd. Outside a unit with
+// NotifyAccess, NOTIFY_SOCKET is unset and nothing is sent.
+func sdNotify(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// watchdogInterval returns the WatchdogSec of the unit, or 0 when the
+// watchdog is disabled or meant for another process.
+func watchdogInterval() time.Duration {
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
+
+// notifyReady tells systemd the server listening on addr accepts requests,
+// and keeps its watchdog fed for as long as the server answers them.
+func notifyReady(addr net.Addr) {
+	if err := sdNotify("READY=1"); err != nil {
+		log.Printf("Error notifying systemd: %v", err)
+		return
+	}
+
+	interval := watchdogInterval()
+	if interval == 0 {
+		return
+	}
+	go runWatchdog(addr, interval/2)
+}
+
+// runWatchdog pings systemd's watchdog whenever a request to the server
+// succeeds. When handlers hang, the pings stop and systemd restarts the
+// service.
+func runWatchdog(addr net.Addr, every time.Duration) {
+	network, address := addr.Network(), addr.String()
+	if tcp, ok := addr.(*net.TCPAddr); ok && tcp.IP.IsUnspecified() {
+		loopback := net.IPv6loopback
+		if tcp.IP.To4() != nil {
+			loopback = net.IPv4(127, 0, 0, 1)
+		}
+		address = net.JoinHostPort(loopback.String(), strconv.Itoa(tcp.Port))
+	}
+	client := &http.Client{
+		Timeout: every,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, network, address)
+			},
+		},
+	}
+
+	for range time.Tick(every) {
+		resp, err := client.Get("http://deeplx/")
+		if err != nil {
+			log.Printf("Error probing server for the watchdog: %v", err)
+			continue
+		}
+		resp.Body.Close()
+		if err := sdNotify("WATCHDOG=1"); err != nil {
+			log.Printf("Error notifying systemd: %v", err)
+		}
+	}
+}
+
+// listenFDsStart is the first file descriptor passed by socket activation.
+const listenFDsStart = 3
+
+// activationListener returns the socket passed by systemd socket activation,
+// or nil when the server was started without one.
+func activationListener() (net.Listener, error) {
+	if os.Getenv("LISTEN_PID") != strconv.Itoa(os.Getpid()) {
+		return nil, nil
+	}
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count < 1 {
+		return nil, nil
+	}
+
+	// The variables are meant for this process, not for its children.
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+	if count > 1 {
+		log.Printf("Socket activation passed %d sockets, serving on the first one", count)
+	}
+
+	file := os.NewFile(listenFDsStart, "listen-fd")
+	defer file.Close()
+	return net.FileListener(file)
+}
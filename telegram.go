@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const telegramAPI = "https://api.telegram.org/bot"
+
+const telegramHelp = "Send me a text and I'll translate it to %s.\n\n" +
+	"To pick another language, start with a command such as /de or a prefix such as \"de:\".\n" +
+	"In any chat, type @<this bot> followed by the text to translate inline."
+
+// telegramBot answers messages and inline queries by long polling the
+// Telegram Bot API.
+type telegramBot struct {
+	token      string
+	targetLang string
+	client     *http.Client
+	offset     int64
+}
+
+type telegramUpdate struct {
+	UpdateID    int64                `json:"update_id"`
+	Message     *telegramMessage     `json:"message"`
+	InlineQuery *telegramInlineQuery `json:"inline_query"`
+}
+
+type telegramUser struct {
+	ID int64 `json:"id"`
+}
+
+type telegramMessage struct {
+	MessageID int64         `json:"message_id"`
+	Text      string        `json:"text"`
+	From      *telegramUser `json:"from"`
+	Chat      struct {
+		ID int64 `json:"id"`
+	} `json:"chat"`
+}
+
+type telegramInlineQuery struct {
+	ID    string       `json:"id"`
+	Query string       `json:"query"`
+	From  telegramUser `json:"from"`
+}
+
+func newTelegramBot(token, targetLang string) *telegramBot {
+	return &telegramBot{
+		token:      token,
+		targetLang: targetLang,
+		// Long polls are held open for up to 50 seconds.
+		client: &http.Client{Timeout: time.Minute},
+	}
+}
+
+// call invokes a Bot API method and decodes its result into result.
+func (b *telegramBot) call(method string, payload, result any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	resp, err := b.client.Post(telegramAPI+b.token+"/"+method, "application/json", bytes.NewReader(body))
+	if err != nil {
+		// The error includes the URL, and with it the token.
+		return errors.New(strings.ReplaceAll(err.Error(), b.token, "***"))
+	}
+	defer resp.Body.Close()
+
+	var reply struct {
+		OK          bool            `json:"ok"`
+		Description string          `json:"description"`
+		Result      json.RawMessage `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&reply); err != nil {
+		return err
+	}
+	if !reply.OK {
+		return fmt.Errorf("%s: %s", method, reply.Description)
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(reply.Result, result)
+}
+
+func (b *telegramBot) run() {
+	for {
+		var updates []telegramUpdate
+		err := b.call("getUpdates", map[string]any{
+			"offset":          b.offset,
+			"timeout":         50,
+			"allowed_updates": []string{"message", "inline_query"},
+		}, &updates)
+		if err != nil {
+			log.Printf("Error polling Telegram: %v", err)
+			time.Sleep(5 * time.Second)
+			continue
+		}
+
+		for _, update := range updates {
+			b.offset = update.UpdateID + 1
+			switch {
+			case update.Message != nil && update.Message.Text != "":
+				go b.handleMessage(update.Message)
+			case update.InlineQuery != nil:
+				go b.handleInlineQuery(update.InlineQuery)
+			}
+		}
+	}
+}
+
+var (
+	telegramCommand    = regexp.MustCompile(`^/([A-Za-z]+(?:[-_][A-Za-z]+)?)(?:@\w+)?(?:\s+|$)`)
+	telegramLangPrefix = regexp.MustCompile(`^([A-Za-z]{2}(?:-[A-Za-z]{2,4})?):\s*`)
+)
+
+// parseTelegramText splits a message into the target language and the text
+// to translate. A leading /xx command or "xx:" prefix picks the language;
+// command is set for /start and /help.
+func parseTelegramText(text, defaultLang string) (targetLang, rest, command string) {
+	if match := telegramCommand.FindStringSubmatch(text); match != nil {
+		name := strings.ToLower(match[1])
+		if name == "start" || name == "help" {
+			return "", "", name
+		}
+		return strings.ToUpper(strings.ReplaceAll(name, "_", "-")), strings.TrimSpace(text[len(match[0]):]), ""
+	}
+	if match := telegramLangPrefix.FindStringSubmatch(text); match != nil {
+		return strings.ToUpper(match[1]), strings.TrimSpace(text[len(match[0]):]), ""
+	}
+	return defaultLang, strings.TrimSpace(text), ""
+}
+
+func (b *telegramBot) handleMessage(message *telegramMessage) {
+	targetLang, text, command := parseTelegramText(message.Text, b.targetLang)
+
+	reply := fmt.Sprintf(telegramHelp, b.targetLang)
+	if command == "" && text != "" {
+		result := TranslateResponse{Code: 429, Message: "Too many requests, please try again later."}
+		if message.From == nil || callerLimits.allow("telegram:"+strconv.FormatInt(message.From.ID, 10)) {
+			result = translate(TranslateParams{Text: text, TargetLang: targetLang})
+		}
+		if result.Code == 200 {
+			reply = result.Data
+		} else {
+			reply = "Translation failed: " + result.Message
+		}
+	}
+
+	err := b.call("sendMessage", map[string]any{
+		"chat_id":             message.Chat.ID,
+		"text":                reply,
+		"reply_to_message_id": message.MessageID,
+	}, nil)
+	if err != nil {
+		log.Printf("Error replying on Telegram: %v", err)
+	}
+}
+
+// handleInlineQuery offers the translation and its alternatives as inline
+// results.
+func (b *telegramBot) handleInlineQuery(query *telegramInlineQuery) {
+	targetLang, text, _ := parseTelegramText(query.Query, b.targetLang)
+	if text == "" || !callerLimits.allow("telegram:"+strconv.FormatInt(query.From.ID, 10)) {
+		return
+	}
+	result := translate(TranslateParams{Text: text, TargetLang: targetLang})
+	if result.Code != 200 {
+		return
+	}
+
+	description := strings.ToUpper(result.SourceLang) + " → " + targetLang
+	var articles []map[string]any
+	for i, translation := range append([]string{result.Data}, result.Alternatives...) {
+		articles = append(articles, map[string]any{
+			"type":                  "article",
+			"id":                    strconv.Itoa(i),
+			"title":                 translation,
+			"description":           description,
+			"input_message_content": map[string]string{"message_text": translation},
+		})
+	}
+
+	err := b.call("answerInlineQuery", map[string]any{
+		"inline_query_id": query.ID,
+		"results":         articles,
+		"cache_time":      300,
+	}, nil)
+	if err != nil {
+		log.Printf("Error answering Telegram inline query: %v", err)
+	}
+}
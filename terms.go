@@ -0,0 +1,257 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+)
+
+// TermRule forces a term in the translated output to a fixed replacement,
+// for example to keep brand or product names intact. Empty languages match
+// any language.
+type TermRule struct {
+	ID          string `json:"id"`
+	SourceLang  string `json:"source_lang,omitempty"`
+	TargetLang  string `json:"target_lang,omitempty"`
+	Pattern     string `json:"pattern"`
+	Replacement string `json:"replacement"`
+	Regex       bool   `json:"regex,omitempty"`
+
+	re *regexp.Regexp
+}
+
+func (r *TermRule) compile() error {
+	if r.Pattern == "" {
+		return errors.New("pattern is required")
+	}
+	if !r.Regex {
+		r.re = nil
+		return nil
+	}
+	re, err := regexp.Compile(r.Pattern)
+	if err != nil {
+		return fmt.Errorf("invalid pattern %q: %w", r.Pattern, err)
+	}
+	r.re = re
+	return nil
+}
+
+func (r *TermRule) matches(sourceLang, targetLang string) bool {
+	return languageMatches(r.SourceLang, sourceLang) && languageMatches(r.TargetLang, targetLang)
+}
+
+// languageMatches reports whether lang satisfies the language of a rule. A
+// rule with a regional variant such as "EN-GB" only matches that variant.
+func languageMatches(rule, lang string) bool {
+	if rule == "" {
+		return true
+	}
+	if strings.ContainsAny(rule, "-_") {
+		return strings.EqualFold(rule, lang)
+	}
+	return baseLanguage(rule) == baseLanguage(lang)
+}
+
+func (r *TermRule) apply(text string) string {
+	if r.re != nil {
+		return r.re.ReplaceAllString(text, r.Replacement)
+	}
+	return strings.ReplaceAll(text, r.Pattern, r.Replacement)
+}
+
+type termStore struct {
+	mu    sync.RWMutex
+	rules []TermRule
+	path  string
+}
+
+var terms = &termStore{}
+
+// load reads the rules from path. A missing file is not an error, so the
+// file can be created later through the admin API.
+func (s *termStore) load(path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.path = path
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read terms file: %w", err)
+	}
+
+	var rules []TermRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return fmt.Errorf("failed to parse terms file: %w", err)
+	}
+	if err := prepareRules(rules); err != nil {
+		return err
+	}
+	s.rules = rules
+	return nil
+}
+
+// save writes the rules back to the terms file. Callers must hold the lock.
+func (s *termStore) save() error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(s.rules, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal terms: %w", err)
+	}
+	if err := os.WriteFile(s.path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write terms file: %w", err)
+	}
+	return nil
+}
+
+func prepareRules(rules []TermRule) error {
+	for i := range rules {
+		if rules[i].ID == "" {
+			rules[i].ID = utils.UUIDv4()
+		}
+		if err := rules[i].compile(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *termStore) list() []TermRule {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]TermRule(nil), s.rules...)
+}
+
+func (s *termStore) add(rule TermRule) (TermRule, error) {
+	rule.ID = ""
+	rules := []TermRule{rule}
+	if err := prepareRules(rules); err != nil {
+		return TermRule{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rules = append(s.rules, rules[0])
+	return rules[0], s.save()
+}
+
+func (s *termStore) replace(rules []TermRule) error {
+	if err := prepareRules(rules); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rules = rules
+	return s.save()
+}
+
+func (s *termStore) remove(id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, rule := range s.rules {
+		if rule.ID == id {
+			s.rules = append(s.rules[:i], s.rules[i+1:]...)
+			return true, s.save()
+		}
+	}
+	return false, nil
+}
+
+// apply runs every rule matching the language pair over text.
+func (s *termStore) apply(text, sourceLang, targetLang string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for i := range s.rules {
+		if s.rules[i].matches(sourceLang, targetLang) {
+			text = s.rules[i].apply(text)
+		}
+	}
+	return text
+}
+
+// applyTerms enforces the terminology rules on every translated text of the
+// response.
+func applyTerms(response *TranslateResponse) {
+	apply := func(text string) string {
+		return terms.apply(text, response.SourceLang, response.TargetLang)
+	}
+
+	response.Data = apply(response.Data)
+	for i := range response.Alternatives {
+		response.Alternatives[i] = apply(response.Alternatives[i])
+	}
+	for i := range response.Sentences {
+		item := &response.Sentences[i]
+		item.Text = apply(item.Text)
+		for j := range item.Alternatives {
+			item.Alternatives[j] = apply(item.Alternatives[j])
+		}
+	}
+}
+
+func handleListTerms(c *fiber.Ctx) error {
+	return c.JSON(terms.list())
+}
+
+func handleAddTerm(c *fiber.Ctx) error {
+	var rule TermRule
+	if err := c.BodyParser(&rule); err != nil {
+		return c.Status(400).JSON(fiber.Map{"code": 400, "message": "Invalid request body"})
+	}
+
+	rule, err := terms.add(rule)
+	if err != nil {
+		log.Printf("Error adding term rule: %v", err)
+		return c.Status(400).JSON(fiber.Map{"code": 400, "message": err.Error()})
+	}
+	auditAdmin(c, "terms.add", rule.ID, nil, rule)
+	return c.Status(201).JSON(rule)
+}
+
+func handleReplaceTerms(c *fiber.Ctx) error {
+	var rules []TermRule
+	if err := c.BodyParser(&rules); err != nil {
+		return c.Status(400).JSON(fiber.Map{"code": 400, "message": "Invalid request body"})
+	}
+
+	before := terms.list()
+	if err := terms.replace(rules); err != nil {
+		log.Printf("Error replacing term rules: %v", err)
+		return c.Status(400).JSON(fiber.Map{"code": 400, "message": err.Error()})
+	}
+	after := terms.list()
+	auditAdmin(c, "terms.replace", "", before, after)
+	return c.JSON(after)
+}
+
+func handleDeleteTerm(c *fiber.Ctx) error {
+	var before *TermRule
+	for _, rule := range terms.list() {
+		if rule.ID == c.Params("id") {
+			before = &rule
+		}
+	}
+	found, err := terms.remove(c.Params("id"))
+	if err != nil {
+		log.Printf("Error deleting term rule: %v", err)
+		return c.Status(500).JSON(fiber.Map{"code": 500, "message": "Failed to save terms"})
+	}
+	if !found {
+		return c.Status(404).JSON(fiber.Map{"code": 404, "message": "Term rule not found"})
+	}
+	auditAdmin(c, "terms.delete", c.Params("id"), before, nil)
+	return c.SendStatus(fiber.StatusNoContent)
+}
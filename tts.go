@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+)
+
+// ttsMaxAudio is the largest clip read from the TTS backend.
+const ttsMaxAudio = 32 << 20
+
+// ttsCacheMaxBytes bounds the audio kept by ttsAudios.
+const ttsCacheMaxBytes = 64 << 20
+
+// ttsClip is a text to be spoken, kept until its audio URL expires.
+type ttsClip struct {
+	Text    string    `json:"text"`
+	Lang    string    `json:"lang"`
+	Expires time.Time `json:"expires"`
+}
+
+// ttsClipStore holds the clips of the audio URLs handed out. They are kept in
+// sharedStore when Redis is configured, so any replica can serve them.
+type ttsClipStore struct {
+	mu    sync.Mutex
+	clips map[string]ttsClip
+}
+
+var ttsClips = &ttsClipStore{clips: make(map[string]ttsClip)}
+
+// ttsAudio is the audio of a clip. done is closed once it is synthesized.
+type ttsAudio struct {
+	done        chan struct{}
+	audio       []byte
+	contentType string
+	err         error
+	expires     time.Time
+}
+
+// ttsAudioCache keeps the audio of clips until they expire, so a clip
+// fetched again, such as by a "listen" button pressed twice, is synthesized
+// once per process. Requests for a clip being synthesized wait for it.
+type ttsAudioCache struct {
+	mu     sync.Mutex
+	audios map[string]*ttsAudio
+	bytes  int
+}
+
+var ttsAudios = &ttsAudioCache{audios: make(map[string]*ttsAudio)}
+
+var ttsClient = &http.Client{Timeout: 30 * time.Second}
+
+func ttsEnabled() bool {
+	return cfg().TTSURL != ""
+}
+
+// add keeps a clip for TTS_TTL and returns its id.
+func (s *ttsClipStore) add(text, lang string) string {
+	id := utils.UUIDv4()
+	now := time.Now()
+	clip := ttsClip{Text: text, Lang: lang, Expires: now.Add(cfg().TTSTTL)}
+	if sharedStore != nil {
+		data, _ := json.Marshal(clip)
+		_ = sharedStore.Set("tts:"+id, data, cfg().TTSTTL)
+		return id
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, kept := range s.clips {
+		if !now.Before(kept.Expires) {
+			delete(s.clips, key)
+		}
+	}
+	s.clips[id] = clip
+	return id
+}
+
+func (s *ttsClipStore) get(id string) (ttsClip, bool) {
+	var clip ttsClip
+	if sharedStore != nil {
+		data, err := sharedStore.Get("tts:" + id)
+		if err != nil || data == nil || json.Unmarshal(data, &clip) != nil {
+			return clip, false
+		}
+	} else {
+		s.mu.Lock()
+		clip = s.clips[id]
+		s.mu.Unlock()
+	}
+	return clip, time.Now().Before(clip.Expires)
+}
+
+// audioURL returns the URL the translation can be listened to at.
+func audioURL(c *fiber.Ctx, text, lang string) string {
+	return c.BaseURL() + "/tts/" + ttsClips.add(text, lang)
+}
+
+// synthesize posts a text to TTS_URL and returns the audio it answers with
+// and its content type.
+func synthesize(clip ttsClip) ([]byte, string, error) {
+	body, err := jsonMarshal(map[string]string{"text": clip.Text, "lang": clip.Lang})
+	if err != nil {
+		return nil, "", err
+	}
+	req, err := http.NewRequest(http.MethodPost, cfg().TTSURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token := cfg().TTSToken; token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := ttsClient.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return nil, "", fmt.Errorf("TTS backend answered %s", resp.Status)
+	}
+	audio, err := io.ReadAll(io.LimitReader(resp.Body, ttsMaxAudio+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if len(audio) > ttsMaxAudio {
+		return nil, "", fmt.Errorf("TTS backend answered more than %d bytes", ttsMaxAudio)
+	}
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "audio/mpeg"
+	}
+	return audio, contentType, nil
+}
+
+// get returns the audio of the clip id, synthesizing it the first time.
+// Failures are not kept, so the clip can be fetched again.
+func (a *ttsAudioCache) get(id string, clip ttsClip) ([]byte, string, error) {
+	now := time.Now()
+	a.mu.Lock()
+	if cached, ok := a.audios[id]; ok && now.Before(cached.expires) {
+		a.mu.Unlock()
+		<-cached.done
+		return cached.audio, cached.contentType, cached.err
+	}
+	for key, cached := range a.audios {
+		if !now.Before(cached.expires) {
+			a.bytes -= len(cached.audio)
+			delete(a.audios, key)
+		}
+	}
+	entry := &ttsAudio{done: make(chan struct{}), expires: clip.Expires}
+	a.audios[id] = entry
+	a.mu.Unlock()
+
+	entry.audio, entry.contentType, entry.err = synthesize(clip)
+	close(entry.done)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.audios[id] == entry {
+		if entry.err != nil || a.bytes+len(entry.audio) > ttsCacheMaxBytes {
+			delete(a.audios, id)
+		} else {
+			a.bytes += len(entry.audio)
+		}
+	}
+	return entry.audio, entry.contentType, entry.err
+}
+
+// handleTTS speaks the clip of an audio URL through the TTS backend.
+func handleTTS(c *fiber.Ctx) error {
+	id := c.Params("id")
+	clip, ok := ttsClips.get(id)
+	if !ok || !ttsEnabled() {
+		return c.Status(404).JSON(fiber.Map{"code": 404, "message": "Audio not found or expired"})
+	}
+	audio, contentType, err := ttsAudios.get(id, clip)
+	if err != nil {
+		log.Printf("Error synthesizing speech: %v", err)
+		return c.Status(502).JSON(fiber.Map{"code": 502, "message": "Text-to-speech failed"})
+	}
+	c.Set(fiber.HeaderContentType, contentType)
+	c.Set(fiber.HeaderCacheControl, "private, max-age="+strconv.Itoa(int(time.Until(clip.Expires).Seconds())))
+	return c.Send(audio)
+}
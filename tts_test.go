@@ -0,0 +1,69 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// TestTTSAudioCache checks that a clip is synthesized once however often it
+// is fetched, that failures are retried, and that fetches are rate limited.
+func TestTTSAudioCache(t *testing.T) {
+	var calls atomic.Int32
+	failing := atomic.Bool{}
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if failing.Load() {
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set(fiber.HeaderContentType, "audio/ogg")
+		w.Write([]byte("audio"))
+	}))
+	t.Cleanup(backend.Close)
+	withConfig(t, func(c *Config) {
+		c.TTSURL = backend.URL
+		c.TTSTTL = time.Hour
+		c.RateLimit = 3
+		c.RateLimitWindow = time.Minute
+	})
+	previous := ttsAudios
+	ttsAudios = &ttsAudioCache{audios: make(map[string]*ttsAudio)}
+	t.Cleanup(func() { ttsAudios = previous })
+
+	currentLimiter.Store(newRateLimiter())
+	app := fiber.New()
+	app.Get("/tts/:id", rateLimit, handleTTS)
+	fetch := func(id string) (int, string) {
+		t.Helper()
+		response, err := app.Test(httptest.NewRequest(http.MethodGet, "/tts/"+id, nil), -1)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		body, _ := io.ReadAll(response.Body)
+		return response.StatusCode, string(body)
+	}
+
+	failing.Store(true)
+	id := ttsClips.add("Hallo", "DE")
+	if status, _ := fetch(id); status != 502 {
+		t.Errorf("failing backend: status %d, want 502", status)
+	}
+	failing.Store(false)
+	for range 2 {
+		if status, body := fetch(id); status != 200 || body != "audio" {
+			t.Errorf("status %d, body %q", status, body)
+		}
+	}
+	if calls.Load() != 2 {
+		t.Errorf("backend called %d times, want 2", calls.Load())
+	}
+	if status, _ := fetch(id); status != 429 {
+		t.Errorf("past the rate limit: status %d, want 429", status)
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// tuiLanguages are the target languages the TUI cycles through.
+var tuiLanguages = []string{"EN-US", "EN-GB", "DE", "FR", "ES", "IT", "NL", "PL", "PT-BR", "PT-PT", "RU", "UK", "JA", "ZH", "KO", "TR"}
+
+// tuiDebounce is how long the TUI waits after the last keystroke before
+// translating.
+const tuiDebounce = 300 * time.Millisecond
+
+type tuiModel struct {
+	client     *cliClient
+	sourceLang string
+	targetLang int
+
+	source       []rune
+	translation  string
+	alternatives []string
+	detected     string
+	status       string
+	result       TranslateResponse
+
+	// seq numbers edits so that stale debounce ticks and translations of
+	// older text are ignored.
+	seq           int
+	width, height int
+}
+
+type tuiDebounceMsg struct{ seq int }
+
+type tuiResultMsg struct {
+	seq    int
+	result TranslateResponse
+	err    error
+}
+
+func tuiCommand() (*flag.FlagSet, func() error) {
+	flags := flag.NewFlagSet("tui", flag.ContinueOnError)
+	client := clientFlags(flags)
+	output := outputFlags(flags)
+	source := flags.String("source", "", "source language (detected by default)")
+	target := flags.String("target", "EN-US", "initial target language")
+
+	return flags, func() error {
+		model := tuiModel{client: client, sourceLang: strings.ToUpper(*source)}
+		for i, lang := range tuiLanguages {
+			if strings.EqualFold(lang, *target) {
+				model.targetLang = i
+			}
+		}
+		final, err := tea.NewProgram(model, tea.WithAltScreen()).Run()
+		if err != nil {
+			return err
+		}
+
+		// For scripts, the last translation is printed on exit.
+		if m := final.(tuiModel); output.machine() && m.result.Code == 200 {
+			return output.print(string(m.source), m.result)
+		}
+		return nil
+	}
+}
+
+func (m tuiModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m tuiModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+		return m, nil
+
+	case tuiDebounceMsg:
+		if msg.seq != m.seq {
+			return m, nil
+		}
+		return m, m.translate()
+
+	case tuiResultMsg:
+		if msg.seq != m.seq {
+			return m, nil
+		}
+		if msg.err != nil {
+			m.status = "Error: " + msg.err.Error()
+			return m, nil
+		}
+		m.result = msg.result
+		m.translation, m.alternatives, m.detected = msg.result.Data, msg.result.Alternatives, msg.result.SourceLang
+		m.status = fmt.Sprintf("Translated in %dms", msg.result.TookMs)
+		if msg.result.Cached {
+			m.status += " (cached)"
+		}
+		return m, nil
+
+	case tea.KeyMsg:
+		switch msg.Type {
+		case tea.KeyCtrlC, tea.KeyEsc:
+			return m, tea.Quit
+		case tea.KeyTab:
+			m.targetLang = (m.targetLang + 1) % len(tuiLanguages)
+		case tea.KeyShiftTab:
+			m.targetLang = (m.targetLang + len(tuiLanguages) - 1) % len(tuiLanguages)
+		case tea.KeyCtrlL:
+			m.source = nil
+		case tea.KeyBackspace:
+			if len(m.source) > 0 {
+				m.source = m.source[:len(m.source)-1]
+			}
+		case tea.KeyEnter:
+			m.source = append(m.source, '\n')
+		case tea.KeySpace:
+			m.source = append(m.source, ' ')
+		case tea.KeyRunes:
+			m.source = append(m.source, msg.Runes...)
+		default:
+			return m, nil
+		}
+		return m.edited()
+	}
+	return m, nil
+}
+
+// edited schedules a translation of the changed source or language.
+func (m tuiModel) edited() (tea.Model, tea.Cmd) {
+	m.seq++
+	if strings.TrimSpace(string(m.source)) == "" {
+		m.translation, m.alternatives, m.detected, m.status = "", nil, "", ""
+		m.result = TranslateResponse{}
+		return m, nil
+	}
+	m.status = "Translating…"
+	seq := m.seq
+	return m, tea.Tick(tuiDebounce, func(time.Time) tea.Msg { return tuiDebounceMsg{seq: seq} })
+}
+
+func (m tuiModel) translate() tea.Cmd {
+	seq, client := m.seq, m.client
+	params := TranslateParams{
+		Text:       string(m.source),
+		SourceLang: m.sourceLang,
+		TargetLang: tuiLanguages[m.targetLang],
+	}
+	return func() tea.Msg {
+		result, err := client.translate(params)
+		return tuiResultMsg{seq: seq, result: result, err: err}
+	}
+}
+
+var (
+	tuiPane     = lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).Padding(0, 1)
+	tuiTitle    = lipgloss.NewStyle().Bold(true)
+	tuiSelected = lipgloss.NewStyle().Reverse(true)
+	tuiFaint    = lipgloss.NewStyle().Faint(true)
+)
+
+func (m tuiModel) View() string {
+	if m.width == 0 {
+		return ""
+	}
+
+	var langs []string
+	for i, lang := range tuiLanguages {
+		if i == m.targetLang {
+			lang = tuiSelected.Render(" " + lang + " ")
+		}
+		langs = append(langs, lang)
+	}
+	header := tuiTitle.Render("Target: ") + strings.Join(langs, " ")
+
+	sourceTitle := "Source"
+	switch {
+	case m.sourceLang != "":
+		sourceTitle += " (" + m.sourceLang + ")"
+	case m.detected != "":
+		sourceTitle += " (detected " + m.detected + ")"
+	}
+	translation := m.translation
+	if len(m.alternatives) > 0 {
+		translation += "\n\n" + tuiTitle.Render("Alternatives")
+		for i, alternative := range m.alternatives {
+			translation += fmt.Sprintf("\n%d. %s", i+1, alternative)
+		}
+	}
+
+	paneWidth := max(m.width/2-4, 10)
+	paneHeight := max(m.height-lipgloss.Height(header)-5, 3)
+	pane := tuiPane.Width(paneWidth).Height(paneHeight)
+	panes := lipgloss.JoinHorizontal(lipgloss.Top,
+		pane.Render(tuiTitle.Render(sourceTitle)+"\n"+string(m.source)+"▏"),
+		pane.Render(tuiTitle.Render("Translation")+"\n"+translation),
+	)
+
+	help := tuiFaint.Render("tab/shift+tab: language · ctrl+l: clear · esc: quit")
+	if m.status != "" {
+		help = m.status + "  " + help
+	}
+	return lipgloss.JoinVertical(lipgloss.Left, header, panes, help)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// handleUI serves the web UI, a page translating text through /translate
+// for people who'd rather not use the API. With OIDC, users without a
+// session are sent to log in first, so a team can share the instance
+// without handing out tokens.
+func handleUI(c *fiber.Ctx) error {
+	page := uiPage
+	if oidcEnabled() {
+		if _, ok := currentSession(c); !ok {
+			return c.Redirect("/auth/login?next=/ui", fiber.StatusFound)
+		}
+		page = strings.Replace(page, "const sessionLogin = false;", "const sessionLogin = true;", 1)
+	}
+	c.Set(fiber.HeaderContentType, fiber.MIMETextHTMLCharsetUTF8)
+	c.Set(fiber.HeaderContentSecurityPolicy, "default-src 'self'; script-src 'unsafe-inline'; style-src 'unsafe-inline'")
+	return c.SendString(page)
+}
+
+const uiPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>DeepLX-Go</title>
+<style>
+body { font-family: system-ui, sans-serif; margin: 2em; color: #222; max-width: 60em; }
+textarea { width: 100%; height: 12em; font: inherit; padding: .5em; box-sizing: border-box; }
+input { font: inherit; width: 6em; }
+#result { white-space: pre-wrap; min-height: 12em; padding: .5em; border: 1px solid #ddd; }
+#status { color: #777; }
+</style>
+</head>
+<body>
+<h1>Translate</h1>
+<p>
+<label>From <input id="source" value="auto"></label>
+<label>To <input id="target" value="EN"></label>
+<button id="translate">Translate</button>
+<button id="logout" hidden>Log out</button>
+</p>
+<textarea id="text" placeholder="Text to translate"></textarea>
+<p id="status"></p>
+<div id="result"></div>
+<script>
+"use strict";
+
+// sessionLogin is set by the server when users log in through OIDC.
+const sessionLogin = false;
+
+const status = document.getElementById("status");
+
+document.getElementById("translate").addEventListener("click", async () => {
+  status.textContent = "Translating…";
+  try {
+    const response = await fetch("/translate", {
+      method: "POST",
+      headers: {"Content-Type": "application/json"},
+      body: JSON.stringify({
+        text: document.getElementById("text").value,
+        source_lang: document.getElementById("source").value,
+        target_lang: document.getElementById("target").value,
+      }),
+    });
+    const result = await response.json();
+    if (result.code !== 200) {
+      throw new Error(result.message || "HTTP " + response.status);
+    }
+    document.getElementById("result").textContent = result.data;
+    status.textContent = "Translated from " + result.source_lang;
+  } catch (error) {
+    status.textContent = "Failed: " + error.message;
+  }
+});
+
+if (sessionLogin) {
+  const logout = document.getElementById("logout");
+  logout.hidden = false;
+  logout.onclick = () => fetch("/auth/logout", {method: "POST"}).then(() => { location.href = "/"; });
+}
+</script>
+</body>
+</html>
+`
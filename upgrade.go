@@ -0,0 +1,65 @@
+package main
+
+import (
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// listen returns the listener of the server: the one handed over by the
+// process being upgraded, the one passed by socket activation, or a new one
+// on port 8080.
+func listen() (net.Listener, error) {
+	ln, err := inheritedListener()
+	if err == nil && ln == nil {
+		ln, err = activationListener()
+	}
+	if err == nil && ln == nil {
+		ln, err = net.Listen("tcp", ":8080")
+	}
+	return ln, err
+}
+
+// stopRequests receives the signals handled by the server. The Windows
+// service sends SIGTERM to it when the service is stopped.
+var stopRequests = make(chan os.Signal, 1)
+
+// handleSignals stops the server gracefully on SIGTERM or an interrupt, and
+// hands its listener over to a new process on the upgrade signal. stopped is
+// closed once requests and jobs in flight have completed.
+func handleSignals(app *fiber.App, ln net.Listener, stopped chan<- struct{}) {
+	defer close(stopped)
+
+	notify := []os.Signal{syscall.SIGTERM, os.Interrupt}
+	if upgradeSignal != nil {
+		notify = append(notify, upgradeSignal)
+	}
+	signal.Notify(stopRequests, notify...)
+
+	for sig := range stopRequests {
+		if sig == upgradeSignal {
+			pid, err := upgrade(ln)
+			if err != nil {
+				log.Printf("Error upgrading: %v", err)
+				continue
+			}
+			log.Printf("Handed over to process %d", pid)
+		}
+
+		if err := sdNotify("STOPPING=1"); err != nil {
+			log.Printf("Error notifying systemd: %v", err)
+		}
+		if err := app.ShutdownWithTimeout(cfg().ShutdownTimeout); err != nil {
+			log.Printf("Error shutting down: %v", err)
+		}
+		if !jobs.drain(cfg().ShutdownTimeout) {
+			log.Printf("Stopping with jobs unfinished")
+		}
+		exportUsage()
+		return
+	}
+}
@@ -0,0 +1,141 @@
+//go:build !windows
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// upgradeSignal makes the server start a new copy of its executable, hand it
+// the listener and exit once the new process accepts connections.
+var upgradeSignal os.Signal = syscall.SIGUSR2
+
+// upgradeTimeout is how long a new process may take to become ready before
+// the upgrade is abandoned.
+const upgradeTimeout = time.Minute
+
+// File descriptors of the listener and the readiness pipe in a process
+// started by an upgrade.
+const (
+	upgradeListenerFD = 3
+	upgradeReadyFD    = 4
+)
+
+// upgraded is set in a process started by an upgrade.
+var upgraded = os.Getenv("DEEPLX_UPGRADE") != ""
+
+func inheritedListener() (net.Listener, error) {
+	if !upgraded {
+		return nil, nil
+	}
+	os.Unsetenv("DEEPLX_UPGRADE")
+
+	file := os.NewFile(upgradeListenerFD, "upgrade-listener")
+	defer file.Close()
+	return net.FileListener(file)
+}
+
+// notifyUpgradeReady tells the process being upgraded that this one accepts
+// connections, so it can stop.
+func notifyUpgradeReady() error {
+	if !upgraded {
+		return nil
+	}
+	ready := os.NewFile(upgradeReadyFD, "upgrade-ready")
+	defer ready.Close()
+	_, err := ready.Write([]byte{1})
+	return err
+}
+
+// upgradeEnviron returns the environment of the new process. WATCHDOG_PID
+// names this process, so it is dropped: once systemd follows the new
+// process as the main one, that process feeds the watchdog.
+func upgradeEnviron() []string {
+	var env []string
+	for _, variable := range os.Environ() {
+		if !strings.HasPrefix(variable, "WATCHDOG_PID=") {
+			env = append(env, variable)
+		}
+	}
+	return env
+}
+
+// afterHandover runs f once the process being upgraded has exited, or right
+// away in a process not started by an upgrade. Checkpointed jobs are
+// restored this way, so they aren't run by both processes at once.
+func afterHandover(f func()) {
+	if !upgraded {
+		f()
+		return
+	}
+	parent := os.Getppid()
+	go func() {
+		for os.Getppid() == parent {
+			time.Sleep(100 * time.Millisecond)
+		}
+		f()
+	}()
+}
+
+// upgrade starts a new copy of the executable with the listener and waits
+// until it is ready. systemd is told to follow the new process.
+func upgrade(ln net.Listener) (int, error) {
+	listener, ok := ln.(interface{ File() (*os.File, error) })
+	if !ok {
+		return 0, fmt.Errorf("can't hand over a %T", ln)
+	}
+	file, err := listener.File()
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	ready, readyWriter, err := os.Pipe()
+	if err != nil {
+		return 0, err
+	}
+	defer ready.Close()
+
+	executable, err := os.Executable()
+	if err != nil {
+		readyWriter.Close()
+		return 0, err
+	}
+	cmd := exec.Command(executable, os.Args[1:]...)
+	cmd.Env = append(upgradeEnviron(), "DEEPLX_UPGRADE=1")
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	cmd.ExtraFiles = []*os.File{file, readyWriter}
+	err = cmd.Start()
+	readyWriter.Close()
+	if err != nil {
+		return 0, err
+	}
+
+	// The read fails when the new process exits without reporting ready.
+	result := make(chan error, 1)
+	go func() {
+		_, err := ready.Read(make([]byte, 1))
+		result <- err
+	}()
+	select {
+	case err = <-result:
+	case <-time.After(upgradeTimeout):
+		err = errors.New("timed out")
+	}
+	if err != nil {
+		cmd.Process.Kill()
+		return 0, fmt.Errorf("new process failed to start: %w", err)
+	}
+
+	if err := sdNotify(fmt.Sprintf("MAINPID=%d", cmd.Process.Pid)); err != nil {
+		return 0, err
+	}
+	return cmd.Process.Pid, nil
+}
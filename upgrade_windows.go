@@ -0,0 +1,27 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"os"
+)
+
+// Upgrades hand the listener over by file descriptor, which Windows doesn't
+// support.
+var upgradeSignal os.Signal
+
+func inheritedListener() (net.Listener, error) {
+	return nil, nil
+}
+
+func notifyUpgradeReady() error {
+	return nil
+}
+
+func afterHandover(f func()) {
+	f()
+}
+
+func upgrade(net.Listener) (int, error) {
+	return 0, errors.New("upgrades are not supported on Windows")
+}
@@ -0,0 +1,729 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andybalholm/brotli"
+)
+
+// statsDecay is the weight of the newest sample in the rolling latency and
+// error rate of a target.
+const statsDecay = 0.2
+
+// sharedCooldownTTL is how long the cooldown state read from the shared
+// store is trusted, so that picking a target doesn't cost a Redis round trip
+// per target on every translation.
+const sharedCooldownTTL = time.Second
+
+// recentSamples is the number of latencies kept per target for the admin
+// dashboard.
+const recentSamples = 60
+
+// upstreamReply is the outcome of one JSON-RPC call to a target.
+type upstreamReply struct {
+	Target *upstreamTarget
+	Status int
+	Body   []byte
+	Err    error
+
+	// buf holds Body until release returns it to bufferPool.
+	buf *bytes.Buffer
+}
+
+// release returns the buffer holding Body to the pool. Body must not be used
+// afterwards.
+func (r upstreamReply) release() {
+	if r.buf != nil {
+		putBuffer(r.buf)
+	}
+}
+
+func (r upstreamReply) ok() bool {
+	return r.Err == nil && r.Status == http.StatusOK
+}
+
+// upstreamTarget is an endpoint, optionally reached through a proxy, with
+// the rolling health statistics used to choose between targets.
+type upstreamTarget struct {
+	Endpoint string
+	Proxy    string
+	client   *http.Client
+
+	mu             sync.Mutex
+	endpointWeight float64
+	proxyWeight    float64
+	latency        float64
+	errorRate      float64
+	requests       uint64
+	failures       uint64
+	consecutive    int
+	quarantined    bool
+	coolUntil      time.Time
+	// sharedCooling caches until sharedExpires whether another replica
+	// put the target in cooldown.
+	sharedCooling bool
+	sharedExpires time.Time
+	// disabled targets are taken out of rotation by an admin.
+	disabled bool
+	// recent holds the latest latencies in milliseconds, oldest first.
+	recent []float64
+	// ids numbers the requests sent to the target.
+	ids *sequenceSource
+}
+
+// TargetStats is the admin view of an upstream target.
+type TargetStats struct {
+	Endpoint  string  `json:"endpoint"`
+	Proxy     string  `json:"proxy,omitempty"`
+	LatencyMs float64 `json:"latency_ms"`
+	ErrorRate float64 `json:"error_rate"`
+	Requests  uint64  `json:"requests"`
+	Failures  uint64  `json:"failures"`
+	Weight    float64 `json:"weight"`
+	Score     float64 `json:"score"`
+	State     string  `json:"state"`
+	Enabled   bool    `json:"enabled"`
+
+	RecentLatencyMs []float64 `json:"recent_latency_ms"`
+}
+
+// parseWeighted splits a "value|weight" list entry. Entries without a weight
+// get weight 1; weight 0 marks a backup that is only used when nothing else
+// is available.
+func parseWeighted(entry string) (string, float64, error) {
+	value, weightText, found := strings.Cut(entry, "|")
+	if !found {
+		return value, 1, nil
+	}
+	weight, err := strconv.ParseFloat(strings.TrimSpace(weightText), 64)
+	if err != nil || weight < 0 {
+		return "", 0, fmt.Errorf("invalid weight in %q", entry)
+	}
+	return strings.TrimSpace(value), weight, nil
+}
+
+func newUpstreamTarget(endpoint, proxy string) (*upstreamTarget, error) {
+	endpoint, endpointWeight, err := parseWeighted(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	proxy, proxyWeight, err := parseWeighted(proxy)
+	if err != nil {
+		return nil, err
+	}
+
+	target := &upstreamTarget{
+		Endpoint:       endpoint,
+		Proxy:          proxy,
+		client:         upstreamClient,
+		endpointWeight: endpointWeight,
+		proxyWeight:    proxyWeight,
+		ids:            newSequenceSource(),
+	}
+	if proxy != "" {
+		proxyURL, err := url.Parse(proxy)
+		if err != nil {
+			return nil, err
+		}
+		target.client = &http.Client{Transport: newUpstreamTransport(proxyURL)}
+	}
+	if cfg().StickySessions {
+		stickySession(target)
+	}
+	return target, nil
+}
+
+// upstreamClient is shared by the targets without a proxy, which then share
+// its connections.
+var upstreamClient = &http.Client{Transport: newUpstreamTransport(nil)}
+
+// newUpstreamTransport returns a transport that negotiates HTTP/2 with
+// upstreams that support it, connecting through proxy unless it is nil.
+// Hostnames are resolved with resolver.
+func newUpstreamTransport(proxy *url.URL) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ForceAttemptHTTP2 = true
+	transport.DialContext = dialUpstream
+	if proxy != nil {
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+	return transport
+}
+
+func (t *upstreamTarget) name() string {
+	if t.Proxy == "" {
+		return t.Endpoint
+	}
+	return t.Endpoint + " via " + t.Proxy
+}
+
+func (t *upstreamTarget) record(took time.Duration, ok, rateLimited bool) {
+	if rateLimited && cfg().UpstreamCooldown > 0 {
+		t.coolDown(cfg().UpstreamCooldown)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	failed := 0.0
+	if ok {
+		if t.quarantined {
+			log.Printf("Upstream %s recovered, returning it to rotation", t.name())
+		}
+		t.consecutive = 0
+		t.quarantined = false
+	} else {
+		failed = 1
+		t.failures++
+		t.consecutive++
+		if !t.quarantined && cfg().QuarantineFailures > 0 && t.consecutive >= cfg().QuarantineFailures {
+			log.Printf("Upstream %s failed %d times in a row, quarantining it", t.name(), t.consecutive)
+			t.quarantined = true
+		}
+	}
+	ms := float64(took.Milliseconds())
+	if t.requests == 0 {
+		t.latency, t.errorRate = ms, failed
+	} else {
+		t.latency += statsDecay * (ms - t.latency)
+		t.errorRate += statsDecay * (failed - t.errorRate)
+	}
+	t.requests++
+	if len(t.recent) == recentSamples {
+		t.recent = append(t.recent[:0], t.recent[1:]...)
+	}
+	t.recent = append(t.recent, ms)
+}
+
+func (t *upstreamTarget) weight() float64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.endpointWeight * t.proxyWeight
+}
+
+// score rates the target from its configured weight, latency and error
+// rate; higher is better. Targets without traffic are assumed to be average
+// so they get tried.
+func (t *upstreamTarget) score() float64 {
+	weight := t.weight()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	latency := 500.0
+	if t.requests > 0 {
+		latency = math.Max(t.latency, 50)
+	}
+	health := (1 - t.errorRate) * (1 - t.errorRate)
+	return weight * math.Max(health, 0.01) * 1000 / latency
+}
+
+// coolDown takes a rate-limited target out of rotation for d, on every
+// replica when shared state is configured.
+func (t *upstreamTarget) coolDown(d time.Duration) {
+	t.mu.Lock()
+	t.coolUntil = time.Now().Add(d)
+	t.mu.Unlock()
+
+	log.Printf("Upstream %s is rate limited, cooling down for %v", t.name(), d)
+	if sharedStore != nil {
+		if err := sharedStore.Set("cooldown:"+t.name(), []byte("1"), d); err != nil {
+			log.Printf("Error sharing cooldown of %s: %v", t.name(), err)
+		}
+	}
+}
+
+func (t *upstreamTarget) isCoolingDown() bool {
+	now := time.Now()
+	t.mu.Lock()
+	local := now.Before(t.coolUntil)
+	cached := now.Before(t.sharedExpires)
+	shared := t.sharedCooling
+	t.mu.Unlock()
+	if local || sharedStore == nil {
+		return local
+	}
+	if cached {
+		return shared
+	}
+
+	value, err := sharedStore.Get("cooldown:" + t.name())
+	if err != nil {
+		log.Printf("Error reading cooldown of %s: %v", t.name(), err)
+	}
+	t.mu.Lock()
+	t.sharedCooling = value != nil
+	t.sharedExpires = now.Add(sharedCooldownTTL)
+	t.mu.Unlock()
+	return value != nil
+}
+
+func (t *upstreamTarget) isDisabled() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.disabled
+}
+
+func (t *upstreamTarget) isQuarantined() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.quarantined
+}
+
+func (t *upstreamTarget) stats() TargetStats {
+	score := t.score()
+	weight := t.weight()
+	coolingDown := t.isCoolingDown()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	state := "healthy"
+	switch {
+	case t.disabled:
+		state = "disabled"
+	case t.quarantined:
+		state = "quarantined"
+	case coolingDown:
+		state = "cooling_down"
+	}
+	return TargetStats{
+		Endpoint:  t.Endpoint,
+		Proxy:     t.Proxy,
+		LatencyMs: math.Round(t.latency),
+		ErrorRate: math.Round(t.errorRate*1000) / 1000,
+		Requests:  t.requests,
+		Failures:  t.failures,
+		Weight:    weight,
+		Score:     math.Round(score*1000) / 1000,
+		State:     state,
+		Enabled:   !t.disabled,
+
+		RecentLatencyMs: append([]float64{}, t.recent...),
+	}
+}
+
+// upstreamPool spreads requests over every combination of the configured
+// endpoints and proxies, preferring the healthiest targets.
+type upstreamPool struct {
+	mu      sync.RWMutex
+	targets []*upstreamTarget
+}
+
+var upstreams = mustUpstreamPool(cfg().Endpoints, cfg().Proxies)
+
+func newUpstreamPool(endpoints, proxies []string) (*upstreamPool, error) {
+	if len(endpoints) == 0 {
+		endpoints = []string{DeeplApiEndpoint}
+	}
+	if len(proxies) == 0 {
+		proxies = []string{""}
+	}
+
+	pool := &upstreamPool{}
+	for _, endpoint := range endpoints {
+		for _, proxy := range proxies {
+			target, err := newUpstreamTarget(endpoint, proxy)
+			if err != nil {
+				return nil, err
+			}
+			pool.targets = append(pool.targets, target)
+		}
+	}
+	return pool, nil
+}
+
+func mustUpstreamPool(endpoints, proxies []string) *upstreamPool {
+	pool, err := newUpstreamPool(endpoints, proxies)
+	if err != nil {
+		log.Fatalf("Error configuring upstreams: %v", err)
+	}
+	return pool
+}
+
+// snapshot returns the current targets. The slice is replaced rather than
+// modified on reconfiguration, so callers may keep using it.
+func (p *upstreamPool) snapshot() []*upstreamTarget {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.targets
+}
+
+// reconfigure replaces the endpoints and proxies at runtime. Combinations
+// that remain keep their statistics and state and take the new weights;
+// requests in flight to removed ones complete normally.
+func (p *upstreamPool) reconfigure(endpoints, proxies []string) error {
+	next, err := newUpstreamPool(endpoints, proxies)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i, target := range next.targets {
+		for _, current := range p.targets {
+			if current.Endpoint == target.Endpoint && current.Proxy == target.Proxy {
+				current.mu.Lock()
+				current.endpointWeight, current.proxyWeight = target.endpointWeight, target.proxyWeight
+				current.mu.Unlock()
+				next.targets[i] = current
+				break
+			}
+		}
+	}
+	p.targets = next.targets
+	return nil
+}
+
+// available returns the targets in rotation: weighted targets that are
+// neither disabled, quarantined nor cooling down, then backups, and as a
+// last resort every enabled target (or every target, when all are
+// disabled) rather than failing all requests.
+func (p *upstreamPool) available() []*upstreamTarget {
+	targets := p.snapshot()
+	var weighted, backups, enabled []*upstreamTarget
+	for _, target := range targets {
+		if !target.isDisabled() {
+			enabled = append(enabled, target)
+		}
+		switch {
+		case target.isDisabled(), target.isQuarantined(), target.isCoolingDown():
+		case target.weight() > 0:
+			weighted = append(weighted, target)
+		default:
+			backups = append(backups, target)
+		}
+	}
+	if len(weighted) > 0 {
+		return weighted
+	}
+	if len(backups) > 0 {
+		return backups
+	}
+	if len(enabled) > 0 {
+		return enabled
+	}
+	return targets
+}
+
+// setEnabled takes the target combining endpoint and proxy in or out of
+// rotation.
+func (p *upstreamPool) setEnabled(endpoint, proxy string, enabled bool) error {
+	for _, target := range p.snapshot() {
+		if target.Endpoint == endpoint && target.Proxy == proxy {
+			target.mu.Lock()
+			target.disabled = !enabled
+			target.mu.Unlock()
+			if enabled {
+				log.Printf("Upstream %s enabled by admin", target.name())
+			} else {
+				log.Printf("Upstream %s disabled by admin", target.name())
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("no upstream %q via %q", endpoint, proxy)
+}
+
+// setWeights updates the weights of endpoints and proxies at runtime. Keys
+// are endpoint and proxy URLs; unknown keys are reported as an error.
+func (p *upstreamPool) setWeights(endpoints, proxies map[string]float64) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	known := func(match func(*upstreamTarget) bool) bool {
+		for _, target := range p.targets {
+			if match(target) {
+				return true
+			}
+		}
+		return false
+	}
+	for endpoint, weight := range endpoints {
+		if weight < 0 || !known(func(t *upstreamTarget) bool { return t.Endpoint == endpoint }) {
+			return fmt.Errorf("invalid weight for endpoint %q", endpoint)
+		}
+	}
+	for proxy, weight := range proxies {
+		if weight < 0 || !known(func(t *upstreamTarget) bool { return t.Proxy == proxy }) {
+			return fmt.Errorf("invalid weight for proxy %q", proxy)
+		}
+	}
+
+	for _, target := range p.targets {
+		target.mu.Lock()
+		if weight, ok := endpoints[target.Endpoint]; ok {
+			target.endpointWeight = weight
+		}
+		if weight, ok := proxies[target.Proxy]; ok {
+			target.proxyWeight = weight
+		}
+		target.mu.Unlock()
+	}
+	return nil
+}
+
+// pick chooses n targets by weighted random selection on their scores,
+// without repeating a target while others are left.
+func (p *upstreamPool) pick(n int) []*upstreamTarget {
+	available := p.available()
+	candidates := append([]*upstreamTarget(nil), available...)
+	picked := make([]*upstreamTarget, 0, n)
+	for len(picked) < n {
+		if len(candidates) == 0 {
+			candidates = append(candidates, available...)
+		}
+
+		scores := make([]float64, len(candidates))
+		total := 0.0
+		for i, target := range candidates {
+			scores[i] = target.score()
+			total += scores[i]
+		}
+
+		// The uniform choice only stands when every score is zero, such as
+		// when only backups are left.
+		choice := rand.Intn(len(candidates))
+		r := rand.Float64() * total
+		for i, score := range scores {
+			if r < score {
+				choice = i
+				break
+			}
+			r -= score
+		}
+
+		picked = append(picked, candidates[choice])
+		candidates = append(candidates[:choice], candidates[choice+1:]...)
+	}
+	return picked
+}
+
+func (p *upstreamPool) stats() []TargetStats {
+	targets := p.snapshot()
+	stats := make([]TargetStats, 0, len(targets))
+	for _, target := range targets {
+		stats = append(stats, target.stats())
+	}
+	return stats
+}
+
+// probeQuarantined periodically sends a short probe translation to every
+// quarantined target. A successful probe returns the target to rotation.
+func (p *upstreamPool) probeQuarantined(interval time.Duration) {
+	if interval <= 0 {
+		log.Printf("PROBE_INTERVAL must be positive, quarantined upstreams are not probed")
+		return
+	}
+	params := TranslateParams{Text: "Hello", SourceLang: "EN", TargetLang: "DE"}
+	for range time.Tick(interval) {
+		for _, target := range p.snapshot() {
+			if !target.isQuarantined() {
+				continue
+			}
+			postRequest(context.Background(), target, textsRequest(params, []string{params.Text})).release()
+		}
+	}
+}
+
+// requestBody builds the JSON-RPC body of a request for a target.
+type requestBody func(target *upstreamTarget) (string, error)
+
+// textsRequest returns the requestBody translating texts.
+func textsRequest(params TranslateParams, texts []string) requestBody {
+	return func(target *upstreamTarget) (string, error) {
+		return target.requestBody(params, texts)
+	}
+}
+
+// requestBody builds the request for texts with the next ID of the target,
+// as the web client numbers the calls of a session in sequence rather than
+// drawing a new ID each time.
+func (t *upstreamTarget) requestBody(params TranslateParams, texts []string) (string, error) {
+	return t.builder().build(params, texts)
+}
+
+// builder builds requests numbered in the sequence of the target.
+func (t *upstreamTarget) builder() requestBuilder {
+	return requestBuilder{ids: t.ids, clock: upstreamRequests.clock}
+}
+
+// call posts a request to a target. With hedging enabled, the same request
+// is also sent to a second target when the first has not answered within
+// cfg().HedgeDelay (or has already failed), and the first successful reply
+// wins.
+func (p *upstreamPool) call(body requestBody) upstreamReply {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hedged := cfg().HedgeDelay > 0
+	targets := p.pick(1)
+	if hedged {
+		targets = p.pick(2)
+		// With a single target available, pick repeats it, and hedging
+		// would only double the load on it.
+		hedged = targets[0] != targets[1]
+	}
+
+	replies := make(chan upstreamReply, len(targets))
+	send := func(target *upstreamTarget) {
+		go func() {
+			replies <- postRequest(ctx, target, body)
+		}()
+	}
+
+	send(targets[0])
+	pending := 1
+
+	var hedge <-chan time.Time
+	if hedged {
+		timer := time.NewTimer(cfg().HedgeDelay)
+		defer timer.Stop()
+		hedge = timer.C
+	}
+
+	var last upstreamReply
+	for pending > 0 {
+		select {
+		case <-hedge:
+			hedge = nil
+			send(targets[1])
+			pending++
+		case reply := <-replies:
+			pending--
+			if reply.ok() {
+				return reply
+			}
+			last.release()
+			last = reply
+			if hedge != nil {
+				hedge = nil
+				send(targets[1])
+				pending++
+			}
+		}
+	}
+	return last
+}
+
+// hasEndpoint reports whether endpoint is one of the configured endpoints.
+func (p *upstreamPool) hasEndpoint(endpoint string) bool {
+	for _, target := range p.snapshot() {
+		if target.Endpoint == endpoint {
+			return true
+		}
+	}
+	return false
+}
+
+// callEndpoint posts a request to endpoint, through any of the proxies it
+// is reached through. Endpoints out of rotation are called all the same, as
+// they may be the ones to look into.
+func (p *upstreamPool) callEndpoint(endpoint string, body requestBody) upstreamReply {
+	var targets []*upstreamTarget
+	for _, target := range p.snapshot() {
+		if target.Endpoint == endpoint {
+			targets = append(targets, target)
+		}
+	}
+	if len(targets) == 0 {
+		return upstreamReply{Err: fmt.Errorf("no upstream %q", endpoint)}
+	}
+	return postRequest(context.Background(), targets[rand.Intn(len(targets))], body)
+}
+
+// postRequest builds the request for target and posts it.
+func postRequest(ctx context.Context, target *upstreamTarget, body requestBody) upstreamReply {
+	data, err := body(target)
+	if err != nil {
+		log.Printf("Error building request body: %v", err)
+		return upstreamReply{Target: target, Err: err}
+	}
+	return postUpstream(ctx, target, data)
+}
+
+func postUpstream(ctx context.Context, target *upstreamTarget, body string) upstreamReply {
+	reply := upstreamReply{Target: target}
+
+	ctx, bound := withSourceAddr(ctx)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target.Endpoint, strings.NewReader(body))
+	if err != nil {
+		reply.Err = err
+		return reply
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("Accept-Encoding", "gzip, br")
+	// Connections are not reused, so each request comes from its own address.
+	req.Close = bound
+
+	start := time.Now()
+	defer func() {
+		// Requests abandoned after a hedge won say nothing about the target.
+		if !errors.Is(reply.Err, context.Canceled) {
+			target.record(time.Since(start), reply.ok(), reply.Status == http.StatusTooManyRequests)
+			alerts.observe(reply.ok(), reply.Status == http.StatusTooManyRequests)
+			recordUpstream(target, time.Since(start), reply)
+		}
+	}()
+
+	if fault, ok := injectFault(ctx, reply); ok {
+		reply = fault
+		return reply
+	}
+
+	resp, err := target.client.Do(req)
+	if err != nil {
+		if !errors.Is(err, context.Canceled) {
+			log.Printf("Error making HTTP request to %s: %v", target.name(), err)
+		}
+		reply.Err = err
+		return reply
+	}
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+			log.Printf("Error closing response body: %v", err)
+		}
+	}(resp.Body)
+
+	reply.Status = resp.StatusCode
+	decoded, err := decodedBody(resp)
+	if err != nil {
+		log.Printf("Error decoding response from %s: %v", target.name(), err)
+		reply.Err = err
+		return reply
+	}
+	reply.buf = getBuffer()
+	_, reply.Err = reply.buf.ReadFrom(decoded)
+	reply.Body = reply.buf.Bytes()
+	recordExchange(target, body, reply)
+	return reply
+}
+
+// decodedBody returns the body of resp, decompressed according to its
+// Content-Encoding.
+func decodedBody(resp *http.Response) (io.Reader, error) {
+	switch encoding := strings.ToLower(resp.Header.Get("Content-Encoding")); encoding {
+	case "", "identity":
+		return resp.Body, nil
+	case "gzip":
+		return gzip.NewReader(resp.Body)
+	case "br":
+		return brotli.NewReader(resp.Body), nil
+	default:
+		return nil, fmt.Errorf("unsupported content encoding %q", encoding)
+	}
+}
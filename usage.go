@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Formats usage is exported in.
+const (
+	UsageCSV  = "csv"
+	UsageJSON = "json"
+)
+
+// usageAnonymous is the key of requests without a named token or signing
+// key.
+const usageAnonymous = "anonymous"
+
+// usageCounts is the usage of one key in a period.
+type usageCounts struct {
+	Key        string `json:"key"`
+	Requests   int64  `json:"requests"`
+	Characters int64  `json:"characters"`
+	CacheHits  int64  `json:"cache_hits"`
+}
+
+// usageReport is the usage of all keys in a period, as exported.
+type usageReport struct {
+	From  time.Time     `json:"from"`
+	To    time.Time     `json:"to"`
+	Usage []usageCounts `json:"usage"`
+}
+
+// usageMeter counts requests, translated characters and cache hits by key
+// since the last export.
+type usageMeter struct {
+	mu     sync.Mutex
+	from   time.Time
+	counts map[string]*usageCounts
+}
+
+var usage = &usageMeter{from: time.Now(), counts: make(map[string]*usageCounts)}
+
+var usageClient = &http.Client{Timeout: 10 * time.Second}
+
+func usageEnabled() bool {
+	return cfg().UsageExport != ""
+}
+
+func (m *usageMeter) add(key string, requests, characters, cacheHits int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	counts := m.counts[key]
+	if counts == nil {
+		counts = &usageCounts{Key: key}
+		m.counts[key] = counts
+	}
+	counts.Requests += requests
+	counts.Characters += characters
+	counts.CacheHits += cacheHits
+}
+
+// meterKey returns the key the requests of a caller are metered under.
+func meterKey(c *fiber.Ctx) string {
+	if key := callerName(c); key != "" {
+		return key
+	}
+	return usageAnonymous
+}
+
+// meterRequest counts a request to a translation route and returns the key
+// its translations are counted and capped under, to be set as the usageKey
+// of their params.
+func meterRequest(c *fiber.Ctx) string {
+	key := meterKey(c)
+	if usageEnabled() {
+		usage.add(key, 1, 0, 0)
+	}
+	return key
+}
+
+// meterTranslation counts the characters of a successful translation made
+// for a metered request.
+func meterTranslation(params TranslateParams, result TranslateResponse) {
+	if params.usageKey == "" || result.Code != 200 || !usageEnabled() {
+		return
+	}
+	var cacheHits int64
+	if result.Cached {
+		cacheHits = 1
+	}
+	usage.add(params.usageKey, 0, int64(utf8.RuneCountInString(params.Text)), cacheHits)
+}
+
+// take returns the usage since the last export and starts a new period.
+func (m *usageMeter) take() usageReport {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	report := usageReport{From: m.from, To: time.Now()}
+	for _, counts := range m.counts {
+		report.Usage = append(report.Usage, *counts)
+	}
+	slices.SortFunc(report.Usage, func(a, b usageCounts) int { return strings.Compare(a.Key, b.Key) })
+	m.from, m.counts = report.To, make(map[string]*usageCounts)
+	return report
+}
+
+// restore adds back the usage of a report that couldn't be exported, so it
+// is included in the next one.
+func (m *usageMeter) restore(report usageReport) {
+	for _, counts := range report.Usage {
+		m.add(counts.Key, counts.Requests, counts.Characters, counts.CacheHits)
+	}
+	m.mu.Lock()
+	m.from = report.From
+	m.mu.Unlock()
+}
+
+// exportUsagePeriodically exports the usage every USAGE_EXPORT_INTERVAL.
+// Both settings are read again after each export, so reloads apply them.
+func exportUsagePeriodically() {
+	timer := time.NewTimer(cfg().UsageExportInterval)
+	for range timer.C {
+		exportUsage()
+		timer.Reset(cfg().UsageExportInterval)
+	}
+}
+
+// exportUsage writes the usage since the last export to USAGE_EXPORT.
+// Periods without requests are skipped.
+func exportUsage() {
+	if !usageEnabled() {
+		return
+	}
+	report := usage.take()
+	if len(report.Usage) == 0 {
+		return
+	}
+	if err := writeUsage(cfg().UsageExport, cfg().UsageExportFormat, report); err != nil {
+		log.Printf("Error exporting usage: %v", err)
+		usage.restore(report)
+	}
+}
+
+// writeUsage appends a report to a file, or posts it to an http(s) URL.
+func writeUsage(target, format string, report usageReport) error {
+	webhook := strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://")
+	var body bytes.Buffer
+	contentType := fiber.MIMEApplicationJSON
+	if format == UsageCSV {
+		contentType = "text/csv"
+		// A file only gets the header when it is new.
+		header := webhook
+		if !webhook {
+			info, err := os.Stat(target)
+			header = err != nil || info.Size() == 0
+		}
+		if err := encodeUsageCSV(&body, report, header); err != nil {
+			return err
+		}
+	} else if err := json.NewEncoder(&body).Encode(report); err != nil {
+		return err
+	}
+
+	if webhook {
+		resp, err := usageClient.Post(target, contentType, &body)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			return fmt.Errorf("%s answered %s", target, resp.Status)
+		}
+		return nil
+	}
+	file, err := os.OpenFile(target, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(body.Bytes()); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func encodeUsageCSV(w *bytes.Buffer, report usageReport, header bool) error {
+	writer := csv.NewWriter(w)
+	if header {
+		writer.Write([]string{"from", "to", "key", "requests", "characters", "cache_hits"})
+	}
+	from, to := report.From.UTC().Format(time.RFC3339), report.To.UTC().Format(time.RFC3339)
+	for _, counts := range report.Usage {
+		writer.Write([]string{from, to, counts.Key,
+			strconv.FormatInt(counts.Requests, 10),
+			strconv.FormatInt(counts.Characters, 10),
+			strconv.FormatInt(counts.CacheHits, 10)})
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// queryHistory counts how often queries are requested, so that the most
+// requested ones are kept warm in the cache.
+type queryHistory struct {
+	mu      sync.Mutex
+	queries map[string]*queryCount
+}
+
+type queryCount struct {
+	params TranslateParams
+	hits   float64
+}
+
+var history = &queryHistory{queries: make(map[string]*queryCount)}
+
+// record counts a request for the query with the given cache key. At most
+// ten times limit queries are tracked; the least requested make way for new
+// ones.
+func (h *queryHistory) record(key string, params TranslateParams, limit int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	query, ok := h.queries[key]
+	if !ok {
+		if len(h.queries) >= 10*limit {
+			h.keep(limit)
+		}
+		query = &queryCount{params: params}
+		h.queries[key] = query
+	}
+	query.hits++
+}
+
+// top returns the n most requested queries and halves all counts, so that
+// queries popular long ago make way for the ones popular now.
+func (h *queryHistory) top(n int) []TranslateParams {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ranked := h.keep(n)
+	params := make([]TranslateParams, len(ranked))
+	for i, query := range ranked {
+		params[i] = query.params
+		query.hits /= 2
+	}
+	return params
+}
+
+// keep drops all but the n most requested queries and returns those in
+// order. Callers must hold the lock.
+func (h *queryHistory) keep(n int) []*queryCount {
+	keys := make([]string, 0, len(h.queries))
+	for key := range h.queries {
+		keys = append(keys, key)
+	}
+	slices.SortFunc(keys, func(a, b string) int {
+		return -cmpFloat(h.queries[a].hits, h.queries[b].hits)
+	})
+
+	ranked := make([]*queryCount, 0, n)
+	for i, key := range keys {
+		if i < n {
+			ranked = append(ranked, h.queries[key])
+		} else {
+			delete(h.queries, key)
+		}
+	}
+	return ranked
+}
+
+func cmpFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// warmInterval is how often a cache keeping translations for ttl is warmed:
+// WARM_INTERVAL, or just under ttl so warmed translations never expire.
+func warmInterval(ttl time.Duration) time.Duration {
+	if interval := cfg().WarmInterval; interval > 0 {
+		return interval
+	}
+	return ttl - ttl/10
+}
+
+// warmCache translates the queries of WARM_FILE and the WARM_TOP most
+// requested ones again every warmInterval, replacing their cached
+// translations before they expire. ttl is the CACHE_TTL of the cache.
+func warmCache(ttl time.Duration) {
+	for {
+		if cfg().WarmFile != "" || cfg().WarmTop > 0 {
+			warm()
+		}
+		time.Sleep(warmInterval(ttl))
+	}
+}
+
+func warm() {
+	var queries []TranslateParams
+	if cfg().WarmFile != "" {
+		phrases, err := loadWarmFile(cfg().WarmFile)
+		if err != nil {
+			log.Printf("Error loading WARM_FILE: %v", err)
+		}
+		queries = append(queries, phrases...)
+	}
+	if cfg().WarmTop > 0 {
+		queries = append(queries, history.top(cfg().WarmTop)...)
+	}
+
+	seen := make(map[TranslateParams]bool)
+	warmed, failed := 0, 0
+	for _, params := range queries {
+		if seen[params] {
+			continue
+		}
+		seen[params] = true
+		if response := translateParams(params, true); response.Code == 200 {
+			warmed++
+		} else {
+			failed++
+		}
+	}
+	log.Printf("Warmed %d cached translations, %d failed", warmed, failed)
+}
+
+// loadWarmFile reads a file of /translate request bodies, one JSON object
+// per line. Blank lines and lines starting with # are skipped.
+func loadWarmFile(path string) ([]TranslateParams, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var queries []TranslateParams
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, 1<<20)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		var params TranslateParams
+		if err := jsonUnmarshal([]byte(text), &params); err != nil {
+			return queries, fmt.Errorf("line %d: %w", line, err)
+		}
+		queries = append(queries, params)
+	}
+	return queries, scanner.Err()
+}